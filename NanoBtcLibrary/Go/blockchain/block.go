@@ -1,7 +1,10 @@
 package blockchain
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
+	"io"
 	"strconv"
 	"time"
 
@@ -12,6 +15,9 @@ import (
 type Hash256 []byte
 type MagicId uint32
 
+// HeaderSize is the size of a serialized block header.
+const HeaderSize = 80
+
 type BlockHeader struct {
 	Hash             []byte
 	Version          int
@@ -30,6 +36,8 @@ type Block struct {
 	TransactionCount uint64
 	Transactions     []transactions.Transaction
 	StartPos         uint64
+	// FileNumber is the n of the blkn.dat file the block was read from.
+	FileNumber int
 }
 
 func NewBlock(version int,
@@ -56,8 +64,13 @@ func (blockHeader *BlockHeader) HashBlock() Hash256 {
 	if blockHeader.Hash != nil {
 		return blockHeader.Hash
 	}
+	blockHeader.Hash = utils.DoubleSha256(blockHeader.Serialize())
+	return blockHeader.Hash
+}
 
-	bin := make([]byte, 0)
+// Serialize returns the 80-byte wire encoding of the header.
+func (blockHeader *BlockHeader) Serialize() []byte {
+	bin := make([]byte, 0, HeaderSize)
 
 	version := make([]byte, 4)
 	binary.LittleEndian.PutUint32(version, uint32(blockHeader.Version))
@@ -78,6 +91,76 @@ func (blockHeader *BlockHeader) HashBlock() Hash256 {
 	binary.LittleEndian.PutUint32(nonce, uint32(blockHeader.Nonce))
 	bin = append(bin, nonce...)
 
-	blockHeader.Hash = utils.DoubleSha256(bin)
-	return blockHeader.Hash
+	return bin
+}
+
+// ParseBlockHeader reads an 80-byte serialized header. Hashes are kept in
+// the internal byte order used on the wire.
+func ParseBlockHeader(reader *bytes.Reader) (*BlockHeader, error) {
+	bin := make([]byte, HeaderSize)
+	if _, err := io.ReadFull(reader, bin); err != nil {
+		return nil, err
+	}
+	result := &BlockHeader{
+		Version:          int(int32(binary.LittleEndian.Uint32(bin[0:4]))),
+		HashPrev:         append(Hash256{}, bin[4:36]...),
+		HashMerkle:       append(Hash256{}, bin[36:68]...),
+		Timestamp:        time.Unix(int64(binary.LittleEndian.Uint32(bin[68:72])), 0),
+		TargetDifficulty: binary.LittleEndian.Uint32(bin[72:76]),
+		Nonce:            int(binary.LittleEndian.Uint32(bin[76:80])),
+	}
+	copy(result.MerkleRoot[:], result.HashMerkle)
+	result.Hash = utils.DoubleSha256(bin)
+	return result, nil
+}
+
+// ParseBlock reads a serialized block: its header, the transaction count and
+// the transactions.
+func ParseBlock(reader *bytes.Reader) (*Block, error) {
+	header, err := ParseBlockHeader(reader)
+	if err != nil {
+		return nil, err
+	}
+	count, err := utils.ReadVarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	if count > uint64(reader.Len()) {
+		return nil, errors.New("transaction count exceeds block size")
+	}
+	result := &Block{
+		BlockHeader:      *header,
+		TransactionCount: count,
+		Transactions:     make([]transactions.Transaction, count),
+	}
+	for i := range result.Transactions {
+		if result.Transactions[i], err = transactions.ParseTransaction(reader); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
+}
+
+// Serialize returns the wire encoding of the block, including witness data.
+func (block *Block) Serialize() []byte {
+	bin := block.BlockHeader.Serialize()
+	bin = append(bin, utils.Varint(uint64(len(block.Transactions)))...)
+	for _, tx := range block.Transactions {
+		bin = append(bin, transactions.Serialize(tx)...)
+	}
+	return bin
+}
+
+// StrippedSize returns the size of the block serialized without witness data.
+func (block *Block) StrippedSize() int {
+	size := HeaderSize + len(utils.Varint(uint64(len(block.Transactions))))
+	for _, tx := range block.Transactions {
+		size += transactions.StrippedSize(tx)
+	}
+	return size
+}
+
+// Weight returns the BIP141 weight of the block.
+func (block *Block) Weight() int {
+	return block.StrippedSize()*(transactions.WitnessScaleFactor-1) + len(block.Serialize())
 }
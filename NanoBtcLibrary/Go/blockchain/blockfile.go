@@ -0,0 +1,330 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+const (
+	// MaxBlockFileSize is the size at which Bitcoin Core starts a new blk file.
+	MaxBlockFileSize = 0x8000000
+	// MaxBlockSerializedSize is the largest block a record may hold.
+	MaxBlockSerializedSize = 4000000
+	// blockRecordHeaderSize is the size of the magic and length framing a block.
+	blockRecordHeaderSize = 8
+	// xorKeyFile holds the obfuscation key of the blocks directory.
+	xorKeyFile = "xor.dat"
+)
+
+var (
+	ErrBlockRecordTooLarge = errors.New("block record exceeds the maximum block size")
+	ErrBlockRecordTooSmall = errors.New("block record is smaller than a block header")
+)
+
+// checkRecordLength checks the length field of a block record.
+func checkRecordLength(length uint32) error {
+	if length < HeaderSize {
+		return fmt.Errorf("%w: %d bytes", ErrBlockRecordTooSmall, length)
+	}
+	if length > MaxBlockSerializedSize {
+		return fmt.Errorf("%w: %d bytes", ErrBlockRecordTooLarge, length)
+	}
+	return nil
+}
+
+// BlockFileName returns the name of the nth block file, blk00000.dat style.
+func BlockFileName(n int) string {
+	return fmt.Sprintf("blk%05d.dat", n)
+}
+
+// readXorKey returns the obfuscation key of a blocks directory. Directories
+// written by Bitcoin Core before version 28 have no key file, in which case
+// the data is stored as is.
+func readXorKey(dir string) ([]byte, error) {
+	key, err := os.ReadFile(filepath.Join(dir, xorKeyFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, b := range key {
+		if b != 0 {
+			return key, nil
+		}
+	}
+	return nil, nil
+}
+
+// xor applies the obfuscation key to data read from or written at offset.
+func xor(key []byte, data []byte, offset uint64) {
+	if len(key) == 0 {
+		return
+	}
+	for i := range data {
+		data[i] ^= key[(offset+uint64(i))%uint64(len(key))]
+	}
+}
+
+// BlockFileReader walks the blk*.dat files of a Bitcoin Core blocks directory.
+type BlockFileReader struct {
+	dir    string
+	magic  MagicId
+	key    []byte
+	file   *os.File
+	number int
+	offset uint64
+}
+
+// NewBlockFileReader returns a reader over dir yielding the blocks framed
+// with magic, MagicId(params.Net) of the network, starting from
+// blk00000.dat.
+func NewBlockFileReader(dir string, magic MagicId) (*BlockFileReader, error) {
+	key, err := readXorKey(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &BlockFileReader{dir: dir, magic: magic, key: key, number: -1}, nil
+}
+
+// Close closes the file currently being read.
+func (reader *BlockFileReader) Close() error {
+	if reader.file == nil {
+		return nil
+	}
+	err := reader.file.Close()
+	reader.file = nil
+	return err
+}
+
+func (reader *BlockFileReader) openNext() error {
+	if err := reader.Close(); err != nil {
+		return err
+	}
+	file, err := os.Open(filepath.Join(reader.dir, BlockFileName(reader.number+1)))
+	if os.IsNotExist(err) {
+		return io.EOF
+	}
+	if err != nil {
+		return err
+	}
+	reader.file = file
+	reader.number++
+	reader.offset = 0
+	return nil
+}
+
+func (reader *BlockFileReader) read(data []byte) error {
+	if _, err := io.ReadFull(reader.file, data); err != nil {
+		return err
+	}
+	xor(reader.key, data, reader.offset)
+	reader.offset += uint64(len(data))
+	return nil
+}
+
+// Next returns the next block in file order, which is not necessarily chain
+// order. It returns io.EOF after the last block of the last file.
+func (reader *BlockFileReader) Next() (*Block, error) {
+	for {
+		if reader.file == nil {
+			if err := reader.openNext(); err != nil {
+				return nil, err
+			}
+		}
+		block, err := reader.nextInFile()
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			if err := reader.openNext(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		return block, err
+	}
+}
+
+// nextInFile reads the next record of the current file. Core preallocates
+// block files, so a run of zeroes marks the end of the data.
+func (reader *BlockFileReader) nextInFile() (*Block, error) {
+	header := make([]byte, blockRecordHeaderSize)
+	if err := reader.read(header[:4]); err != nil {
+		return nil, err
+	}
+	// Resynchronize on the magic after garbage, as Core does on reindex.
+	for MagicId(binary.LittleEndian.Uint32(header[:4])) != reader.magic {
+		if binary.LittleEndian.Uint32(header[:4]) == 0 {
+			return nil, io.EOF
+		}
+		copy(header[:3], header[1:4])
+		if err := reader.read(header[3:4]); err != nil {
+			return nil, err
+		}
+	}
+	if err := reader.read(header[4:]); err != nil {
+		return nil, err
+	}
+	length := binary.LittleEndian.Uint32(header[4:])
+	if err := checkRecordLength(length); err != nil {
+		return nil, err
+	}
+	startPos := reader.offset
+	data := make([]byte, length)
+	if err := reader.read(data); err != nil {
+		return nil, err
+	}
+	block, err := ParseBlock(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%s offset %d: %w", BlockFileName(reader.number), startPos, err)
+	}
+	block.MagicId = reader.magic
+	block.Length = length
+	block.StartPos = startPos
+	block.FileNumber = reader.number
+	return block, nil
+}
+
+// ReadBlockAt reads the block whose data starts at offset in the given file,
+// as recorded in Block.FileNumber and Block.StartPos.
+func (reader *BlockFileReader) ReadBlockAt(number int, offset uint64) (*Block, error) {
+	if offset < blockRecordHeaderSize {
+		return nil, fmt.Errorf("invalid block offset %d", offset)
+	}
+	file, err := os.Open(filepath.Join(reader.dir, BlockFileName(number)))
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	header := make([]byte, blockRecordHeaderSize)
+	if _, err := file.ReadAt(header, int64(offset-blockRecordHeaderSize)); err != nil {
+		return nil, err
+	}
+	xor(reader.key, header, offset-blockRecordHeaderSize)
+	if MagicId(binary.LittleEndian.Uint32(header[:4])) != reader.magic {
+		return nil, fmt.Errorf("no block at %s offset %d", BlockFileName(number), offset)
+	}
+	length := binary.LittleEndian.Uint32(header[4:])
+	if err := checkRecordLength(length); err != nil {
+		return nil, err
+	}
+	data := make([]byte, length)
+	if _, err := file.ReadAt(data, int64(offset)); err != nil {
+		return nil, err
+	}
+	xor(reader.key, data, offset)
+	block, err := ParseBlock(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	block.MagicId = reader.magic
+	block.Length = length
+	block.StartPos = offset
+	block.FileNumber = number
+	return block, nil
+}
+
+// BlockFileWriter appends blocks to blk*.dat files using Core's layout.
+type BlockFileWriter struct {
+	dir    string
+	magic  MagicId
+	key    []byte
+	file   *os.File
+	number int
+	offset uint64
+}
+
+// NewBlockFileWriter opens dir for appending blocks framed with magic. A
+// non-empty key is stored in xor.dat and used to obfuscate the files, unless
+// the directory already has a key, which then takes precedence.
+func NewBlockFileWriter(dir string, magic MagicId, key []byte) (*BlockFileWriter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	existing, err := readXorKey(dir)
+	if err != nil {
+		return nil, err
+	}
+	if existing != nil {
+		key = existing
+	} else if len(key) != 0 {
+		if err := os.WriteFile(filepath.Join(dir, xorKeyFile), key, 0644); err != nil {
+			return nil, err
+		}
+	}
+	writer := &BlockFileWriter{dir: dir, magic: magic, key: key}
+	for {
+		if _, err := os.Stat(filepath.Join(dir, BlockFileName(writer.number+1))); err != nil {
+			break
+		}
+		writer.number++
+	}
+	if err := writer.open(); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (writer *BlockFileWriter) open() error {
+	file, err := os.OpenFile(filepath.Join(writer.dir, BlockFileName(writer.number)), os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	writer.file = file
+	writer.offset = uint64(info.Size())
+	return nil
+}
+
+// WriteBlock appends block, starting a new file when the current one would
+// grow beyond MaxBlockFileSize. It returns where the block data was written
+// and records the position in the block.
+func (writer *BlockFileWriter) WriteBlock(block *Block) (int, uint64, error) {
+	data := block.Serialize()
+	if len(data) > MaxBlockSerializedSize {
+		return 0, 0, ErrBlockRecordTooLarge
+	}
+	record := make([]byte, blockRecordHeaderSize, blockRecordHeaderSize+len(data))
+	binary.LittleEndian.PutUint32(record[:4], uint32(writer.magic))
+	binary.LittleEndian.PutUint32(record[4:], uint32(len(data)))
+	record = append(record, data...)
+
+	if writer.offset > 0 && writer.offset+uint64(len(record)) > MaxBlockFileSize {
+		if err := writer.file.Close(); err != nil {
+			return 0, 0, err
+		}
+		writer.number++
+		if err := writer.open(); err != nil {
+			return 0, 0, err
+		}
+	}
+	xor(writer.key, record, writer.offset)
+	if _, err := writer.file.WriteAt(record, int64(writer.offset)); err != nil {
+		return 0, 0, err
+	}
+	startPos := writer.offset + blockRecordHeaderSize
+	writer.offset += uint64(len(record))
+
+	block.MagicId = writer.magic
+	block.Length = uint32(len(data))
+	block.StartPos = startPos
+	block.FileNumber = writer.number
+	return writer.number, startPos, nil
+}
+
+// Flush commits the current file to disk.
+func (writer *BlockFileWriter) Flush() error {
+	return writer.file.Sync()
+}
+
+// Close closes the current file.
+func (writer *BlockFileWriter) Close() error {
+	return writer.file.Close()
+}
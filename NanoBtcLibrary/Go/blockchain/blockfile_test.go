@@ -0,0 +1,136 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
+)
+
+// writeTestBlocks writes the mainnet and regtest genesis blocks to dir and
+// returns them.
+func writeTestBlocks(t *testing.T, dir string, key []byte) []*Block {
+	writer, err := NewBlockFileWriter(dir, MagicId(chaincfg.MainNetParams.Net), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer writer.Close()
+	var blocks []*Block
+	for _, params := range []*chaincfg.ChainParams{&chaincfg.MainNetParams, &chaincfg.RegTestParams} {
+		block, err := GenesisBlock(params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := writer.WriteBlock(block); err != nil {
+			t.Fatal(err)
+		}
+		blocks = append(blocks, block)
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	return blocks
+}
+
+// readTestBlocks reads every block of dir.
+func readTestBlocks(t *testing.T, dir string) ([]*Block, error) {
+	reader, err := NewBlockFileReader(dir, MagicId(chaincfg.MainNetParams.Net))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	var blocks []*Block
+	for {
+		block, err := reader.Next()
+		if err == io.EOF {
+			return blocks, nil
+		}
+		if err != nil {
+			return blocks, err
+		}
+		blocks = append(blocks, block)
+	}
+}
+
+func checkBlocksRead(t *testing.T, dir string, written []*Block) {
+	read, err := readTestBlocks(t, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != len(written) {
+		t.Fatalf("read %d blocks, wrote %d", len(read), len(written))
+	}
+	reader, _ := NewBlockFileReader(dir, MagicId(chaincfg.MainNetParams.Net))
+	for i, block := range read {
+		if !bytes.Equal(block.HashBlock(), written[i].HashBlock()) || block.StartPos != written[i].StartPos {
+			t.Fatalf("block %d differs", i)
+		}
+		again, err := reader.ReadBlockAt(block.FileNumber, block.StartPos)
+		if err != nil || !bytes.Equal(again.HashBlock(), block.HashBlock()) {
+			t.Fatalf("block %d at its position: %v", i, err)
+		}
+	}
+}
+
+func TestBlockFileRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	written := writeTestBlocks(t, dir, nil)
+	checkBlocksRead(t, dir, written)
+	if _, err := os.Stat(filepath.Join(dir, xorKeyFile)); !os.IsNotExist(err) {
+		t.Fatal("key file written without a key")
+	}
+
+	// A new writer appends after the existing blocks.
+	more := writeTestBlocks(t, dir, nil)
+	checkBlocksRead(t, dir, append(written, more...))
+}
+
+func TestBlockFileXorKey(t *testing.T) {
+	dir := t.TempDir()
+	key := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+	written := writeTestBlocks(t, dir, key)
+	data, err := os.ReadFile(filepath.Join(dir, BlockFileName(0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, written[0].BlockHeader.Serialize()) {
+		t.Fatal("block stored without obfuscation")
+	}
+	checkBlocksRead(t, dir, written)
+
+	// The stored key wins over the one given to a later writer.
+	more := writeTestBlocks(t, dir, []byte{9})
+	checkBlocksRead(t, dir, append(written, more...))
+}
+
+func TestBlockFileBadRecords(t *testing.T) {
+	dir := t.TempDir()
+	written := writeTestBlocks(t, dir, nil)
+	path := filepath.Join(dir, BlockFileName(0))
+	data, _ := os.ReadFile(path)
+
+	// A record cut short at the end of the file is not returned.
+	truncated := append(append([]byte{}, data...), data[:100]...)
+	os.WriteFile(path, truncated, 0644)
+	checkBlocksRead(t, dir, written)
+
+	record := binary.LittleEndian.AppendUint32(nil, chaincfg.MainNetParams.Net)
+	for _, test := range []struct {
+		length uint32
+		err    error
+	}{
+		{HeaderSize - 1, ErrBlockRecordTooSmall},
+		{MaxBlockSerializedSize + 1, ErrBlockRecordTooLarge},
+	} {
+		bad := binary.LittleEndian.AppendUint32(append([]byte{}, record...), test.length)
+		os.WriteFile(path, append(append([]byte{}, data...), append(bad, make([]byte, HeaderSize)...)...), 0644)
+		if _, err := readTestBlocks(t, dir); !errors.Is(err, test.err) {
+			t.Errorf("record of %d bytes: %v", test.length, err)
+		}
+	}
+}
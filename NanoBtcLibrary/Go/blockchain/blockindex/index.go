@@ -0,0 +1,350 @@
+package blockindex
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/big"
+	"sync"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	difficulty "github.com/Btcercises/NanoBtcLibrary/Go/consensus/difficulty"
+)
+
+// Status flags of an indexed block.
+type Status uint32
+
+const (
+	// StatusHaveData means the block is stored at Entry.File and Entry.Offset.
+	StatusHaveData Status = 1 << iota
+	// StatusValid means the block passed full validation.
+	StatusValid
+	// StatusFailed means the block or one of its ancestors is invalid.
+	StatusFailed
+)
+
+// Key prefixes in the store.
+var (
+	entryPrefix  = []byte{'b'}
+	heightPrefix = []byte{'h'}
+	tipKey       = []byte{'t'}
+)
+
+var (
+	ErrUnknownBlock = errors.New("block not in index")
+	ErrOrphanBlock  = errors.New("parent block not in index")
+)
+
+// Entry is what the index knows about a block.
+type Entry struct {
+	Header    *blockchain.BlockHeader
+	Hash      blockchain.Hash256
+	Height    int32
+	File      int
+	Offset    uint64
+	ChainWork *big.Int
+	Status    Status
+}
+
+func (entry *Entry) serialize() []byte {
+	bin := entry.Header.Serialize()
+	bin = binary.LittleEndian.AppendUint32(bin, uint32(entry.Height))
+	bin = binary.LittleEndian.AppendUint32(bin, uint32(entry.File))
+	bin = binary.LittleEndian.AppendUint64(bin, entry.Offset)
+	bin = binary.LittleEndian.AppendUint32(bin, uint32(entry.Status))
+	return append(bin, entry.ChainWork.Bytes()...)
+}
+
+func parseEntry(bin []byte) (*Entry, error) {
+	if len(bin) < blockchain.HeaderSize+20 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	header, err := blockchain.ParseBlockHeader(bytes.NewReader(bin[:blockchain.HeaderSize]))
+	if err != nil {
+		return nil, err
+	}
+	bin = bin[blockchain.HeaderSize:]
+	return &Entry{
+		Header:    header,
+		Hash:      header.HashBlock(),
+		Height:    int32(binary.LittleEndian.Uint32(bin[0:4])),
+		File:      int(binary.LittleEndian.Uint32(bin[4:8])),
+		Offset:    binary.LittleEndian.Uint64(bin[8:16]),
+		Status:    Status(binary.LittleEndian.Uint32(bin[16:20])),
+		ChainWork: new(big.Int).SetBytes(bin[20:]),
+	}, nil
+}
+
+func entryKey(hash []byte) []byte {
+	return append(append([]byte{}, entryPrefix...), hash...)
+}
+
+func heightKey(height int32) []byte {
+	return binary.BigEndian.AppendUint32(append([]byte{}, heightPrefix...), uint32(height))
+}
+
+// BlockIndex maps block hashes to their position in the blk files and
+// heights to the hashes of the active chain, the branch with the most work
+// among blocks not marked as failed.
+type BlockIndex struct {
+	mutex sync.RWMutex
+	store Store
+	tip   *Entry
+	// orphans holds the blocks read out of order, keyed by their parent
+	// hash.
+	orphans map[string][]orphanBlock
+}
+
+// orphanBlock is where a block whose parent is not indexed yet is stored.
+// Only its header is kept in memory.
+type orphanBlock struct {
+	header blockchain.BlockHeader
+	file   int
+	offset uint64
+}
+
+// Open loads the index persisted in store, which may be empty.
+func Open(store Store) (*BlockIndex, error) {
+	index := &BlockIndex{store: store, orphans: make(map[string][]orphanBlock)}
+	tipHash, err := store.Get(tipKey)
+	if err == ErrNotFound {
+		return index, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if index.tip, err = index.get(tipHash); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// Close syncs and closes the underlying store.
+func (index *BlockIndex) Close() error {
+	return index.store.Close()
+}
+
+// Sync makes the index durable.
+func (index *BlockIndex) Sync() error {
+	return index.store.Sync()
+}
+
+func (index *BlockIndex) get(hash []byte) (*Entry, error) {
+	bin, err := index.store.Get(entryKey(hash))
+	if err == ErrNotFound {
+		return nil, ErrUnknownBlock
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseEntry(bin)
+}
+
+// Get returns the entry of the block with the given hash.
+func (index *BlockIndex) Get(hash []byte) (*Entry, error) {
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+	return index.get(hash)
+}
+
+// HashAtHeight returns the hash of the block at height on the active chain.
+func (index *BlockIndex) HashAtHeight(height int32) (blockchain.Hash256, error) {
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+	hash, err := index.store.Get(heightKey(height))
+	if err == ErrNotFound {
+		return nil, ErrUnknownBlock
+	}
+	return hash, err
+}
+
+// EntryAtHeight returns the entry of the block at height on the active chain.
+func (index *BlockIndex) EntryAtHeight(height int32) (*Entry, error) {
+	hash, err := index.HashAtHeight(height)
+	if err != nil {
+		return nil, err
+	}
+	return index.Get(hash)
+}
+
+// Tip returns the entry at the tip of the active chain, or nil for an empty index.
+func (index *BlockIndex) Tip() *Entry {
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+	return index.tip
+}
+
+// AddBlock indexes a block stored at block.FileNumber and block.StartPos, as
+// set by BlockFileReader and BlockFileWriter. The first block added is taken
+// as genesis. Re-adding a known block updates its position.
+func (index *BlockIndex) AddBlock(block *blockchain.Block) (*Entry, error) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	return index.addBlock(block.BlockHeader, block.FileNumber, block.StartPos)
+}
+
+// addBlock indexes the block with header stored in file at offset.
+func (index *BlockIndex) addBlock(header blockchain.BlockHeader, file int, offset uint64) (*Entry, error) {
+	hash := header.HashBlock()
+	entry := &Entry{
+		Header:    &header,
+		Hash:      hash,
+		File:      file,
+		Offset:    offset,
+		ChainWork: difficulty.CalcWork(header.TargetDifficulty),
+		Status:    StatusHaveData,
+	}
+	if known, err := index.get(hash); err == nil {
+		entry.Height, entry.ChainWork = known.Height, known.ChainWork
+		entry.Status = known.Status | StatusHaveData
+		return entry, index.store.Put(entryKey(hash), entry.serialize())
+	} else if err != ErrUnknownBlock {
+		return nil, err
+	}
+	if index.tip != nil {
+		parent, err := index.get(header.HashPrev)
+		if err == ErrUnknownBlock {
+			return nil, ErrOrphanBlock
+		}
+		if err != nil {
+			return nil, err
+		}
+		entry.Height = parent.Height + 1
+		entry.ChainWork = difficulty.CalcChainWork(parent.ChainWork, header.TargetDifficulty)
+		entry.Status |= parent.Status & StatusFailed
+	}
+	if err := index.store.Put(entryKey(hash), entry.serialize()); err != nil {
+		return nil, err
+	}
+	if entry.Status&StatusFailed == 0 && (index.tip == nil || entry.ChainWork.Cmp(index.tip.ChainWork) > 0) {
+		if err := index.setTip(entry); err != nil {
+			return nil, err
+		}
+	}
+	return entry, nil
+}
+
+// setTip makes entry the active tip, rewriting the height mapping from the
+// fork point with the previous active chain.
+func (index *BlockIndex) setTip(entry *Entry) error {
+	if index.tip != nil {
+		for height := index.tip.Height; height > entry.Height; height-- {
+			if err := index.store.Delete(heightKey(height)); err != nil {
+				return err
+			}
+		}
+	}
+	node := entry
+	for {
+		active, err := index.store.Get(heightKey(node.Height))
+		if err == nil && bytes.Equal(active, node.Hash) {
+			break
+		}
+		if err := index.store.Put(heightKey(node.Height), node.Hash); err != nil {
+			return err
+		}
+		if node.Height == 0 {
+			break
+		}
+		if node, err = index.get(node.Header.HashPrev); err != nil {
+			return err
+		}
+	}
+	if err := index.store.Put(tipKey, entry.Hash); err != nil {
+		return err
+	}
+	index.tip = entry
+	return nil
+}
+
+// SetStatus adds flags to the status of a block. Marking a block of the
+// active chain as failed does not move the tip; callers rebuild the index or
+// add a better branch for that.
+func (index *BlockIndex) SetStatus(hash []byte, status Status) error {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	entry, err := index.get(hash)
+	if err != nil {
+		return err
+	}
+	entry.Status |= status
+	return index.store.Put(entryKey(hash), entry.serialize())
+}
+
+// AddFromFiles indexes every block yielded by reader. Block files are not in
+// chain order, so blocks whose parent has not been seen yet are held back
+// until it is. It returns the number of blocks indexed.
+func (index *BlockIndex) AddFromFiles(reader *blockchain.BlockFileReader) (int, error) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	count := 0
+	for {
+		block, err := reader.Next()
+		if err == io.EOF {
+			return count, index.store.Sync()
+		}
+		if err != nil {
+			return count, err
+		}
+		added, err := index.addWithOrphans(block)
+		count += added
+		if err != nil {
+			return count, err
+		}
+	}
+}
+
+func (index *BlockIndex) addWithOrphans(block *blockchain.Block) (int, error) {
+	orphan := orphanBlock{header: block.BlockHeader, file: block.FileNumber, offset: block.StartPos}
+	if index.tip != nil {
+		if _, err := index.get(block.HashPrev); err == ErrUnknownBlock {
+			index.orphans[string(block.HashPrev)] = append(index.orphans[string(block.HashPrev)], orphan)
+			return 0, nil
+		}
+	}
+	count := 0
+	queue := []orphanBlock{orphan}
+	for len(queue) > 0 {
+		next := queue[0]
+		queue = queue[1:]
+		entry, err := index.addBlock(next.header, next.file, next.offset)
+		if err != nil {
+			return count, err
+		}
+		count++
+		queue = append(queue, index.orphans[string(entry.Hash)]...)
+		delete(index.orphans, string(entry.Hash))
+	}
+	return count, nil
+}
+
+// OrphanCount returns how many blocks are waiting for their parent.
+func (index *BlockIndex) OrphanCount() int {
+	index.mutex.RLock()
+	defer index.mutex.RUnlock()
+	count := 0
+	for _, blocks := range index.orphans {
+		count += len(blocks)
+	}
+	return count
+}
+
+// StoreBlock appends a block received from the network to the block files
+// and indexes it.
+func (index *BlockIndex) StoreBlock(writer *blockchain.BlockFileWriter, block *blockchain.Block) (*Entry, error) {
+	index.mutex.Lock()
+	defer index.mutex.Unlock()
+	if index.tip != nil {
+		if _, err := index.get(block.HashPrev); err != nil {
+			if err == ErrUnknownBlock {
+				return nil, ErrOrphanBlock
+			}
+			return nil, err
+		}
+	}
+	if _, _, err := writer.WriteBlock(block); err != nil {
+		return nil, err
+	}
+	return index.addBlock(block.BlockHeader, block.FileNumber, block.StartPos)
+}
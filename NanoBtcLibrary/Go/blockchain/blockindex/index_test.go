@@ -0,0 +1,263 @@
+package blockindex
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
+	difficulty "github.com/Btcercises/NanoBtcLibrary/Go/consensus/difficulty"
+)
+
+// testChain returns the regtest genesis block followed by count blocks
+// mined on top of it.
+func testChain(t *testing.T, count int) []*blockchain.Block {
+	genesis, err := blockchain.GenesisBlock(&chaincfg.RegTestParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := []*blockchain.Block{genesis}
+	for i := 0; i < count; i++ {
+		parent := blocks[len(blocks)-1]
+		block := &blockchain.Block{
+			BlockHeader: blockchain.BlockHeader{
+				Version:          4,
+				HashPrev:         parent.HashBlock(),
+				HashMerkle:       genesis.HashMerkle,
+				Timestamp:        parent.Timestamp.Add(10 * time.Minute),
+				TargetDifficulty: parent.TargetDifficulty,
+			},
+			Transactions: genesis.Transactions,
+		}
+		for difficulty.CheckProofOfWork(block.HashBlock(), block.TargetDifficulty, &difficulty.RegTestParams) != nil {
+			block.Hash = nil
+			block.Nonce++
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+func openTestStore(t *testing.T, path string) *FileStore {
+	store, err := OpenFileStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return store
+}
+
+func TestFileStoreReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.log")
+	store := openTestStore(t, path)
+	store.Put([]byte("a"), []byte("1"))
+	store.Put([]byte("b"), []byte("2"))
+	store.Put([]byte("a"), []byte("3"))
+	store.Delete([]byte("b"))
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store = openTestStore(t, path)
+	defer store.Close()
+	if value, err := store.Get([]byte("a")); err != nil || !bytes.Equal(value, []byte("3")) {
+		t.Fatalf("a = %q, %v", value, err)
+	}
+	if _, err := store.Get([]byte("b")); err != ErrNotFound {
+		t.Fatalf("deleted key: %v", err)
+	}
+}
+
+func TestFileStoreTornTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.log")
+	store := openTestStore(t, path)
+	store.Put([]byte("a"), []byte("1"))
+	store.Close()
+	info, _ := os.Stat(path)
+	valid := info.Size()
+
+	// A crash while appending the second record leaves part of it.
+	store = openTestStore(t, path)
+	store.Put([]byte("b"), []byte("2"))
+	store.Close()
+	data, _ := os.ReadFile(path)
+	for _, tail := range [][]byte{data[valid : len(data)-3], data[valid : valid+4], make([]byte, 20)} {
+		os.WriteFile(path, append(append([]byte{}, data[:valid]...), tail...), 0644)
+		store = openTestStore(t, path)
+		if _, err := store.Get([]byte("a")); err != nil {
+			t.Fatalf("record before the torn tail lost: %v", err)
+		}
+		if _, err := store.Get([]byte("b")); err != ErrNotFound {
+			t.Fatalf("torn record loaded: %v", err)
+		}
+		store.Close()
+		if info, _ := os.Stat(path); info.Size() != valid {
+			t.Fatalf("log is %d bytes after reopening, want %d", info.Size(), valid)
+		}
+	}
+
+	// A bad checksum on the last record is a torn tail too.
+	bad := append([]byte{}, data...)
+	bad[len(bad)-1] ^= 1
+	os.WriteFile(path, bad, 0644)
+	store = openTestStore(t, path)
+	if _, err := store.Get([]byte("b")); err != ErrNotFound {
+		t.Fatalf("record with a bad checksum loaded: %v", err)
+	}
+	store.Close()
+}
+
+func TestFileStoreCorruptMiddle(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.log")
+	store := openTestStore(t, path)
+	store.Put([]byte("a"), []byte("1"))
+	store.Put([]byte("b"), []byte("2"))
+	store.Close()
+
+	data, _ := os.ReadFile(path)
+	for _, offset := range []int{0, 10} {
+		bad := append([]byte{}, data...)
+		bad[offset] ^= 0x40
+		os.WriteFile(path, bad, 0644)
+		if _, err := OpenFileStore(path); !errors.Is(err, ErrCorruptLog) {
+			t.Fatalf("byte %d flipped: %v", offset, err)
+		}
+		if info, _ := os.Stat(path); info.Size() != int64(len(data)) {
+			t.Fatal("corrupt log truncated")
+		}
+	}
+}
+
+func TestFileStoreCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.log")
+	store := openTestStore(t, path)
+	for i := 0; i < 100; i++ {
+		store.Put([]byte("a"), []byte{byte(i)})
+	}
+	store.Put([]byte("b"), []byte("2"))
+	store.Sync()
+	before, _ := os.Stat(path)
+	if err := store.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size() {
+		t.Fatalf("log grew from %d to %d bytes", before.Size(), after.Size())
+	}
+	store.Put([]byte("c"), []byte("3"))
+	store.Close()
+
+	store = openTestStore(t, path)
+	defer store.Close()
+	for key, want := range map[string][]byte{"a": {99}, "b": []byte("2"), "c": []byte("3")} {
+		if value, err := store.Get([]byte(key)); err != nil || !bytes.Equal(value, want) {
+			t.Errorf("%s = %q, %v", key, value, err)
+		}
+	}
+}
+
+func TestFileStoreConcurrentWrites(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "index.log")
+	store := openTestStore(t, path)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(writer byte) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				// Every writer overwrites the shared key, so only a log in
+				// the same order as the values replays to the same value.
+				store.Put([]byte{writer, byte(j)}, []byte{byte(j)})
+				store.Put([]byte("shared"), []byte{writer, byte(j)})
+				if j%10 == 0 {
+					store.Sync()
+				}
+			}
+		}(byte(i))
+	}
+	wg.Wait()
+	want, _ := store.Get([]byte("shared"))
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store = openTestStore(t, path)
+	defer store.Close()
+	if value, err := store.Get([]byte("shared")); err != nil || !bytes.Equal(value, want) {
+		t.Fatalf("shared = %x, %v after reopening, want %x", value, err, want)
+	}
+	for i := 0; i < 8; i++ {
+		for j := 0; j < 100; j++ {
+			if _, err := store.Get([]byte{byte(i), byte(j)}); err != nil {
+				t.Fatalf("key %d/%d lost: %v", i, j, err)
+			}
+		}
+	}
+}
+
+func TestIndexFromBlockFiles(t *testing.T) {
+	dir := t.TempDir()
+	blocks := testChain(t, 4)
+	writer, err := blockchain.NewBlockFileWriter(dir, blockchain.MagicId(chaincfg.RegTestParams.Net), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Blocks reach the files in download order, not chain order.
+	for _, i := range []int{0, 3, 1, 4, 2} {
+		if _, _, err := writer.WriteBlock(blocks[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	writer.Close()
+
+	path := filepath.Join(dir, "index.log")
+	index, err := Open(openTestStore(t, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := blockchain.NewBlockFileReader(dir, blockchain.MagicId(chaincfg.RegTestParams.Net))
+	if err != nil {
+		t.Fatal(err)
+	}
+	count, err := index.AddFromFiles(reader)
+	reader.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(blocks) || index.OrphanCount() != 0 {
+		t.Fatalf("indexed %d blocks with %d orphans", count, index.OrphanCount())
+	}
+	index.Close()
+
+	// The index survives a restart and points at the stored blocks.
+	index, err = Open(openTestStore(t, path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer index.Close()
+	if tip := index.Tip(); tip == nil || tip.Height != 4 || !bytes.Equal(tip.Hash, blocks[4].HashBlock()) {
+		t.Fatalf("tip %+v", tip)
+	}
+	reader, err = blockchain.NewBlockFileReader(dir, blockchain.MagicId(chaincfg.RegTestParams.Net))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	for height, block := range blocks {
+		entry, err := index.EntryAtHeight(int32(height))
+		if err != nil {
+			t.Fatal(err)
+		}
+		stored, err := reader.ReadBlockAt(entry.File, entry.Offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(stored.HashBlock(), block.HashBlock()) {
+			t.Fatalf("block at height %d is %x", height, stored.HashBlock())
+		}
+	}
+}
@@ -0,0 +1,323 @@
+package blockindex
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// ErrNotFound is returned by Store.Get for missing keys.
+var ErrNotFound = errors.New("key not found")
+
+// Store is the key-value storage the block index is persisted in. Keys are
+// iterated in byte order.
+type Store interface {
+	Get(key []byte) ([]byte, error)
+	Put(key, value []byte) error
+	Delete(key []byte) error
+	// ForEach calls fn for every key with the given prefix, in key order.
+	ForEach(prefix []byte, fn func(key, value []byte) error) error
+	// Sync makes all previous writes durable.
+	Sync() error
+	Close() error
+}
+
+// MemoryStore is a Store kept in memory, for tests and throwaway indexes.
+type MemoryStore struct {
+	mutex  sync.RWMutex
+	values map[string][]byte
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{values: make(map[string][]byte)}
+}
+
+func (store *MemoryStore) Get(key []byte) ([]byte, error) {
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	value, ok := store.values[string(key)]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return append([]byte{}, value...), nil
+}
+
+func (store *MemoryStore) Put(key, value []byte) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.values[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (store *MemoryStore) Delete(key []byte) error {
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	delete(store.values, string(key))
+	return nil
+}
+
+func (store *MemoryStore) ForEach(prefix []byte, fn func(key, value []byte) error) error {
+	store.mutex.RLock()
+	keys := make([]string, 0)
+	for key := range store.values {
+		if bytes.HasPrefix([]byte(key), prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	values := make([][]byte, len(keys))
+	for i, key := range keys {
+		values[i] = store.values[key]
+	}
+	store.mutex.RUnlock()
+	for i, key := range keys {
+		if err := fn([]byte(key), values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (store *MemoryStore) Sync() error {
+	return nil
+}
+
+func (store *MemoryStore) Close() error {
+	return nil
+}
+
+const (
+	recordPut    byte = 1
+	recordDelete byte = 2
+	// maxRecordSize bounds the allocation made for a possibly corrupt record.
+	maxRecordSize = 1 << 26
+)
+
+// ErrCorruptLog is returned on opening a log with a damaged record that is
+// followed by more data, which a crash cannot leave behind.
+var ErrCorruptLog = errors.New("corrupt record in the middle of the log")
+
+// FileStore is a Store backed by an append-only log file. The whole data set
+// is kept in memory and the log is replayed on open; a torn record at the end
+// of the log, left by a crash, is discarded.
+type FileStore struct {
+	*MemoryStore
+	path string
+	// logMutex orders the appends to the log with the changes to the
+	// values, so that replaying the log gives the same values.
+	logMutex sync.Mutex
+	file     *os.File
+	writer   *bufio.Writer
+}
+
+// OpenFileStore opens or creates the log file at path.
+func OpenFileStore(path string) (*FileStore, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, err
+	}
+	store := &FileStore{MemoryStore: NewMemoryStore(), path: path, file: file}
+	valid, err := store.replay()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	if err := file.Truncate(valid); err != nil {
+		file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(valid, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	store.writer = bufio.NewWriter(file)
+	return store, nil
+}
+
+// replay loads the log and returns the length of its valid prefix. Only
+// the last record may be damaged: a crash tears the record being appended
+// and nothing after it.
+func (store *FileStore) replay() (int64, error) {
+	info, err := store.file.Stat()
+	if err != nil {
+		return 0, err
+	}
+	reader := bufio.NewReader(store.file)
+	var valid int64
+	for {
+		op, key, value, size, err := readRecord(reader)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return valid, nil
+		}
+		if err == errBadRecord {
+			torn, err := store.isTornTail(valid, size, info.Size())
+			if err != nil {
+				return 0, err
+			}
+			if !torn {
+				return 0, fmt.Errorf("%w: %s offset %d", ErrCorruptLog, store.path, valid)
+			}
+			return valid, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+		if op == recordPut {
+			store.values[string(key)] = value
+		} else {
+			delete(store.values, string(key))
+		}
+		valid += size
+	}
+}
+
+// isTornTail reports whether the bad record at offset is the last one of a
+// log of fileSize bytes. size is the length the record claims, or 0 when
+// even its header is unreadable, in which case only zeroes, as left by a
+// preallocating file system, may follow.
+func (store *FileStore) isTornTail(offset, size, fileSize int64) (bool, error) {
+	if size > 0 {
+		return offset+size >= fileSize, nil
+	}
+	rest := make([]byte, fileSize-offset)
+	if _, err := store.file.ReadAt(rest, offset); err != nil {
+		return false, err
+	}
+	for _, b := range rest {
+		if b != 0 {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+var errBadRecord = errors.New("corrupt log record")
+
+// A record is op, key length, value length, key, value and a CRC32 of all of
+// the preceding bytes. A bad record comes with the size it claims, if its
+// header could be read.
+func readRecord(reader *bufio.Reader) (byte, []byte, []byte, int64, error) {
+	header := make([]byte, 9)
+	if _, err := io.ReadFull(reader, header); err != nil {
+		return 0, nil, nil, 0, err
+	}
+	op := header[0]
+	if op != recordPut && op != recordDelete {
+		return 0, nil, nil, 0, errBadRecord
+	}
+	keyLength := binary.LittleEndian.Uint32(header[1:5])
+	valueLength := binary.LittleEndian.Uint32(header[5:9])
+	size := int64(len(header)) + int64(keyLength) + int64(valueLength) + 4
+	if uint64(keyLength)+uint64(valueLength) > maxRecordSize {
+		return 0, nil, nil, size, errBadRecord
+	}
+	body := make([]byte, uint64(keyLength)+uint64(valueLength)+4)
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return 0, nil, nil, 0, err
+	}
+	checksum := crc32.NewIEEE()
+	checksum.Write(header)
+	checksum.Write(body[:len(body)-4])
+	if checksum.Sum32() != binary.LittleEndian.Uint32(body[len(body)-4:]) {
+		return 0, nil, nil, size, errBadRecord
+	}
+	key := body[:keyLength]
+	value := body[keyLength : len(body)-4]
+	return op, key, value, size, nil
+}
+
+func (store *FileStore) writeRecord(op byte, key, value []byte) error {
+	record := make([]byte, 9, 9+len(key)+len(value)+4)
+	record[0] = op
+	binary.LittleEndian.PutUint32(record[1:5], uint32(len(key)))
+	binary.LittleEndian.PutUint32(record[5:9], uint32(len(value)))
+	record = append(record, key...)
+	record = append(record, value...)
+	record = binary.LittleEndian.AppendUint32(record, crc32.ChecksumIEEE(record))
+	_, err := store.writer.Write(record)
+	return err
+}
+
+func (store *FileStore) Put(key, value []byte) error {
+	store.logMutex.Lock()
+	defer store.logMutex.Unlock()
+	if err := store.writeRecord(recordPut, key, value); err != nil {
+		return err
+	}
+	return store.MemoryStore.Put(key, value)
+}
+
+func (store *FileStore) Delete(key []byte) error {
+	store.logMutex.Lock()
+	defer store.logMutex.Unlock()
+	if err := store.writeRecord(recordDelete, key, nil); err != nil {
+		return err
+	}
+	return store.MemoryStore.Delete(key)
+}
+
+// Sync flushes buffered records and fsyncs the log.
+func (store *FileStore) Sync() error {
+	store.logMutex.Lock()
+	defer store.logMutex.Unlock()
+	return store.sync()
+}
+
+func (store *FileStore) sync() error {
+	if err := store.writer.Flush(); err != nil {
+		return err
+	}
+	return store.file.Sync()
+}
+
+// Compact rewrites the log with only the live keys.
+func (store *FileStore) Compact() error {
+	store.logMutex.Lock()
+	defer store.logMutex.Unlock()
+	if err := store.writer.Flush(); err != nil {
+		return err
+	}
+	tmpPath := store.path + ".tmp"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	compacted := &FileStore{MemoryStore: store.MemoryStore, file: tmp, writer: bufio.NewWriter(tmp)}
+	err = store.MemoryStore.ForEach(nil, func(key, value []byte) error {
+		return compacted.writeRecord(recordPut, key, value)
+	})
+	if err == nil {
+		err = compacted.sync()
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := os.Rename(tmpPath, store.path); err != nil {
+		tmp.Close()
+		return err
+	}
+	store.file.Close()
+	store.file = tmp
+	store.writer = compacted.writer
+	return nil
+}
+
+// Close syncs and closes the log.
+func (store *FileStore) Close() error {
+	store.logMutex.Lock()
+	defer store.logMutex.Unlock()
+	if err := store.sync(); err != nil {
+		store.file.Close()
+		return err
+	}
+	return store.file.Close()
+}
@@ -0,0 +1,190 @@
+// Package bloom implements the BIP37 bloom filters that SPV clients load
+// into peers to have only matching transactions relayed to them.
+package bloom
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	blockchainUtils "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+	utils "github.com/Btcercises/NanoBtcLibrary/Go/utils"
+)
+
+// Limits set by BIP37.
+const (
+	MaxFilterSize = 36000
+	MaxHashFuncs  = 50
+)
+
+// UpdateFlag tells a peer which outpoints to add to the filter when an
+// output matches.
+type UpdateFlag uint8
+
+const (
+	// UpdateNone never updates the filter.
+	UpdateNone UpdateFlag = iota
+	// UpdateAll adds the outpoint of every matching output.
+	UpdateAll
+	// UpdateP2PubKeyOnly adds the outpoint of matching pay-to-pubkey and
+	// bare multisig outputs only.
+	UpdateP2PubKeyOnly
+)
+
+// hashSeedMultiplier spaces the seeds of the filter's hash functions.
+const hashSeedMultiplier = 0xfba4c795
+
+var (
+	ErrFilterTooLarge   = errors.New("bloom filter exceeds the maximum size")
+	ErrTooManyHashFuncs = errors.New("bloom filter uses too many hash functions")
+)
+
+type Filter struct {
+	Data      []byte
+	HashFuncs uint32
+	Tweak     uint32
+	Flags     UpdateFlag
+}
+
+// New returns an empty filter sized to hold elements items with the given
+// false positive rate, capped at the BIP37 limits.
+func New(elements int, fpRate float64, tweak uint32, flags UpdateFlag) *Filter {
+	elements = max(elements, 1)
+	// The integer truncations match Bitcoin Core, so that filters built with
+	// the same parameters have the same size.
+	bits := uint32(-1 / (math.Ln2 * math.Ln2) * float64(elements) * math.Log(fpRate))
+	size := min(bits, MaxFilterSize*8) / 8
+	hashFuncs := min(uint32(float64(size*8/uint32(elements))*math.Ln2), MaxHashFuncs)
+	return &Filter{
+		Data:      make([]byte, size),
+		HashFuncs: hashFuncs,
+		Tweak:     tweak,
+		Flags:     flags,
+	}
+}
+
+func (filter *Filter) bit(n uint32, data []byte) uint32 {
+	return utils.MurmurHash3(n*hashSeedMultiplier+filter.Tweak, data) % uint32(len(filter.Data)*8)
+}
+
+// Insert adds data to the filter.
+func (filter *Filter) Insert(data []byte) {
+	if len(filter.Data) == 0 {
+		return
+	}
+	for i := uint32(0); i < filter.HashFuncs; i++ {
+		bit := filter.bit(i, data)
+		filter.Data[bit>>3] |= 1 << (bit & 7)
+	}
+}
+
+// Contains reports whether data may have been inserted. An empty filter
+// matches everything, as in Bitcoin Core.
+func (filter *Filter) Contains(data []byte) bool {
+	if len(filter.Data) == 0 {
+		return true
+	}
+	for i := uint32(0); i < filter.HashFuncs; i++ {
+		bit := filter.bit(i, data)
+		if filter.Data[bit>>3]&(1<<(bit&7)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func outpoint(txid []byte, index uint32) []byte {
+	return binary.LittleEndian.AppendUint32(append([]byte{}, txid...), index)
+}
+
+// InsertOutPoint adds the serialized outpoint txid:index.
+func (filter *Filter) InsertOutPoint(txid []byte, index uint32) {
+	filter.Insert(outpoint(txid, index))
+}
+
+// ContainsOutPoint reports whether outpoint txid:index may have been inserted.
+func (filter *Filter) ContainsOutPoint(txid []byte, index uint32) bool {
+	return filter.Contains(outpoint(txid, index))
+}
+
+// IsRelevantAndUpdate reports whether tx matches the filter as BIP37
+// defines it: by txid, by a data push in an output script, by a spent
+// outpoint or by a data push in an input script. Outpoints of matching
+// outputs are inserted according to the filter's update flags. An empty
+// filter matches every transaction.
+func (filter *Filter) IsRelevantAndUpdate(tx transactions.Transaction) bool {
+	if len(filter.Data) == 0 {
+		return true
+	}
+	txid := transactions.GenerateTransactionId(tx)
+	found := filter.Contains(txid)
+	for i, out := range tx.Output {
+		for _, data := range transactions.PushedData(out.Script) {
+			if !filter.Contains(data) {
+				continue
+			}
+			found = true
+			switch filter.Flags & 3 {
+			case UpdateAll:
+				filter.InsertOutPoint(txid, uint32(i))
+			case UpdateP2PubKeyOnly:
+				if transactions.IsPayToPubKey(out.Script) || transactions.IsMultisig(out.Script) {
+					filter.InsertOutPoint(txid, uint32(i))
+				}
+			}
+			break
+		}
+	}
+	if found {
+		return true
+	}
+	for _, in := range tx.Input {
+		if filter.ContainsOutPoint(in.Hash, in.Index) {
+			return true
+		}
+		for _, data := range transactions.PushedData(in.Script) {
+			if filter.Contains(data) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Serialize returns the filter as carried by filterload.
+func (filter *Filter) Serialize() []byte {
+	result := blockchainUtils.Varint(uint64(len(filter.Data)))
+	result = append(result, filter.Data...)
+	result = binary.LittleEndian.AppendUint32(result, filter.HashFuncs)
+	result = binary.LittleEndian.AppendUint32(result, filter.Tweak)
+	return append(result, byte(filter.Flags))
+}
+
+// Parse reads a filter serialized by Serialize, enforcing the BIP37 limits.
+func Parse(reader *bytes.Reader) (*Filter, error) {
+	size, err := blockchainUtils.ReadVarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	if size > MaxFilterSize {
+		return nil, ErrFilterTooLarge
+	}
+	filter := &Filter{Data: make([]byte, size)}
+	if _, err := io.ReadFull(reader, filter.Data); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, 9)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return nil, err
+	}
+	filter.HashFuncs = binary.LittleEndian.Uint32(buf[0:4])
+	filter.Tweak = binary.LittleEndian.Uint32(buf[4:8])
+	filter.Flags = UpdateFlag(buf[8])
+	if filter.HashFuncs > MaxHashFuncs {
+		return nil, ErrTooManyHashFuncs
+	}
+	return filter, nil
+}
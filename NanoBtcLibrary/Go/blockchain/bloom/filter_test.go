@@ -0,0 +1,107 @@
+package bloom
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+)
+
+// Vectors from Bitcoin Core's bloom_tests.
+func TestFilterSerialize(t *testing.T) {
+	tests := []struct {
+		tweak uint32
+		want  string
+	}{
+		{0, "03614e9b050000000000000001"},
+		{2147483649, "03ce4299050000000100008001"},
+	}
+	for _, test := range tests {
+		filter := New(3, 0.01, test.tweak, UpdateAll)
+		for _, item := range []string{
+			"99108ad8ed9bb6274d3980bab5a85c048f0950c8",
+			"b5a2c786d9ef4658287ced5914b37a1b4aa32eee",
+			"b9300670b4c5366e95b2699e8b18bc75e5f729c5",
+		} {
+			data, _ := hex.DecodeString(item)
+			filter.Insert(data)
+		}
+		probe, _ := hex.DecodeString("99108ad8ed9bb6274d3980bab5a85c048f0950c8")
+		if !filter.Contains(probe) {
+			t.Fatal("inserted item not found")
+		}
+		probe[0] = 0x19
+		if filter.Contains(probe) {
+			t.Fatal("absent item found")
+		}
+		if got := hex.EncodeToString(filter.Serialize()); got != test.want {
+			t.Fatalf("tweak %d: %s, want %s", test.tweak, got, test.want)
+		}
+	}
+}
+
+func TestEmptyFilterMatchesAll(t *testing.T) {
+	filter := &Filter{}
+	filter.Insert([]byte{1})
+	if !filter.Contains([]byte{2}) || !filter.ContainsOutPoint(make([]byte, 32), 0) {
+		t.Fatal("empty filter rejected an item")
+	}
+	if !filter.IsRelevantAndUpdate(transactions.Transaction{Version: 1}) {
+		t.Fatal("empty filter rejected a transaction")
+	}
+}
+
+func TestFilterUpdateFlags(t *testing.T) {
+	pubKey := bytes.Repeat([]byte{2}, 33)
+	pubKeyHash := bytes.Repeat([]byte{3}, 20)
+	p2pk := append(append(transactions.Script{}, transactions.PushData(pubKey)...), transactions.OP_CHECKSIG)
+	p2pkh := append(append(transactions.Script{transactions.OP_DUP, transactions.OP_HASH160}, transactions.PushData(pubKeyHash)...), transactions.OP_EQUALVERIFY, transactions.OP_CHECKSIG)
+	funding := transactions.Transaction{
+		Version: 1,
+		Input:   []transactions.TxInput{{Hash: make([]byte, 32), Sequence: 0xffffffff}},
+		Output:  []transactions.TxOutput{{Amount: 1, Script: p2pk}, {Amount: 2, Script: p2pkh}},
+	}
+	txid := transactions.GenerateTransactionId(funding)
+	spend := func(index uint32) transactions.Transaction {
+		return transactions.Transaction{
+			Version: 1,
+			Input:   []transactions.TxInput{{Hash: txid, Index: index, Sequence: 0xffffffff}},
+			Output:  []transactions.TxOutput{{Amount: 1, Script: transactions.Script{transactions.OP_1}}},
+		}
+	}
+
+	tests := []struct {
+		flags UpdateFlag
+		// inserted tells whether the outpoints of the P2PK and P2PKH
+		// outputs are added when they match.
+		inserted [2]bool
+	}{
+		{UpdateNone, [2]bool{false, false}},
+		{UpdateAll, [2]bool{true, true}},
+		{UpdateP2PubKeyOnly, [2]bool{true, false}},
+	}
+	for _, test := range tests {
+		filter := New(10, 0.000001, 0, test.flags)
+		filter.Insert(pubKey)
+		filter.Insert(pubKeyHash)
+		if !filter.IsRelevantAndUpdate(funding) {
+			t.Fatalf("flags %d: funding transaction not matched", test.flags)
+		}
+		for index, want := range test.inserted {
+			if filter.ContainsOutPoint(txid, uint32(index)) != want {
+				t.Errorf("flags %d: outpoint %d inserted %v", test.flags, index, !want)
+			}
+			if filter.IsRelevantAndUpdate(spend(uint32(index))) != want {
+				t.Errorf("flags %d: spend of output %d matched %v", test.flags, index, !want)
+			}
+		}
+	}
+
+	// An outpoint inserted directly matches its spend.
+	filter := New(10, 0.000001, 0, UpdateNone)
+	filter.InsertOutPoint(txid, 1)
+	if !filter.IsRelevantAndUpdate(spend(1)) || filter.IsRelevantAndUpdate(spend(0)) {
+		t.Fatal("inserted outpoint not matched")
+	}
+}
@@ -0,0 +1,59 @@
+package filter
+
+import (
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+)
+
+// Parameters of the BIP158 basic filter.
+const (
+	BasicP = 19
+	BasicM = 784931
+)
+
+// BlockKey returns the SipHash key of the filters of the block with the
+// given hash, in internal byte order.
+func BlockKey(blockHash []byte) [KeySize]byte {
+	var key [KeySize]byte
+	copy(key[:], blockHash)
+	return key
+}
+
+// BasicFilterItems returns the distinct items of the basic filter of block:
+// the script of every output except empty and OP_RETURN ones, and the
+// non-empty scripts of the outputs its inputs spend.
+func BasicFilterItems(block *blockchain.Block, prevScripts [][]byte) [][]byte {
+	seen := make(map[string]bool)
+	items := make([][]byte, 0)
+	add := func(script []byte) {
+		if len(script) == 0 || seen[string(script)] {
+			return
+		}
+		seen[string(script)] = true
+		items = append(items, script)
+	}
+	for _, tx := range block.Transactions {
+		for _, out := range tx.Output {
+			if len(out.Script) > 0 && out.Script[0] == transactions.OP_RETURN {
+				continue
+			}
+			add(out.Script)
+		}
+	}
+	for _, script := range prevScripts {
+		add(script)
+	}
+	return items
+}
+
+// BuildBasicFilter returns the basic filter of block, given the scripts of
+// every output spent by its non-coinbase inputs.
+func BuildBasicFilter(block *blockchain.Block, prevScripts [][]byte) (*Filter, error) {
+	return New(BasicP, BasicM, BlockKey(block.HashBlock()), BasicFilterItems(block, prevScripts))
+}
+
+// ParseBasicFilter decodes the serialized basic filter of the block with the
+// given hash.
+func ParseBasicFilter(blockHash []byte, data []byte) (*Filter, error) {
+	return FromBytes(BasicP, BasicM, BlockKey(blockHash), data)
+}
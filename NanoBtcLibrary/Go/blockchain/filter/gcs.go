@@ -0,0 +1,211 @@
+// Package filter implements the compact block filters of BIP158: sets of
+// items hashed to a small range, sorted and Golomb-Rice coded.
+package filter
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/bits"
+	"sort"
+
+	blockchainUtils "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+	utils "github.com/Btcercises/NanoBtcLibrary/Go/utils"
+)
+
+// KeySize is the size of the SipHash key, taken from the block hash.
+const KeySize = 16
+
+var (
+	ErrBadParameters = errors.New("invalid golomb-coded set parameters")
+	ErrTooManyItems  = errors.New("too many items for a golomb-coded set")
+	ErrBadFilter     = errors.New("malformed filter data")
+)
+
+// Filter is a Golomb-coded set of N items with Golomb-Rice parameter P and
+// false positive rate 1/M.
+type Filter struct {
+	N   uint32
+	P   uint8
+	M   uint64
+	Key [KeySize]byte
+	// data is the Golomb-Rice coded bit stream, without the item count.
+	data []byte
+}
+
+// hashToRange maps item uniformly to [0, n*m), as BIP158 does with a 64x64
+// bit multiplication instead of a modulo.
+func hashToRange(key [KeySize]byte, item []byte, f uint64) uint64 {
+	k0 := binary.LittleEndian.Uint64(key[0:8])
+	k1 := binary.LittleEndian.Uint64(key[8:16])
+	hi, _ := bits.Mul64(utils.SipHash(k0, k1, item), f)
+	return hi
+}
+
+func (filter *Filter) hashedItems(items [][]byte) []uint64 {
+	f := uint64(filter.N) * filter.M
+	hashes := make([]uint64, len(items))
+	for i, item := range items {
+		hashes[i] = hashToRange(filter.Key, item, f)
+	}
+	sort.Slice(hashes, func(i, j int) bool { return hashes[i] < hashes[j] })
+	return hashes
+}
+
+// New builds the filter of items. Duplicate items are kept, so callers
+// wanting a set should remove them first.
+func New(p uint8, m uint64, key [KeySize]byte, items [][]byte) (*Filter, error) {
+	if p == 0 || p > 32 || m == 0 {
+		return nil, ErrBadParameters
+	}
+	if uint64(len(items)) >= 1<<32 {
+		return nil, ErrTooManyItems
+	}
+	filter := &Filter{N: uint32(len(items)), P: p, M: m, Key: key}
+	writer := &bitWriter{}
+	var last uint64
+	for _, hash := range filter.hashedItems(items) {
+		delta := hash - last
+		last = hash
+		for q := delta >> p; q > 0; q-- {
+			writer.writeBit(1)
+		}
+		writer.writeBit(0)
+		writer.writeBits(delta, int(p))
+	}
+	filter.data = writer.bytes
+	return filter, nil
+}
+
+// FromBytes decodes a filter serialized by Bytes.
+func FromBytes(p uint8, m uint64, key [KeySize]byte, data []byte) (*Filter, error) {
+	if p == 0 || p > 32 || m == 0 {
+		return nil, ErrBadParameters
+	}
+	reader := bytes.NewReader(data)
+	n, err := blockchainUtils.ReadVarint(reader)
+	if err != nil {
+		return nil, ErrBadFilter
+	}
+	if n >= 1<<32 {
+		return nil, ErrTooManyItems
+	}
+	rest, _ := io.ReadAll(reader)
+	return &Filter{N: uint32(n), P: p, M: m, Key: key, data: rest}, nil
+}
+
+// Bytes returns the serialized filter: the item count followed by the coded
+// items.
+func (filter *Filter) Bytes() []byte {
+	return append(blockchainUtils.Varint(uint64(filter.N)), filter.data...)
+}
+
+// Hash returns the double SHA256 of the serialized filter.
+func (filter *Filter) Hash() []byte {
+	return blockchainUtils.DoubleSha256(filter.Bytes())
+}
+
+// Header returns the filter header chaining this filter to the header of the
+// previous block's filter, which is all zeroes before the genesis block.
+func (filter *Filter) Header(prevHeader []byte) []byte {
+	return FilterHeader(filter.Hash(), prevHeader)
+}
+
+// FilterHeader chains a filter hash to the previous filter header.
+func FilterHeader(filterHash, prevHeader []byte) []byte {
+	data := append(append([]byte{}, filterHash...), prevHeader...)
+	return blockchainUtils.DoubleSha256(data)
+}
+
+// Match reports whether item may be in the filter.
+func (filter *Filter) Match(item []byte) (bool, error) {
+	return filter.MatchAny([][]byte{item})
+}
+
+// MatchAny reports whether any of items may be in the filter. The coded set
+// is walked once alongside the sorted query hashes.
+func (filter *Filter) MatchAny(items [][]byte) (bool, error) {
+	if filter.N == 0 || len(items) == 0 {
+		return false, nil
+	}
+	queries := filter.hashedItems(items)
+	reader := &bitReader{data: filter.data}
+	var value uint64
+	next := 0
+	for i := uint32(0); i < filter.N; i++ {
+		delta, err := reader.readGolombRice(filter.P)
+		if err != nil {
+			return false, err
+		}
+		value += delta
+		for next < len(queries) && queries[next] < value {
+			next++
+		}
+		if next == len(queries) {
+			return false, nil
+		}
+		if queries[next] == value {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type bitWriter struct {
+	bytes []byte
+	used  uint8
+}
+
+func (writer *bitWriter) writeBit(bit uint8) {
+	if writer.used == 0 {
+		writer.bytes = append(writer.bytes, 0)
+		writer.used = 8
+	}
+	writer.used--
+	writer.bytes[len(writer.bytes)-1] |= bit << writer.used
+}
+
+// writeBits writes the n low bits of value, most significant first.
+func (writer *bitWriter) writeBits(value uint64, n int) {
+	for i := n - 1; i >= 0; i-- {
+		writer.writeBit(uint8(value>>uint(i)) & 1)
+	}
+}
+
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (reader *bitReader) readBit() (uint64, error) {
+	if reader.pos >= 8*len(reader.data) {
+		return 0, ErrBadFilter
+	}
+	bit := reader.data[reader.pos/8] >> (7 - uint(reader.pos%8)) & 1
+	reader.pos++
+	return uint64(bit), nil
+}
+
+func (reader *bitReader) readGolombRice(p uint8) (uint64, error) {
+	var quotient uint64
+	for {
+		bit, err := reader.readBit()
+		if err != nil {
+			return 0, err
+		}
+		if bit == 0 {
+			break
+		}
+		quotient++
+	}
+	remainder := uint64(0)
+	for i := uint8(0); i < p; i++ {
+		bit, err := reader.readBit()
+		if err != nil {
+			return 0, err
+		}
+		remainder = remainder<<1 | bit
+	}
+	return quotient<<p | remainder, nil
+}
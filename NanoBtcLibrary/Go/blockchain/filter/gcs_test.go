@@ -0,0 +1,71 @@
+package filter
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	utils "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
+)
+
+// The first BIP158 test vector: the testnet3 genesis block.
+func TestBasicFilterGenesis(t *testing.T) {
+	genesis, err := blockchain.GenesisBlock(&chaincfg.TestNet3Params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := BuildBasicFilter(genesis, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hex.EncodeToString(filter.Bytes()) != "019dfca8" {
+		t.Fatalf("filter %x", filter.Bytes())
+	}
+	header := utils.ReverseByteArray(filter.Header(make([]byte, 32)))
+	if hex.EncodeToString(header) != "21584579b7eb08997773e5aeff3a7f932700042d0ed2a6129012b7d7ae81b750" {
+		t.Fatalf("header %x", header)
+	}
+	match, err := filter.Match(genesis.Transactions[0].Output[0].Script)
+	if err != nil || !match {
+		t.Fatalf("coinbase script not matched: %v", err)
+	}
+}
+
+func TestMatchAny(t *testing.T) {
+	var key [KeySize]byte
+	copy(key[:], "0123456789abcdef")
+	items := make([][]byte, 0)
+	for i := 0; i < 200; i++ {
+		items = append(items, []byte(fmt.Sprintf("item %d", i)))
+	}
+	built, err := New(BasicP, BasicM, key, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter, err := FromBytes(BasicP, BasicM, key, built.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filter.N != 200 || !bytes.Equal(filter.Bytes(), built.Bytes()) {
+		t.Fatal("round trip changed the filter")
+	}
+	for _, item := range items {
+		if match, err := filter.Match(item); err != nil || !match {
+			t.Fatalf("%s not matched: %v", item, err)
+		}
+	}
+	absent := [][]byte{[]byte("absent 1"), []byte("absent 2")}
+	if match, _ := filter.MatchAny(absent); match {
+		t.Fatal("absent items matched")
+	}
+	if match, _ := filter.MatchAny(append(absent, items[150])); !match {
+		t.Fatal("present item not matched")
+	}
+	truncated, _ := FromBytes(BasicP, BasicM, key, built.Bytes()[:20])
+	if _, err := truncated.Match([]byte("absent 1")); err != ErrBadFilter {
+		t.Fatalf("truncated filter: %v", err)
+	}
+}
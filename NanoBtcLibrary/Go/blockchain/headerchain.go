@@ -0,0 +1,348 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"time"
+
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
+	difficulty "github.com/Btcercises/NanoBtcLibrary/Go/consensus/difficulty"
+)
+
+const (
+	// MaxFutureBlockTime is how far ahead of the local clock a header may be
+	// timestamped.
+	MaxFutureBlockTime = 2 * time.Hour
+	// medianTimeSpan is the number of blocks used for the median time past.
+	medianTimeSpan = 11
+)
+
+// Errors returned by HeaderChain.AcceptHeader besides those of
+// difficulty.CheckProofOfWork.
+var (
+	ErrOrphanHeader          = errors.New("previous header not found")
+	ErrBadDiffBits           = errors.New("incorrect proof of work bits")
+	ErrTimeTooOld            = errors.New("header timestamp not after median time past")
+	ErrTimeTooNew            = errors.New("header timestamp too far in the future")
+	ErrTimewarp              = errors.New("header timestamp violates the timewarp rule")
+	ErrCheckpointMismatch    = errors.New("header does not match checkpoint")
+	ErrForkBeforeCheckpoint  = errors.New("header forks the chain before the last checkpoint")
+	ErrUnknownHeader         = errors.New("header not found")
+	ErrHeaderChainNoGenesis  = errors.New("header chain requires a genesis header")
+	ErrGenesisHeaderMismatch = errors.New("header chain genesis does not match")
+)
+
+// Checkpoint pins the hash of the block at Height.
+type Checkpoint = chaincfg.Checkpoint
+
+// ChainEventType tells whether a header joined or left the active chain.
+type ChainEventType int
+
+const (
+	HeaderConnected ChainEventType = iota
+	HeaderDisconnected
+)
+
+func (eventType ChainEventType) String() string {
+	if eventType == HeaderDisconnected {
+		return "disconnected"
+	}
+	return "connected"
+}
+
+// ChainEvent reports a change of the active chain. During a reorg the old
+// branch is disconnected tip first, then the new branch is connected from the
+// fork point up.
+type ChainEvent struct {
+	Type   ChainEventType
+	Header *BlockHeader
+	Height int32
+}
+
+// headerNode is a header in the header tree along with its position and the
+// cumulative work of the branch ending with it.
+type headerNode struct {
+	header *BlockHeader
+	hash   Hash256
+	parent *headerNode
+	height int32
+	work   *big.Int
+}
+
+func (node *headerNode) Height() int32 {
+	return node.height
+}
+
+func (node *headerNode) Bits() uint32 {
+	return node.header.TargetDifficulty
+}
+
+func (node *headerNode) Timestamp() int64 {
+	return node.header.Timestamp.Unix()
+}
+
+// HeaderChain validates block headers, keeps every valid branch in a tree and
+// follows the branch with the most cumulative work.
+type HeaderChain struct {
+	params      *difficulty.Params
+	checkpoints map[int32]Hash256
+	nodes       map[string]*headerNode
+	active      []*headerNode
+	// Now returns the current adjusted time, time.Now by default.
+	Now func() time.Time
+}
+
+// NewHeaderChain returns a header chain starting at genesis, which is trusted
+// without validation.
+func NewHeaderChain(params *difficulty.Params, genesis *BlockHeader, checkpoints []Checkpoint) (*HeaderChain, error) {
+	if genesis == nil {
+		return nil, ErrHeaderChainNoGenesis
+	}
+	chain := &HeaderChain{
+		params:      params,
+		checkpoints: make(map[int32]Hash256),
+		nodes:       make(map[string]*headerNode),
+		Now:         time.Now,
+	}
+	for _, checkpoint := range checkpoints {
+		chain.checkpoints[checkpoint.Height] = checkpoint.Hash
+	}
+	hash := genesis.HashBlock()
+	if expected, ok := chain.checkpoints[0]; ok && !bytes.Equal(expected, hash) {
+		return nil, ErrGenesisHeaderMismatch
+	}
+	node := &headerNode{
+		header: genesis,
+		hash:   hash,
+		work:   difficulty.CalcWork(genesis.TargetDifficulty),
+	}
+	chain.nodes[string(hash)] = node
+	chain.active = []*headerNode{node}
+	return chain, nil
+}
+
+// Ancestor implements difficulty.HeaderStore for the branch ending with node.
+func (chain *HeaderChain) Ancestor(node difficulty.HeaderNode, height int32) (difficulty.HeaderNode, error) {
+	own, ok := node.(*headerNode)
+	if !ok {
+		return nil, difficulty.ErrForeignNode
+	}
+	result := chain.ancestor(own, height)
+	if result == nil {
+		return nil, nil
+	}
+	return result, nil
+}
+
+func (chain *HeaderChain) ancestor(node *headerNode, height int32) *headerNode {
+	if height < 0 || height > node.height {
+		return nil
+	}
+	for node != nil && !chain.isActive(node) {
+		if node.height == height {
+			return node
+		}
+		node = node.parent
+	}
+	if node == nil {
+		return nil
+	}
+	return chain.active[height]
+}
+
+func (chain *HeaderChain) isActive(node *headerNode) bool {
+	return int(node.height) < len(chain.active) && chain.active[node.height] == node
+}
+
+// medianTimePast returns the median timestamp of node and its ten ancestors.
+func (chain *HeaderChain) medianTimePast(node *headerNode) int64 {
+	timestamps := make([]int64, 0, medianTimeSpan)
+	for i := 0; i < medianTimeSpan && node != nil; i++ {
+		timestamps = append(timestamps, node.Timestamp())
+		node = node.parent
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps[len(timestamps)/2]
+}
+
+// MedianTimePast returns the median time past of the active tip.
+func (chain *HeaderChain) MedianTimePast() time.Time {
+	return time.Unix(chain.medianTimePast(chain.tip()), 0)
+}
+
+func (chain *HeaderChain) tip() *headerNode {
+	return chain.active[len(chain.active)-1]
+}
+
+// lastCheckpointHeight returns the height of the highest checkpoint already
+// in the header tree, or -1.
+func (chain *HeaderChain) lastCheckpointHeight() int32 {
+	result := int32(-1)
+	for height, hash := range chain.checkpoints {
+		if height > result {
+			if _, ok := chain.nodes[string(hash)]; ok {
+				result = height
+			}
+		}
+	}
+	return result
+}
+
+// checkHeader runs the contextual checks of header as a child of parent.
+func (chain *HeaderChain) checkHeader(header *BlockHeader, hash Hash256, parent *headerNode) error {
+	height := parent.height + 1
+	timestamp := header.Timestamp.Unix()
+
+	if err := difficulty.CheckProofOfWork(hash, header.TargetDifficulty, chain.params); err != nil {
+		return err
+	}
+	bits, err := difficulty.NextWorkRequired(chain.params, chain, parent, timestamp)
+	if err != nil {
+		return err
+	}
+	if header.TargetDifficulty != bits {
+		return fmt.Errorf("%w: got %08x, expected %08x", ErrBadDiffBits, header.TargetDifficulty, bits)
+	}
+	if timestamp <= chain.medianTimePast(parent) {
+		return ErrTimeTooOld
+	}
+	if !difficulty.CheckTimewarp(chain.params, parent, timestamp) {
+		return ErrTimewarp
+	}
+	if header.Timestamp.After(chain.Now().Add(MaxFutureBlockTime)) {
+		return ErrTimeTooNew
+	}
+	if expected, ok := chain.checkpoints[height]; ok && !bytes.Equal(expected, hash) {
+		return ErrCheckpointMismatch
+	}
+	if height < chain.lastCheckpointHeight() {
+		return ErrForkBeforeCheckpoint
+	}
+	return nil
+}
+
+// AcceptHeader validates header and adds it to the header tree. If its
+// branch now has the most work it becomes the active chain and the resulting
+// disconnect and connect events are returned. Known headers are ignored.
+func (chain *HeaderChain) AcceptHeader(header *BlockHeader) ([]ChainEvent, error) {
+	hash := header.HashBlock()
+	if _, ok := chain.nodes[string(hash)]; ok {
+		return nil, nil
+	}
+	parent, ok := chain.nodes[string(header.HashPrev)]
+	if !ok {
+		return nil, ErrOrphanHeader
+	}
+	if err := chain.checkHeader(header, hash, parent); err != nil {
+		return nil, err
+	}
+	node := &headerNode{
+		header: header,
+		hash:   hash,
+		parent: parent,
+		height: parent.height + 1,
+		work:   difficulty.CalcChainWork(parent.work, header.TargetDifficulty),
+	}
+	chain.nodes[string(hash)] = node
+	if node.work.Cmp(chain.tip().work) <= 0 {
+		return nil, nil
+	}
+	return chain.setTip(node), nil
+}
+
+// AcceptHeaders accepts headers in order, stopping at the first invalid one.
+func (chain *HeaderChain) AcceptHeaders(headers []*BlockHeader) ([]ChainEvent, error) {
+	events := make([]ChainEvent, 0)
+	for _, header := range headers {
+		accepted, err := chain.AcceptHeader(header)
+		events = append(events, accepted...)
+		if err != nil {
+			return events, err
+		}
+	}
+	return events, nil
+}
+
+// setTip makes node the active tip and returns the events describing the
+// switch from the previous active chain.
+func (chain *HeaderChain) setTip(node *headerNode) []ChainEvent {
+	fork := node
+	connect := make([]*headerNode, 0)
+	for !chain.isActive(fork) {
+		connect = append(connect, fork)
+		fork = fork.parent
+	}
+	events := make([]ChainEvent, 0, len(connect))
+	for height := int32(len(chain.active)) - 1; height > fork.height; height-- {
+		disconnected := chain.active[height]
+		events = append(events, ChainEvent{HeaderDisconnected, disconnected.header, disconnected.height})
+	}
+	chain.active = chain.active[:fork.height+1]
+	for i := len(connect) - 1; i >= 0; i-- {
+		chain.active = append(chain.active, connect[i])
+		events = append(events, ChainEvent{HeaderConnected, connect[i].header, connect[i].height})
+	}
+	return events
+}
+
+// Tip returns the header at the tip of the active chain.
+func (chain *HeaderChain) Tip() *BlockHeader {
+	return chain.tip().header
+}
+
+// Height returns the height of the active tip.
+func (chain *HeaderChain) Height() int32 {
+	return chain.tip().height
+}
+
+// ChainWork returns the cumulative work of the active chain.
+func (chain *HeaderChain) ChainWork() *big.Int {
+	return new(big.Int).Set(chain.tip().work)
+}
+
+// HeaderByHeight returns the header at height on the active chain.
+func (chain *HeaderChain) HeaderByHeight(height int32) (*BlockHeader, error) {
+	if height < 0 || int(height) >= len(chain.active) {
+		return nil, ErrUnknownHeader
+	}
+	return chain.active[height].header, nil
+}
+
+// HeaderByHash returns a known header and its height, whether or not it is
+// on the active chain.
+func (chain *HeaderChain) HeaderByHash(hash []byte) (*BlockHeader, int32, error) {
+	node, ok := chain.nodes[string(hash)]
+	if !ok {
+		return nil, 0, ErrUnknownHeader
+	}
+	return node.header, node.height, nil
+}
+
+// IsActive reports whether the header with the given hash is on the active chain.
+func (chain *HeaderChain) IsActive(hash []byte) bool {
+	node, ok := chain.nodes[string(hash)]
+	return ok && chain.isActive(node)
+}
+
+// NextWorkRequired returns the bits for a block built on the active tip at
+// the given time.
+func (chain *HeaderChain) NextWorkRequired(timestamp time.Time) (uint32, error) {
+	return difficulty.NextWorkRequired(chain.params, chain, chain.tip(), timestamp.Unix())
+}
+
+// Locator returns block hashes from the active tip back to genesis, dense at
+// first and then exponentially sparser, for getheaders requests.
+func (chain *HeaderChain) Locator() []Hash256 {
+	result := make([]Hash256, 0)
+	step := int32(1)
+	for height := chain.tip().height; height > 0; height -= step {
+		result = append(result, chain.active[height].hash)
+		if len(result) >= 10 {
+			step *= 2
+		}
+	}
+	return append(result, chain.active[0].hash)
+}
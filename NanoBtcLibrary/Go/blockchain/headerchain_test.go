@@ -0,0 +1,174 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	difficulty "github.com/Btcercises/NanoBtcLibrary/Go/consensus/difficulty"
+)
+
+func regtestGenesisHeader(t *testing.T) *BlockHeader {
+	return &BlockHeader{
+		Version:          1,
+		HashPrev:         make(Hash256, 32),
+		HashMerkle:       hashFromHex(t, "4a5e1e4baab89f3a32518a88c31bc87f618f76673e2cc77ab2127b7afdeda33b"),
+		Timestamp:        time.Unix(1296688602, 0),
+		TargetDifficulty: 0x207fffff,
+		Nonce:            2,
+	}
+}
+
+func mineTestHeader(parent *BlockHeader, extra byte) *BlockHeader {
+	return mineTestHeaderAt(parent, extra, parent.Timestamp.Add(10*time.Minute))
+}
+
+func mineTestHeaderAt(parent *BlockHeader, extra byte, timestamp time.Time) *BlockHeader {
+	header := &BlockHeader{
+		Version:          4,
+		HashPrev:         parent.HashBlock(),
+		HashMerkle:       bytes.Repeat([]byte{extra}, 32),
+		Timestamp:        timestamp,
+		TargetDifficulty: 0x207fffff,
+	}
+	for {
+		header.Hash = nil
+		if difficulty.CheckProofOfWork(header.HashBlock(), header.TargetDifficulty, &difficulty.RegTestParams) == nil {
+			return header
+		}
+		header.Nonce++
+	}
+}
+
+func TestHeaderChainReorg(t *testing.T) {
+	genesis := regtestGenesisHeader(t)
+	want := hashFromHex(t, "0f9188f13cb7b2c71f2a335e3a4fc328bf5beb436012afca590b1a11466e2206")
+	if !bytes.Equal(genesis.HashBlock(), want) {
+		t.Fatalf("genesis hash %x", genesis.HashBlock())
+	}
+	chain, err := NewHeaderChain(&difficulty.RegTestParams, genesis, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	main := []*BlockHeader{genesis}
+	for i := 0; i < 3; i++ {
+		main = append(main, mineTestHeader(main[len(main)-1], 1))
+	}
+	if _, err := chain.AcceptHeaders(main[1:]); err != nil {
+		t.Fatal(err)
+	}
+	if chain.Height() != 3 {
+		t.Fatalf("height %d", chain.Height())
+	}
+
+	fork := []*BlockHeader{main[1]}
+	for i := 0; i < 3; i++ {
+		fork = append(fork, mineTestHeader(fork[len(fork)-1], 2))
+	}
+	events, err := chain.AcceptHeaders(fork[1:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if chain.Tip() != fork[3] || chain.Height() != 4 {
+		t.Fatalf("fork did not become active")
+	}
+	expected := []ChainEvent{
+		{HeaderDisconnected, main[3], 3},
+		{HeaderDisconnected, main[2], 2},
+		{HeaderConnected, fork[1], 2},
+		{HeaderConnected, fork[2], 3},
+		{HeaderConnected, fork[3], 4},
+	}
+	if len(events) != len(expected) {
+		t.Fatalf("got %d events, want %d", len(events), len(expected))
+	}
+	for i := range events {
+		if events[i] != expected[i] {
+			t.Errorf("event %d: got %v %d, want %v %d", i, events[i].Type, events[i].Height, expected[i].Type, expected[i].Height)
+		}
+	}
+}
+
+func TestHeaderChainRejectsBadHeaders(t *testing.T) {
+	genesis := regtestGenesisHeader(t)
+	chain, _ := NewHeaderChain(&difficulty.RegTestParams, genesis, nil)
+
+	old := mineTestHeaderAt(genesis, 1, genesis.Timestamp)
+	if _, err := chain.AcceptHeader(old); err != ErrTimeTooOld {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	future := mineTestHeaderAt(genesis, 1, time.Now().Add(3*time.Hour))
+	if _, err := chain.AcceptHeader(future); err != ErrTimeTooNew {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	orphan := mineTestHeader(mineTestHeader(genesis, 1), 1)
+	if _, err := chain.AcceptHeader(orphan); err != ErrOrphanHeader {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestHeaderChainRejectsBadBits(t *testing.T) {
+	genesis := regtestGenesisHeader(t)
+	chain, _ := NewHeaderChain(&difficulty.RegTestParams, genesis, nil)
+	header := mineTestHeader(genesis, 1)
+	header.TargetDifficulty = 0x2000ffff
+	for {
+		header.Hash = nil
+		if difficulty.CheckProofOfWork(header.HashBlock(), header.TargetDifficulty, &difficulty.RegTestParams) == nil {
+			break
+		}
+		header.Nonce++
+	}
+	if _, err := chain.AcceptHeader(header); !errors.Is(err, ErrBadDiffBits) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestHeaderChainCheckpoints(t *testing.T) {
+	genesis := regtestGenesisHeader(t)
+	main := []*BlockHeader{genesis}
+	for i := 0; i < 3; i++ {
+		main = append(main, mineTestHeader(main[len(main)-1], 1))
+	}
+	chain, err := NewHeaderChain(&difficulty.RegTestParams, genesis, []Checkpoint{{Height: 2, Hash: main[2].HashBlock()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.AcceptHeader(main[1]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.AcceptHeader(mineTestHeader(main[1], 2)); err != ErrCheckpointMismatch {
+		t.Fatalf("header conflicting with a checkpoint: %v", err)
+	}
+	if _, err := chain.AcceptHeaders(main[2:]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.AcceptHeader(mineTestHeader(genesis, 2)); err != ErrForkBeforeCheckpoint {
+		t.Fatalf("fork below the checkpoint: %v", err)
+	}
+	// Forks above the last checkpoint are fine.
+	if _, err := chain.AcceptHeader(mineTestHeader(main[2], 2)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewHeaderChain(&difficulty.RegTestParams, genesis, []Checkpoint{{Height: 0, Hash: main[1].HashBlock()}}); err != ErrGenesisHeaderMismatch {
+		t.Fatalf("wrong genesis checkpoint: %v", err)
+	}
+}
+
+type foreignNode struct{}
+
+func (foreignNode) Height() int32    { return 5 }
+func (foreignNode) Bits() uint32     { return 0x207fffff }
+func (foreignNode) Timestamp() int64 { return 0 }
+
+func TestHeaderChainForeignNode(t *testing.T) {
+	chain, _ := NewHeaderChain(&difficulty.RegTestParams, regtestGenesisHeader(t), nil)
+	if _, err := chain.Ancestor(foreignNode{}, 0); err != difficulty.ErrForeignNode {
+		t.Fatalf("foreign node: %v", err)
+	}
+}
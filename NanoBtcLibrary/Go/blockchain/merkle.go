@@ -0,0 +1,147 @@
+package blockchain
+
+import (
+	"bytes"
+	"errors"
+
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	utils "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+)
+
+var (
+	// ErrMerkleMutated is returned when a block's transaction list hashes to the
+	// header's merkle root only because a subtree was duplicated (CVE-2012-2459).
+	// Such a block must be rejected without marking its header invalid.
+	ErrMerkleMutated = errors.New("merkle tree contains a duplicated subtree (CVE-2012-2459)")
+	// ErrBadMerkleRoot is returned when the transactions do not hash to the header's merkle root.
+	ErrBadMerkleRoot = errors.New("merkle root mismatch")
+	// ErrNoTransactions is returned for blocks without a coinbase transaction.
+	ErrNoTransactions = errors.New("block has no transactions")
+	// ErrBadWitnessNonce is returned when the coinbase witness is not a single 32-byte reserved value.
+	ErrBadWitnessNonce = errors.New("coinbase witness reserved value has invalid size")
+	// ErrBadWitnessCommitment is returned when the coinbase commitment does not match the witness merkle root.
+	ErrBadWitnessCommitment = errors.New("witness merkle commitment mismatch")
+	// ErrUnexpectedWitness is returned when a block without a witness commitment contains witness data.
+	ErrUnexpectedWitness = errors.New("unexpected witness data found")
+)
+
+// witnessCommitmentHeader is OP_RETURN, a 36-byte push and the BIP141 commitment tag.
+var witnessCommitmentHeader = []byte{0x6a, 0x24, 0xaa, 0x21, 0xa9, 0xed}
+
+// CalcMerkleRoot computes the merkle root of the given hashes the way Bitcoin
+// Core does, duplicating the last node of every odd-sized level.
+// mutated is true when two identical nodes were paired at any level, in which
+// case a different transaction list has the same root (CVE-2012-2459).
+func CalcMerkleRoot(hashes [][]byte) (root []byte, mutated bool) {
+	if len(hashes) == 0 {
+		return make([]byte, 32), false
+	}
+	level := make([][]byte, len(hashes))
+	copy(level, hashes)
+	for len(level) > 1 {
+		for i := 0; i+1 < len(level); i += 2 {
+			if bytes.Equal(level[i], level[i+1]) {
+				mutated = true
+			}
+		}
+		if len(level)%2 != 0 {
+			level = append(level, level[len(level)-1])
+		}
+		parents := make([][]byte, len(level)/2)
+		for i := range parents {
+			parents[i] = utils.MerkleParent(level[2*i], level[2*i+1])
+		}
+		level = parents
+	}
+	return level[0], mutated
+}
+
+// MerkleRoot returns the txid merkle root of txs.
+func MerkleRoot(txs []transactions.Transaction) ([]byte, bool) {
+	hashes := make([][]byte, len(txs))
+	for i, tx := range txs {
+		hashes[i] = transactions.GenerateTransactionId(tx)
+	}
+	return CalcMerkleRoot(hashes)
+}
+
+// WitnessMerkleRoot returns the wtxid merkle root of txs. The coinbase wtxid
+// is defined as all zeroes by BIP141.
+func WitnessMerkleRoot(txs []transactions.Transaction) ([]byte, bool) {
+	hashes := make([][]byte, len(txs))
+	for i, tx := range txs {
+		if i == 0 {
+			hashes[i] = make([]byte, 32)
+			continue
+		}
+		hashes[i] = transactions.GenerateWitnessTransactionId(tx)
+	}
+	return CalcMerkleRoot(hashes)
+}
+
+// WitnessCommitment returns the value committed to by a coinbase whose
+// witness merkle root is witnessRoot and whose reserved value is nonce.
+func WitnessCommitment(witnessRoot, nonce []byte) []byte {
+	return utils.MerkleParent(witnessRoot, nonce)
+}
+
+// WitnessCommitmentIndex returns the index of the coinbase output holding the
+// witness commitment, or -1 if there is none. As in Bitcoin Core, the last
+// matching output wins.
+func WitnessCommitmentIndex(coinbase transactions.Transaction) int {
+	index := -1
+	for i, out := range coinbase.Output {
+		if len(out.Script) >= 38 && bytes.HasPrefix(out.Script, witnessCommitmentHeader) {
+			index = i
+		}
+	}
+	return index
+}
+
+// CheckMerkleRoot verifies that the block's transactions hash to the header's
+// merkle root. A block whose transaction list was mutated by duplicating a
+// subtree is reported with ErrMerkleMutated even though its root matches.
+func (block *Block) CheckMerkleRoot() error {
+	if len(block.Transactions) == 0 {
+		return ErrNoTransactions
+	}
+	root, mutated := MerkleRoot(block.Transactions)
+	if !bytes.Equal(root, block.HashMerkle) {
+		return ErrBadMerkleRoot
+	}
+	if mutated {
+		return ErrMerkleMutated
+	}
+	return nil
+}
+
+// CheckWitnessCommitment verifies the BIP141 witness commitment in the
+// coinbase against the block's witness merkle root. Blocks without a
+// commitment must not contain any witness data.
+func (block *Block) CheckWitnessCommitment() error {
+	if len(block.Transactions) == 0 {
+		return ErrNoTransactions
+	}
+	coinbase := block.Transactions[0]
+	index := WitnessCommitmentIndex(coinbase)
+	if index < 0 {
+		for _, tx := range block.Transactions {
+			if transactions.HasWitness(tx) {
+				return ErrUnexpectedWitness
+			}
+		}
+		return nil
+	}
+	if len(coinbase.Input) != 1 {
+		return ErrBadWitnessNonce
+	}
+	witness := coinbase.Input[0].ScriptWitness
+	if len(witness) != 1 || len(witness[0]) != 32 {
+		return ErrBadWitnessNonce
+	}
+	root, _ := WitnessMerkleRoot(block.Transactions)
+	if !bytes.Equal(WitnessCommitment(root, witness[0]), coinbase.Output[index].Script[6:38]) {
+		return ErrBadWitnessCommitment
+	}
+	return nil
+}
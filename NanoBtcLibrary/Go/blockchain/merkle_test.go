@@ -0,0 +1,141 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	utils "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+)
+
+func hashFromHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return utils.ReverseByteArray(b)
+}
+
+func TestCalcMerkleRootBlock100000(t *testing.T) {
+	hashes := [][]byte{
+		hashFromHex(t, "8c14f0db3df150123e6f3dbbf30f8b955a8249b62ac1d1ff16284aefa3d06d87"),
+		hashFromHex(t, "fff2525b8931402dd09222c50775608f75787bd2b87e56995a7bdd30f79702c4"),
+		hashFromHex(t, "6359f0868171b1d194cbee1af2f16ea598ae8fad666d9b012c8ed2b79a236ec4"),
+		hashFromHex(t, "e9a66845e05d5abc0ad04ec80f774a7e585c6e8db975962d069a522137b80c1d"),
+	}
+	root, mutated := CalcMerkleRoot(hashes)
+	want := hashFromHex(t, "f3e94742aca4b5ef85488dc37c06c3282295ffec960994b2c0d5ac2a25a95766")
+	if !bytes.Equal(root, want) {
+		t.Fatalf("root %x, want %x", root, want)
+	}
+	if mutated {
+		t.Fatal("unexpected mutation")
+	}
+}
+
+func TestCalcMerkleRootMutated(t *testing.T) {
+	a, b, c := bytes.Repeat([]byte{1}, 32), bytes.Repeat([]byte{2}, 32), bytes.Repeat([]byte{3}, 32)
+	root, mutated := CalcMerkleRoot([][]byte{a, b, c})
+	if mutated {
+		t.Fatal("odd level duplication must not count as mutation")
+	}
+	mutatedRoot, mutated := CalcMerkleRoot([][]byte{a, b, c, c})
+	if !mutated {
+		t.Fatal("duplicated leaf not detected")
+	}
+	if !bytes.Equal(root, mutatedRoot) {
+		t.Fatal("mutated list should hash to the same root")
+	}
+}
+
+func TestPartialMerkleTreeRoundTrip(t *testing.T) {
+	txids := make([][]byte, 7)
+	for i := range txids {
+		txids[i] = utils.DoubleSha256([]byte{byte(i)})
+	}
+	root, _ := CalcMerkleRoot(txids)
+	matched := [][]byte{txids[2], txids[6]}
+
+	flags, hashes := BuildPartialMerkleTree(txids, matched)
+	tree := NewTree(len(txids))
+	if err := tree.PopulateTree(BytesToBitField(flags), hashes); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tree.Root(), root) {
+		t.Fatalf("root %x, want %x", tree.Root(), root)
+	}
+	if len(tree.Matched) != 2 || !bytes.Equal(tree.Matched[0], txids[2]) || !bytes.Equal(tree.Matched[1], txids[6]) {
+		t.Fatalf("unexpected matches %x", tree.Matched)
+	}
+}
+
+func TestPartialMerkleTreeEmpty(t *testing.T) {
+	if flags, hashes := BuildPartialMerkleTree(nil, nil); flags != nil || hashes != nil {
+		t.Fatalf("no txids gave flags %x, hashes %x", flags, hashes)
+	}
+}
+
+// witnessBlock returns a block of a coinbase committing to its witnesses and
+// a transaction spending a segwit output.
+func witnessBlock() *Block {
+	coinbase := transactions.Transaction{
+		Version: 2,
+		Input: []transactions.TxInput{{
+			Hash:          make([]byte, 32),
+			Index:         0xffffffff,
+			PrevIndex:     -1,
+			Script:        []byte{0x51, 0x51},
+			Sequence:      0xffffffff,
+			ScriptWitness: [][]byte{make([]byte, 32)},
+		}},
+		Output: []transactions.TxOutput{{Amount: 5000000000, Script: []byte{0x51}}},
+	}
+	spend := transactions.Transaction{
+		Version: 2,
+		Input: []transactions.TxInput{{
+			Hash:          bytes.Repeat([]byte{7}, 32),
+			Sequence:      0xffffffff,
+			ScriptWitness: [][]byte{{0x51}},
+		}},
+		Output: []transactions.TxOutput{{Amount: 1000, Script: []byte{0x51}}},
+	}
+	txs := []transactions.Transaction{coinbase, spend}
+	root, _ := WitnessMerkleRoot(txs)
+	script := append(append([]byte{}, witnessCommitmentHeader...), WitnessCommitment(root, make([]byte, 32))...)
+	txs[0].Output = append(txs[0].Output, transactions.TxOutput{Script: script})
+	return &Block{Transactions: txs}
+}
+
+func TestCheckWitnessCommitment(t *testing.T) {
+	block := witnessBlock()
+	if err := block.CheckWitnessCommitment(); err != nil {
+		t.Fatalf("valid commitment: %v", err)
+	}
+
+	missing := witnessBlock()
+	missing.Transactions[0].Output = missing.Transactions[0].Output[:1]
+	if err := missing.CheckWitnessCommitment(); err != ErrUnexpectedWitness {
+		t.Fatalf("missing commitment: %v", err)
+	}
+	missing.Transactions[0].Input[0].ScriptWitness = nil
+	missing.Transactions[1].Input[0].ScriptWitness = nil
+	if err := missing.CheckWitnessCommitment(); err != nil {
+		t.Fatalf("block without witnesses: %v", err)
+	}
+
+	mismatched := witnessBlock()
+	mismatched.Transactions[1].Input[0].ScriptWitness = [][]byte{{0x52}}
+	if err := mismatched.CheckWitnessCommitment(); err != ErrBadWitnessCommitment {
+		t.Fatalf("changed witness: %v", err)
+	}
+	mismatched = witnessBlock()
+	mismatched.Transactions[0].Input[0].ScriptWitness = [][]byte{bytes.Repeat([]byte{1}, 32)}
+	if err := mismatched.CheckWitnessCommitment(); err != ErrBadWitnessCommitment {
+		t.Fatalf("changed reserved value: %v", err)
+	}
+	mismatched.Transactions[0].Input[0].ScriptWitness = [][]byte{make([]byte, 31)}
+	if err := mismatched.CheckWitnessCommitment(); err != ErrBadWitnessNonce {
+		t.Fatalf("short reserved value: %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package blockchain
+
+import (
+	"bytes"
+
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
+)
+
+// GenesisBlock parses the genesis block of the network.
+func GenesisBlock(params *chaincfg.ChainParams) (*Block, error) {
+	block, err := ParseBlock(bytes.NewReader(params.GenesisBlock))
+	if err != nil {
+		return nil, err
+	}
+	block.MagicId = MagicId(params.Net)
+	return block, nil
+}
+
+// NewNetworkHeaderChain returns a header chain for the network, starting at
+// its genesis block and enforcing its checkpoints.
+func NewNetworkHeaderChain(params *chaincfg.ChainParams) (*HeaderChain, error) {
+	genesis, err := GenesisBlock(params)
+	if err != nil {
+		return nil, err
+	}
+	return NewHeaderChain(params.Pow, &genesis.BlockHeader, params.Checkpoints)
+}
@@ -0,0 +1,107 @@
+package blockchain
+
+import (
+	"bytes"
+
+	utils "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+)
+
+// partialTreeBuilder walks the full merkle tree of a block depth first and
+// records the BIP37 flag bits and hashes needed to prove the matched leaves.
+type partialTreeBuilder struct {
+	txids   [][]byte
+	matches []bool
+	bits    []byte
+	hashes  [][]byte
+}
+
+// BuildPartialMerkleTree builds the BIP37 partial merkle tree proving that the
+// matched txids are part of the block whose transactions are txids.
+// flags is packed eight bits per byte, least significant bit first, as sent
+// in a merkleblock message. It is the inverse of Tree.PopulateTree. A block
+// has at least its coinbase, so no txids give no flags and no hashes.
+func BuildPartialMerkleTree(txids [][]byte, matched [][]byte) (flags []byte, hashes [][]byte) {
+	if len(txids) == 0 {
+		return nil, nil
+	}
+	builder := &partialTreeBuilder{
+		txids:   txids,
+		matches: make([]bool, len(txids)),
+	}
+	for i, txid := range txids {
+		for _, match := range matched {
+			if bytes.Equal(txid, match) {
+				builder.matches[i] = true
+				break
+			}
+		}
+	}
+	height := 0
+	for builder.width(height) > 1 {
+		height++
+	}
+	builder.traverse(height, 0)
+	return BitFieldToBytes(builder.bits), builder.hashes
+}
+
+// width returns the number of nodes at the given height above the leaves.
+func (builder *partialTreeBuilder) width(height int) int {
+	return (len(builder.txids) + (1 << uint(height)) - 1) >> uint(height)
+}
+
+func (builder *partialTreeBuilder) hash(height, pos int) []byte {
+	if height == 0 {
+		return builder.txids[pos]
+	}
+	left := builder.hash(height-1, pos*2)
+	right := left
+	if pos*2+1 < builder.width(height-1) {
+		right = builder.hash(height-1, pos*2+1)
+	}
+	return utils.MerkleParent(left, right)
+}
+
+func (builder *partialTreeBuilder) traverse(height, pos int) {
+	parentOfMatch := false
+	for p := pos << uint(height); p < (pos+1)<<uint(height) && p < len(builder.txids); p++ {
+		if builder.matches[p] {
+			parentOfMatch = true
+			break
+		}
+	}
+	if parentOfMatch {
+		builder.bits = append(builder.bits, 1)
+	} else {
+		builder.bits = append(builder.bits, 0)
+	}
+	if height == 0 || !parentOfMatch {
+		builder.hashes = append(builder.hashes, builder.hash(height, pos))
+		return
+	}
+	builder.traverse(height-1, pos*2)
+	if pos*2+1 < builder.width(height-1) {
+		builder.traverse(height-1, pos*2+1)
+	}
+}
+
+// BitFieldToBytes packs one flag per byte into the wire format used by
+// merkleblock, eight flags per byte with the first flag in the lowest bit.
+func BitFieldToBytes(bits []byte) []byte {
+	result := make([]byte, (len(bits)+7)/8)
+	for i, bit := range bits {
+		if bit != 0 {
+			result[i/8] |= 1 << uint(i%8)
+		}
+	}
+	return result
+}
+
+// BytesToBitField unpacks wire format flag bytes into one flag per byte, the
+// form Tree.PopulateTree consumes.
+func BytesToBitField(flags []byte) []byte {
+	result := make([]byte, len(flags)*8)
+	for i := range result {
+		result[i] = (flags[i/8] >> uint(i%8)) & 1
+	}
+	return result
+}
@@ -0,0 +1,180 @@
+// Package supply computes the circulating supply from the blocks themselves,
+// independently of any node's own accounting.
+package supply
+
+import (
+	"bytes"
+	"errors"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	utxo "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utxo"
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
+)
+
+var (
+	ErrSetNotAtGenesis = errors.New("audit must start from an empty UTXO set")
+	ErrNegativeFee     = errors.New("transaction spends less than it creates")
+)
+
+// Shortfall records a block whose coinbase claimed less than it could.
+type Shortfall struct {
+	Height int32
+	Amount int64
+}
+
+// Report is the supply accounting of the blocks audited so far. Amounts are
+// in satoshis.
+type Report struct {
+	Height int32
+	// MaxSupply is the sum of the subsidies allowed up to Height.
+	MaxSupply int64
+	// Issued is the subsidy actually claimed: coinbase outputs less fees.
+	Issued int64
+	Fees   int64
+	// UnderClaimed is MaxSupply less Issued, and Shortfalls the blocks it
+	// comes from.
+	UnderClaimed int64
+	Shortfalls   []Shortfall
+	// Unspendable is the value of outputs that can never be spent, split
+	// into its sources.
+	Unspendable int64
+	// UnspendableScripts holds OP_RETURN and oversized outputs.
+	UnspendableScripts int64
+	Genesis            int64
+	// Overwritten holds coinbase outputs lost when a later coinbase with the
+	// same txid replaced them, before BIP30.
+	Overwritten int64
+	// Circulating is Issued less Unspendable. It equals the total amount of
+	// the UTXO set.
+	Circulating int64
+}
+
+// Auditor walks a chain from genesis, connecting each block to a UTXO set to
+// learn the value of the coins it spends.
+type Auditor struct {
+	params *chaincfg.ChainParams
+	set    *utxo.Set
+	report Report
+}
+
+// NewAuditor returns an auditor connecting blocks to set, which must be
+// empty and at the genesis block of params. The genesis block is accounted
+// for immediately.
+func NewAuditor(params *chaincfg.ChainParams, set *utxo.Set) (*Auditor, error) {
+	best, height := set.BestBlock()
+	if height != 0 || !bytes.Equal(best, params.GenesisHash) {
+		return nil, ErrSetNotAtGenesis
+	}
+	genesis, err := blockchain.GenesisBlock(params)
+	if err != nil {
+		return nil, err
+	}
+	auditor := &Auditor{params: params, set: set}
+	auditor.report.MaxSupply = params.BlockSubsidy(0)
+	for _, out := range genesis.Transactions[0].Output {
+		auditor.report.Issued += out.Amount
+		auditor.report.Genesis += out.Amount
+	}
+	auditor.addShortfall(0, auditor.report.MaxSupply-auditor.report.Issued)
+	return auditor, nil
+}
+
+func (auditor *Auditor) addShortfall(height int32, amount int64) {
+	if amount > 0 {
+		auditor.report.Shortfalls = append(auditor.report.Shortfalls, Shortfall{height, amount})
+	}
+}
+
+// AddBlock connects the next block of the chain and accounts for it.
+func (auditor *Auditor) AddBlock(block *blockchain.Block) error {
+	if len(block.Transactions) == 0 {
+		return blockchain.ErrNoTransactions
+	}
+	_, height := auditor.set.BestBlock()
+	height++
+	txid := transactions.GenerateTransactionId(block.Transactions[0])
+	// A coinbase output already in the set is about to be replaced.
+	var overwritten int64
+	for i := range block.Transactions[0].Output {
+		coin, err := auditor.set.GetCoin(utxo.NewOutPoint(txid, uint32(i)))
+		if err == nil {
+			overwritten += coin.Amount
+		} else if !errors.Is(err, utxo.ErrCoinNotFound) {
+			return err
+		}
+	}
+	if err := auditor.set.ConnectBlock(block, height); err != nil {
+		return err
+	}
+	undo, err := auditor.set.BlockUndo(block.HashBlock())
+	if err != nil {
+		return err
+	}
+
+	var fees, coinbaseValue, unspendable int64
+	for i, tx := range block.Transactions {
+		var out int64
+		for _, output := range tx.Output {
+			out += output.Amount
+			if utxo.IsUnspendable(output.Script) {
+				unspendable += output.Amount
+			}
+		}
+		if i == 0 {
+			coinbaseValue = out
+			continue
+		}
+		var in int64
+		for _, coin := range undo.Spent[i-1] {
+			in += coin.Amount
+		}
+		if in < out {
+			return ErrNegativeFee
+		}
+		fees += in - out
+	}
+
+	report := &auditor.report
+	subsidy := auditor.params.BlockSubsidy(height)
+	report.Height = height
+	report.MaxSupply += subsidy
+	report.Issued += coinbaseValue - fees
+	report.Fees += fees
+	report.UnspendableScripts += unspendable
+	report.Overwritten += overwritten
+	auditor.addShortfall(height, subsidy+fees-coinbaseValue)
+	return nil
+}
+
+// BlockSource gives blocks of the active chain by height, as regtest.Chain
+// does.
+type BlockSource interface {
+	BlockAtHeight(height int32) (*blockchain.Block, error)
+}
+
+// Walk audits the blocks of source after the last one audited, up to and
+// including height.
+func (auditor *Auditor) Walk(source BlockSource, height int32) error {
+	_, current := auditor.set.BestBlock()
+	for next := current + 1; next <= height; next++ {
+		block, err := source.BlockAtHeight(next)
+		if err != nil {
+			return err
+		}
+		if err := auditor.AddBlock(block); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Report returns the accounting of the blocks audited so far.
+func (auditor *Auditor) Report() Report {
+	report := auditor.report
+	report.Shortfalls = append([]Shortfall{}, report.Shortfalls...)
+	report.UnderClaimed = report.MaxSupply - report.Issued
+	report.Unspendable = report.UnspendableScripts + report.Genesis + report.Overwritten
+	report.Circulating = report.Issued - report.Unspendable
+	return report
+}
@@ -0,0 +1,68 @@
+package supply
+
+import (
+	"testing"
+
+	blockindex "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/blockindex"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	utxo "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utxo"
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
+	regtesttest "github.com/Btcercises/NanoBtcLibrary/Go/internal/regtesttest"
+)
+
+func TestAudit(t *testing.T) {
+	fixture, err := regtesttest.NewSpendFixture(func(amount int64) []transactions.TxOutput {
+		return []transactions.TxOutput{
+			{Amount: amount - 6000, Script: regtesttest.TrueScript},
+			{Amount: 5000, Script: []byte{transactions.OP_RETURN}},
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := fixture.Chain
+
+	params := &chaincfg.RegTestParams
+	set, err := utxo.Open(blockindex.NewMemoryStore(), params.GenesisHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auditor, err := NewAuditor(params, set)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := auditor.Walk(chain, chain.Height()-1); err != nil {
+		t.Fatal(err)
+	}
+
+	// Mine the last block again with a coinbase claiming 700 less.
+	tip := *chain.Tip()
+	tip.Transactions = append([]transactions.Transaction{}, tip.Transactions...)
+	tip.Transactions[0].Output = append([]transactions.TxOutput{}, tip.Transactions[0].Output...)
+	tip.Transactions[0].Output[0].Amount -= 700
+	tip.Transactions[0].Id = nil
+	if err := regtesttest.Remine(&tip); err != nil {
+		t.Fatal(err)
+	}
+	if err := auditor.AddBlock(&tip); err != nil {
+		t.Fatal(err)
+	}
+
+	report := auditor.Report()
+	if report.Height != chain.Height() || report.MaxSupply != params.TotalSupply(report.Height) {
+		t.Fatalf("report at height %d with max supply %d", report.Height, report.MaxSupply)
+	}
+	if report.Fees != 1000 || report.UnderClaimed != 700 || len(report.Shortfalls) != 1 || report.Shortfalls[0].Height != report.Height {
+		t.Fatalf("fees %d, under-claimed %d in %v", report.Fees, report.UnderClaimed, report.Shortfalls)
+	}
+	if report.UnspendableScripts != 5000 || report.Genesis != params.BlockSubsidy(0) {
+		t.Fatalf("unspendable %d, genesis %d", report.UnspendableScripts, report.Genesis)
+	}
+	info, err := set.TxOutSetInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Circulating != info.TotalAmount {
+		t.Fatalf("circulating %d, UTXO set holds %d", report.Circulating, info.TotalAmount)
+	}
+}
@@ -0,0 +1,1255 @@
+package transactions
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+
+	"github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+	secp256k1 "github.com/Btcercises/NanoBtcLibrary/Go/crypto/secp256k1"
+	cryptoUtils "github.com/Btcercises/NanoBtcLibrary/Go/crypto/utils"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// Opcodes understood by the interpreter, besides the push opcodes above.
+const (
+	OP_RESERVED            = 0x50
+	OP_NOP                 = 0x61
+	OP_VER                 = 0x62
+	OP_IF                  = 0x63
+	OP_NOTIF               = 0x64
+	OP_VERIF               = 0x65
+	OP_VERNOTIF            = 0x66
+	OP_ELSE                = 0x67
+	OP_ENDIF               = 0x68
+	OP_VERIFY              = 0x69
+	OP_TOALTSTACK          = 0x6b
+	OP_FROMALTSTACK        = 0x6c
+	OP_2DROP               = 0x6d
+	OP_2DUP                = 0x6e
+	OP_3DUP                = 0x6f
+	OP_2OVER               = 0x70
+	OP_2ROT                = 0x71
+	OP_2SWAP               = 0x72
+	OP_IFDUP               = 0x73
+	OP_DEPTH               = 0x74
+	OP_DROP                = 0x75
+	OP_DUP                 = 0x76
+	OP_NIP                 = 0x77
+	OP_OVER                = 0x78
+	OP_PICK                = 0x79
+	OP_ROLL                = 0x7a
+	OP_ROT                 = 0x7b
+	OP_SWAP                = 0x7c
+	OP_TUCK                = 0x7d
+	OP_CAT                 = 0x7e
+	OP_SIZE                = 0x82
+	OP_INVERT              = 0x83
+	OP_XOR                 = 0x86
+	OP_EQUAL               = 0x87
+	OP_EQUALVERIFY         = 0x88
+	OP_RESERVED1           = 0x89
+	OP_RESERVED2           = 0x8a
+	OP_1ADD                = 0x8b
+	OP_1SUB                = 0x8c
+	OP_2MUL                = 0x8d
+	OP_2DIV                = 0x8e
+	OP_NEGATE              = 0x8f
+	OP_ABS                 = 0x90
+	OP_NOT                 = 0x91
+	OP_0NOTEQUAL           = 0x92
+	OP_ADD                 = 0x93
+	OP_SUB                 = 0x94
+	OP_MUL                 = 0x95
+	OP_RSHIFT              = 0x99
+	OP_BOOLAND             = 0x9a
+	OP_BOOLOR              = 0x9b
+	OP_NUMEQUAL            = 0x9c
+	OP_NUMEQUALVERIFY      = 0x9d
+	OP_NUMNOTEQUAL         = 0x9e
+	OP_LESSTHAN            = 0x9f
+	OP_GREATERTHAN         = 0xa0
+	OP_LESSTHANOREQUAL     = 0xa1
+	OP_GREATERTHANOREQUAL  = 0xa2
+	OP_MIN                 = 0xa3
+	OP_MAX                 = 0xa4
+	OP_WITHIN              = 0xa5
+	OP_RIPEMD160           = 0xa6
+	OP_SHA1                = 0xa7
+	OP_SHA256              = 0xa8
+	OP_HASH160             = 0xa9
+	OP_HASH256             = 0xaa
+	OP_CODESEPARATOR       = 0xab
+	OP_CHECKSIG            = 0xac
+	OP_CHECKSIGVERIFY      = 0xad
+	OP_CHECKMULTISIG       = 0xae
+	OP_CHECKMULTISIGVERIFY = 0xaf
+	OP_NOP1                = 0xb0
+	OP_CHECKLOCKTIMEVERIFY = 0xb1
+	OP_CHECKSEQUENCEVERIFY = 0xb2
+	OP_NOP10               = 0xb9
+	OP_CHECKSIGADD         = 0xba
+)
+
+// Consensus limits on scripts.
+const (
+	MaxScriptSize         = 10000
+	MaxScriptElementSize  = 520
+	MaxOpsPerScript       = 201
+	MaxStackSize          = 1000
+	MaxPubKeysPerMultisig = 20
+	maxScriptNumLength    = 4
+	locktimeThreshold     = 500000000
+)
+
+// BIP68 relative lock times, held in input sequence numbers.
+const (
+	// SequenceLockTimeDisableFlag turns the relative lock of an input off.
+	SequenceLockTimeDisableFlag = 1 << 31
+	// SequenceLockTimeTypeFlag makes the lock a time instead of a height.
+	SequenceLockTimeTypeFlag = 1 << 22
+	// SequenceLockTimeMask selects the lock value.
+	SequenceLockTimeMask = 0xffff
+	// SequenceLockTimeGranularity is the shift turning a time lock value
+	// into seconds.
+	SequenceLockTimeGranularity = 9
+)
+
+// ScriptFlags select the soft fork rules enforced by VerifyScript.
+type ScriptFlags uint32
+
+const (
+	ScriptVerifyP2SH ScriptFlags = 1 << iota
+	ScriptVerifyDERSig
+	ScriptVerifyNullDummy
+	ScriptVerifyCheckLockTimeVerify
+	ScriptVerifyCheckSequenceVerify
+	ScriptVerifyWitness
+	ScriptVerifyTaproot
+)
+
+// ScriptVerifyConsensus enables every rule implemented here.
+const ScriptVerifyConsensus = ScriptVerifyP2SH | ScriptVerifyDERSig | ScriptVerifyNullDummy |
+	ScriptVerifyCheckLockTimeVerify | ScriptVerifyCheckSequenceVerify | ScriptVerifyWitness | ScriptVerifyTaproot
+
+var (
+	ErrEvalFalse             = errors.New("script evaluated without error but finished with a false/empty top stack element")
+	ErrScriptSize            = errors.New("script is too big")
+	ErrPushSize              = errors.New("push value size limit exceeded")
+	ErrOpCount               = errors.New("operation limit exceeded")
+	ErrStackSize             = errors.New("stack size limit exceeded")
+	ErrBadOpcode             = errors.New("opcode missing or not understood")
+	ErrDisabledOpcode        = errors.New("attempted to use a disabled opcode")
+	ErrOpReturn              = errors.New("OP_RETURN was encountered")
+	ErrUnbalancedConditional = errors.New("invalid OP_IF construction")
+	ErrInvalidStackOperation = errors.New("operation not valid with the current stack size")
+	ErrVerify                = errors.New("script failed an OP_VERIFY operation")
+	ErrEqualVerify           = errors.New("script failed an OP_EQUALVERIFY operation")
+	ErrNumEqualVerify        = errors.New("script failed an OP_NUMEQUALVERIFY operation")
+	ErrCheckSigVerify        = errors.New("script failed an OP_CHECKSIGVERIFY operation")
+	ErrCheckMultiSigVerify   = errors.New("script failed an OP_CHECKMULTISIGVERIFY operation")
+	ErrScriptNumOverflow     = errors.New("script number overflow")
+	ErrPubKeyCount           = errors.New("pubkey count out of range")
+	ErrSigCount              = errors.New("signature count out of range")
+	ErrSigDER                = errors.New("non-canonical DER signature")
+	ErrSigNullDummy          = errors.New("dummy CHECKMULTISIG argument must be zero")
+	ErrSigPushOnly           = errors.New("only push operators allowed in signatures")
+	ErrNegativeLocktime      = errors.New("negative locktime")
+	ErrUnsatisfiedLocktime   = errors.New("locktime requirement not satisfied")
+	ErrWitnessProgramLength  = errors.New("witness program has incorrect length")
+	ErrWitnessProgramEmpty   = errors.New("witness program was passed an empty witness")
+	ErrWitnessMismatch       = errors.New("witness program hash mismatch")
+	ErrWitnessMalleated      = errors.New("witness requires empty scriptSig")
+	ErrWitnessMalleatedP2SH  = errors.New("witness requires only-redeemscript scriptSig")
+	ErrWitnessUnexpected     = errors.New("witness provided for non-witness script")
+	ErrWitnessCleanStack     = errors.New("witness script did not leave exactly one element")
+	ErrSchnorrSig            = errors.New("invalid Schnorr signature")
+	ErrSchnorrSigSize        = errors.New("invalid Schnorr signature size")
+	ErrSchnorrSigHashType    = errors.New("invalid Schnorr signature hash type")
+	ErrTaprootControlSize    = errors.New("invalid taproot control block size")
+	ErrTapscriptWeight       = errors.New("too much signature validation relative to witness weight")
+	ErrTapscriptMultiSig     = errors.New("OP_CHECKMULTISIG(VERIFY) is not available in tapscript")
+	ErrTapscriptMinimalIf    = errors.New("OP_IF/NOTIF argument must be minimal in tapscript")
+	ErrPubKeyType            = errors.New("public key type not allowed")
+)
+
+type sigVersion int
+
+const (
+	sigVersionBase sigVersion = iota
+	sigVersionWitnessV0
+	sigVersionTaproot
+	sigVersionTapscript
+)
+
+// SigChecker gives the interpreter access to the spending transaction.
+type SigChecker struct {
+	Tx     *Transaction
+	Index  int
+	Amount int64
+	// Taproot holds the outputs spent by all inputs of Tx, which taproot
+	// signatures commit to. Taproot signatures fail without it.
+	Taproot *TaprootHashes
+}
+
+// taprootExec is the state of a taproot spend that its signatures commit
+// to, and for tapscript the remaining signature validation budget.
+type taprootExec struct {
+	annex         []byte
+	leafHash      []byte
+	codeSeparator uint32
+	weightLeft    int
+}
+
+// scriptOp is a decoded script operation.
+type scriptOp struct {
+	opcode byte
+	data   []byte
+}
+
+// nextOp decodes the operation at pc and returns the position after it.
+func nextOp(script Script, pc int) (scriptOp, int, error) {
+	opcode := script[pc]
+	pc++
+	var length int
+	switch {
+	case opcode < OP_PUSHDATA1:
+		length = int(opcode)
+	case opcode == OP_PUSHDATA1:
+		if pc+1 > len(script) {
+			return scriptOp{}, 0, ErrBadOpcode
+		}
+		length = int(script[pc])
+		pc++
+	case opcode == OP_PUSHDATA2:
+		if pc+2 > len(script) {
+			return scriptOp{}, 0, ErrBadOpcode
+		}
+		length = int(binary.LittleEndian.Uint16(script[pc:]))
+		pc += 2
+	case opcode == OP_PUSHDATA4:
+		if pc+4 > len(script) {
+			return scriptOp{}, 0, ErrBadOpcode
+		}
+		length = int(binary.LittleEndian.Uint32(script[pc:]))
+		pc += 4
+	default:
+		return scriptOp{opcode: opcode}, pc, nil
+	}
+	if length < 0 || pc+length > len(script) {
+		return scriptOp{}, 0, ErrBadOpcode
+	}
+	return scriptOp{opcode: opcode, data: script[pc : pc+length]}, pc + length, nil
+}
+
+// parseScript splits a script into its operations.
+func parseScript(script Script) ([]scriptOp, error) {
+	ops := make([]scriptOp, 0)
+	for pc := 0; pc < len(script); {
+		op, next, err := nextOp(script, pc)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, op)
+		pc = next
+	}
+	return ops, nil
+}
+
+// IsPushOnly reports whether the script only pushes data.
+func IsPushOnly(script Script) bool {
+	ops, err := parseScript(script)
+	if err != nil {
+		return false
+	}
+	for _, op := range ops {
+		if op.opcode > OP_16 {
+			return false
+		}
+	}
+	return true
+}
+
+// IsPayToScriptHash reports whether script is OP_HASH160 <20 bytes> OP_EQUAL.
+func IsPayToScriptHash(script Script) bool {
+	return len(script) == 23 && script[0] == OP_HASH160 && script[1] == 0x14 && script[22] == OP_EQUAL
+}
+
+// IsPayToPubKey reports whether script is <pubkey> OP_CHECKSIG.
+func IsPayToPubKey(script Script) bool {
+	n := len(script)
+	return (n == 35 || n == 67) && int(script[0]) == n-2 && script[n-1] == OP_CHECKSIG
+}
+
+// IsMultisig reports whether script is a bare OP_m <pubkeys> OP_n
+// OP_CHECKMULTISIG.
+func IsMultisig(script Script) bool {
+	ops, err := parseScript(script)
+	if err != nil || len(ops) < 4 || ops[len(ops)-1].opcode != OP_CHECKMULTISIG {
+		return false
+	}
+	required := int(ops[0].opcode) - OP_1 + 1
+	total := int(ops[len(ops)-2].opcode) - OP_1 + 1
+	if required < 1 || required > 16 || total < required || total > 16 || total != len(ops)-3 {
+		return false
+	}
+	for _, op := range ops[1 : len(ops)-2] {
+		if len(op.data) != 33 && len(op.data) != 65 {
+			return false
+		}
+	}
+	return true
+}
+
+// PushedData returns the data pushed by script, up to the first operation
+// that cannot be decoded. Empty pushes are left out.
+func PushedData(script Script) [][]byte {
+	result := make([][]byte, 0)
+	for pc := 0; pc < len(script); {
+		op, next, err := nextOp(script, pc)
+		if err != nil {
+			break
+		}
+		if len(op.data) > 0 {
+			result = append(result, op.data)
+		}
+		pc = next
+	}
+	return result
+}
+
+// WitnessProgram returns the version and program of a segwit output script.
+func WitnessProgram(script Script) (int, []byte, bool) {
+	if len(script) < 4 || len(script) > 42 {
+		return 0, nil, false
+	}
+	if script[0] != OP_0 && (script[0] < OP_1 || script[0] > OP_16) {
+		return 0, nil, false
+	}
+	if int(script[1])+2 != len(script) {
+		return 0, nil, false
+	}
+	version := 0
+	if script[0] != OP_0 {
+		version = int(script[0]) - OP_1 + 1
+	}
+	return version, script[2:], true
+}
+
+func castToBool(value []byte) bool {
+	for i, b := range value {
+		if b != 0 {
+			// Negative zero is false.
+			return !(i == len(value)-1 && b == 0x80)
+		}
+	}
+	return false
+}
+
+// decodeScriptNum reads a stack element as a number of at most maxLength bytes.
+func decodeScriptNum(value []byte, maxLength int) (int64, error) {
+	if len(value) > maxLength {
+		return 0, ErrScriptNumOverflow
+	}
+	if len(value) == 0 {
+		return 0, nil
+	}
+	var result int64
+	for i, b := range value {
+		result |= int64(b) << (8 * uint(i))
+	}
+	last := value[len(value)-1]
+	if last&0x80 != 0 {
+		result &= ^(int64(0x80) << (8 * uint(len(value)-1)))
+		return -result, nil
+	}
+	return result, nil
+}
+
+type stack [][]byte
+
+func (s *stack) push(value []byte) {
+	*s = append(*s, value)
+}
+
+func (s *stack) pop() ([]byte, error) {
+	if len(*s) == 0 {
+		return nil, ErrInvalidStackOperation
+	}
+	value := (*s)[len(*s)-1]
+	*s = (*s)[:len(*s)-1]
+	return value, nil
+}
+
+// top returns the element at depth i, 0 being the top.
+func (s stack) top(i int) ([]byte, error) {
+	if i < 0 || i >= len(s) {
+		return nil, ErrInvalidStackOperation
+	}
+	return s[len(s)-1-i], nil
+}
+
+func (s *stack) popNum() (int64, error) {
+	value, err := s.pop()
+	if err != nil {
+		return 0, err
+	}
+	return decodeScriptNum(value, maxScriptNumLength)
+}
+
+func (s *stack) pushBool(value bool) {
+	if value {
+		s.push([]byte{1})
+	} else {
+		s.push([]byte{})
+	}
+}
+
+func boolToNum(value bool) int64 {
+	if value {
+		return 1
+	}
+	return 0
+}
+
+// findAndDelete removes every push of sig from script, as the legacy
+// signature hash requires.
+func findAndDelete(script Script, sig []byte) Script {
+	if len(sig) == 0 {
+		return script
+	}
+	pattern := PushData(sig)
+	result := make(Script, 0, len(script))
+	for pc := 0; pc < len(script); {
+		_, next, err := nextOp(script, pc)
+		if err != nil {
+			return append(result, script[pc:]...)
+		}
+		if !bytes.Equal(script[pc:next], pattern) {
+			result = append(result, script[pc:next]...)
+		}
+		pc = next
+	}
+	return result
+}
+
+// removeCodeSeparators drops OP_CODESEPARATOR from a legacy script code.
+func removeCodeSeparators(script Script) Script {
+	result := make(Script, 0, len(script))
+	for pc := 0; pc < len(script); {
+		op, next, err := nextOp(script, pc)
+		if err != nil {
+			return append(result, script[pc:]...)
+		}
+		if op.opcode != OP_CODESEPARATOR {
+			result = append(result, script[pc:next]...)
+		}
+		pc = next
+	}
+	return result
+}
+
+func isDisabled(opcode byte) bool {
+	return (opcode >= OP_CAT && opcode <= 0x81) || (opcode >= OP_INVERT && opcode <= OP_XOR) ||
+		opcode == OP_2MUL || opcode == OP_2DIV || (opcode >= OP_MUL && opcode <= OP_RSHIFT)
+}
+
+// checkSig verifies a signature with its trailing hash type against pubKey.
+func (checker *SigChecker) checkSig(sig, pubKey []byte, scriptCode Script, version sigVersion, flags ScriptFlags) (bool, error) {
+	if len(sig) == 0 {
+		return false, nil
+	}
+	der := sig[:len(sig)-1]
+	if flags&ScriptVerifyDERSig != 0 && !secp256k1.IsValidDER(der) {
+		return false, ErrSigDER
+	}
+	if checker == nil || checker.Tx == nil {
+		return false, nil
+	}
+	parsedSig, err := secp256k1.ParseDERSignature(der)
+	if err != nil {
+		return false, nil
+	}
+	key, err := secp256k1.ParsePublicKey(pubKey)
+	if err != nil {
+		return false, nil
+	}
+	hashType := uint32(sig[len(sig)-1])
+	var hash []byte
+	if version == sigVersionWitnessV0 {
+		hash = WitnessV0SignatureHash(*checker.Tx, checker.Index, scriptCode, checker.Amount, hashType)
+	} else {
+		hash = LegacySignatureHash(*checker.Tx, checker.Index, scriptCode, hashType)
+	}
+	return parsedSig.Verify(hash, key), nil
+}
+
+// checkSchnorr verifies a BIP340 signature, with an optional hash type
+// byte, of a taproot key or tapscript spend.
+func (checker *SigChecker) checkSchnorr(sig, pubKey []byte, version sigVersion, exec *taprootExec) error {
+	hashType := byte(SigHashDefault)
+	switch len(sig) {
+	case secp256k1.SchnorrSigSize:
+	case secp256k1.SchnorrSigSize + 1:
+		hashType = sig[secp256k1.SchnorrSigSize]
+		if hashType == SigHashDefault {
+			return ErrSchnorrSigHashType
+		}
+		sig = sig[:secp256k1.SchnorrSigSize]
+	default:
+		return ErrSchnorrSigSize
+	}
+	if checker == nil || checker.Tx == nil || checker.Taproot == nil {
+		return ErrSchnorrSig
+	}
+	var leafHash []byte
+	if version == sigVersionTapscript {
+		leafHash = exec.leafHash
+	}
+	hash, err := TaprootSignatureHash(*checker.Tx, checker.Index, checker.Taproot, hashType, exec.annex, leafHash, exec.codeSeparator)
+	if err != nil {
+		return err
+	}
+	if !secp256k1.VerifySchnorr(sig, hash, pubKey) {
+		return ErrSchnorrSig
+	}
+	return nil
+}
+
+// checkTapscriptSig runs the signature check of OP_CHECKSIG, OP_CHECKSIGVERIFY
+// and OP_CHECKSIGADD in tapscript. An empty signature is a false result, a
+// failing one an error. Keys of unknown types other than the empty one are
+// left for future soft forks and accept any signature.
+func (checker *SigChecker) checkTapscriptSig(sig, pubKey []byte, exec *taprootExec) (bool, error) {
+	success := len(sig) != 0
+	if success {
+		exec.weightLeft -= validationWeightPerSigOp
+		if exec.weightLeft < 0 {
+			return false, ErrTapscriptWeight
+		}
+	}
+	if len(pubKey) == 0 {
+		return false, ErrPubKeyType
+	}
+	if success && len(pubKey) == secp256k1.XOnlyPubKeySize {
+		if err := checker.checkSchnorr(sig, pubKey, sigVersionTapscript, exec); err != nil {
+			return false, err
+		}
+	}
+	return success, nil
+}
+
+func (checker *SigChecker) checkLockTime(locktime int64) bool {
+	tx := checker.Tx
+	if (int64(tx.Locktime) < locktimeThreshold) != (locktime < locktimeThreshold) {
+		return false
+	}
+	if locktime > int64(tx.Locktime) {
+		return false
+	}
+	return tx.Input[checker.Index].Sequence != 0xffffffff
+}
+
+func (checker *SigChecker) checkSequence(sequence int64) bool {
+	const mask = SequenceLockTimeTypeFlag | SequenceLockTimeMask
+	txSequence := int64(checker.Tx.Input[checker.Index].Sequence)
+	// Versions are compared unsigned, so negative ones enable BIP68 too.
+	if uint32(checker.Tx.Version) < 2 || txSequence&SequenceLockTimeDisableFlag != 0 {
+		return false
+	}
+	if (txSequence&SequenceLockTimeTypeFlag != 0) != (sequence&SequenceLockTimeTypeFlag != 0) {
+		return false
+	}
+	return sequence&mask <= txSequence&mask
+}
+
+// evalScript runs script on s. exec is only used by tapscript.
+func evalScript(s *stack, script Script, flags ScriptFlags, checker *SigChecker, version sigVersion, exec *taprootExec) error {
+	legacy := version == sigVersionBase || version == sigVersionWitnessV0
+	if legacy && len(script) > MaxScriptSize {
+		return ErrScriptSize
+	}
+	var alt stack
+	var conditions []bool
+	opCount := 0
+	codeStart := 0
+
+	executing := func() bool {
+		for _, condition := range conditions {
+			if !condition {
+				return false
+			}
+		}
+		return true
+	}
+
+	for pc, opcodePos := 0, uint32(0); pc < len(script); opcodePos++ {
+		op, next, err := nextOp(script, pc)
+		if err != nil {
+			return err
+		}
+		pc = next
+		executed := executing()
+
+		if len(op.data) > MaxScriptElementSize {
+			return ErrPushSize
+		}
+		if legacy && op.opcode > OP_16 {
+			opCount++
+			if opCount > MaxOpsPerScript {
+				return ErrOpCount
+			}
+		}
+		if isDisabled(op.opcode) {
+			return ErrDisabledOpcode
+		}
+		if op.opcode == OP_VERIF || op.opcode == OP_VERNOTIF {
+			return ErrBadOpcode
+		}
+
+		if executed && op.opcode <= OP_PUSHDATA4 {
+			s.push(op.data)
+		} else if executed || (op.opcode >= OP_IF && op.opcode <= OP_ENDIF) {
+			if err := executeOp(op, s, &alt, &conditions, executed, flags, checker, version, exec, script, &codeStart, pc, opcodePos, &opCount); err != nil {
+				return err
+			}
+		}
+		if len(*s)+len(alt) > MaxStackSize {
+			return ErrStackSize
+		}
+	}
+	if len(conditions) != 0 {
+		return ErrUnbalancedConditional
+	}
+	return nil
+}
+
+func executeOp(op scriptOp, s *stack, alt *stack, conditions *[]bool, executed bool, flags ScriptFlags, checker *SigChecker, version sigVersion, exec *taprootExec, script Script, codeStart *int, pc int, opcodePos uint32, opCount *int) error {
+	switch op.opcode {
+	case OP_1NEGATE:
+		s.push(ScriptNum(-1))
+	case OP_NOP, OP_NOP1, 0xb3, 0xb4, 0xb5, 0xb6, 0xb7, 0xb8, OP_NOP10:
+	case OP_CHECKLOCKTIMEVERIFY:
+		if flags&ScriptVerifyCheckLockTimeVerify == 0 {
+			break
+		}
+		value, err := s.top(0)
+		if err != nil {
+			return err
+		}
+		locktime, err := decodeScriptNum(value, 5)
+		if err != nil {
+			return err
+		}
+		if locktime < 0 {
+			return ErrNegativeLocktime
+		}
+		if checker == nil || checker.Tx == nil || !checker.checkLockTime(locktime) {
+			return ErrUnsatisfiedLocktime
+		}
+	case OP_CHECKSEQUENCEVERIFY:
+		if flags&ScriptVerifyCheckSequenceVerify == 0 {
+			break
+		}
+		value, err := s.top(0)
+		if err != nil {
+			return err
+		}
+		sequence, err := decodeScriptNum(value, 5)
+		if err != nil {
+			return err
+		}
+		if sequence < 0 {
+			return ErrNegativeLocktime
+		}
+		if sequence&(1<<31) != 0 {
+			break
+		}
+		if checker == nil || checker.Tx == nil || !checker.checkSequence(sequence) {
+			return ErrUnsatisfiedLocktime
+		}
+	case OP_IF, OP_NOTIF:
+		value := false
+		if executed {
+			top, err := s.pop()
+			if err != nil {
+				return ErrUnbalancedConditional
+			}
+			if version == sigVersionTapscript && (len(top) > 1 || (len(top) == 1 && top[0] != 1)) {
+				return ErrTapscriptMinimalIf
+			}
+			value = castToBool(top)
+			if op.opcode == OP_NOTIF {
+				value = !value
+			}
+		}
+		*conditions = append(*conditions, value)
+	case OP_ELSE:
+		if len(*conditions) == 0 {
+			return ErrUnbalancedConditional
+		}
+		(*conditions)[len(*conditions)-1] = !(*conditions)[len(*conditions)-1]
+	case OP_ENDIF:
+		if len(*conditions) == 0 {
+			return ErrUnbalancedConditional
+		}
+		*conditions = (*conditions)[:len(*conditions)-1]
+	case OP_VERIFY:
+		value, err := s.pop()
+		if err != nil {
+			return err
+		}
+		if !castToBool(value) {
+			return ErrVerify
+		}
+	case OP_RETURN:
+		return ErrOpReturn
+	case OP_TOALTSTACK:
+		value, err := s.pop()
+		if err != nil {
+			return err
+		}
+		alt.push(value)
+	case OP_FROMALTSTACK:
+		value, err := alt.pop()
+		if err != nil {
+			return err
+		}
+		s.push(value)
+	case OP_2DROP:
+		if len(*s) < 2 {
+			return ErrInvalidStackOperation
+		}
+		*s = (*s)[:len(*s)-2]
+	case OP_2DUP, OP_3DUP:
+		count := 2
+		if op.opcode == OP_3DUP {
+			count = 3
+		}
+		if len(*s) < count {
+			return ErrInvalidStackOperation
+		}
+		*s = append(*s, (*s)[len(*s)-count:]...)
+	case OP_2OVER:
+		if len(*s) < 4 {
+			return ErrInvalidStackOperation
+		}
+		*s = append(*s, (*s)[len(*s)-4:len(*s)-2]...)
+	case OP_2ROT:
+		if len(*s) < 6 {
+			return ErrInvalidStackOperation
+		}
+		n := len(*s)
+		moved := [][]byte{(*s)[n-6], (*s)[n-5]}
+		*s = append(append((*s)[:n-6:n-6], (*s)[n-4:]...), moved...)
+	case OP_2SWAP:
+		if len(*s) < 4 {
+			return ErrInvalidStackOperation
+		}
+		n := len(*s)
+		(*s)[n-4], (*s)[n-3], (*s)[n-2], (*s)[n-1] = (*s)[n-2], (*s)[n-1], (*s)[n-4], (*s)[n-3]
+	case OP_IFDUP:
+		value, err := s.top(0)
+		if err != nil {
+			return err
+		}
+		if castToBool(value) {
+			s.push(value)
+		}
+	case OP_DEPTH:
+		s.push(ScriptNum(int64(len(*s))))
+	case OP_DROP:
+		if _, err := s.pop(); err != nil {
+			return err
+		}
+	case OP_DUP:
+		value, err := s.top(0)
+		if err != nil {
+			return err
+		}
+		s.push(value)
+	case OP_NIP:
+		if len(*s) < 2 {
+			return ErrInvalidStackOperation
+		}
+		n := len(*s)
+		*s = append((*s)[:n-2], (*s)[n-1])
+	case OP_OVER:
+		value, err := s.top(1)
+		if err != nil {
+			return err
+		}
+		s.push(value)
+	case OP_PICK, OP_ROLL:
+		n, err := s.popNum()
+		if err != nil {
+			return err
+		}
+		if n < 0 || n >= int64(len(*s)) {
+			return ErrInvalidStackOperation
+		}
+		index := len(*s) - 1 - int(n)
+		value := (*s)[index]
+		if op.opcode == OP_ROLL {
+			*s = append((*s)[:index], (*s)[index+1:]...)
+		}
+		s.push(value)
+	case OP_ROT:
+		if len(*s) < 3 {
+			return ErrInvalidStackOperation
+		}
+		n := len(*s)
+		(*s)[n-3], (*s)[n-2], (*s)[n-1] = (*s)[n-2], (*s)[n-1], (*s)[n-3]
+	case OP_SWAP:
+		if len(*s) < 2 {
+			return ErrInvalidStackOperation
+		}
+		n := len(*s)
+		(*s)[n-2], (*s)[n-1] = (*s)[n-1], (*s)[n-2]
+	case OP_TUCK:
+		if len(*s) < 2 {
+			return ErrInvalidStackOperation
+		}
+		n := len(*s)
+		top := (*s)[n-1]
+		*s = append((*s)[:n-2], top, (*s)[n-2], top)
+	case OP_SIZE:
+		value, err := s.top(0)
+		if err != nil {
+			return err
+		}
+		s.push(ScriptNum(int64(len(value))))
+	case OP_EQUAL, OP_EQUALVERIFY:
+		a, err := s.pop()
+		if err != nil {
+			return err
+		}
+		b, err := s.pop()
+		if err != nil {
+			return err
+		}
+		equal := bytes.Equal(a, b)
+		if op.opcode == OP_EQUALVERIFY {
+			if !equal {
+				return ErrEqualVerify
+			}
+		} else {
+			s.pushBool(equal)
+		}
+	case OP_1ADD, OP_1SUB, OP_NEGATE, OP_ABS, OP_NOT, OP_0NOTEQUAL:
+		n, err := s.popNum()
+		if err != nil {
+			return err
+		}
+		switch op.opcode {
+		case OP_1ADD:
+			n++
+		case OP_1SUB:
+			n--
+		case OP_NEGATE:
+			n = -n
+		case OP_ABS:
+			if n < 0 {
+				n = -n
+			}
+		case OP_NOT:
+			n = boolToNum(n == 0)
+		case OP_0NOTEQUAL:
+			n = boolToNum(n != 0)
+		}
+		s.push(ScriptNum(n))
+	case OP_ADD, OP_SUB, OP_BOOLAND, OP_BOOLOR, OP_NUMEQUAL, OP_NUMEQUALVERIFY, OP_NUMNOTEQUAL,
+		OP_LESSTHAN, OP_GREATERTHAN, OP_LESSTHANOREQUAL, OP_GREATERTHANOREQUAL, OP_MIN, OP_MAX:
+		b, err := s.popNum()
+		if err != nil {
+			return err
+		}
+		a, err := s.popNum()
+		if err != nil {
+			return err
+		}
+		var result int64
+		switch op.opcode {
+		case OP_ADD:
+			result = a + b
+		case OP_SUB:
+			result = a - b
+		case OP_BOOLAND:
+			result = boolToNum(a != 0 && b != 0)
+		case OP_BOOLOR:
+			result = boolToNum(a != 0 || b != 0)
+		case OP_NUMEQUAL, OP_NUMEQUALVERIFY:
+			result = boolToNum(a == b)
+		case OP_NUMNOTEQUAL:
+			result = boolToNum(a != b)
+		case OP_LESSTHAN:
+			result = boolToNum(a < b)
+		case OP_GREATERTHAN:
+			result = boolToNum(a > b)
+		case OP_LESSTHANOREQUAL:
+			result = boolToNum(a <= b)
+		case OP_GREATERTHANOREQUAL:
+			result = boolToNum(a >= b)
+		case OP_MIN:
+			result = min(a, b)
+		case OP_MAX:
+			result = max(a, b)
+		}
+		if op.opcode == OP_NUMEQUALVERIFY {
+			if result == 0 {
+				return ErrNumEqualVerify
+			}
+		} else {
+			s.push(ScriptNum(result))
+		}
+	case OP_WITHIN:
+		upper, err := s.popNum()
+		if err != nil {
+			return err
+		}
+		lower, err := s.popNum()
+		if err != nil {
+			return err
+		}
+		x, err := s.popNum()
+		if err != nil {
+			return err
+		}
+		s.pushBool(lower <= x && x < upper)
+	case OP_RIPEMD160, OP_SHA1, OP_SHA256, OP_HASH160, OP_HASH256:
+		value, err := s.pop()
+		if err != nil {
+			return err
+		}
+		var hash []byte
+		switch op.opcode {
+		case OP_RIPEMD160:
+			hasher := ripemd160.New()
+			hasher.Write(value)
+			hash = hasher.Sum(nil)
+		case OP_SHA1:
+			sum := sha1.Sum(value)
+			hash = sum[:]
+		case OP_SHA256:
+			sum := sha256.Sum256(value)
+			hash = sum[:]
+		case OP_HASH160:
+			hash = cryptoUtils.Hash160(value)
+		case OP_HASH256:
+			hash = utils.DoubleSha256(value)
+		}
+		s.push(hash)
+	case OP_CODESEPARATOR:
+		*codeStart = pc
+		if exec != nil {
+			exec.codeSeparator = opcodePos
+		}
+	case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+		pubKey, err := s.pop()
+		if err != nil {
+			return err
+		}
+		sig, err := s.pop()
+		if err != nil {
+			return err
+		}
+		var valid bool
+		if version == sigVersionTapscript {
+			valid, err = checker.checkTapscriptSig(sig, pubKey, exec)
+		} else {
+			scriptCode := script[*codeStart:]
+			if version == sigVersionBase {
+				scriptCode = removeCodeSeparators(findAndDelete(scriptCode, sig))
+			}
+			valid, err = checker.checkSig(sig, pubKey, scriptCode, version, flags)
+		}
+		if err != nil {
+			return err
+		}
+		if op.opcode == OP_CHECKSIGVERIFY {
+			if !valid {
+				return ErrCheckSigVerify
+			}
+		} else {
+			s.pushBool(valid)
+		}
+	case OP_CHECKSIGADD:
+		if version != sigVersionTapscript {
+			return ErrBadOpcode
+		}
+		if len(*s) < 3 {
+			return ErrInvalidStackOperation
+		}
+		pubKey, err := s.pop()
+		if err != nil {
+			return err
+		}
+		n, err := s.popNum()
+		if err != nil {
+			return err
+		}
+		sig, err := s.pop()
+		if err != nil {
+			return err
+		}
+		valid, err := checker.checkTapscriptSig(sig, pubKey, exec)
+		if err != nil {
+			return err
+		}
+		s.push(ScriptNum(n + boolToNum(valid)))
+	case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+		if version == sigVersionTapscript {
+			return ErrTapscriptMultiSig
+		}
+		keyCount, err := s.popNum()
+		if err != nil {
+			return err
+		}
+		if keyCount < 0 || keyCount > MaxPubKeysPerMultisig {
+			return ErrPubKeyCount
+		}
+		*opCount += int(keyCount)
+		if *opCount > MaxOpsPerScript {
+			return ErrOpCount
+		}
+		if len(*s) < int(keyCount) {
+			return ErrInvalidStackOperation
+		}
+		keys := make([][]byte, keyCount)
+		for i := range keys {
+			keys[i], _ = s.pop()
+		}
+		sigCount, err := s.popNum()
+		if err != nil {
+			return err
+		}
+		if sigCount < 0 || sigCount > keyCount {
+			return ErrSigCount
+		}
+		if len(*s) < int(sigCount) {
+			return ErrInvalidStackOperation
+		}
+		sigs := make([][]byte, sigCount)
+		for i := range sigs {
+			sigs[i], _ = s.pop()
+		}
+		// The extra element consumed because of an off-by-one in the original client.
+		dummy, err := s.pop()
+		if err != nil {
+			return err
+		}
+		if flags&ScriptVerifyNullDummy != 0 && len(dummy) != 0 {
+			return ErrSigNullDummy
+		}
+
+		scriptCode := script[*codeStart:]
+		if version == sigVersionBase {
+			for _, sig := range sigs {
+				scriptCode = findAndDelete(scriptCode, sig)
+			}
+			scriptCode = removeCodeSeparators(scriptCode)
+		}
+		// Signatures must match keys in order; keys are tried from the first.
+		valid := true
+		keyIndex := 0
+		for sigIndex := 0; sigIndex < len(sigs); {
+			if len(sigs)-sigIndex > len(keys)-keyIndex {
+				valid = false
+				break
+			}
+			ok, err := checker.checkSig(sigs[sigIndex], keys[keyIndex], scriptCode, version, flags)
+			if err != nil {
+				return err
+			}
+			if ok {
+				sigIndex++
+			}
+			keyIndex++
+		}
+		if op.opcode == OP_CHECKMULTISIGVERIFY {
+			if !valid {
+				return ErrCheckMultiSigVerify
+			}
+		} else {
+			s.pushBool(valid)
+		}
+	default:
+		if op.opcode >= OP_1 && op.opcode <= OP_16 {
+			s.push(ScriptNum(int64(op.opcode - OP_1 + 1)))
+			return nil
+		}
+		return ErrBadOpcode
+	}
+	return nil
+}
+
+// VerifyScript checks that scriptSig and witness satisfy scriptPubKey for the
+// input described by checker. Witness programs of unknown versions and
+// lengths, and P2SH wrapped taproot outputs, are left for future soft forks
+// and succeed.
+func VerifyScript(scriptSig, scriptPubKey Script, witness [][]byte, flags ScriptFlags, checker *SigChecker) error {
+	if flags&ScriptVerifyP2SH != 0 && !IsPushOnly(scriptSig) && IsPayToScriptHash(scriptPubKey) {
+		return ErrSigPushOnly
+	}
+	var s stack
+	if err := evalScript(&s, scriptSig, flags, checker, sigVersionBase, nil); err != nil {
+		return err
+	}
+	var saved stack
+	if flags&ScriptVerifyP2SH != 0 {
+		saved = append(saved, s...)
+	}
+	if err := evalScript(&s, scriptPubKey, flags, checker, sigVersionBase, nil); err != nil {
+		return err
+	}
+	if len(s) == 0 || !castToBool(s[len(s)-1]) {
+		return ErrEvalFalse
+	}
+
+	hadWitness := false
+	if flags&ScriptVerifyWitness != 0 {
+		if version, program, ok := WitnessProgram(scriptPubKey); ok {
+			hadWitness = true
+			if len(scriptSig) != 0 {
+				return ErrWitnessMalleated
+			}
+			if err := verifyWitnessProgram(witness, version, program, false, flags, checker); err != nil {
+				return err
+			}
+		}
+	}
+
+	if flags&ScriptVerifyP2SH != 0 && IsPayToScriptHash(scriptPubKey) {
+		s = saved
+		redeemScript, err := s.pop()
+		if err != nil {
+			return ErrEvalFalse
+		}
+		if err := evalScript(&s, redeemScript, flags, checker, sigVersionBase, nil); err != nil {
+			return err
+		}
+		if len(s) == 0 || !castToBool(s[len(s)-1]) {
+			return ErrEvalFalse
+		}
+		if flags&ScriptVerifyWitness != 0 {
+			if version, program, ok := WitnessProgram(redeemScript); ok {
+				hadWitness = true
+				if !bytes.Equal(scriptSig, PushData(redeemScript)) {
+					return ErrWitnessMalleatedP2SH
+				}
+				if err := verifyWitnessProgram(witness, version, program, true, flags, checker); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if flags&ScriptVerifyWitness != 0 && !hadWitness && len(witness) != 0 {
+		return ErrWitnessUnexpected
+	}
+	return nil
+}
+
+func verifyWitnessProgram(witness [][]byte, version int, program []byte, isP2SH bool, flags ScriptFlags, checker *SigChecker) error {
+	if version == 1 && len(program) == secp256k1.XOnlyPubKeySize && !isP2SH {
+		if flags&ScriptVerifyTaproot == 0 {
+			return nil
+		}
+		return verifyTaproot(witness, program, flags, checker)
+	}
+	if version != 0 {
+		return nil
+	}
+	var script Script
+	s := make(stack, 0, len(witness))
+	switch len(program) {
+	case 32:
+		if len(witness) == 0 {
+			return ErrWitnessProgramEmpty
+		}
+		script = witness[len(witness)-1]
+		hash := sha256.Sum256(script)
+		if !bytes.Equal(hash[:], program) {
+			return ErrWitnessMismatch
+		}
+		s = append(s, witness[:len(witness)-1]...)
+	case 20:
+		if len(witness) != 2 {
+			return ErrWitnessMismatch
+		}
+		script = append(append(Script{OP_DUP, OP_HASH160}, PushData(program)...), OP_EQUALVERIFY, OP_CHECKSIG)
+		s = append(s, witness...)
+	default:
+		return ErrWitnessProgramLength
+	}
+	return executeWitnessScript(s, script, flags, checker, sigVersionWitnessV0, nil)
+}
+
+// verifyTaproot checks a BIP341 spend of the output key program, by a
+// signature for the key or by a script of the tree it commits to.
+func verifyTaproot(witness [][]byte, program []byte, flags ScriptFlags, checker *SigChecker) error {
+	s := append(stack{}, witness...)
+	if len(s) == 0 {
+		return ErrWitnessProgramEmpty
+	}
+	exec := &taprootExec{codeSeparator: 0xffffffff}
+	if len(s) >= 2 && len(s[len(s)-1]) > 0 && s[len(s)-1][0] == AnnexTag {
+		exec.annex = s[len(s)-1]
+		s = s[:len(s)-1]
+	}
+	if len(s) == 1 {
+		return checker.checkSchnorr(s[0], program, sigVersionTaproot, exec)
+	}
+
+	control, script := s[len(s)-1], Script(s[len(s)-2])
+	s = s[:len(s)-2]
+	if len(control) < taprootControlBaseSize || len(control) > taprootControlMaxSize ||
+		(len(control)-taprootControlBaseSize)%taprootControlNodeSize != 0 {
+		return ErrTaprootControlSize
+	}
+	leafVersion := control[0] & taprootLeafMask
+	exec.leafHash = TapLeafHash(leafVersion, script)
+	if !verifyTaprootCommitment(control, program, exec.leafHash) {
+		return ErrWitnessMismatch
+	}
+	if leafVersion != TapscriptLeafVersion {
+		return nil
+	}
+	for pc := 0; pc < len(script); {
+		op, next, err := nextOp(script, pc)
+		if err != nil {
+			return err
+		}
+		if isOpSuccess(op.opcode) {
+			return nil
+		}
+		pc = next
+	}
+	if len(s) > MaxStackSize {
+		return ErrStackSize
+	}
+	exec.weightLeft = witnessSize(witness) + validationWeightOffset
+	return executeWitnessScript(s, script, flags, checker, sigVersionTapscript, exec)
+}
+
+// executeWitnessScript runs a segwit script on the witness stack s, which
+// must end with a single true element.
+func executeWitnessScript(s stack, script Script, flags ScriptFlags, checker *SigChecker, version sigVersion, exec *taprootExec) error {
+	for _, item := range s {
+		if len(item) > MaxScriptElementSize {
+			return ErrPushSize
+		}
+	}
+	if err := evalScript(&s, script, flags, checker, version, exec); err != nil {
+		return err
+	}
+	if len(s) != 1 {
+		return ErrWitnessCleanStack
+	}
+	if !castToBool(s[0]) {
+		return ErrEvalFalse
+	}
+	return nil
+}
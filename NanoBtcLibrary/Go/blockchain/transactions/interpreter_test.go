@@ -0,0 +1,372 @@
+package transactions
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"testing"
+
+	"github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+	secp256k1 "github.com/Btcercises/NanoBtcLibrary/Go/crypto/secp256k1"
+	cryptoUtils "github.com/Btcercises/NanoBtcLibrary/Go/crypto/utils"
+)
+
+func decodeHex(t *testing.T, s string) []byte {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func parseTestTx(t *testing.T, s string) Transaction {
+	tx, err := ParseTransaction(bytes.NewReader(decodeHex(t, s)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tx
+}
+
+func checkTxId(t *testing.T, tx Transaction, want string) {
+	if got := hex.EncodeToString(utils.ReverseByteArray(GenerateTransactionId(tx))); got != want {
+		t.Fatalf("txid %s, want %s", got, want)
+	}
+}
+
+// TestVerifyScriptBlock170 checks the first transaction between two people,
+// spending the P2PK coinbase of block 9.
+func TestVerifyScriptBlock170(t *testing.T) {
+	tx := parseTestTx(t, "0100000001c997a5e56e104102fa209c6a852dd90660a20b2d9c352423edce25857fcd3704000000004847304402204e45e16932b8af514961a1d3a1a25fdf3f4f7732e9d624c6c61548ab5fb8cd410220181522ec8eca07de4860a4acdd12909d831cc56cbbac4622082221a8768d1d0901ffffffff0200ca9a3b00000000434104ae1a62fe09c5f51b13905f07f06b99a2f7159b2225f374cd378d71302fa28414e7aab37397f554a7df5f142c21c1b7303b8a0626f1baded5c72a704f7e6cd84cac00286bee0000000043410411db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5cb2e0eaddfb84ccf9744464f82e160bfa9b8b64f9d4c03f999b8643f656b412a3ac00000000")
+	checkTxId(t, tx, "f4184fc596403b9d638783cf57adfe4c75c605f6356fbc91338530e9831e9e16")
+	prevout := Script(decodeHex(t, "410411db93e1dcdb8a016b49840f8c53bc1eb68a382e97b1482ecad7b148a6909a5cb2e0eaddfb84ccf9744464f82e160bfa9b8b64f9d4c03f999b8643f656b412a3ac"))
+	checker := &SigChecker{Tx: &tx, Index: 0, Amount: 5000000000}
+	if err := VerifyScript(tx.Input[0].Script, prevout, nil, ScriptVerifyConsensus, checker); err != nil {
+		t.Fatal(err)
+	}
+
+	tx.Output[0].Amount++
+	if err := VerifyScript(tx.Input[0].Script, prevout, nil, ScriptVerifyConsensus, checker); err != ErrEvalFalse {
+		t.Fatalf("changed output: %v", err)
+	}
+}
+
+// TestVerifyScriptP2PKH checks the P2PKH spend used as an example in
+// Programming Bitcoin.
+func TestVerifyScriptP2PKH(t *testing.T) {
+	tx := parseTestTx(t, "0100000001813f79011acb80925dfe69b3def355fe914bd1d96a3f5f71bf8303c6a989c7d1000000006b483045022100ed81ff192e75a3fd2304004dcadb746fa5e24c5031ccfcf21320b0277457c98f02207a986d955c6e0cb35d446a89d3f56100f4d7f67801c31967743a9c8e10615bed01210349fc4e631e3624a545de3f89f5d8684c7b8138bd94bdd531d2e213bf016b278afeffffff02a135ef01000000001976a914bc3b654dca7e56b04dca18f2566cdaf02e8d9ada88ac99c39800000000001976a9141c4bc762dd5423e332166702cb75f40df79fea1288ac19430600")
+	checkTxId(t, tx, "452c629d67e41baec3ac6f04fe744b4b9617f8f859c63b3002f8684e7a4fee03")
+	prevout := Script(decodeHex(t, "76a914a802fc56c704ce87c42d7c92eb75e7896bdc41ae88ac"))
+	hash := LegacySignatureHash(tx, 0, prevout, SigHashAll)
+	if got := hex.EncodeToString(hash); got != "27e0c5994dec7824e56dec6b2fcb342eb7cdb0d0957c2fce9882f715e85d81a6" {
+		t.Fatalf("signature hash %s", got)
+	}
+	checker := &SigChecker{Tx: &tx, Index: 0, Amount: 42505594}
+	if err := VerifyScript(tx.Input[0].Script, prevout, nil, ScriptVerifyConsensus, checker); err != nil {
+		t.Fatal(err)
+	}
+
+	other := append(Script{}, prevout...)
+	other[3] ^= 1
+	if err := VerifyScript(tx.Input[0].Script, other, nil, ScriptVerifyConsensus, checker); err != ErrEqualVerify {
+		t.Fatalf("other key hash: %v", err)
+	}
+	tx.Locktime++
+	if err := VerifyScript(tx.Input[0].Script, prevout, nil, ScriptVerifyConsensus, checker); err != ErrEvalFalse {
+		t.Fatalf("changed locktime: %v", err)
+	}
+}
+
+// TestVerifyScriptBIP143 checks the native P2WPKH and P2SH-P2WPKH examples
+// of BIP143.
+func TestVerifyScriptBIP143(t *testing.T) {
+	unsigned := parseTestTx(t, "0100000002fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f0000000000eeffffffef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a0100000000ffffffff02202cb206000000001976a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac9093510d000000001976a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac11000000")
+	scriptCode := Script(decodeHex(t, "76a9141d0f172a0ecb48aee1be1f2687d2963ae33f71a188ac"))
+	hash := WitnessV0SignatureHash(unsigned, 1, scriptCode, 600000000, SigHashAll)
+	if got := hex.EncodeToString(hash); got != "c37af31116d1b27caf68aae9e3ac82f1477929014d5b917657d0eb49478cb670" {
+		t.Fatalf("P2WPKH signature hash %s", got)
+	}
+
+	tx := parseTestTx(t, "01000000000102fff7f7881a8099afa6940d42d1e7f6362bec38171ea3edf433541db4e4ad969f00000000494830450221008b9d1dc26ba6a9cb62127b02742fa9d754cd3bebf337f7a55d114c8e5cdd30be022040529b194ba3f9281a99f2b1c0a19c0489bc22ede944ccf4ecbab4cc618ef3ed01eeffffffef51e1b804cc89d182d279655c3aa89e815b1b309fe287d9b2b55d57b90ec68a0100000000ffffffff02202cb206000000001976a9148280b37df378db99f66f85c95a783a76ac7a6d5988ac9093510d000000001976a9143bde42dbee7e4dbe6a21b2d50ce2f0167faa815988ac000247304402203609e17b84f6a7d30c80bfa610b5b4542f32a8a0d5447a12fb1366d7f01cc44a0220573a954c4518331561406f90300e8f3358f51928d43c212a8caed02de67eebee0121025476c2e83188368da1ff3e292e7acafcdb3566bb0ad253f62fc70f07aeee635711000000")
+	prevouts := []TxOutput{
+		{Amount: 625000000, Script: decodeHex(t, "2103c9f4836b9a4f77fc0d81f7bcb01b7f1b35916864b9476c241ce9fc198bd25432ac")},
+		{Amount: 600000000, Script: decodeHex(t, "00141d0f172a0ecb48aee1be1f2687d2963ae33f71a1")},
+	}
+	for i, prevout := range prevouts {
+		checker := &SigChecker{Tx: &tx, Index: i, Amount: prevout.Amount}
+		if err := VerifyScript(tx.Input[i].Script, prevout.Script, tx.Input[i].ScriptWitness, ScriptVerifyConsensus, checker); err != nil {
+			t.Fatalf("input %d: %v", i, err)
+		}
+	}
+	witness := tx.Input[1].ScriptWitness
+	checker := &SigChecker{Tx: &tx, Index: 1, Amount: 600000001}
+	if err := VerifyScript(nil, prevouts[1].Script, witness, ScriptVerifyConsensus, checker); err != ErrEvalFalse {
+		t.Fatalf("other amount: %v", err)
+	}
+	checker.Amount = 600000000
+	if err := VerifyScript(Script{OP_0}, prevouts[1].Script, witness, ScriptVerifyConsensus, checker); err != ErrWitnessMalleated {
+		t.Fatalf("non-empty scriptSig: %v", err)
+	}
+	if err := VerifyScript(nil, prevouts[1].Script, witness[:1], ScriptVerifyConsensus, checker); err != ErrWitnessMismatch {
+		t.Fatalf("missing witness item: %v", err)
+	}
+	if err := VerifyScript(tx.Input[0].Script, prevouts[0].Script, witness, ScriptVerifyConsensus, &SigChecker{Tx: &tx, Amount: prevouts[0].Amount}); err != ErrWitnessUnexpected {
+		t.Fatalf("witness on a P2PK spend: %v", err)
+	}
+
+	nested := parseTestTx(t, "01000000000101db6b1b20aa0fd7b23880be2ecbd4a98130974cf4748fb66092ac4d3ceb1a5477010000001716001479091972186c449eb1ded22b78e40d009bdf0089feffffff02b8b4eb0b000000001976a914a457b684d7f0d539a46a45bbc043f35b59d0d96388ac0008af2f000000001976a914fd270b1ee6abcaea97fea7ad0402e8bd8ad6d77c88ac02473044022047ac8e878352d3ebbde1c94ce3a10d057c24175747116f8288e5d794d12d482f0220217f36a485cae903c713331d877c1f64677e3622ad4010726870540656fe9dcb012103ad1d8e89212f0b92c74d23bb710c00662ad1470198ac48c43f7d6f93a2a2687392040000")
+	scriptCode = decodeHex(t, "76a91479091972186c449eb1ded22b78e40d009bdf008988ac")
+	hash = WitnessV0SignatureHash(nested, 0, scriptCode, 1000000000, SigHashAll)
+	if got := hex.EncodeToString(hash); got != "64f3b0f4dd2bb3aa1ce8566d220cc74dda9df97d8490cc81d89d735c92e59fb6" {
+		t.Fatalf("P2SH-P2WPKH signature hash %s", got)
+	}
+	p2sh := Script(decodeHex(t, "a9144733f37cf4db86fbc2efed2500b4f4e49f31202387"))
+	in := nested.Input[0]
+	checker = &SigChecker{Tx: &nested, Index: 0, Amount: 1000000000}
+	if err := VerifyScript(in.Script, p2sh, in.ScriptWitness, ScriptVerifyConsensus, checker); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyScript(append(Script{OP_0}, in.Script...), p2sh, in.ScriptWitness, ScriptVerifyConsensus, checker); err != ErrWitnessMalleatedP2SH {
+		t.Fatalf("extra push before the redeem script: %v", err)
+	}
+	// Without the segwit rules the witness is ignored and the spend is
+	// anyone-can-spend.
+	if err := VerifyScript(in.Script, p2sh, nil, ScriptVerifyP2SH, checker); err != nil {
+		t.Fatalf("pre-segwit rules: %v", err)
+	}
+}
+
+// assemble builds a script of opcodes, pushes of byte slices and already
+// encoded Script fragments.
+func assemble(parts ...interface{}) Script {
+	result := Script{}
+	for _, part := range parts {
+		switch part := part.(type) {
+		case int:
+			result = append(result, byte(part))
+		case []byte:
+			result = append(result, PushData(part)...)
+		case Script:
+			result = append(result, part...)
+		}
+	}
+	return result
+}
+
+// TestVerifyScriptRules runs small scripts in the spirit of Bitcoin Core's
+// script_tests.json, each hitting one rule.
+func TestVerifyScriptRules(t *testing.T) {
+	tx := Transaction{
+		Version:  2,
+		Input:    []TxInput{{Hash: make([]byte, 32), Sequence: 10}},
+		Output:   []TxOutput{{Amount: 0}},
+		Locktime: 100,
+	}
+	redeem := []byte(append(PushInt(2), OP_EQUAL))
+	p2sh := assemble(OP_HASH160, cryptoUtils.Hash160(redeem), OP_EQUAL)
+	tests := []struct {
+		name                    string
+		scriptSig, scriptPubKey Script
+		flags                   ScriptFlags
+		err                     error
+	}{
+		{"equal", assemble(OP_1, PushInt(2)), assemble(PushInt(2), OP_EQUALVERIFY, OP_1, OP_EQUAL), 0, nil},
+		{"false result", assemble(OP_0), assemble(), 0, ErrEvalFalse},
+		{"negative zero is false", assemble([]byte{0x80}), assemble(), 0, ErrEvalFalse},
+		{"op_return", assemble(OP_1), assemble(OP_RETURN), 0, ErrOpReturn},
+		{"disabled opcode in an unexecuted branch", assemble(OP_0), assemble(OP_IF, OP_CAT, OP_ENDIF, OP_1), 0, ErrDisabledOpcode},
+		{"unknown opcode in an unexecuted branch", assemble(OP_0), assemble(OP_IF, 0xba, OP_ENDIF, OP_1), 0, nil},
+		{"checksigadd outside tapscript", assemble(OP_1), assemble(OP_1, OP_1, OP_1, OP_CHECKSIGADD), 0, ErrBadOpcode},
+		{"unbalanced conditional", assemble(OP_1), assemble(OP_IF, OP_1), 0, ErrUnbalancedConditional},
+		{"5-byte number", assemble([]byte{1, 0, 0, 0, 0}), assemble(OP_1ADD), 0, ErrScriptNumOverflow},
+		{"push of 521 bytes", assemble(make([]byte, 521)), assemble(OP_DROP, OP_1), 0, ErrPushSize},
+		{"push of 520 bytes", assemble(make([]byte, 520)), assemble(OP_DROP, OP_1), 0, nil},
+		{"p2sh", assemble(PushInt(2), redeem), p2sh, ScriptVerifyP2SH, nil},
+		{"p2sh redeem script false", assemble(PushInt(3), redeem), p2sh, ScriptVerifyP2SH, ErrEvalFalse},
+		{"p2sh before BIP16", assemble(PushInt(3), redeem), p2sh, 0, nil},
+		{"p2sh scriptSig not push only", assemble(PushInt(2), OP_NOP, redeem), p2sh, ScriptVerifyP2SH, ErrSigPushOnly},
+		{"null dummy", assemble(OP_1), assemble(OP_0, OP_0, OP_CHECKMULTISIG), ScriptVerifyNullDummy, ErrSigNullDummy},
+		{"non-null dummy before BIP147", assemble(OP_1), assemble(OP_0, OP_0, OP_CHECKMULTISIG), 0, nil},
+		{"bad DER", assemble([]byte{0x30, 0x01}), assemble(OP_0, OP_CHECKSIG, OP_NOT), ScriptVerifyDERSig, ErrSigDER},
+		{"bad DER before BIP66", assemble([]byte{0x30, 0x01}), assemble(OP_0, OP_CHECKSIG, OP_NOT), 0, nil},
+		{"cltv satisfied", assemble(), assemble(PushInt(100), OP_CHECKLOCKTIMEVERIFY), ScriptVerifyCheckLockTimeVerify, nil},
+		{"cltv in the future", assemble(), assemble(PushInt(101), OP_CHECKLOCKTIMEVERIFY), ScriptVerifyCheckLockTimeVerify, ErrUnsatisfiedLocktime},
+		{"cltv negative", assemble(), assemble(OP_1NEGATE, OP_CHECKLOCKTIMEVERIFY), ScriptVerifyCheckLockTimeVerify, ErrNegativeLocktime},
+		{"cltv as a nop", assemble(), assemble(PushInt(101), OP_CHECKLOCKTIMEVERIFY), 0, nil},
+		{"csv satisfied", assemble(), assemble(PushInt(10), OP_CHECKSEQUENCEVERIFY), ScriptVerifyCheckSequenceVerify, nil},
+		{"csv not reached", assemble(), assemble(PushInt(11), OP_CHECKSEQUENCEVERIFY), ScriptVerifyCheckSequenceVerify, ErrUnsatisfiedLocktime},
+		{"csv of another type", assemble(), assemble(PushInt(1<<22|10), OP_CHECKSEQUENCEVERIFY), ScriptVerifyCheckSequenceVerify, ErrUnsatisfiedLocktime},
+		{"csv disabled", assemble(), assemble(PushInt(1<<31), OP_CHECKSEQUENCEVERIFY), ScriptVerifyCheckSequenceVerify, nil},
+	}
+	for _, test := range tests {
+		checker := &SigChecker{Tx: &tx}
+		err := VerifyScript(test.scriptSig, test.scriptPubKey, nil, test.flags, checker)
+		if err != test.err {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+
+	// BIP68 applies to versions of at least 2 compared unsigned.
+	csv := assemble(PushInt(10), OP_CHECKSEQUENCEVERIFY)
+	for version, want := range map[int32]error{1: ErrUnsatisfiedLocktime, 2: nil, -1: nil} {
+		tx.Version = version
+		err := VerifyScript(nil, csv, nil, ScriptVerifyCheckSequenceVerify, &SigChecker{Tx: &tx})
+		if err != want {
+			t.Errorf("version %d: got %v, want %v", version, err, want)
+		}
+	}
+}
+
+// TestTaprootOutputKey checks the first two scriptPubKey vectors of BIP341.
+func TestTaprootOutputKey(t *testing.T) {
+	output, _, err := TaprootOutputKey(decodeHex(t, "d6889cb081036e0faefa3a35157ad71086b123b2b144b649798b494c300a961d"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(output); got != "53a1f6e454df1aa2776a2814a721372d6258050de330b3c6d10ee8f4e0dda343" {
+		t.Errorf("output key without scripts %s", got)
+	}
+
+	leafHash := TapLeafHash(TapscriptLeafVersion, decodeHex(t, "20d85a959b0290bf19bb89ed43c916be835475d013da4b362117393e25a48229b8ac"))
+	if got := hex.EncodeToString(leafHash); got != "5b75adecf53548f3ec6ad7d78383bf84cc57b55a3127c72b9a2481752dd88b21" {
+		t.Errorf("leaf hash %s", got)
+	}
+	output, _, err = TaprootOutputKey(decodeHex(t, "187791b6f712a8ea41c8ecdd0ee77fab3e85263b37e1ec18a3651926b3a6cf27"), leafHash)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(output); got != "147c9c57132f6e7ecddba9800bb0c4449251c92a1e60371ee77557b6620f3ea3" {
+		t.Errorf("output key with one leaf %s", got)
+	}
+}
+
+// TestVerifyScriptTaproot spends taproot outputs committing to a single
+// tapscript leaf, by the key path and by the script path.
+func TestVerifyScriptTaproot(t *testing.T) {
+	internalKey, _ := secp256k1.NewPrivateKey(big.NewInt(0x1234))
+	leafKey, _ := secp256k1.NewPrivateKey(big.NewInt(0x5678))
+	internal := internalKey.SerializeXOnly()
+	tx := Transaction{
+		Version: 2,
+		Input:   []TxInput{{Hash: make([]byte, 32), Sequence: 0xffffffff}},
+		Output:  []TxOutput{{Amount: 90000, Script: assemble(OP_1)}},
+	}
+
+	// commit returns the output committing to leaf, its control block and a
+	// checker for the input spending it.
+	commit := func(leaf Script) (Script, []byte, *SigChecker) {
+		output, odd, err := TaprootOutputKey(internal, TapLeafHash(TapscriptLeafVersion, leaf))
+		if err != nil {
+			t.Fatal(err)
+		}
+		control := append([]byte{TapscriptLeafVersion}, internal...)
+		if odd {
+			control[0] |= 1
+		}
+		scriptPubKey := assemble(OP_1, output)
+		prevouts := []TxOutput{{Amount: 100000, Script: scriptPubKey}}
+		return scriptPubKey, control, &SigChecker{Tx: &tx, Amount: 100000, Taproot: NewTaprootHashes(tx, prevouts)}
+	}
+	// sign signs the spend of the output committing to leaf, by the key path
+	// if leafHash is nil.
+	sign := func(key *secp256k1.PrivateKey, leaf Script, leafHash []byte, hashType byte) []byte {
+		_, _, checker := commit(leaf)
+		hash, err := TaprootSignatureHash(tx, 0, checker.Taproot, hashType, nil, leafHash, 0xffffffff)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := key.SignSchnorr(hash, make([]byte, 32))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hashType != SigHashDefault {
+			sig = append(sig, hashType)
+		}
+		return sig
+	}
+	leafSign := func(key *secp256k1.PrivateKey, leaf Script, hashType byte) []byte {
+		return sign(key, leaf, TapLeafHash(TapscriptLeafVersion, leaf), hashType)
+	}
+
+	checkSig := assemble(leafKey.SerializeXOnly(), OP_CHECKSIG)
+	tweakedKey, err := secp256k1.TweakPrivateKey(internalKey, TaprootTweak(internal, TapLeafHash(TapscriptLeafVersion, checkSig)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keySig := sign(tweakedKey, checkSig, nil, SigHashDefault)
+	flipped := append([]byte{}, keySig...)
+	flipped[10] ^= 1
+	scriptPubKey, control, checker := commit(checkSig)
+	keyTests := []struct {
+		name    string
+		witness [][]byte
+		err     error
+	}{
+		{"key path", [][]byte{keySig}, nil},
+		{"key path with SIGHASH_ALL", [][]byte{sign(tweakedKey, checkSig, nil, SigHashAll)}, nil},
+		{"key path with SIGHASH_SINGLE|ANYONECANPAY", [][]byte{sign(tweakedKey, checkSig, nil, SigHashSingle|SigHashAnyoneCanPay)}, nil},
+		{"explicit default hash type", [][]byte{append(keySig, SigHashDefault)}, ErrSchnorrSigHashType},
+		{"undefined hash type", [][]byte{append(keySig, 0x04)}, ErrSchnorrSigHashType},
+		{"short signature", [][]byte{keySig[:63]}, ErrSchnorrSigSize},
+		{"altered signature", [][]byte{flipped}, ErrSchnorrSig},
+		{"untweaked key", [][]byte{sign(internalKey, checkSig, nil, SigHashDefault)}, ErrSchnorrSig},
+		{"annex not signed", [][]byte{keySig, {AnnexTag}}, ErrSchnorrSig},
+		{"empty witness", nil, ErrWitnessProgramEmpty},
+		{"script path", [][]byte{leafSign(leafKey, checkSig, SigHashDefault), checkSig, control}, nil},
+		{"script path with SIGHASH_NONE", [][]byte{leafSign(leafKey, checkSig, SigHashNone), checkSig, control}, nil},
+		{"script path signed as key path", [][]byte{sign(leafKey, checkSig, nil, SigHashDefault), checkSig, control}, ErrSchnorrSig},
+		{"empty signature", [][]byte{{}, checkSig, control}, ErrEvalFalse},
+		{"control block too short", [][]byte{{}, checkSig, control[:32]}, ErrTaprootControlSize},
+		{"control block with a partial node", [][]byte{{}, checkSig, append(control, 1)}, ErrTaprootControlSize},
+		{"wrong parity", [][]byte{{}, checkSig, append([]byte{control[0] ^ 1}, control[1:]...)}, ErrWitnessMismatch},
+		{"other leaf", [][]byte{{}, assemble(OP_1), control}, ErrWitnessMismatch},
+	}
+	for _, test := range keyTests {
+		err := VerifyScript(nil, scriptPubKey, test.witness, ScriptVerifyConsensus, checker)
+		if err != test.err {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+
+	// Before taproot, and wrapped in P2SH, version 1 programs are left for
+	// future soft forks.
+	if err := VerifyScript(nil, scriptPubKey, [][]byte{flipped}, ScriptVerifyConsensus&^ScriptVerifyTaproot, checker); err != nil {
+		t.Errorf("before taproot: %v", err)
+	}
+	p2sh := assemble(OP_HASH160, cryptoUtils.Hash160(scriptPubKey), OP_EQUAL)
+	if err := VerifyScript(assemble([]byte(scriptPubKey)), p2sh, [][]byte{flipped}, ScriptVerifyConsensus, checker); err != nil {
+		t.Errorf("P2SH wrapped: %v", err)
+	}
+	if err := VerifyScript(nil, scriptPubKey, [][]byte{keySig}, ScriptVerifyConsensus, &SigChecker{Tx: &tx, Amount: 100000}); err != ErrSchnorrSig {
+		t.Errorf("without the spent outputs: %v", err)
+	}
+
+	multiSig := assemble(leafKey.SerializeXOnly(), OP_CHECKSIG, internal, OP_CHECKSIGADD, PushInt(2), OP_NUMEQUAL)
+	minimalIf := assemble(OP_IF, OP_1, OP_ENDIF)
+	scriptTests := []struct {
+		name    string
+		leaf    Script
+		witness [][]byte
+		err     error
+	}{
+		{"checksigadd", multiSig, [][]byte{leafSign(internalKey, multiSig, SigHashDefault), leafSign(leafKey, multiSig, SigHashDefault)}, nil},
+		{"checksigadd with one signature", multiSig, [][]byte{{}, leafSign(leafKey, multiSig, SigHashDefault)}, ErrEvalFalse},
+		{"checksigadd with a bad signature", multiSig, [][]byte{leafSign(leafKey, multiSig, SigHashDefault), leafSign(leafKey, multiSig, SigHashDefault)}, ErrSchnorrSig},
+		{"checksigadd on a short stack", assemble(OP_1, OP_1, OP_CHECKSIGADD), nil, ErrInvalidStackOperation},
+		{"minimal if", minimalIf, [][]byte{{1}}, nil},
+		{"non-minimal if", minimalIf, [][]byte{{2}}, ErrTapscriptMinimalIf},
+		{"checkmultisig", assemble(OP_0, OP_0, OP_CHECKMULTISIG), nil, ErrTapscriptMultiSig},
+		{"op_success", assemble(OP_RETURN, 0x50), nil, nil},
+		{"unknown key type", assemble([]byte{1}, OP_CHECKSIG), [][]byte{{1}}, nil},
+		{"empty key", assemble(OP_0, OP_CHECKSIG), [][]byte{{1}}, ErrPubKeyType},
+		{"more than 201 opcodes", append(Script(bytes.Repeat([]byte{OP_NOP}, MaxOpsPerScript+1)), OP_1), nil, nil},
+		{"signatures over the weight budget", assemble(OP_2DUP, OP_CHECKSIGVERIFY, OP_2DUP, OP_CHECKSIGVERIFY, OP_CHECKSIG), [][]byte{{1}, {1}}, ErrTapscriptWeight},
+	}
+	for _, test := range scriptTests {
+		scriptPubKey, control, checker := commit(test.leaf)
+		witness := append(append([][]byte{}, test.witness...), test.leaf, control)
+		err := VerifyScript(nil, scriptPubKey, witness, ScriptVerifyConsensus, checker)
+		if err != test.err {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+}
@@ -1,11 +1,15 @@
 package transactions
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
 )
 
 type Transaction struct {
@@ -14,7 +18,7 @@ type Transaction struct {
 	Input    []TxInput
 	Output   []TxOutput
 	Locktime uint32
-	Testnet  bool
+	Params   *chaincfg.ChainParams
 }
 
 func Print(tx Transaction) {
@@ -26,8 +30,8 @@ func Print(tx Transaction) {
 		tx.Locktime)
 }
 
-func CreateTransaction(version int32, input []TxInput, output []TxOutput, locktime uint32, testnet bool) Transaction {
-	tx := Transaction{nil, version, input, output, locktime, testnet}
+func CreateTransaction(version int32, input []TxInput, output []TxOutput, locktime uint32, params *chaincfg.ChainParams) Transaction {
+	tx := Transaction{nil, version, input, output, locktime, params}
 	tx.Id = GenerateTransactionId(tx)
 	return tx
 }
@@ -36,11 +40,53 @@ func GenerateTransactionId(tx Transaction) []byte {
 	if tx.Id != nil {
 		return tx.Id
 	}
+	tx.Id = utils.DoubleSha256(serialize(tx, false))
+	return tx.Id
+}
+
+// GenerateWitnessTransactionId returns the wtxid of tx, which commits to its witness data.
+// For transactions without witness data it is equal to the txid.
+func GenerateWitnessTransactionId(tx Transaction) []byte {
+	return utils.DoubleSha256(Serialize(tx))
+}
+
+// Serialize returns the wire encoding of tx, using the BIP144 format when any input has witness data.
+func Serialize(tx Transaction) []byte {
+	return serialize(tx, HasWitness(tx))
+}
+
+// StrippedSize returns the size of tx serialized without witness data.
+func StrippedSize(tx Transaction) int {
+	return len(serialize(tx, false))
+}
+
+// Weight returns the BIP141 weight of tx: its stripped size scaled by
+// WitnessScaleFactor, plus the size of its witness data.
+func Weight(tx Transaction) int {
+	stripped := StrippedSize(tx)
+	return stripped*(WitnessScaleFactor-1) + len(Serialize(tx))
+}
+
+// HasWitness reports whether any input of tx carries witness data.
+func HasWitness(tx Transaction) bool {
+	for _, in := range tx.Input {
+		if len(in.ScriptWitness) != 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func serialize(tx Transaction, witness bool) []byte {
 	bin := make([]byte, 0)
 	version := make([]byte, 4)
 	binary.LittleEndian.PutUint32(version, uint32(tx.Version))
 	bin = append(bin, version...)
 
+	if witness {
+		bin = append(bin, 0x00, 0x01)
+	}
+
 	vinLength := utils.Varint(uint64(len(tx.Input)))
 	bin = append(bin, vinLength...)
 	for _, in := range tx.Input {
@@ -53,12 +99,123 @@ func GenerateTransactionId(tx Transaction) []byte {
 		bin = append(bin, out.Binary()...)
 	}
 
+	if witness {
+		for _, in := range tx.Input {
+			bin = append(bin, utils.Varint(uint64(len(in.ScriptWitness)))...)
+			for _, item := range in.ScriptWitness {
+				bin = append(bin, utils.Varint(uint64(len(item)))...)
+				bin = append(bin, item...)
+			}
+		}
+	}
+
 	locktime := make([]byte, 4)
 	binary.LittleEndian.PutUint32(locktime, tx.Locktime)
 	bin = append(bin, locktime...)
 
-	tx.Id = utils.DoubleSha256(bin)
-	return tx.Id
+	return bin
+}
+
+// ParseTransaction reads a serialized transaction, with or without BIP144
+// witness data.
+func ParseTransaction(reader *bytes.Reader) (Transaction, error) {
+	var tx Transaction
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return tx, err
+	}
+	tx.Version = int32(binary.LittleEndian.Uint32(buf))
+
+	numInputs, err := utils.ReadVarint(reader)
+	if err != nil {
+		return tx, err
+	}
+	witness := false
+	if numInputs == 0 {
+		// An empty input list is the BIP144 marker, followed by the flag.
+		flag, err := reader.ReadByte()
+		if err != nil {
+			return tx, err
+		}
+		if flag != 0x01 {
+			return tx, fmt.Errorf("unexpected witness flag %x", flag)
+		}
+		witness = true
+		if numInputs, err = utils.ReadVarint(reader); err != nil {
+			return tx, err
+		}
+	}
+	if numInputs > uint64(reader.Len()/minInputSize) {
+		return tx, errors.New("input count exceeds transaction size")
+	}
+	tx.Input = make([]TxInput, numInputs)
+	for i := range tx.Input {
+		if tx.Input[i], err = parseInput(reader); err != nil {
+			return tx, err
+		}
+	}
+
+	numOutputs, err := utils.ReadVarint(reader)
+	if err != nil {
+		return tx, err
+	}
+	if numOutputs > uint64(reader.Len()/minOutputSize) {
+		return tx, errors.New("output count exceeds transaction size")
+	}
+	tx.Output = make([]TxOutput, numOutputs)
+	for i := range tx.Output {
+		if tx.Output[i], err = parseOutput(reader); err != nil {
+			return tx, err
+		}
+	}
+
+	if witness {
+		for i := range tx.Input {
+			if tx.Input[i].ScriptWitness, err = parseWitness(reader); err != nil {
+				return tx, err
+			}
+		}
+		if !HasWitness(tx) {
+			return tx, errors.New("superfluous witness record")
+		}
+	}
+
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return tx, err
+	}
+	tx.Locktime = binary.LittleEndian.Uint32(buf)
+	tx.Id = GenerateTransactionId(tx)
+	return tx, nil
+}
+
+func readBytes(reader *bytes.Reader) ([]byte, error) {
+	length, err := utils.ReadVarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(reader.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	result := make([]byte, length)
+	_, err = io.ReadFull(reader, result)
+	return result, err
+}
+
+func parseWitness(reader *bytes.Reader) ([][]byte, error) {
+	numItems, err := utils.ReadVarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	if numItems > uint64(reader.Len()) {
+		return nil, errors.New("witness item count exceeds transaction size")
+	}
+	result := make([][]byte, numItems)
+	for i := range result {
+		if result[i], err = readBytes(reader); err != nil {
+			return nil, err
+		}
+	}
+	return result, nil
 }
 
 func IsCoinbaseTx(tx Transaction) bool {
@@ -90,9 +247,18 @@ func CreateCoinbaseTransaction(tx Transaction) {
 	// return little_endian_to_int(element)
 }
 
-func GetUrl(testnet bool) string {
-	if testnet {
-		return "http://testnet.programmingbitcoin.com"
+// ErrNoTxService is returned by GetUrl for networks without a transaction
+// service.
+var ErrNoTxService = errors.New("no transaction service for the network")
+
+// GetUrl returns the transaction service for the network. Only mainnet and
+// testnet3 are served.
+func GetUrl(params *chaincfg.ChainParams) (string, error) {
+	switch params.Net {
+	case chaincfg.MainNetParams.Net:
+		return "http://mainnet.programmingbitcoin.com/", nil
+	case chaincfg.TestNet3Params.Net:
+		return "http://testnet.programmingbitcoin.com", nil
 	}
-	return "http://mainnet.programmingbitcoin.com/"
+	return "", fmt.Errorf("%w: %s", ErrNoTxService, params.Name)
 }
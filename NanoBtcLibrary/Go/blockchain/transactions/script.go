@@ -32,3 +32,74 @@ func Op_hash160(stack utils.Stack) bool {
 	stack.Push(string(h160))
 	return true
 }
+
+// Opcodes used when building scripts.
+const (
+	OP_0         = 0x00
+	OP_PUSHDATA1 = 0x4c
+	OP_PUSHDATA2 = 0x4d
+	OP_PUSHDATA4 = 0x4e
+	OP_1NEGATE   = 0x4f
+	OP_1         = 0x51
+	OP_16        = 0x60
+	OP_RETURN    = 0x6a
+)
+
+// ScriptNum encodes n as a minimal little endian sign-magnitude number, the
+// way numbers are pushed to and read from the script stack.
+func ScriptNum(n int64) []byte {
+	if n == 0 {
+		return []byte{}
+	}
+	negative := n < 0
+	abs := uint64(n)
+	if negative {
+		abs = uint64(-n)
+	}
+	result := make([]byte, 0, 9)
+	for abs > 0 {
+		result = append(result, byte(abs&0xff))
+		abs >>= 8
+	}
+	// Add a byte for the sign if the most significant bit is already in use.
+	if result[len(result)-1]&0x80 != 0 {
+		if negative {
+			result = append(result, 0x80)
+		} else {
+			result = append(result, 0x00)
+		}
+	} else if negative {
+		result[len(result)-1] |= 0x80
+	}
+	return result
+}
+
+// PushData returns the script fragment pushing data with the smallest
+// possible push opcode for its length.
+func PushData(data []byte) Script {
+	length := len(data)
+	var result Script
+	switch {
+	case length < OP_PUSHDATA1:
+		result = Script{byte(length)}
+	case length <= 0xff:
+		result = Script{OP_PUSHDATA1, byte(length)}
+	case length <= 0xffff:
+		result = Script{OP_PUSHDATA2, byte(length), byte(length >> 8)}
+	default:
+		result = Script{OP_PUSHDATA4, byte(length), byte(length >> 8), byte(length >> 16), byte(length >> 24)}
+	}
+	return append(result, data...)
+}
+
+// PushInt returns the script fragment pushing n, using OP_0, OP_1NEGATE and
+// OP_1 to OP_16 for small numbers as Bitcoin Core does.
+func PushInt(n int64) Script {
+	if n == 0 {
+		return Script{OP_0}
+	}
+	if n == -1 || (n >= 1 && n <= 16) {
+		return Script{byte(OP_1 + n - 1)}
+	}
+	return PushData(ScriptNum(n))
+}
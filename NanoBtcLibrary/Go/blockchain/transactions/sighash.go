@@ -0,0 +1,226 @@
+package transactions
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+
+	"github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+	secp256k1 "github.com/Btcercises/NanoBtcLibrary/Go/crypto/secp256k1"
+)
+
+// Signature hash types. SigHashDefault is only valid for taproot, where it
+// signs like SigHashAll.
+const (
+	SigHashDefault      = 0x00
+	SigHashAll          = 0x01
+	SigHashNone         = 0x02
+	SigHashSingle       = 0x03
+	SigHashAnyoneCanPay = 0x80
+)
+
+// legacySigHashOne is returned for SIGHASH_SINGLE without a matching output,
+// a quirk of the original client that consensus keeps.
+var legacySigHashOne = append([]byte{0x01}, make([]byte, 31)...)
+
+func outpoint(in TxInput) []byte {
+	return binary.LittleEndian.AppendUint32(append([]byte{}, in.Hash...), in.Index)
+}
+
+// LegacySignatureHash returns the hash signed by pre-segwit signatures of
+// input index, with scriptCode already stripped of OP_CODESEPARATOR and the
+// signature itself.
+func LegacySignatureHash(tx Transaction, index int, scriptCode Script, hashType uint32) []byte {
+	if index >= len(tx.Input) {
+		return legacySigHashOne
+	}
+	base := hashType & 0x1f
+	if base == SigHashSingle && index >= len(tx.Output) {
+		return legacySigHashOne
+	}
+
+	copied := Transaction{Version: tx.Version, Locktime: tx.Locktime}
+	for i, in := range tx.Input {
+		if hashType&SigHashAnyoneCanPay != 0 && i != index {
+			continue
+		}
+		in.ScriptWitness = nil
+		in.Script = nil
+		if i == index {
+			in.Script = scriptCode
+		} else if base == SigHashNone || base == SigHashSingle {
+			in.Sequence = 0
+		}
+		copied.Input = append(copied.Input, in)
+	}
+	switch base {
+	case SigHashNone:
+	case SigHashSingle:
+		for i := 0; i < index; i++ {
+			copied.Output = append(copied.Output, TxOutput{Amount: -1})
+		}
+		copied.Output = append(copied.Output, tx.Output[index])
+	default:
+		copied.Output = tx.Output
+	}
+
+	data := serialize(copied, false)
+	data = binary.LittleEndian.AppendUint32(data, hashType)
+	return utils.DoubleSha256(data)
+}
+
+// WitnessV0SignatureHash returns the BIP143 hash signed by segwit v0
+// signatures of input index spending amount.
+func WitnessV0SignatureHash(tx Transaction, index int, scriptCode Script, amount int64, hashType uint32) []byte {
+	base := hashType & 0x1f
+	anyoneCanPay := hashType&SigHashAnyoneCanPay != 0
+	zero := make([]byte, 32)
+
+	hashPrevouts, hashSequence, hashOutputs := zero, zero, zero
+	if !anyoneCanPay {
+		data := make([]byte, 0, 36*len(tx.Input))
+		for _, in := range tx.Input {
+			data = append(data, outpoint(in)...)
+		}
+		hashPrevouts = utils.DoubleSha256(data)
+	}
+	if !anyoneCanPay && base != SigHashSingle && base != SigHashNone {
+		data := make([]byte, 0, 4*len(tx.Input))
+		for _, in := range tx.Input {
+			data = binary.LittleEndian.AppendUint32(data, in.Sequence)
+		}
+		hashSequence = utils.DoubleSha256(data)
+	}
+	if base != SigHashSingle && base != SigHashNone {
+		data := make([]byte, 0)
+		for _, out := range tx.Output {
+			data = append(data, out.Binary()...)
+		}
+		hashOutputs = utils.DoubleSha256(data)
+	} else if base == SigHashSingle && index < len(tx.Output) {
+		hashOutputs = utils.DoubleSha256(tx.Output[index].Binary())
+	}
+
+	in := tx.Input[index]
+	data := binary.LittleEndian.AppendUint32(nil, uint32(tx.Version))
+	data = append(data, hashPrevouts...)
+	data = append(data, hashSequence...)
+	data = append(data, outpoint(in)...)
+	data = append(data, utils.Varint(uint64(len(scriptCode)))...)
+	data = append(data, scriptCode...)
+	data = binary.LittleEndian.AppendUint64(data, uint64(amount))
+	data = binary.LittleEndian.AppendUint32(data, in.Sequence)
+	data = append(data, hashOutputs...)
+	data = binary.LittleEndian.AppendUint32(data, tx.Locktime)
+	data = binary.LittleEndian.AppendUint32(data, hashType)
+	return utils.DoubleSha256(data)
+}
+
+// TaprootHashes holds the outputs spent by every input of a transaction and
+// the BIP341 hashes over them and the transaction, which the signature
+// hashes of all inputs share.
+type TaprootHashes struct {
+	Prevouts      []TxOutput
+	prevouts      []byte
+	amounts       []byte
+	scriptPubKeys []byte
+	sequences     []byte
+	outputs       []byte
+}
+
+func sha256Bytes(data []byte) []byte {
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// NewTaprootHashes precomputes the hashes of tx spending prevouts, which
+// must match its inputs.
+func NewTaprootHashes(tx Transaction, prevouts []TxOutput) *TaprootHashes {
+	var outpoints, amounts, scripts, sequences, outputs []byte
+	for i, in := range tx.Input {
+		outpoints = append(outpoints, outpoint(in)...)
+		sequences = binary.LittleEndian.AppendUint32(sequences, in.Sequence)
+		if i < len(prevouts) {
+			amounts = binary.LittleEndian.AppendUint64(amounts, uint64(prevouts[i].Amount))
+			scripts = append(scripts, utils.Varint(uint64(len(prevouts[i].Script)))...)
+			scripts = append(scripts, prevouts[i].Script...)
+		}
+	}
+	for _, out := range tx.Output {
+		outputs = append(outputs, out.Binary()...)
+	}
+	return &TaprootHashes{
+		Prevouts:      prevouts,
+		prevouts:      sha256Bytes(outpoints),
+		amounts:       sha256Bytes(amounts),
+		scriptPubKeys: sha256Bytes(scripts),
+		sequences:     sha256Bytes(sequences),
+		outputs:       sha256Bytes(outputs),
+	}
+}
+
+func isValidTaprootHashType(hashType byte) bool {
+	return hashType <= SigHashSingle || (hashType >= SigHashAnyoneCanPay|SigHashAll && hashType <= SigHashAnyoneCanPay|SigHashSingle)
+}
+
+// TaprootSignatureHash returns the BIP341 hash signed by taproot signatures
+// of input index. annex is nil when the witness has none. For key path
+// spends leafHash is nil; for script path spends it is the hash of the
+// executed leaf and codeSeparator the opcode position of the last executed
+// OP_CODESEPARATOR, or 0xffffffff.
+func TaprootSignatureHash(tx Transaction, index int, hashes *TaprootHashes, hashType byte, annex, leafHash []byte, codeSeparator uint32) ([]byte, error) {
+	if !isValidTaprootHashType(hashType) || index >= len(tx.Input) || len(hashes.Prevouts) != len(tx.Input) {
+		return nil, ErrSchnorrSigHashType
+	}
+	base := hashType & 0x03
+	anyoneCanPay := hashType&SigHashAnyoneCanPay != 0
+	if base == SigHashSingle && index >= len(tx.Output) {
+		return nil, ErrSchnorrSigHashType
+	}
+
+	// The leading zero is the sighash epoch.
+	data := []byte{0x00, hashType}
+	data = binary.LittleEndian.AppendUint32(data, uint32(tx.Version))
+	data = binary.LittleEndian.AppendUint32(data, tx.Locktime)
+	if !anyoneCanPay {
+		data = append(data, hashes.prevouts...)
+		data = append(data, hashes.amounts...)
+		data = append(data, hashes.scriptPubKeys...)
+		data = append(data, hashes.sequences...)
+	}
+	if base != SigHashNone && base != SigHashSingle {
+		data = append(data, hashes.outputs...)
+	}
+
+	spendType := byte(0)
+	if leafHash != nil {
+		spendType |= 2
+	}
+	if annex != nil {
+		spendType |= 1
+	}
+	data = append(data, spendType)
+	if anyoneCanPay {
+		in, prevout := tx.Input[index], hashes.Prevouts[index]
+		data = append(data, outpoint(in)...)
+		data = binary.LittleEndian.AppendUint64(data, uint64(prevout.Amount))
+		data = append(data, utils.Varint(uint64(len(prevout.Script)))...)
+		data = append(data, prevout.Script...)
+		data = binary.LittleEndian.AppendUint32(data, in.Sequence)
+	} else {
+		data = binary.LittleEndian.AppendUint32(data, uint32(index))
+	}
+	if annex != nil {
+		data = append(data, sha256Bytes(append(utils.Varint(uint64(len(annex))), annex...))...)
+	}
+	if base == SigHashSingle {
+		data = append(data, sha256Bytes(tx.Output[index].Binary())...)
+	}
+
+	if leafHash != nil {
+		// The key version is 0.
+		data = append(data, leafHash...)
+		data = append(data, 0x00)
+		data = binary.LittleEndian.AppendUint32(data, codeSeparator)
+	}
+	return secp256k1.TaggedHash("TapSighash", data), nil
+}
@@ -0,0 +1,81 @@
+package transactions
+
+// WitnessScaleFactor is the BIP141 ratio between the cost of base and
+// witness data, applied to both weight and signature operations.
+const WitnessScaleFactor = 4
+
+// SigOpCount counts the signature operations in script. Multisig operations
+// count as 20 unless accurate is set and the key count precedes them, as in
+// redeem and witness scripts. Counting stops at the first malformed push.
+func SigOpCount(script Script, accurate bool) int {
+	count := 0
+	var last byte = 0xff
+	for pc := 0; pc < len(script); {
+		op, next, err := nextOp(script, pc)
+		if err != nil {
+			break
+		}
+		switch op.opcode {
+		case OP_CHECKSIG, OP_CHECKSIGVERIFY:
+			count++
+		case OP_CHECKMULTISIG, OP_CHECKMULTISIGVERIFY:
+			if accurate && last >= OP_1 && last <= OP_16 {
+				count += int(last - OP_1 + 1)
+			} else {
+				count += MaxPubKeysPerMultisig
+			}
+		}
+		last = op.opcode
+		pc = next
+	}
+	return count
+}
+
+// P2SHSigOpCount counts the signature operations of the redeem script
+// scriptSig reveals when spending a pay-to-script-hash scriptPubKey.
+func P2SHSigOpCount(scriptSig, scriptPubKey Script) int {
+	if !IsPayToScriptHash(scriptPubKey) || !IsPushOnly(scriptSig) {
+		return 0
+	}
+	return SigOpCount(lastPush(scriptSig), true)
+}
+
+// lastPush returns the data pushed last by a push-only script.
+func lastPush(script Script) []byte {
+	ops, err := parseScript(script)
+	if err != nil || len(ops) == 0 {
+		return nil
+	}
+	return ops[len(ops)-1].data
+}
+
+// WitnessSigOpCount counts the signature operations of the version 0
+// witness program scriptPubKey commits to, directly or nested in P2SH.
+// Unlike legacy operations they are not scaled by WitnessScaleFactor.
+func WitnessSigOpCount(scriptSig, scriptPubKey Script, witness [][]byte, flags ScriptFlags) int {
+	if flags&ScriptVerifyWitness == 0 {
+		return 0
+	}
+	if version, program, ok := WitnessProgram(scriptPubKey); ok {
+		return witnessSigOps(version, program, witness)
+	}
+	if IsPayToScriptHash(scriptPubKey) && IsPushOnly(scriptSig) {
+		if version, program, ok := WitnessProgram(lastPush(scriptSig)); ok {
+			return witnessSigOps(version, program, witness)
+		}
+	}
+	return 0
+}
+
+func witnessSigOps(version int, program []byte, witness [][]byte) int {
+	if version != 0 {
+		return 0
+	}
+	switch {
+	case len(program) == 20:
+		return 1
+	case len(program) == 32 && len(witness) > 0:
+		return SigOpCount(witness[len(witness)-1], true)
+	}
+	return 0
+}
@@ -0,0 +1,92 @@
+package transactions
+
+import (
+	"bytes"
+
+	"github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+	secp256k1 "github.com/Btcercises/NanoBtcLibrary/Go/crypto/secp256k1"
+)
+
+// BIP341 and BIP342 constants.
+const (
+	// TapscriptLeafVersion is the leaf version of BIP342 scripts.
+	TapscriptLeafVersion = 0xc0
+	// AnnexTag is the first byte of an annex, the optional last witness item.
+	AnnexTag = 0x50
+
+	taprootLeafMask        = 0xfe
+	taprootControlBaseSize = 33
+	taprootControlNodeSize = 32
+	taprootControlMaxSize  = taprootControlBaseSize + taprootControlNodeSize*128
+	// validationWeightPerSigOp is the budget used by each signature check
+	// in tapscript, and validationWeightOffset the budget given on top of
+	// the witness size.
+	validationWeightPerSigOp = 50
+	validationWeightOffset   = 50
+)
+
+// TapLeafHash returns the hash of a script leaf.
+func TapLeafHash(leafVersion byte, script Script) []byte {
+	return secp256k1.TaggedHash("TapLeaf", []byte{leafVersion}, utils.Varint(uint64(len(script))), script)
+}
+
+// TapBranchHash returns the hash of the branch over two nodes, which are
+// sorted first.
+func TapBranchHash(a, b []byte) []byte {
+	if bytes.Compare(a, b) > 0 {
+		a, b = b, a
+	}
+	return secp256k1.TaggedHash("TapBranch", a, b)
+}
+
+// TaprootTweak returns the tweak committing internalKey to the script tree
+// with root merkleRoot, or to no scripts if merkleRoot is nil.
+func TaprootTweak(internalKey, merkleRoot []byte) []byte {
+	return secp256k1.TaggedHash("TapTweak", internalKey, merkleRoot)
+}
+
+// TaprootOutputKey returns the x-only output key of internalKey tweaked by
+// merkleRoot and whether its y is odd.
+func TaprootOutputKey(internalKey, merkleRoot []byte) ([]byte, bool, error) {
+	key, err := secp256k1.ParseXOnlyPublicKey(internalKey)
+	if err != nil {
+		return nil, false, err
+	}
+	tweaked, err := secp256k1.TweakPublicKey(key, TaprootTweak(internalKey, merkleRoot))
+	if err != nil {
+		return nil, false, err
+	}
+	return tweaked.SerializeXOnly(), !tweaked.HasEvenY(), nil
+}
+
+// verifyTaprootCommitment checks that the control block proves leafHash is
+// in the script tree committed to by the output key program.
+func verifyTaprootCommitment(control, program, leafHash []byte) bool {
+	node := leafHash
+	for i := taprootControlBaseSize; i < len(control); i += taprootControlNodeSize {
+		node = TapBranchHash(node, control[i:i+taprootControlNodeSize])
+	}
+	outputKey, odd, err := TaprootOutputKey(control[1:taprootControlBaseSize], node)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(outputKey, program) && odd == (control[0]&1 == 1)
+}
+
+// isOpSuccess reports whether opcode is one of the OP_SUCCESSx of BIP342,
+// which make a tapscript succeed unconditionally.
+func isOpSuccess(opcode byte) bool {
+	return opcode == 0x50 || opcode == 0x62 || (opcode >= 0x7e && opcode <= 0x81) ||
+		(opcode >= 0x83 && opcode <= 0x86) || (opcode >= 0x89 && opcode <= 0x8a) ||
+		(opcode >= 0x8d && opcode <= 0x8e) || (opcode >= 0x95 && opcode <= 0x99) ||
+		(opcode >= 0xbb && opcode <= 0xfe)
+}
+
+// witnessSize returns the serialized size of a witness stack.
+func witnessSize(witness [][]byte) int {
+	size := len(utils.Varint(uint64(len(witness))))
+	for _, item := range witness {
+		size += len(utils.Varint(uint64(len(item)))) + len(item)
+	}
+	return size
+}
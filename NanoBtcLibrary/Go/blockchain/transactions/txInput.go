@@ -1,13 +1,18 @@
 package transactions
 
 import (
+	"bytes"
 	"encoding/binary"
+	"io"
 
 	"github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
 )
 
 var SequenceDefaultVal = "0xffffffff"
 
+// minInputSize is the size of an input with an empty script.
+const minInputSize = 41
+
 type TxInput struct {
 	Hash          []byte
 	Index         uint32
@@ -37,3 +42,27 @@ func (in TxInput) Binary() []byte {
 
 	return bin
 }
+
+func parseInput(reader *bytes.Reader) (TxInput, error) {
+	var in TxInput
+	in.Hash = make([]byte, 32)
+	if _, err := io.ReadFull(reader, in.Hash); err != nil {
+		return in, err
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return in, err
+	}
+	in.Index = binary.LittleEndian.Uint32(buf)
+	in.PrevIndex = int(int32(in.Index))
+	script, err := readBytes(reader)
+	if err != nil {
+		return in, err
+	}
+	in.Script = script
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return in, err
+	}
+	in.Sequence = binary.LittleEndian.Uint32(buf)
+	return in, nil
+}
@@ -1,11 +1,16 @@
 package transactions
 
 import (
+	"bytes"
 	"encoding/binary"
+	"io"
 
 	"github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
 )
 
+// minOutputSize is the size of an output with an empty script.
+const minOutputSize = 9
+
 type TxOutput struct {
 	Amount int64
 	Script Script
@@ -24,3 +29,18 @@ func (out TxOutput) Binary() Script {
 
 	return bin
 }
+
+func parseOutput(reader *bytes.Reader) (TxOutput, error) {
+	var out TxOutput
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return out, err
+	}
+	out.Amount = int64(binary.LittleEndian.Uint64(buf))
+	script, err := readBytes(reader)
+	if err != nil {
+		return out, err
+	}
+	out.Script = script
+	return out, nil
+}
@@ -1,6 +1,7 @@
 package blockchain
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"math"
@@ -9,6 +10,8 @@ import (
 	utils "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
 )
 
+var errPartialTreeOverflow = errors.New("ran out of flag bits or hashes")
+
 // Tree represents a merkle tree.
 type Tree struct {
 	Total        int
@@ -16,6 +19,8 @@ type Tree struct {
 	Nodes        [][][]byte
 	CurrentDepth int
 	CurrentIndex int
+	// Matched holds the leaf hashes flagged as matches by the last PopulateTree call.
+	Matched [][]byte
 }
 
 // NewTree initializes a new merkle tree.
@@ -54,9 +59,17 @@ func (tree *Tree) String() string {
 }
 
 // PopulateTree populates the tree.
+// flagBits holds one flag per byte, see BytesToBitField for the wire format.
 func (tree *Tree) PopulateTree(flagBits []byte, hashes [][]byte) error {
+	tree.Matched = nil
 	for len(tree.Root()) == 0 {
 		if tree.isLeaf() {
+			if len(flagBits) == 0 || len(hashes) == 0 {
+				return errPartialTreeOverflow
+			}
+			if flagBits[0] != 0 {
+				tree.Matched = append(tree.Matched, hashes[0])
+			}
 			flagBits = flagBits[1:]
 			tree.setCurrentNode(hashes[0])
 			hashes = hashes[1:]
@@ -65,9 +78,15 @@ func (tree *Tree) PopulateTree(flagBits []byte, hashes [][]byte) error {
 		}
 		leftHash := tree.getLeftNode()
 		if len(leftHash) == 0 {
+			if len(flagBits) == 0 {
+				return errPartialTreeOverflow
+			}
 			flagBit := flagBits[0]
 			flagBits = flagBits[1:]
 			if flagBit == 0 {
+				if len(hashes) == 0 {
+					return errPartialTreeOverflow
+				}
 				tree.setCurrentNode(hashes[0])
 				hashes = hashes[1:]
 				tree.up()
@@ -79,6 +98,11 @@ func (tree *Tree) PopulateTree(flagBits []byte, hashes [][]byte) error {
 			if len(rightHash) == 0 {
 				tree.right()
 			} else {
+				// Identical siblings would let a proof for a mutated
+				// transaction list pass, see CVE-2012-2459.
+				if bytes.Equal(leftHash, rightHash) {
+					return errors.New("identical left and right hashes")
+				}
 				tree.setCurrentNode(utils.MerkleParent(leftHash, rightHash))
 				tree.up()
 			}
@@ -3,6 +3,8 @@ package utils
 import (
 	"crypto/sha256"
 	"encoding/binary"
+	"encoding/hex"
+	"io"
 )
 
 type Hash256 []byte
@@ -19,22 +21,26 @@ func DoubleSha256(data []byte) []byte {
 func Varint(n uint64) []byte {
 	if n > 4294967295 {
 		val := make([]byte, 8)
-		binary.BigEndian.PutUint64(val, n)
+		binary.LittleEndian.PutUint64(val, n)
 		return append([]byte{0xFF}, val...)
 	} else if n > 65535 {
 		val := make([]byte, 4)
-		binary.BigEndian.PutUint32(val, uint32(n))
+		binary.LittleEndian.PutUint32(val, uint32(n))
 		return append([]byte{0xFE}, val...)
-	} else if n > 255 {
+	} else if n >= 0xFD {
 		val := make([]byte, 2)
-		binary.BigEndian.PutUint16(val, uint16(n))
+		binary.LittleEndian.PutUint16(val, uint16(n))
 		return append([]byte{0xFD}, val...)
 	} else {
 		return []byte{byte(n)}
 	}
 }
+
 func MerkleParent(hash1, hash2 []byte) []byte {
-	return Hash256(append(hash1, hash2...))
+	data := make([]byte, 0, len(hash1)+len(hash2))
+	data = append(data, hash1...)
+	data = append(data, hash2...)
+	return DoubleSha256(data)
 }
 
 func ReverseByteArray(arr []byte) []byte {
@@ -44,3 +50,38 @@ func ReverseByteArray(arr []byte) []byte {
 	}
 	return arr
 }
+
+// HashString returns hash, in internal byte order, as hex in the reversed
+// order block explorers and RPCs display. Unlike ReverseByteArray it leaves
+// hash untouched.
+func HashString(hash []byte) string {
+	reversed := make([]byte, len(hash))
+	for i := range hash {
+		reversed[len(hash)-1-i] = hash[i]
+	}
+	return hex.EncodeToString(reversed)
+}
+
+// ReadVarint reads a Bitcoin compact size integer.
+func ReadVarint(reader io.Reader) (uint64, error) {
+	prefix := make([]byte, 1)
+	if _, err := io.ReadFull(reader, prefix); err != nil {
+		return 0, err
+	}
+	var size int
+	switch prefix[0] {
+	case 0xFD:
+		size = 2
+	case 0xFE:
+		size = 4
+	case 0xFF:
+		size = 8
+	default:
+		return uint64(prefix[0]), nil
+	}
+	buf := make([]byte, 8)
+	if _, err := io.ReadFull(reader, buf[:size]); err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(buf), nil
+}
@@ -0,0 +1,96 @@
+// Package utxo keeps the set of unspent transaction outputs, connecting and
+// disconnecting blocks with undo data so that reorgs restore it exactly.
+package utxo
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	utils "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+)
+
+var ErrBadCoinEncoding = errors.New("malformed coin record")
+
+// OutPoint identifies a transaction output. TxId is in internal byte order.
+type OutPoint struct {
+	TxId  [32]byte
+	Index uint32
+}
+
+// NewOutPoint returns the outpoint of output index of the transaction txid.
+func NewOutPoint(txid []byte, index uint32) OutPoint {
+	result := OutPoint{Index: index}
+	copy(result.TxId[:], txid)
+	return result
+}
+
+// Serialize returns the wire encoding of the outpoint.
+func (outPoint OutPoint) Serialize() []byte {
+	return binary.LittleEndian.AppendUint32(append([]byte{}, outPoint.TxId[:]...), outPoint.Index)
+}
+
+// Coin is an unspent output along with the height and kind of transaction
+// that created it.
+type Coin struct {
+	Amount   int64
+	Script   []byte
+	Height   int32
+	Coinbase bool
+}
+
+// heightAndCoinbase packs the height and coinbase flag as Bitcoin Core does.
+func (coin *Coin) heightAndCoinbase() uint32 {
+	code := uint32(coin.Height) << 1
+	if coin.Coinbase {
+		code |= 1
+	}
+	return code
+}
+
+// Serialize returns the coin as stored: the packed height and coinbase flag
+// followed by the output.
+func (coin *Coin) Serialize() []byte {
+	result := utils.Varint(uint64(coin.heightAndCoinbase()))
+	return append(result, transactions.TxOutput{Amount: coin.Amount, Script: coin.Script}.Binary()...)
+}
+
+// ParseCoin decodes a coin written by Serialize.
+func ParseCoin(reader *bytes.Reader) (*Coin, error) {
+	code, err := utils.ReadVarint(reader)
+	if err != nil || code > 0xffffffff {
+		return nil, ErrBadCoinEncoding
+	}
+	amount := make([]byte, 8)
+	if _, err := io.ReadFull(reader, amount); err != nil {
+		return nil, ErrBadCoinEncoding
+	}
+	length, err := utils.ReadVarint(reader)
+	if err != nil || length > uint64(reader.Len()) {
+		return nil, ErrBadCoinEncoding
+	}
+	script := make([]byte, length)
+	reader.Read(script)
+	return &Coin{
+		Amount:   int64(binary.LittleEndian.Uint64(amount)),
+		Script:   script,
+		Height:   int32(code >> 1),
+		Coinbase: code&1 == 1,
+	}, nil
+}
+
+// txOutSer is the serialization of an outpoint and its coin hashed by
+// gettxoutsetinfo, both for hash_serialized_3 and for muhash.
+func txOutSer(outPoint OutPoint, coin *Coin) []byte {
+	result := outPoint.Serialize()
+	result = binary.LittleEndian.AppendUint32(result, coin.heightAndCoinbase())
+	return append(result, transactions.TxOutput{Amount: coin.Amount, Script: coin.Script}.Binary()...)
+}
+
+// IsUnspendable reports whether an output script can never be spent and so
+// is left out of the set: OP_RETURN outputs and oversized scripts.
+func IsUnspendable(script []byte) bool {
+	return (len(script) > 0 && script[0] == transactions.OP_RETURN) || len(script) > transactions.MaxScriptSize
+}
@@ -0,0 +1,4 @@
+package utxo
+
+// UndoKey exposes undoKey to the external tests.
+var UndoKey = undoKey
@@ -0,0 +1,104 @@
+package utxo
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/big"
+	"math/bits"
+)
+
+// muHashSize is the size in bytes of a MuHash3072 group element.
+const muHashSize = 384
+
+// muHashPrime is 2^3072 - 1103717, the modulus of MuHash3072.
+var muHashPrime = new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 3072), big.NewInt(1103717))
+
+// MuHash is the rolling set hash Bitcoin Core reports as muhash in
+// gettxoutsetinfo. Elements can be added and removed in any order; the hash
+// only depends on the resulting set.
+type MuHash struct {
+	numerator   *big.Int
+	denominator *big.Int
+}
+
+func NewMuHash() *MuHash {
+	return &MuHash{numerator: big.NewInt(1), denominator: big.NewInt(1)}
+}
+
+// toNum3072 maps data to a group element: the ChaCha20 keystream keyed by
+// its SHA256, read as a little endian number.
+func toNum3072(data []byte) *big.Int {
+	key := sha256.Sum256(data)
+	stream := chacha20Keystream(key, muHashSize)
+	reverse(stream)
+	return new(big.Int).SetBytes(stream)
+}
+
+func reverse(data []byte) {
+	for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+		data[i], data[j] = data[j], data[i]
+	}
+}
+
+// Insert adds data to the set.
+func (hash *MuHash) Insert(data []byte) {
+	hash.numerator.Mul(hash.numerator, toNum3072(data))
+	hash.numerator.Mod(hash.numerator, muHashPrime)
+}
+
+// Remove takes data out of the set.
+func (hash *MuHash) Remove(data []byte) {
+	hash.denominator.Mul(hash.denominator, toNum3072(data))
+	hash.denominator.Mod(hash.denominator, muHashPrime)
+}
+
+// Finalize returns the SHA256 of the set's group element in little endian
+// form, in internal byte order.
+func (hash *MuHash) Finalize() []byte {
+	inverse := new(big.Int).ModInverse(hash.denominator, muHashPrime)
+	value := new(big.Int).Mul(hash.numerator, inverse)
+	value.Mod(value, muHashPrime)
+	data := value.FillBytes(make([]byte, muHashSize))
+	reverse(data)
+	sum := sha256.Sum256(data)
+	return sum[:]
+}
+
+// chacha20Keystream returns length bytes of the ChaCha20 keystream for key
+// with a zero nonce, starting at block 0.
+func chacha20Keystream(key [32]byte, length int) []byte {
+	var state [16]uint32
+	state[0], state[1], state[2], state[3] = 0x61707865, 0x3320646e, 0x79622d32, 0x6b206574
+	for i := 0; i < 8; i++ {
+		state[4+i] = binary.LittleEndian.Uint32(key[4*i:])
+	}
+	result := make([]byte, 0, length+64)
+	for counter := uint32(0); len(result) < length; counter++ {
+		state[12] = counter
+		x := state
+		quarter := func(a, b, c, d int) {
+			x[a] += x[b]
+			x[d] = bits.RotateLeft32(x[d]^x[a], 16)
+			x[c] += x[d]
+			x[b] = bits.RotateLeft32(x[b]^x[c], 12)
+			x[a] += x[b]
+			x[d] = bits.RotateLeft32(x[d]^x[a], 8)
+			x[c] += x[d]
+			x[b] = bits.RotateLeft32(x[b]^x[c], 7)
+		}
+		for round := 0; round < 10; round++ {
+			quarter(0, 4, 8, 12)
+			quarter(1, 5, 9, 13)
+			quarter(2, 6, 10, 14)
+			quarter(3, 7, 11, 15)
+			quarter(0, 5, 10, 15)
+			quarter(1, 6, 11, 12)
+			quarter(2, 7, 8, 13)
+			quarter(3, 4, 9, 14)
+		}
+		for i := range x {
+			result = binary.LittleEndian.AppendUint32(result, x[i]+state[i])
+		}
+	}
+	return result[:length]
+}
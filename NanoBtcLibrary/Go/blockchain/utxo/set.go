@@ -0,0 +1,420 @@
+package utxo
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	blockindex "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/blockindex"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	utils "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+)
+
+// DefaultMaxCacheEntries is the number of cached entries past which the set
+// flushes itself after connecting or disconnecting a block.
+const DefaultMaxCacheEntries = 200000
+
+// Key prefixes in the store.
+var (
+	coinPrefix = []byte{'C'}
+	undoPrefix = []byte{'u'}
+	bestKey    = []byte{'B'}
+)
+
+var (
+	ErrCoinNotFound    = errors.New("coin not found")
+	ErrMissingInput    = errors.New("input spends a missing or spent coin")
+	ErrNotBestBlock    = errors.New("block does not connect to the best block")
+	ErrWrongHeight     = errors.New("block height does not follow the best block")
+	ErrMissingUndo     = errors.New("no undo data for block")
+	ErrUndoMismatch    = errors.New("undo data does not match block")
+	ErrBadBestEncoding = errors.New("malformed best block record")
+)
+
+func coinKey(outPoint OutPoint) []byte {
+	key := append(append([]byte{}, coinPrefix...), outPoint.TxId[:]...)
+	return binary.BigEndian.AppendUint32(key, outPoint.Index)
+}
+
+func undoKey(hash []byte) []byte {
+	return append(append([]byte{}, undoPrefix...), hash...)
+}
+
+// cacheEntry is a cached coin. A nil coin is spent. Dirty entries differ
+// from the store; fresh entries are known to be absent from it, so spending
+// them before a flush never touches the store.
+type cacheEntry struct {
+	coin  *Coin
+	dirty bool
+	fresh bool
+}
+
+// Set is the UTXO set: a write-back cache of coins over a store, along with
+// the block the set is current as of.
+type Set struct {
+	// MaxCacheEntries is the flush threshold; zero or less disables
+	// automatic flushing.
+	MaxCacheEntries int
+
+	store       blockindex.Store
+	cache       map[OutPoint]*cacheEntry
+	undoDeletes [][]byte
+	best        []byte
+	height      int32
+}
+
+// Open returns the set persisted in store, or an empty set at the genesis
+// block genesisHash if the store is new. Genesis outputs are unspendable and
+// never enter the set.
+func Open(store blockindex.Store, genesisHash []byte) (*Set, error) {
+	set := &Set{
+		MaxCacheEntries: DefaultMaxCacheEntries,
+		store:           store,
+		cache:           make(map[OutPoint]*cacheEntry),
+		best:            genesisHash,
+	}
+	bin, err := store.Get(bestKey)
+	if errors.Is(err, blockindex.ErrNotFound) {
+		return set, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(bin) != 36 {
+		return nil, ErrBadBestEncoding
+	}
+	set.best = bin[:32]
+	set.height = int32(binary.LittleEndian.Uint32(bin[32:]))
+	return set, nil
+}
+
+// BestBlock returns the hash and height of the block the set reflects.
+func (set *Set) BestBlock() ([]byte, int32) {
+	return set.best, set.height
+}
+
+// fetch returns the entry for outPoint, loading it from the store into the
+// cache. It returns nil if the store has no such coin.
+func (set *Set) fetch(outPoint OutPoint) (*cacheEntry, error) {
+	if entry, ok := set.cache[outPoint]; ok {
+		return entry, nil
+	}
+	bin, err := set.store.Get(coinKey(outPoint))
+	if errors.Is(err, blockindex.ErrNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	coin, err := ParseCoin(bytes.NewReader(bin))
+	if err != nil {
+		return nil, err
+	}
+	entry := &cacheEntry{coin: coin}
+	set.cache[outPoint] = entry
+	return entry, nil
+}
+
+// GetCoin returns the unspent coin at outPoint, or ErrCoinNotFound.
+func (set *Set) GetCoin(outPoint OutPoint) (*Coin, error) {
+	entry, err := set.fetch(outPoint)
+	if err != nil {
+		return nil, err
+	}
+	if entry == nil || entry.coin == nil {
+		return nil, ErrCoinNotFound
+	}
+	return entry.coin, nil
+}
+
+func (set *Set) addCoin(outPoint OutPoint, coin *Coin, possibleOverwrite bool) {
+	entry, ok := set.cache[outPoint]
+	if !ok {
+		entry = &cacheEntry{fresh: !possibleOverwrite}
+		set.cache[outPoint] = entry
+	} else if entry.coin == nil && !entry.dirty && !possibleOverwrite {
+		entry.fresh = true
+	}
+	entry.coin = coin
+	entry.dirty = true
+}
+
+func (set *Set) spendCoin(outPoint OutPoint) {
+	entry := set.cache[outPoint]
+	if entry.fresh {
+		delete(set.cache, outPoint)
+		return
+	}
+	entry.coin = nil
+	entry.dirty = true
+}
+
+// view collects a block's changes before they are applied, so that a block
+// that fails part way leaves the set untouched. A nil coin is spent.
+type view struct {
+	set     *Set
+	changes map[OutPoint]*Coin
+	order   []OutPoint
+}
+
+func (v *view) get(outPoint OutPoint) (*Coin, error) {
+	if coin, ok := v.changes[outPoint]; ok {
+		return coin, nil
+	}
+	entry, err := v.set.fetch(outPoint)
+	if err != nil || entry == nil {
+		return nil, err
+	}
+	return entry.coin, nil
+}
+
+func (v *view) put(outPoint OutPoint, coin *Coin) {
+	if _, ok := v.changes[outPoint]; !ok {
+		v.order = append(v.order, outPoint)
+	}
+	v.changes[outPoint] = coin
+}
+
+func (set *Set) newView() *view {
+	return &view{set: set, changes: make(map[OutPoint]*Coin)}
+}
+
+// apply writes the view's changes into the cache.
+func (v *view) apply(coinbase map[OutPoint]bool) {
+	for _, outPoint := range v.order {
+		if coin := v.changes[outPoint]; coin != nil {
+			v.set.addCoin(outPoint, coin, coinbase[outPoint])
+		} else if _, ok := v.set.cache[outPoint]; ok {
+			v.set.spendCoin(outPoint)
+		}
+	}
+}
+
+// ConnectBlock applies block at height on top of the best block: its inputs
+// are spent, its spendable outputs added and the spent coins recorded as
+// undo data. On error the set is left unchanged.
+func (set *Set) ConnectBlock(block *blockchain.Block, height int32) error {
+	if !bytes.Equal(block.HashPrev, set.best) {
+		return ErrNotBestBlock
+	}
+	if height != set.height+1 {
+		return fmt.Errorf("%w: got %d after %d", ErrWrongHeight, height, set.height)
+	}
+	v := set.newView()
+	coinbase := make(map[OutPoint]bool)
+	undo := &BlockUndo{Spent: make([][]*Coin, 0, len(block.Transactions))}
+	for i, tx := range block.Transactions {
+		txid := transactions.GenerateTransactionId(tx)
+		if i > 0 {
+			spent := make([]*Coin, len(tx.Input))
+			for j, in := range tx.Input {
+				outPoint := NewOutPoint(in.Hash, in.Index)
+				coin, err := v.get(outPoint)
+				if err != nil {
+					return err
+				}
+				if coin == nil {
+					return fmt.Errorf("%w: %s:%d", ErrMissingInput, utils.HashString(outPoint.TxId[:]), outPoint.Index)
+				}
+				spent[j] = coin
+				v.put(outPoint, nil)
+			}
+			undo.Spent = append(undo.Spent, spent)
+		}
+		for j, out := range tx.Output {
+			if IsUnspendable(out.Script) {
+				continue
+			}
+			outPoint := NewOutPoint(txid, uint32(j))
+			// Duplicate coinbases could overwrite an existing coin before
+			// BIP30 and BIP34, so theirs are never known to be fresh.
+			coinbase[outPoint] = i == 0
+			v.put(outPoint, &Coin{Amount: out.Amount, Script: out.Script, Height: height, Coinbase: i == 0})
+		}
+	}
+	hash := block.HashBlock()
+	if err := set.store.Put(undoKey(hash), undo.Serialize()); err != nil {
+		return err
+	}
+	set.keepUndo(hash)
+	v.apply(coinbase)
+	set.best = hash
+	set.height = height
+	return set.maybeFlush()
+}
+
+// BlockUndo returns the undo data written when the block hash was
+// connected, listing the coins it spent.
+func (set *Set) BlockUndo(hash []byte) (*BlockUndo, error) {
+	if slices.ContainsFunc(set.undoDeletes, func(key []byte) bool { return bytes.Equal(key, undoKey(hash)) }) {
+		return nil, ErrMissingUndo
+	}
+	bin, err := set.store.Get(undoKey(hash))
+	if errors.Is(err, blockindex.ErrNotFound) {
+		return nil, ErrMissingUndo
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ParseBlockUndo(bytes.NewReader(bin))
+}
+
+// DisconnectBlock reverts block, which must be the best block, using the
+// undo data written when it was connected. On error the set is left
+// unchanged.
+func (set *Set) DisconnectBlock(block *blockchain.Block) error {
+	hash := block.HashBlock()
+	if !bytes.Equal(hash, set.best) {
+		return ErrNotBestBlock
+	}
+	undo, err := set.BlockUndo(hash)
+	if err != nil {
+		return err
+	}
+	if len(block.Transactions) == 0 || len(undo.Spent) != len(block.Transactions)-1 {
+		return ErrUndoMismatch
+	}
+	v := set.newView()
+	for i := len(block.Transactions) - 1; i >= 0; i-- {
+		tx := block.Transactions[i]
+		txid := transactions.GenerateTransactionId(tx)
+		for j := len(tx.Output) - 1; j >= 0; j-- {
+			if IsUnspendable(tx.Output[j].Script) {
+				continue
+			}
+			outPoint := NewOutPoint(txid, uint32(j))
+			coin, err := v.get(outPoint)
+			if err != nil {
+				return err
+			}
+			if coin == nil {
+				return fmt.Errorf("%w: output %s:%d is not in the set", ErrUndoMismatch, utils.HashString(txid), j)
+			}
+			v.put(outPoint, nil)
+		}
+		if i == 0 {
+			continue
+		}
+		spent := undo.Spent[i-1]
+		if len(spent) != len(tx.Input) {
+			return ErrUndoMismatch
+		}
+		for j := len(tx.Input) - 1; j >= 0; j-- {
+			v.put(NewOutPoint(tx.Input[j].Hash, tx.Input[j].Index), spent[j])
+		}
+	}
+	// Restored coins may exist in the store, so none of them are fresh.
+	restored := make(map[OutPoint]bool, len(v.order))
+	for _, outPoint := range v.order {
+		restored[outPoint] = true
+	}
+	v.apply(restored)
+	set.undoDeletes = append(set.undoDeletes, undoKey(hash))
+	set.best = block.HashPrev
+	set.height--
+	return set.maybeFlush()
+}
+
+// keepUndo cancels the pending deletion of the undo data of a block that is
+// connected again before the set is flushed.
+func (set *Set) keepUndo(hash []byte) {
+	key := undoKey(hash)
+	set.undoDeletes = slices.DeleteFunc(set.undoDeletes, func(pending []byte) bool { return bytes.Equal(pending, key) })
+}
+
+func (set *Set) maybeFlush() error {
+	if set.MaxCacheEntries > 0 && len(set.cache) > set.MaxCacheEntries {
+		return set.Flush()
+	}
+	return nil
+}
+
+// CacheSize returns the number of cached entries.
+func (set *Set) CacheSize() int {
+	return len(set.cache)
+}
+
+// Flush writes the dirty coins and the best block to the store, syncs it
+// and empties the cache.
+func (set *Set) Flush() error {
+	for outPoint, entry := range set.cache {
+		if !entry.dirty {
+			continue
+		}
+		var err error
+		if entry.coin == nil {
+			err = set.store.Delete(coinKey(outPoint))
+		} else {
+			err = set.store.Put(coinKey(outPoint), entry.coin.Serialize())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for _, key := range set.undoDeletes {
+		if err := set.store.Delete(key); err != nil {
+			return err
+		}
+	}
+	best := binary.LittleEndian.AppendUint32(append([]byte{}, set.best...), uint32(set.height))
+	if err := set.store.Put(bestKey, best); err != nil {
+		return err
+	}
+	if err := set.store.Sync(); err != nil {
+		return err
+	}
+	set.cache = make(map[OutPoint]*cacheEntry)
+	set.undoDeletes = nil
+	return nil
+}
+
+// TxOutSetInfo mirrors the fields of bitcoind's gettxoutsetinfo. Hashes are
+// in internal byte order; reverse them to compare with bitcoind's output.
+type TxOutSetInfo struct {
+	Height      int32
+	BestBlock   []byte
+	TxOuts      uint64
+	TotalAmount int64
+	// HashSerialized is hash_serialized_3, the double SHA256 of every coin
+	// in outpoint order.
+	HashSerialized []byte
+	// MuHash is the MuHash3072 of the set.
+	MuHash []byte
+}
+
+// TxOutSetInfo flushes the set and computes its statistics and hashes.
+func (set *Set) TxOutSetInfo() (*TxOutSetInfo, error) {
+	if err := set.Flush(); err != nil {
+		return nil, err
+	}
+	info := &TxOutSetInfo{Height: set.height, BestBlock: set.best}
+	hasher := sha256.New()
+	muHash := NewMuHash()
+	err := set.store.ForEach(coinPrefix, func(key, value []byte) error {
+		if len(key) != len(coinPrefix)+36 {
+			return ErrBadCoinEncoding
+		}
+		outPoint := NewOutPoint(key[len(coinPrefix):len(coinPrefix)+32], binary.BigEndian.Uint32(key[len(coinPrefix)+32:]))
+		coin, err := ParseCoin(bytes.NewReader(value))
+		if err != nil {
+			return err
+		}
+		data := txOutSer(outPoint, coin)
+		hasher.Write(data)
+		muHash.Insert(data)
+		info.TxOuts++
+		info.TotalAmount += coin.Amount
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(hasher.Sum(nil))
+	info.HashSerialized = sum[:]
+	info.MuHash = muHash.Finalize()
+	return info, nil
+}
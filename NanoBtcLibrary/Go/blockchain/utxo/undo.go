@@ -0,0 +1,53 @@
+package utxo
+
+import (
+	"bytes"
+	"errors"
+
+	utils "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+)
+
+var ErrBadUndoEncoding = errors.New("malformed block undo data")
+
+// BlockUndo holds the coins a block spent, so that disconnecting it can put
+// them back. Spent has one entry per transaction after the coinbase, each
+// listing the coins of its inputs in input order.
+type BlockUndo struct {
+	Spent [][]*Coin
+}
+
+func (undo *BlockUndo) Serialize() []byte {
+	result := utils.Varint(uint64(len(undo.Spent)))
+	for _, coins := range undo.Spent {
+		result = append(result, utils.Varint(uint64(len(coins)))...)
+		for _, coin := range coins {
+			result = append(result, coin.Serialize()...)
+		}
+	}
+	return result
+}
+
+// ParseBlockUndo decodes undo data written by Serialize.
+func ParseBlockUndo(reader *bytes.Reader) (*BlockUndo, error) {
+	txCount, err := utils.ReadVarint(reader)
+	if err != nil || txCount > uint64(reader.Len()) {
+		return nil, ErrBadUndoEncoding
+	}
+	undo := &BlockUndo{Spent: make([][]*Coin, txCount)}
+	for i := range undo.Spent {
+		coinCount, err := utils.ReadVarint(reader)
+		if err != nil || coinCount > uint64(reader.Len()) {
+			return nil, ErrBadUndoEncoding
+		}
+		undo.Spent[i] = make([]*Coin, coinCount)
+		for j := range undo.Spent[i] {
+			if undo.Spent[i][j], err = ParseCoin(reader); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if reader.Len() != 0 {
+		return nil, ErrBadUndoEncoding
+	}
+	return undo, nil
+}
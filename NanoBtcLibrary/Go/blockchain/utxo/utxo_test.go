@@ -0,0 +1,130 @@
+package utxo_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	blockindex "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/blockindex"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	utils "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+	utxo "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utxo"
+	regtesttest "github.com/Btcercises/NanoBtcLibrary/Go/internal/regtesttest"
+	regtest "github.com/Btcercises/NanoBtcLibrary/Go/regtest"
+)
+
+// TestMuHash checks Bitcoin Core's muhash vector: {0} * {1} / {2}.
+func TestMuHash(t *testing.T) {
+	element := func(i byte) []byte {
+		data := make([]byte, 32)
+		data[0] = i
+		return data
+	}
+	hash := utxo.NewMuHash()
+	hash.Insert(element(0))
+	hash.Insert(element(1))
+	hash.Remove(element(2))
+	want := "10d312b100cbd32ada024a6646e40d3482fcff103668d2625f10002a607d5863"
+	if got := hex.EncodeToString(utils.ReverseByteArray(hash.Finalize())); got != want {
+		t.Fatalf("muhash %s", got)
+	}
+}
+
+func TestConnectDisconnect(t *testing.T) {
+	fixture, err := regtesttest.NewSpendFixture(func(amount int64) []transactions.TxOutput {
+		return []transactions.TxOutput{
+			{Amount: amount - 1000, Script: regtesttest.TrueScript},
+			{Amount: 0, Script: []byte{transactions.OP_RETURN}},
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks, spend := fixture.Blocks, fixture.Spend
+
+	store := blockindex.NewMemoryStore()
+	set, err := utxo.Open(store, regtest.GenesisBlock().HashBlock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	set.MaxCacheEntries = 10
+	var before *utxo.TxOutSetInfo
+	for i, block := range blocks {
+		if i == len(blocks)-1 {
+			if before, err = set.TxOutSetInfo(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := set.ConnectBlock(block, int32(i+1)); err != nil {
+			t.Fatalf("block %d: %v", i+1, err)
+		}
+	}
+	if err := set.ConnectBlock(blocks[len(blocks)-1], int32(len(blocks)+1)); err != utxo.ErrNotBestBlock {
+		t.Fatalf("reconnecting the tip gave %v", err)
+	}
+
+	spendId := transactions.GenerateTransactionId(spend)
+	if _, err := set.GetCoin(utxo.NewOutPoint(spendId, 1)); err != utxo.ErrCoinNotFound {
+		t.Fatal("OP_RETURN output entered the set")
+	}
+	if _, err := set.GetCoin(utxo.NewOutPoint(spend.Input[0].Hash, 0)); err != utxo.ErrCoinNotFound {
+		t.Fatal("spent coinbase still in the set")
+	}
+	after, err := set.TxOutSetInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.TxOuts != before.TxOuts+1 || after.TotalAmount != before.TotalAmount+regtest.CalcBlockSubsidy(after.Height) {
+		t.Fatalf("%d outputs worth %d after spending", after.TxOuts, after.TotalAmount)
+	}
+
+	// Reopening the store must give the same set.
+	reopened, err := utxo.Open(store, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := reopened.TxOutSetInfo(); err != nil || !bytes.Equal(info.MuHash, after.MuHash) || info.Height != after.Height {
+		t.Fatalf("reopened set differs: %v", err)
+	}
+
+	if err := reopened.DisconnectBlock(blocks[len(blocks)-1]); err != nil {
+		t.Fatal(err)
+	}
+	coin, err := reopened.GetCoin(utxo.NewOutPoint(spend.Input[0].Hash, 0))
+	if err != nil || !coin.Coinbase || coin.Height != 1 {
+		t.Fatalf("coinbase not restored: %v", err)
+	}
+	restored, err := reopened.TxOutSetInfo()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(restored.HashSerialized, before.HashSerialized) || !bytes.Equal(restored.MuHash, before.MuHash) ||
+		!bytes.Equal(restored.BestBlock, before.BestBlock) || restored.TxOuts != before.TxOuts {
+		t.Fatal("disconnecting did not restore the set")
+	}
+	if _, err := store.Get(utxo.UndoKey(blocks[len(blocks)-1].HashBlock())); err != blockindex.ErrNotFound {
+		t.Fatal("undo data left after disconnect")
+	}
+
+	// Reconnecting a block before a flush must keep its fresh undo data.
+	tip := blocks[len(blocks)-1]
+	if err := reopened.ConnectBlock(tip, after.Height+1); !errors.Is(err, utxo.ErrWrongHeight) {
+		t.Fatalf("connecting the tip at the wrong height gave %v", err)
+	}
+	if err := reopened.ConnectBlock(tip, after.Height); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.DisconnectBlock(tip); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.ConnectBlock(tip, after.Height); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := reopened.DisconnectBlock(tip); err != nil {
+		t.Fatalf("disconnecting a reconnected block: %v", err)
+	}
+}
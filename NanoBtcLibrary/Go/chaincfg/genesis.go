@@ -0,0 +1,86 @@
+package chaincfg
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+)
+
+const (
+	mainGenesisMessage     = "The Times 03/Jan/2009 Chancellor on brink of second bailout for banks"
+	mainGenesisPubKey      = "04678afdb0fe5548271967f1a67130b7105cd6a828e03909a67962e0ea1f61deb649f6bc3f4cef38c4f35504e51ec112de5c384df7ba0b8d578a4c702b6bf11d5f"
+	testNet4Message        = "03/May/2024 000000000000000000001ebd58c244970b3aa9d783bb001011fbe8ea8e98e00e"
+	testNet4PubKey         = "000000000000000000000000000000000000000000000000000000000000000000"
+	defaultSignetChallenge = "512103ad5e0edad18cb1f0fc0d28a3d4f1f3e445640337489abb10404f2d1e086be430210359ef5021964fe22d6f8e05b2463c9540ce96883fe3b278760f048f5189f2e6c452ae"
+	genesisReward          = 50 * 100000000
+	genesisVersion         = 1
+	genesisCoinbaseBits    = 0x1d00ffff
+)
+
+func mustDecodeHex(str string) []byte {
+	result, err := hex.DecodeString(str)
+	if err != nil {
+		panic(err)
+	}
+	return result
+}
+
+// hashFromHex decodes a hash written in the usual reversed display order into
+// internal byte order.
+func hashFromHex(str string) []byte {
+	hash := mustDecodeHex(str)
+	for i, j := 0, len(hash)-1; i < j; i, j = i+1, j-1 {
+		hash[i], hash[j] = hash[j], hash[i]
+	}
+	return hash
+}
+
+func doubleSha256(data []byte) []byte {
+	first := sha256.Sum256(data)
+	second := sha256.Sum256(first[:])
+	return second[:]
+}
+
+// pushData returns the script fragment pushing data of up to 255 bytes.
+func pushData(data []byte) []byte {
+	if len(data) < 0x4c {
+		return append([]byte{byte(len(data))}, data...)
+	}
+	return append([]byte{0x4c, byte(len(data))}, data...)
+}
+
+// genesisCoinbase serializes a coinbase in the form used by every Bitcoin
+// Core genesis block: the bits 0x1d00ffff, the number 4 and a message in its
+// script, and the reward paid to pubKey with OP_CHECKSIG.
+func genesisCoinbase(message string, pubKey []byte) []byte {
+	scriptSig := pushData(binary.LittleEndian.AppendUint32(nil, genesisCoinbaseBits))
+	scriptSig = append(scriptSig, pushData([]byte{4})...)
+	scriptSig = append(scriptSig, pushData([]byte(message))...)
+	scriptPubKey := append(pushData(pubKey), 0xac)
+
+	tx := binary.LittleEndian.AppendUint32(nil, 1)
+	tx = append(tx, 1)
+	tx = append(tx, make([]byte, 32)...)
+	tx = binary.LittleEndian.AppendUint32(tx, 0xffffffff)
+	tx = append(tx, byte(len(scriptSig)))
+	tx = append(tx, scriptSig...)
+	tx = binary.LittleEndian.AppendUint32(tx, 0xffffffff)
+	tx = append(tx, 1)
+	tx = binary.LittleEndian.AppendUint64(tx, genesisReward)
+	tx = append(tx, byte(len(scriptPubKey)))
+	tx = append(tx, scriptPubKey...)
+	return binary.LittleEndian.AppendUint32(tx, 0)
+}
+
+// genesisBlock serializes a block holding only coinbase and returns it along
+// with its hash.
+func genesisBlock(coinbase []byte, timestamp, bits, nonce uint32) ([]byte, []byte) {
+	header := binary.LittleEndian.AppendUint32(nil, genesisVersion)
+	header = append(header, make([]byte, 32)...)
+	header = append(header, doubleSha256(coinbase)...)
+	header = binary.LittleEndian.AppendUint32(header, timestamp)
+	header = binary.LittleEndian.AppendUint32(header, bits)
+	header = binary.LittleEndian.AppendUint32(header, nonce)
+	block := append(append(append([]byte{}, header...), 1), coinbase...)
+	return block, doubleSha256(header)
+}
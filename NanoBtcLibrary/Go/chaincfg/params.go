@@ -0,0 +1,308 @@
+// Package chaincfg defines the parameters identifying each Bitcoin network.
+// It only depends on the difficulty package so that every other package can
+// take a *ChainParams instead of a testnet flag.
+package chaincfg
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+
+	difficulty "github.com/Btcercises/NanoBtcLibrary/Go/consensus/difficulty"
+)
+
+var ErrUnknownNetwork = errors.New("unknown network")
+
+// Checkpoint pins the hash, in internal byte order, of the block at Height.
+type Checkpoint struct {
+	Height int32
+	Hash   []byte
+}
+
+// ChainParams holds everything that differs between networks.
+type ChainParams struct {
+	Name string
+	// Net is the message start, as a little endian number.
+	Net         uint32
+	DefaultPort int
+	DNSSeeds    []string
+
+	// GenesisBlock is the serialized genesis block and GenesisHash its hash
+	// in internal byte order.
+	GenesisBlock []byte
+	GenesisHash  []byte
+
+	Pow                    *difficulty.Params
+	SubsidyHalvingInterval int32
+	CoinbaseMaturity       int32
+	Checkpoints            []Checkpoint
+
+	// Heights from which soft forks are enforced, as buried in Bitcoin Core.
+	// A negative height means the deployment is not buried on the network.
+	BIP34Height   int32
+	BIP65Height   int32
+	BIP66Height   int32
+	CSVHeight     int32
+	SegwitHeight  int32
+	TaprootHeight int32
+
+	// Address encoding.
+	PubKeyHashAddrId byte
+	ScriptHashAddrId byte
+	PrivateKeyId     byte
+	Bech32HRP        string
+
+	// BIP32 extended key versions.
+	HDPrivateKeyId [4]byte
+	HDPublicKeyId  [4]byte
+
+	// SignetChallenge is the script every block solution must satisfy on a
+	// signet (BIP325). It is nil on other networks.
+	SignetChallenge []byte
+}
+
+// BlockSubsidy returns the new coins a block at height may create.
+func (params *ChainParams) BlockSubsidy(height int32) int64 {
+	halvings := height / params.SubsidyHalvingInterval
+	if halvings >= 64 {
+		return 0
+	}
+	return int64(genesisReward) >> uint(halvings)
+}
+
+// TotalSupply returns the most coins that can exist once the block at height
+// is mined: the sum of the subsidies of blocks 0 to height, including the
+// unspendable genesis reward.
+func (params *ChainParams) TotalSupply(height int32) int64 {
+	var total int64
+	for start := int32(0); start <= height; start += params.SubsidyHalvingInterval {
+		subsidy := params.BlockSubsidy(start)
+		if subsidy == 0 {
+			break
+		}
+		end := min(height, start+params.SubsidyHalvingInterval-1)
+		total += subsidy * int64(end-start+1)
+		if end == height || start > math.MaxInt32-params.SubsidyHalvingInterval {
+			break
+		}
+	}
+	return total
+}
+
+// MaxSupply returns the most coins that can ever exist on the network.
+func (params *ChainParams) MaxSupply() int64 {
+	return params.TotalSupply(math.MaxInt32)
+}
+
+var (
+	mainGenesisBlock, mainGenesisHash         = genesisBlock(genesisCoinbase(mainGenesisMessage, mustDecodeHex(mainGenesisPubKey)), 1231006505, 0x1d00ffff, 2083236893)
+	testNet3GenesisBlock, testNet3GenesisHash = genesisBlock(genesisCoinbase(mainGenesisMessage, mustDecodeHex(mainGenesisPubKey)), 1296688602, 0x1d00ffff, 414098458)
+	testNet4GenesisBlock, testNet4GenesisHash = genesisBlock(genesisCoinbase(testNet4Message, mustDecodeHex(testNet4PubKey)), 1714777860, 0x1d00ffff, 393743547)
+	sigNetGenesisBlock, sigNetGenesisHash     = genesisBlock(genesisCoinbase(mainGenesisMessage, mustDecodeHex(mainGenesisPubKey)), 1598918400, 0x1e0377ae, 52613770)
+	regTestGenesisBlock, regTestGenesisHash   = genesisBlock(genesisCoinbase(mainGenesisMessage, mustDecodeHex(mainGenesisPubKey)), 1296688602, 0x207fffff, 2)
+)
+
+var MainNetParams = ChainParams{
+	Name:        "main",
+	Net:         0xd9b4bef9,
+	DefaultPort: 8333,
+	DNSSeeds: []string{
+		"seed.bitcoin.sipa.be",
+		"dnsseed.bluematt.me",
+		"seed.bitcoinstats.com",
+		"seed.bitcoin.jonasschnelli.ch",
+		"seed.btc.petertodd.net",
+	},
+	GenesisBlock:           mainGenesisBlock,
+	GenesisHash:            mainGenesisHash,
+	Pow:                    &difficulty.MainNetParams,
+	SubsidyHalvingInterval: 210000,
+	CoinbaseMaturity:       100,
+	Checkpoints: []Checkpoint{
+		{11111, hashFromHex("0000000069e244f73d78e8fd29ba2fd2ed618bd6fa2ee92559f542fdb26e7c1d")},
+		{33333, hashFromHex("000000002dd5588a74784eaa7ab0507a18ad16a236e7b1ce69f00d7ddfb5d0a6")},
+		{74000, hashFromHex("0000000000573993a3c9e41ce34471c079dcf5f52a0e824a81e7f953b8661a20")},
+		{105000, hashFromHex("00000000000291ce28027faea320c8d2b054b2e0fe44a773f3eefb151d6bdc97")},
+		{134444, hashFromHex("00000000000005b12ffd4cd315cd34ffd4a594f430ac814c91184a0d42d2b0fe")},
+		{168000, hashFromHex("000000000000099e61ea72015e79632f216fe6cb33d7899acb35b75c8303b763")},
+		{193000, hashFromHex("000000000000059f452a5f7340de6682a977387c17010ff6e6c3bd83ca8b1317")},
+		{210000, hashFromHex("000000000000048b95347e83192f69cf0366076336c639f9b7228e9ba171342e")},
+		{216116, hashFromHex("00000000000001b4f4b433e81ee46494af945cf96014816a4e2370f11b23df4e")},
+		{225430, hashFromHex("00000000000001c108384350f74090433e7fcf79a606b8e797f065b130575932")},
+		{250000, hashFromHex("000000000000003887df1f29024b06fc2200b55f8af8f35453d7be294df2d214")},
+		{279000, hashFromHex("0000000000000001ae8c72a0b0c301f67e3afca10e819efa9041e458e9bd7e40")},
+		{295000, hashFromHex("00000000000000004d9b4ef50f0f9d686fd69db2e03af35a100370c64632a983")},
+	},
+	BIP34Height:      227931,
+	BIP65Height:      388381,
+	BIP66Height:      363725,
+	CSVHeight:        419328,
+	SegwitHeight:     481824,
+	TaprootHeight:    709632,
+	PubKeyHashAddrId: 0x00,
+	ScriptHashAddrId: 0x05,
+	PrivateKeyId:     0x80,
+	Bech32HRP:        "bc",
+	HDPrivateKeyId:   [4]byte{0x04, 0x88, 0xad, 0xe4},
+	HDPublicKeyId:    [4]byte{0x04, 0x88, 0xb2, 0x1e},
+}
+
+var TestNet3Params = ChainParams{
+	Name:        "test",
+	Net:         0x0709110b,
+	DefaultPort: 18333,
+	DNSSeeds: []string{
+		"testnet-seed.bitcoin.jonasschnelli.ch",
+		"seed.tbtc.petertodd.net",
+		"testnet-seed.bluematt.me",
+	},
+	GenesisBlock:           testNet3GenesisBlock,
+	GenesisHash:            testNet3GenesisHash,
+	Pow:                    &difficulty.TestNet3Params,
+	SubsidyHalvingInterval: 210000,
+	CoinbaseMaturity:       100,
+	Checkpoints: []Checkpoint{
+		{546, hashFromHex("000000002a936ca763904c3c35fce2f3556c559c0214345d31b1bcebf76acb70")},
+	},
+	BIP34Height:      21111,
+	BIP65Height:      581885,
+	BIP66Height:      330776,
+	CSVHeight:        770112,
+	SegwitHeight:     834624,
+	TaprootHeight:    -1,
+	PubKeyHashAddrId: 0x6f,
+	ScriptHashAddrId: 0xc4,
+	PrivateKeyId:     0xef,
+	Bech32HRP:        "tb",
+	HDPrivateKeyId:   [4]byte{0x04, 0x35, 0x83, 0x94},
+	HDPublicKeyId:    [4]byte{0x04, 0x35, 0x87, 0xcf},
+}
+
+var TestNet4Params = ChainParams{
+	Name:        "testnet4",
+	Net:         0x283f161c,
+	DefaultPort: 48333,
+	DNSSeeds: []string{
+		"seed.testnet4.bitcoin.sprovoost.nl",
+		"seed.testnet4.wiz.biz",
+	},
+	GenesisBlock:           testNet4GenesisBlock,
+	GenesisHash:            testNet4GenesisHash,
+	Pow:                    &difficulty.TestNet4Params,
+	SubsidyHalvingInterval: 210000,
+	CoinbaseMaturity:       100,
+	BIP34Height:            1,
+	BIP65Height:            1,
+	BIP66Height:            1,
+	CSVHeight:              1,
+	SegwitHeight:           1,
+	TaprootHeight:          1,
+	PubKeyHashAddrId:       0x6f,
+	ScriptHashAddrId:       0xc4,
+	PrivateKeyId:           0xef,
+	Bech32HRP:              "tb",
+	HDPrivateKeyId:         [4]byte{0x04, 0x35, 0x83, 0x94},
+	HDPublicKeyId:          [4]byte{0x04, 0x35, 0x87, 0xcf},
+}
+
+// SigNetParams are the parameters of the default signet. Custom signets
+// differ in their challenge and therefore their magic.
+var SigNetParams = ChainParams{
+	Name:        "signet",
+	Net:         0x40cf030a,
+	DefaultPort: 38333,
+	DNSSeeds: []string{
+		"seed.signet.bitcoin.sprovoost.nl",
+	},
+	GenesisBlock:           sigNetGenesisBlock,
+	GenesisHash:            sigNetGenesisHash,
+	Pow:                    &difficulty.SigNetParams,
+	SubsidyHalvingInterval: 210000,
+	CoinbaseMaturity:       100,
+	BIP34Height:            1,
+	BIP65Height:            1,
+	BIP66Height:            1,
+	CSVHeight:              1,
+	SegwitHeight:           1,
+	TaprootHeight:          0,
+	PubKeyHashAddrId:       0x6f,
+	ScriptHashAddrId:       0xc4,
+	PrivateKeyId:           0xef,
+	Bech32HRP:              "tb",
+	HDPrivateKeyId:         [4]byte{0x04, 0x35, 0x83, 0x94},
+	HDPublicKeyId:          [4]byte{0x04, 0x35, 0x87, 0xcf},
+	SignetChallenge:        mustDecodeHex(defaultSignetChallenge),
+}
+
+// CustomSigNetParams returns the parameters of a signet whose blocks must
+// satisfy challenge. Its message start is the first four bytes of the double
+// SHA256 of the serialized challenge; everything else matches the default
+// signet.
+func CustomSigNetParams(challenge []byte, seeds []string) *ChainParams {
+	params := SigNetParams
+	params.Name = "signet"
+	params.SignetChallenge = append([]byte{}, challenge...)
+	params.DNSSeeds = seeds
+	params.Net = signetMagic(challenge)
+	return &params
+}
+
+func signetMagic(challenge []byte) uint32 {
+	var data []byte
+	switch length := uint64(len(challenge)); {
+	case length < 0xfd:
+		data = []byte{byte(length)}
+	case length <= 0xffff:
+		data = binary.LittleEndian.AppendUint16([]byte{0xfd}, uint16(length))
+	default:
+		data = binary.LittleEndian.AppendUint32([]byte{0xfe}, uint32(length))
+	}
+	return binary.LittleEndian.Uint32(doubleSha256(append(data, challenge...)))
+}
+
+var RegTestParams = ChainParams{
+	Name:                   "regtest",
+	Net:                    0xdab5bffa,
+	DefaultPort:            18444,
+	GenesisBlock:           regTestGenesisBlock,
+	GenesisHash:            regTestGenesisHash,
+	Pow:                    &difficulty.RegTestParams,
+	SubsidyHalvingInterval: 150,
+	CoinbaseMaturity:       100,
+	BIP34Height:            1,
+	BIP65Height:            1,
+	BIP66Height:            1,
+	CSVHeight:              1,
+	SegwitHeight:           0,
+	TaprootHeight:          0,
+	PubKeyHashAddrId:       0x6f,
+	ScriptHashAddrId:       0xc4,
+	PrivateKeyId:           0xef,
+	Bech32HRP:              "bcrt",
+	HDPrivateKeyId:         [4]byte{0x04, 0x35, 0x83, 0x94},
+	HDPublicKeyId:          [4]byte{0x04, 0x35, 0x87, 0xcf},
+}
+
+// Networks lists the parameters of every known network.
+var Networks = []*ChainParams{&MainNetParams, &TestNet3Params, &TestNet4Params, &SigNetParams, &RegTestParams}
+
+// ByName returns the parameters of the network named as in Bitcoin Core's
+// -chain option.
+func ByName(name string) (*ChainParams, error) {
+	for _, params := range Networks {
+		if params.Name == name {
+			return params, nil
+		}
+	}
+	return nil, ErrUnknownNetwork
+}
+
+// ByNet returns the parameters of the network with the given message start.
+func ByNet(net uint32) (*ChainParams, error) {
+	for _, params := range Networks {
+		if params.Net == net {
+			return params, nil
+		}
+	}
+	return nil, ErrUnknownNetwork
+}
@@ -0,0 +1,59 @@
+package chaincfg
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGenesisHashes(t *testing.T) {
+	tests := []struct {
+		params *ChainParams
+		hash   string
+	}{
+		{&MainNetParams, "000000000019d6689c085ae165831e934ff763ae46a2a6c172b3f1b60a8ce26f"},
+		{&TestNet3Params, "000000000933ea01ad0ee984209779baaec3ced90fa3f408719526f8d77f4943"},
+		{&TestNet4Params, "00000000da84f2bafbbc53dee25a72ae507ff4914b867c565be350b0da8bf043"},
+		{&SigNetParams, "00000008819873e925422c1ff0f99f7cc9bbb232af63a077a480a3633bee1ef6"},
+		{&RegTestParams, "0f9188f13cb7b2c71f2a335e3a4fc328bf5beb436012afca590b1a11466e2206"},
+	}
+	for _, test := range tests {
+		if !bytes.Equal(test.params.GenesisHash, hashFromHex(test.hash)) {
+			t.Errorf("%s genesis hash %x", test.params.Name, test.params.GenesisHash)
+		}
+	}
+}
+
+func TestBlockSubsidy(t *testing.T) {
+	if MainNetParams.BlockSubsidy(209999) != 5000000000 || MainNetParams.BlockSubsidy(210000) != 2500000000 {
+		t.Fatal("wrong mainnet halving")
+	}
+	if RegTestParams.BlockSubsidy(150) != 2500000000 {
+		t.Fatal("wrong regtest halving")
+	}
+	if MainNetParams.BlockSubsidy(64*210000) != 0 {
+		t.Fatal("subsidy after 64 halvings")
+	}
+}
+
+func TestTotalSupply(t *testing.T) {
+	if MainNetParams.TotalSupply(0) != 5000000000 || MainNetParams.TotalSupply(210000) != 210000*5000000000+2500000000 {
+		t.Fatal("wrong mainnet supply")
+	}
+	if MainNetParams.MaxSupply() != 2099999997690000 {
+		t.Fatalf("mainnet max supply %d", MainNetParams.MaxSupply())
+	}
+	if RegTestParams.MaxSupply() != 1499999998350 {
+		t.Fatalf("regtest max supply %d", RegTestParams.MaxSupply())
+	}
+}
+
+func TestSignetMagic(t *testing.T) {
+	params := CustomSigNetParams(SigNetParams.SignetChallenge, nil)
+	if params.Net != SigNetParams.Net {
+		t.Fatalf("default challenge magic %08x", params.Net)
+	}
+	custom := CustomSigNetParams([]byte{0x51}, nil)
+	if custom.Net == SigNetParams.Net || SigNetParams.SignetChallenge[0] != 0x51 {
+		t.Fatal("custom challenge changed the default signet")
+	}
+}
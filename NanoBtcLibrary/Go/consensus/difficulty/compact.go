@@ -0,0 +1,132 @@
+package difficulty
+
+import (
+	"errors"
+	"math/big"
+)
+
+var (
+	// ErrBadTarget is returned for bits that are negative, overflow, zero or
+	// easier than the network's proof of work limit.
+	ErrBadTarget = errors.New("invalid proof of work target")
+	// ErrHighHash is returned when a header hash does not meet its target.
+	ErrHighHash = errors.New("proof of work hash above target")
+)
+
+var (
+	bigOne = big.NewInt(1)
+	// oneLsh256 is 2^256, the size of the hash space.
+	oneLsh256 = new(big.Int).Lsh(bigOne, 256)
+)
+
+// CompactToBig decodes the compact "nBits" representation of a target the way
+// Bitcoin Core's arith_uint256::SetCompact does. The top byte is the size of
+// the number in bytes, the next bit is the sign and the low 23 bits are the
+// mantissa. negative and overflow report the conditions Core rejects as an
+// invalid target.
+func CompactToBig(compact uint32) (target *big.Int, negative bool, overflow bool) {
+	size := compact >> 24
+	word := compact & 0x007fffff
+	target = new(big.Int)
+	if size <= 3 {
+		word >>= 8 * (3 - size)
+		target.SetUint64(uint64(word))
+	} else {
+		target.SetUint64(uint64(word))
+		target.Lsh(target, uint(8*(size-3)))
+	}
+	negative = word != 0 && compact&0x00800000 != 0
+	overflow = word != 0 && (size > 34 ||
+		(word > 0xff && size > 33) ||
+		(word > 0xffff && size > 32))
+	if negative {
+		target.Neg(target)
+	}
+	return target, negative, overflow
+}
+
+// BigToCompact encodes target in the compact "nBits" representation the way
+// Bitcoin Core's arith_uint256::GetCompact does. Precision beyond the three
+// most significant bytes is lost.
+func BigToCompact(target *big.Int) uint32 {
+	if target.Sign() == 0 {
+		return 0
+	}
+	abs := new(big.Int).Abs(target)
+	size := uint32(len(abs.Bytes()))
+	var compact uint32
+	if size <= 3 {
+		compact = uint32(abs.Uint64() << (8 * (3 - size)))
+	} else {
+		compact = uint32(new(big.Int).Rsh(abs, uint(8*(size-3))).Uint64())
+	}
+	// The mantissa is signed, so keep the sign bit clear by moving a byte into
+	// the exponent.
+	if compact&0x00800000 != 0 {
+		compact >>= 8
+		size++
+	}
+	compact |= size << 24
+	if target.Sign() < 0 && compact&0x007fffff != 0 {
+		compact |= 0x00800000
+	}
+	return compact
+}
+
+// CalcWork returns the expected number of hashes needed to find a block with
+// the given bits, 2^256 / (target+1). Invalid targets have no work.
+func CalcWork(bits uint32) *big.Int {
+	target, negative, overflow := CompactToBig(bits)
+	if negative || overflow || target.Sign() == 0 {
+		return new(big.Int)
+	}
+	denominator := new(big.Int).Add(target, bigOne)
+	return denominator.Div(oneLsh256, denominator)
+}
+
+// CalcChainWork returns the cumulative work of a chain whose tip has the
+// given bits and whose parent has parentWork.
+func CalcChainWork(parentWork *big.Int, bits uint32) *big.Int {
+	return new(big.Int).Add(parentWork, CalcWork(bits))
+}
+
+// CalcDifficulty returns the difficulty of bits relative to the mainnet
+// genesis target 0x1d00ffff, as reported by Bitcoin Core's getdifficulty.
+func CalcDifficulty(bits uint32) float64 {
+	shift := (bits >> 24) & 0xff
+	mantissa := bits & 0x00ffffff
+	if mantissa == 0 {
+		return 0
+	}
+	diff := float64(0x0000ffff) / float64(mantissa)
+	for ; shift < 29; shift++ {
+		diff *= 256.0
+	}
+	for ; shift > 29; shift-- {
+		diff /= 256.0
+	}
+	return diff
+}
+
+// HashToBig interprets a hash in internal byte order as a little endian
+// number so it can be compared with a target.
+func HashToBig(hash []byte) *big.Int {
+	reversed := make([]byte, len(hash))
+	for i, b := range hash {
+		reversed[len(hash)-1-i] = b
+	}
+	return new(big.Int).SetBytes(reversed)
+}
+
+// CheckProofOfWork reports whether bits encode a valid target for the network
+// and hash satisfies it.
+func CheckProofOfWork(hash []byte, bits uint32, params *Params) error {
+	target, negative, overflow := CompactToBig(bits)
+	if negative || overflow || target.Sign() == 0 || target.Cmp(params.PowLimit) > 0 {
+		return ErrBadTarget
+	}
+	if HashToBig(hash).Cmp(target) > 0 {
+		return ErrHighHash
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package difficulty
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestCompactToBig(t *testing.T) {
+	tests := []struct {
+		compact  uint32
+		target   string
+		negative bool
+		overflow bool
+		encoded  uint32
+	}{
+		{0x00000000, "0", false, false, 0x00000000},
+		{0x00123456, "0", false, false, 0x00000000},
+		{0x01003456, "0", false, false, 0x00000000},
+		{0x02000056, "0", false, false, 0x00000000},
+		{0x03000000, "0", false, false, 0x00000000},
+		{0x04000000, "0", false, false, 0x00000000},
+		{0x00923456, "0", false, false, 0x00000000},
+		{0x01803456, "0", false, false, 0x00000000},
+		{0x02800056, "0", false, false, 0x00000000},
+		{0x03800000, "0", false, false, 0x00000000},
+		{0x04800000, "0", false, false, 0x00000000},
+		{0x01123456, "12", false, false, 0x01120000},
+		{0x01fedcba, "-7e", true, false, 0x01fe0000},
+		{0x02123456, "1234", false, false, 0x02123400},
+		{0x03123456, "123456", false, false, 0x03123456},
+		{0x04123456, "12345600", false, false, 0x04123456},
+		{0x04923456, "-12345600", true, false, 0x04923456},
+		{0x05009234, "92340000", false, false, 0x05009234},
+		{0x20123456, "1234560000000000000000000000000000000000000000000000000000000000", false, false, 0x20123456},
+		{0x1d00ffff, "ffff0000000000000000000000000000000000000000000000000000", false, false, 0x1d00ffff},
+	}
+	for _, test := range tests {
+		target, negative, overflow := CompactToBig(test.compact)
+		want, _ := new(big.Int).SetString(test.target, 16)
+		if target.Cmp(want) != 0 || negative != test.negative || overflow != test.overflow {
+			t.Errorf("CompactToBig(%08x) = %x %v %v", test.compact, target, negative, overflow)
+		}
+		if encoded := BigToCompact(target); encoded != test.encoded {
+			t.Errorf("BigToCompact(%x) = %08x, want %08x", target, encoded, test.encoded)
+		}
+	}
+	if _, _, overflow := CompactToBig(0xff123456); !overflow {
+		t.Error("0xff123456 should overflow")
+	}
+}
+
+func TestCalcWork(t *testing.T) {
+	if work := CalcWork(0x1d00ffff); work.Cmp(big.NewInt(0x100010001)) != 0 {
+		t.Fatalf("genesis work %x", work)
+	}
+	if work := CalcWork(0x01803456); work.Sign() != 0 {
+		t.Fatalf("zero target should have no work, got %x", work)
+	}
+}
+
+func TestCalcDifficulty(t *testing.T) {
+	if diff := CalcDifficulty(0x1d00ffff); diff != 1 {
+		t.Fatalf("genesis difficulty %v", diff)
+	}
+	if diff := CalcDifficulty(0x1b0404cb); math.Abs(diff-16307.420938523983) > 1e-9 {
+		t.Fatalf("difficulty %v", diff)
+	}
+}
@@ -0,0 +1,197 @@
+package difficulty
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// MaxTimewarp is how far, in seconds, the first block of a retarget period may
+// be timestamped before its parent on networks enforcing BIP94.
+const MaxTimewarp = 600
+
+// ErrForeignNode is returned by a HeaderStore given a node it did not create.
+var ErrForeignNode = errors.New("header node does not belong to the store")
+
+// Params holds the proof of work rules of a network.
+type Params struct {
+	// PowLimit is the easiest allowed target.
+	PowLimit *big.Int
+	// PowLimitBits is PowLimit in compact form.
+	PowLimitBits uint32
+	// TargetTimespan is the desired duration of a retarget period in seconds.
+	TargetTimespan int64
+	// TargetSpacing is the desired time between blocks in seconds.
+	TargetSpacing int64
+	// AllowMinDifficultyBlocks enables the testnet rule allowing a block at the
+	// minimum difficulty when none was found for twice the target spacing.
+	AllowMinDifficultyBlocks bool
+	// NoRetargeting keeps the difficulty constant, as on regtest.
+	NoRetargeting bool
+	// EnforceBIP94 retargets from the first block of the period instead of the
+	// last one and limits timewarps, as on testnet4.
+	EnforceBIP94 bool
+}
+
+func hexToBig(str string) *big.Int {
+	result, ok := new(big.Int).SetString(str, 16)
+	if !ok {
+		panic("invalid hex constant " + str)
+	}
+	return result
+}
+
+var (
+	mainPowLimit    = hexToBig("00000000ffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+	signetPowLimit  = hexToBig("00000377ae000000000000000000000000000000000000000000000000000000")
+	regtestPowLimit = hexToBig("7fffffffffffffffffffffffffffffffffffffffffffffffffffffffffffffff")
+)
+
+var MainNetParams = Params{
+	PowLimit:       mainPowLimit,
+	PowLimitBits:   0x1d00ffff,
+	TargetTimespan: 14 * 24 * 60 * 60,
+	TargetSpacing:  10 * 60,
+}
+
+var TestNet3Params = Params{
+	PowLimit:                 mainPowLimit,
+	PowLimitBits:             0x1d00ffff,
+	TargetTimespan:           14 * 24 * 60 * 60,
+	TargetSpacing:            10 * 60,
+	AllowMinDifficultyBlocks: true,
+}
+
+var TestNet4Params = Params{
+	PowLimit:                 mainPowLimit,
+	PowLimitBits:             0x1d00ffff,
+	TargetTimespan:           14 * 24 * 60 * 60,
+	TargetSpacing:            10 * 60,
+	AllowMinDifficultyBlocks: true,
+	EnforceBIP94:             true,
+}
+
+var SigNetParams = Params{
+	PowLimit:       signetPowLimit,
+	PowLimitBits:   0x1e0377ae,
+	TargetTimespan: 14 * 24 * 60 * 60,
+	TargetSpacing:  10 * 60,
+}
+
+var RegTestParams = Params{
+	PowLimit:                 regtestPowLimit,
+	PowLimitBits:             0x207fffff,
+	TargetTimespan:           14 * 24 * 60 * 60,
+	TargetSpacing:            10 * 60,
+	AllowMinDifficultyBlocks: true,
+	NoRetargeting:            true,
+}
+
+// RetargetInterval returns the number of blocks in a retarget period, 2016 on
+// every public network.
+func (params *Params) RetargetInterval() int32 {
+	return int32(params.TargetTimespan / params.TargetSpacing)
+}
+
+// HeaderNode is the part of a connected header that retargeting depends on.
+type HeaderNode interface {
+	Height() int32
+	Bits() uint32
+	Timestamp() int64
+}
+
+// HeaderStore gives access to the ancestors of a header on the branch it
+// belongs to.
+type HeaderStore interface {
+	// Ancestor returns the ancestor of node at the given height, or nil if
+	// it is not known. Nodes of other stores give ErrForeignNode.
+	Ancestor(node HeaderNode, height int32) (HeaderNode, error)
+}
+
+// NextWorkRequired returns the bits a block built on last with the given
+// timestamp must have, following Bitcoin Core's GetNextWorkRequired. last is
+// nil for the genesis block.
+func NextWorkRequired(params *Params, store HeaderStore, last HeaderNode, timestamp int64) (uint32, error) {
+	if last == nil {
+		return params.PowLimitBits, nil
+	}
+	interval := params.RetargetInterval()
+
+	if (last.Height()+1)%interval != 0 {
+		if !params.AllowMinDifficultyBlocks {
+			return last.Bits(), nil
+		}
+		// A block more than twenty minutes after its parent may be mined at
+		// the minimum difficulty.
+		if timestamp > last.Timestamp()+params.TargetSpacing*2 {
+			return params.PowLimitBits, nil
+		}
+		// Otherwise it must have the bits of the last block that was not
+		// mined under that exception.
+		node := last
+		for node.Height() > 0 && node.Height()%interval != 0 && node.Bits() == params.PowLimitBits {
+			parent, err := store.Ancestor(node, node.Height()-1)
+			if err != nil {
+				return 0, err
+			}
+			if parent == nil {
+				return 0, fmt.Errorf("missing ancestor at height %d", node.Height()-1)
+			}
+			node = parent
+		}
+		return node.Bits(), nil
+	}
+
+	first, err := store.Ancestor(last, last.Height()-(interval-1))
+	if err != nil {
+		return 0, err
+	}
+	if first == nil {
+		return 0, fmt.Errorf("missing ancestor at height %d", last.Height()-(interval-1))
+	}
+	return CalculateNextWorkRequired(params, last, first), nil
+}
+
+// CalculateNextWorkRequired computes the bits of the first block of a new
+// retarget period. first is the first block of the period ending with last.
+// Like Bitcoin Core it measures the timespan over interval-1 blocks.
+func CalculateNextWorkRequired(params *Params, last, first HeaderNode) uint32 {
+	if params.NoRetargeting {
+		return last.Bits()
+	}
+
+	timespan := last.Timestamp() - first.Timestamp()
+	if timespan < params.TargetTimespan/4 {
+		timespan = params.TargetTimespan / 4
+	}
+	if timespan > params.TargetTimespan*4 {
+		timespan = params.TargetTimespan * 4
+	}
+
+	bits := last.Bits()
+	if params.EnforceBIP94 {
+		// The first block of a period cannot use the min difficulty exception,
+		// so it always carries the real difficulty.
+		bits = first.Bits()
+	}
+	target, _, _ := CompactToBig(bits)
+	target.Mul(target, big.NewInt(timespan))
+	target.Div(target, big.NewInt(params.TargetTimespan))
+	if target.Cmp(params.PowLimit) > 0 {
+		target.Set(params.PowLimit)
+	}
+	return BigToCompact(target)
+}
+
+// CheckTimewarp applies the BIP94 rule that the first block of a retarget
+// period may not be more than MaxTimewarp seconds older than its parent.
+// It always passes on networks that do not enforce BIP94.
+func CheckTimewarp(params *Params, last HeaderNode, timestamp int64) bool {
+	if !params.EnforceBIP94 || last == nil {
+		return true
+	}
+	if (last.Height()+1)%params.RetargetInterval() != 0 {
+		return true
+	}
+	return timestamp >= last.Timestamp()-MaxTimewarp
+}
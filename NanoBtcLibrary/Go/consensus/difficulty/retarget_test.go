@@ -0,0 +1,136 @@
+package difficulty
+
+import "testing"
+
+type testNode struct {
+	height    int32
+	bits      uint32
+	timestamp int64
+}
+
+func (node testNode) Height() int32    { return node.height }
+func (node testNode) Bits() uint32     { return node.bits }
+func (node testNode) Timestamp() int64 { return node.timestamp }
+
+// The vectors come from Bitcoin Core's pow_tests.
+func TestCalculateNextWorkRequired(t *testing.T) {
+	tests := []struct {
+		last, first testNode
+		want        uint32
+	}{
+		{testNode{32255, 0x1d00ffff, 1262152739}, testNode{30240, 0, 1261130161}, 0x1d00d86a},
+		{testNode{2015, 0x1d00ffff, 1233061996}, testNode{0, 0, 1231006505}, 0x1d00ffff},
+		{testNode{68543, 0x1c05a3f4, 1279297671}, testNode{66528, 0, 1279008237}, 0x1c0168fd},
+		{testNode{46367, 0x1c387f6f, 1269211443}, testNode{44352, 0, 1263163443}, 0x1d00e1fd},
+	}
+	for _, test := range tests {
+		if bits := CalculateNextWorkRequired(&MainNetParams, test.last, test.first); bits != test.want {
+			t.Errorf("height %d: got %08x, want %08x", test.last.height, bits, test.want)
+		}
+	}
+}
+
+// testChain is a single branch of headers indexed by height.
+type testChain map[int32]testNode
+
+func (chain testChain) Ancestor(node HeaderNode, height int32) (HeaderNode, error) {
+	if ancestor, ok := chain[height]; ok {
+		return ancestor, nil
+	}
+	return nil, nil
+}
+
+// minDifficultyChain returns headers from the retarget at 2016 to last, the
+// blocks after normal ones being mined under the min difficulty exception.
+func minDifficultyChain(normal int32, last int32) testChain {
+	chain := make(testChain)
+	for height := int32(2016); height <= last; height++ {
+		bits := uint32(0x1c0fffff)
+		if height > normal {
+			bits = TestNet3Params.PowLimitBits
+		}
+		chain[height] = testNode{height, bits, 1300000000 + int64(height)*600}
+	}
+	return chain
+}
+
+func TestMinDifficultyWalkBack(t *testing.T) {
+	tests := []struct {
+		normal, last int32
+		delay        int64
+		want         uint32
+	}{
+		// Late blocks may be mined at the minimum difficulty.
+		{2016, 2016, 1201, 0x1d00ffff},
+		{2016, 2016, 1200, 0x1c0fffff},
+		// Otherwise the bits of the last normal block apply, stopping at
+		// the retarget block.
+		{2018, 2020, 600, 0x1c0fffff},
+		{2016, 2020, 600, 0x1c0fffff},
+	}
+	for _, test := range tests {
+		chain := minDifficultyChain(test.normal, test.last)
+		last := chain[test.last]
+		bits, err := NextWorkRequired(&TestNet3Params, chain, last, last.timestamp+test.delay)
+		if err != nil || bits != test.want {
+			t.Errorf("normal up to %d, last %d: got %08x, want %08x (%v)", test.normal, test.last, bits, test.want, err)
+		}
+	}
+
+	// The walk back needs every ancestor.
+	chain := minDifficultyChain(2016, 2020)
+	delete(chain, 2018)
+	if _, err := NextWorkRequired(&TestNet3Params, chain, chain[2020], chain[2020].timestamp); err == nil {
+		t.Error("missing ancestor not reported")
+	}
+
+	// Mainnet has no exception.
+	chain = minDifficultyChain(2020, 2020)
+	if bits, _ := NextWorkRequired(&MainNetParams, chain, chain[2020], chain[2020].timestamp+7200); bits != 0x1c0fffff {
+		t.Errorf("mainnet late block: %08x", bits)
+	}
+}
+
+func TestBIP94Retarget(t *testing.T) {
+	// The period ends with a min difficulty block and took exactly the
+	// target timespan.
+	first := testNode{4032, 0x1c0fffff, 1300000000}
+	last := testNode{6047, TestNet3Params.PowLimitBits, 1300000000 + TestNet3Params.TargetTimespan}
+	if bits := CalculateNextWorkRequired(&TestNet4Params, last, first); bits != 0x1c0fffff {
+		t.Errorf("testnet4 retargeted from the last block: %08x", bits)
+	}
+	if bits := CalculateNextWorkRequired(&TestNet3Params, last, first); bits != TestNet3Params.PowLimitBits {
+		t.Errorf("testnet3 retarget: %08x", bits)
+	}
+
+	parent := testNode{4031, 0x1c0fffff, 1300000000}
+	if CheckTimewarp(&TestNet4Params, parent, parent.timestamp-MaxTimewarp-1) {
+		t.Error("timewarp accepted at a retarget")
+	}
+	if !CheckTimewarp(&TestNet4Params, parent, parent.timestamp-MaxTimewarp) {
+		t.Error("timestamp within the limit rejected")
+	}
+	middle := testNode{4032, 0x1c0fffff, 1300000000}
+	if !CheckTimewarp(&TestNet4Params, middle, 0) || !CheckTimewarp(&TestNet3Params, parent, 0) {
+		t.Error("timewarp rule applied outside a testnet4 retarget")
+	}
+}
+
+func TestNoRetargeting(t *testing.T) {
+	first := testNode{0, RegTestParams.PowLimitBits, 1296688602}
+	last := testNode{2015, RegTestParams.PowLimitBits, 1296688602 + 60}
+	if bits := CalculateNextWorkRequired(&RegTestParams, last, first); bits != RegTestParams.PowLimitBits {
+		t.Errorf("regtest retargeted to %08x", bits)
+	}
+	chain := testChain{0: first, 2015: last}
+	if bits, err := NextWorkRequired(&RegTestParams, chain, last, last.timestamp+1); err != nil || bits != last.bits {
+		t.Errorf("regtest next work %08x (%v)", bits, err)
+	}
+
+	// Retargeting would have raised the difficulty fourfold.
+	params := RegTestParams
+	params.NoRetargeting = false
+	if bits := CalculateNextWorkRequired(&params, last, first); bits == RegTestParams.PowLimitBits {
+		t.Error("retarget without NoRetargeting kept the bits")
+	}
+}
@@ -0,0 +1,82 @@
+package consensus
+
+import (
+	"errors"
+	"sort"
+
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+)
+
+// medianTimeSpan is the number of blocks whose timestamps give the median
+// time past of the last one.
+const medianTimeSpan = 11
+
+// ErrNoMedianTime is returned for the median time past of a height below the
+// genesis block, as asked when validating a genesis block.
+var ErrNoMedianTime = errors.New("no median time past before the genesis block")
+
+// MedianTimeFunc returns the median time past of the block at height on the
+// branch being validated.
+type MedianTimeFunc func(height int32) (int64, error)
+
+// MedianTimes returns the MedianTimeFunc of the branch whose block
+// timestamps, by height, timestamp returns.
+func MedianTimes(timestamp func(height int32) (int64, error)) MedianTimeFunc {
+	return func(height int32) (int64, error) {
+		if height < 0 {
+			return 0, ErrNoMedianTime
+		}
+		timestamps := make([]int64, 0, medianTimeSpan)
+		for h := height; h >= 0 && h > height-medianTimeSpan; h-- {
+			t, err := timestamp(h)
+			if err != nil {
+				return 0, err
+			}
+			timestamps = append(timestamps, t)
+		}
+		sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+		return timestamps[len(timestamps)/2], nil
+	}
+}
+
+// SequenceLock is the BIP68 relative lock of a transaction: the last block
+// height and median time past at which it is still locked, or -1 for none.
+type SequenceLock struct {
+	Height int32
+	Time   int64
+}
+
+// CalculateSequenceLock returns the relative lock of tx, whose inputs spend
+// coins mined at prevHeights, in order. Coins of transactions not yet mined
+// count as mined in the block tx is going into.
+func CalculateSequenceLock(tx transactions.Transaction, prevHeights []int32, pastTimes MedianTimeFunc) (SequenceLock, error) {
+	lock := SequenceLock{Height: -1, Time: -1}
+	// Versions are compared unsigned, as in the interpreter.
+	if uint32(tx.Version) < 2 {
+		return lock, nil
+	}
+	for i, in := range tx.Input {
+		if in.Sequence&transactions.SequenceLockTimeDisableFlag != 0 {
+			continue
+		}
+		value := int64(in.Sequence & transactions.SequenceLockTimeMask)
+		if in.Sequence&transactions.SequenceLockTimeTypeFlag == 0 {
+			lock.Height = max(lock.Height, prevHeights[i]+int32(value)-1)
+			continue
+		}
+		// Time locks count from the median time past of the block before
+		// the one holding the coin.
+		coinTime, err := pastTimes(max(prevHeights[i]-1, 0))
+		if err != nil {
+			return lock, err
+		}
+		lock.Time = max(lock.Time, coinTime+(value<<transactions.SequenceLockTimeGranularity)-1)
+	}
+	return lock, nil
+}
+
+// Satisfied reports whether a transaction with this lock may go into a block
+// at height whose parent has median time past medianTimePast.
+func (lock SequenceLock) Satisfied(height int32, medianTimePast int64) bool {
+	return lock.Height < height && lock.Time < medianTimePast
+}
@@ -0,0 +1,211 @@
+package consensus
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding"
+	"encoding/binary"
+	"math/big"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	difficulty "github.com/Btcercises/NanoBtcLibrary/Go/consensus/difficulty"
+)
+
+const (
+	// nonceSpace is the number of nonces in a header.
+	nonceSpace = 1 << 32
+	// checkInterval is how many hashes a worker does between looking at the
+	// context and publishing its hash count.
+	checkInterval = 1 << 14
+)
+
+// MinerStats is a progress report of a nonce search.
+type MinerStats struct {
+	Hashes   uint64
+	Elapsed  time.Duration
+	HashRate float64
+	// Progress is the searched fraction of the nonce space, from 0 to 1.
+	Progress float64
+}
+
+// Miner searches the nonce space of a header on several goroutines.
+type Miner struct {
+	// Workers is the number of goroutines, runtime.NumCPU() by default.
+	Workers int
+	// ReportInterval is the time between calls to OnProgress.
+	ReportInterval time.Duration
+	// OnProgress, if set, receives statistics while mining and once at the end.
+	OnProgress func(MinerStats)
+}
+
+func NewMiner() *Miner {
+	return &Miner{Workers: runtime.NumCPU(), ReportInterval: time.Second}
+}
+
+// nonceSearch holds the precomputed parts of a header hash.
+type nonceSearch struct {
+	// midstate is the SHA-256 state after the first 64 bytes of the header,
+	// which do not depend on the nonce.
+	midstate []byte
+	tail     [16]byte
+	target   [32]byte
+}
+
+func newNonceSearch(header *blockchain.BlockHeader, target *big.Int) *nonceSearch {
+	data := header.Serialize()
+	first := sha256.New()
+	first.Write(data[:64])
+	midstate, err := first.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		panic(err)
+	}
+	search := &nonceSearch{midstate: midstate}
+	copy(search.tail[:], data[64:])
+	target.FillBytes(search.target[:])
+	return search
+}
+
+// meetsTarget compares a hash in internal byte order with the big endian
+// target.
+func (search *nonceSearch) meetsTarget(hash []byte) bool {
+	for i := 0; i < 32; i++ {
+		b := hash[31-i]
+		if b != search.target[i] {
+			return b < search.target[i]
+		}
+	}
+	return true
+}
+
+// run hashes the nonces in [start, end) until one meets the target, stop is
+// set or ctx is done. Hash counts are added to hashes as it goes.
+func (search *nonceSearch) run(ctx context.Context, start, end uint64, stop *atomic.Bool, hashes *atomic.Uint64) (uint32, []byte, bool) {
+	state := sha256.New()
+	unmarshaler := state.(encoding.BinaryUnmarshaler)
+	tail := search.tail
+	first := make([]byte, 0, sha256.Size)
+	var counted uint64
+	for nonce := start; nonce < end; nonce++ {
+		if (nonce-start)%checkInterval == 0 && nonce != start {
+			hashes.Add(nonce - start - counted)
+			counted = nonce - start
+			if stop.Load() || ctx.Err() != nil {
+				return 0, nil, false
+			}
+		}
+		binary.LittleEndian.PutUint32(tail[nonceOffset-64:], uint32(nonce))
+		if err := unmarshaler.UnmarshalBinary(search.midstate); err != nil {
+			panic(err)
+		}
+		state.Write(tail[:])
+		first = state.Sum(first[:0])
+		hash := sha256.Sum256(first)
+		if search.meetsTarget(hash[:]) {
+			hashes.Add(nonce + 1 - start - counted)
+			return uint32(nonce), hash[:], true
+		}
+	}
+	hashes.Add(end - start - counted)
+	return 0, nil, false
+}
+
+// Solve searches the whole nonce space of header, split across the workers.
+// On success the nonce and hash are set on the header. It returns ctx.Err()
+// when cancelled, for instance because a new tip arrived, and
+// ErrNonceSpaceExhausted when no nonce works.
+func (miner *Miner) Solve(ctx context.Context, header *blockchain.BlockHeader) error {
+	pow := NewProof(header)
+	if pow.Target.Sign() <= 0 {
+		return difficulty.ErrBadTarget
+	}
+	workers := miner.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	search := newNonceSearch(header, pow.Target)
+
+	var (
+		stop   atomic.Bool
+		hashes atomic.Uint64
+		once   sync.Once
+		nonce  uint32
+		hash   []byte
+		found  bool
+		wg     sync.WaitGroup
+	)
+	started := time.Now()
+	stats := func() MinerStats {
+		count := hashes.Load()
+		elapsed := time.Since(started)
+		result := MinerStats{Hashes: count, Elapsed: elapsed, Progress: float64(count) / nonceSpace}
+		if elapsed > 0 {
+			result.HashRate = float64(count) / elapsed.Seconds()
+		}
+		return result
+	}
+
+	chunk := uint64(nonceSpace) / uint64(workers)
+	for i := 0; i < workers; i++ {
+		start := uint64(i) * chunk
+		end := start + chunk
+		if i == workers-1 {
+			end = nonceSpace
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if n, h, ok := search.run(ctx, start, end, &stop, &hashes); ok {
+				once.Do(func() {
+					nonce, hash, found = n, h, true
+					stop.Store(true)
+				})
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	if miner.OnProgress != nil && miner.ReportInterval > 0 {
+		ticker := time.NewTicker(miner.ReportInterval)
+	report:
+		for {
+			select {
+			case <-ticker.C:
+				miner.OnProgress(stats())
+			case <-done:
+				break report
+			}
+		}
+		ticker.Stop()
+	} else {
+		<-done
+	}
+	if miner.OnProgress != nil {
+		miner.OnProgress(stats())
+	}
+
+	if found {
+		header.Nonce = int(nonce)
+		header.Hash = hash
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return ErrNonceSpaceExhausted
+}
+
+// Mine mines block at height like MineBlock, using all the workers of the
+// miner and stopping when ctx is done.
+func (miner *Miner) Mine(ctx context.Context, block *blockchain.Block, height int32, now func() time.Time) error {
+	return mineBlock(ctx, block, height, now, func(header *blockchain.BlockHeader) error {
+		return miner.Solve(ctx, header)
+	})
+}
@@ -0,0 +1,39 @@
+package consensus_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	consensus "github.com/Btcercises/NanoBtcLibrary/Go/consensus"
+	regtest "github.com/Btcercises/NanoBtcLibrary/Go/regtest"
+)
+
+func TestMinerSolve(t *testing.T) {
+	genesis := regtest.GenesisBlock()
+	// A target of about one in 2^16 hashes keeps the search short.
+	genesis.TargetDifficulty = 0x1f00ffff
+	genesis.Hash = nil
+	reports := 0
+	miner := &consensus.Miner{Workers: 4, ReportInterval: time.Millisecond, OnProgress: func(consensus.MinerStats) { reports++ }}
+	if err := miner.Solve(context.Background(), &genesis.BlockHeader); err != nil {
+		t.Fatal(err)
+	}
+	if !consensus.NewProof(&genesis.BlockHeader).Validate() {
+		t.Fatal("solved header does not validate")
+	}
+	if reports == 0 {
+		t.Fatal("no progress reported")
+	}
+}
+
+func TestMinerCancel(t *testing.T) {
+	genesis := regtest.GenesisBlock()
+	genesis.TargetDifficulty = 0x1d00ffff
+	genesis.Hash = nil
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := consensus.NewMiner().Solve(ctx, &genesis.BlockHeader); err != context.DeadlineExceeded {
+		t.Fatalf("got %v, want context.DeadlineExceeded", err)
+	}
+}
@@ -1,78 +1,142 @@
 package consensus
 
 import (
-	"bytes"
-	"crypto/sha256"
-	"fmt"
-	"math"
+	"context"
+	"encoding/binary"
+	"errors"
 	"math/big"
+	"sync/atomic"
+	"time"
 
 	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
-	utils "github.com/Btcercises/NanoBtcLibrary/Go/consensus/utils"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	utils "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+	difficulty "github.com/Btcercises/NanoBtcLibrary/Go/consensus/difficulty"
 )
 
-const Difficulty = 1
+// nonceOffset is the position of the nonce in the serialized header.
+const nonceOffset = 76
+
+var (
+	// ErrNonceSpaceExhausted is returned by Run when no nonce gives a hash
+	// meeting the target; the coinbase or the timestamp must change.
+	ErrNonceSpaceExhausted = errors.New("no nonce satisfies the target")
+	ErrBadCoinbaseScript   = errors.New("coinbase script size out of range")
+)
 
 type ProofOfWork struct {
 	Block  *blockchain.BlockHeader
 	Target *big.Int
 }
 
+// NewProof returns a proof of work for b whose target is decoded from the
+// header's compact bits.
 func NewProof(b *blockchain.BlockHeader) *ProofOfWork {
-	target := big.NewInt(1)
-	target.Lsh(target, uint(256-Difficulty))
+	target, negative, overflow := difficulty.CompactToBig(b.TargetDifficulty)
+	if negative || overflow {
+		target = new(big.Int)
+	}
 
 	pow := &ProofOfWork{b, target}
 
 	return pow
 }
 
-func (pow *ProofOfWork) InitData(nonce int) []byte {
-	data := bytes.Join(
-		[][]byte{
-			pow.Block.HashPrev,
-			pow.Block.Hash,
-			utils.ToHex(int64(nonce)),
-			utils.ToHex(int64(Difficulty)),
-		},
-		[]byte{},
-	)
-
+// InitData returns the 80-byte serialized header with nonce in place of the
+// header's own.
+func (pow *ProofOfWork) InitData(nonce uint32) []byte {
+	data := pow.Block.Serialize()
+	binary.LittleEndian.PutUint32(data[nonceOffset:], nonce)
 	return data
 }
 
-func (pow *ProofOfWork) Run() (int, []byte) {
-	var intHash big.Int
-	var hash [32]byte
-
-	nonce := 0
-
-	for nonce < math.MaxInt64 {
-		data := pow.InitData(nonce)
-		hash = sha256.Sum256(data)
-
-		fmt.Printf("\r%x", hash)
-		intHash.SetBytes(hash[:])
+// Run searches the nonce space for a double SHA-256 of the header meeting
+// the target on the calling goroutine. The nonce and hash found are set on
+// the header. Use a Miner to search on all cores.
+func (pow *ProofOfWork) Run() (int, []byte, error) {
+	return pow.run(context.Background())
+}
 
-		if intHash.Cmp(pow.Target) == -1 {
-			break
-		} else {
-			nonce++
+// run is Run stopping with the error of ctx once it is done.
+func (pow *ProofOfWork) run(ctx context.Context) (int, []byte, error) {
+	if pow.Target.Sign() <= 0 {
+		return 0, nil, difficulty.ErrBadTarget
+	}
+	var stop atomic.Bool
+	var hashes atomic.Uint64
+	search := newNonceSearch(pow.Block, pow.Target)
+	nonce, hash, found := search.run(ctx, 0, nonceSpace, &stop, &hashes)
+	if !found {
+		if err := ctx.Err(); err != nil {
+			return 0, nil, err
 		}
-
+		return 0, nil, ErrNonceSpaceExhausted
 	}
-	fmt.Println()
-
-	return nonce, hash[:]
+	pow.Block.Nonce = int(nonce)
+	pow.Block.Hash = hash
+	return int(nonce), hash, nil
 }
 
+// Validate reports whether the hash of the header meets its target.
 func (pow *ProofOfWork) Validate() bool {
-	var intHash big.Int
+	if pow.Target.Sign() <= 0 {
+		return false
+	}
+	hash := utils.DoubleSha256(pow.Block.Serialize())
+	return difficulty.HashToBig(hash).Cmp(pow.Target) <= 0
+}
 
-	data := pow.InitData(pow.Block.Nonce)
+// SetExtraNonce rewrites the coinbase script of block as the BIP34 height
+// followed by extraNonce, as Bitcoin Core's IncrementExtraNonce does, and
+// updates the merkle root. The witness commitment is unaffected since the
+// coinbase wtxid is fixed to zero.
+func SetExtraNonce(block *blockchain.Block, height int32, extraNonce uint64) error {
+	if len(block.Transactions) == 0 || len(block.Transactions[0].Input) != 1 {
+		return blockchain.ErrNoTransactions
+	}
+	script := append(transactions.PushInt(int64(height)), transactions.PushInt(int64(extraNonce))...)
+	if len(script) < 2 || len(script) > 100 {
+		return ErrBadCoinbaseScript
+	}
+	coinbase := &block.Transactions[0]
+	coinbase.Input[0].Script = script
+	coinbase.Id = nil
+
+	root, _ := blockchain.MerkleRoot(block.Transactions)
+	block.HashMerkle = root
+	copy(block.MerkleRoot[:], root)
+	block.Hash = nil
+	return nil
+}
 
-	hash := sha256.Sum256(data)
-	intHash.SetBytes(hash[:])
+// MineBlock mines block at height. Before each pass over the nonce space the
+// timestamp is moved up to now, and once a pass fails the extra nonce in the
+// coinbase is rolled. The search only ends with a solution or once ctx is
+// done, in which case the error of ctx is returned. Bits are left alone, so on
+// networks where they depend on the timestamp the caller must recompute them
+// after a long search.
+func MineBlock(ctx context.Context, block *blockchain.Block, height int32, now func() time.Time) error {
+	return mineBlock(ctx, block, height, now, func(header *blockchain.BlockHeader) error {
+		_, _, err := NewProof(header).run(ctx)
+		return err
+	})
+}
 
-	return intHash.Cmp(pow.Target) == -1
+func mineBlock(ctx context.Context, block *blockchain.Block, height int32, now func() time.Time, solve func(*blockchain.BlockHeader) error) error {
+	for extraNonce := uint64(1); ; extraNonce++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if timestamp := now().Truncate(time.Second); timestamp.After(block.Timestamp) {
+			block.Timestamp = timestamp
+			block.Hash = nil
+		}
+		err := solve(&block.BlockHeader)
+		if err != ErrNonceSpaceExhausted {
+			return err
+		}
+		if err := SetExtraNonce(block, height, extraNonce); err != nil {
+			return err
+		}
+	}
 }
@@ -0,0 +1,56 @@
+package consensus_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	consensus "github.com/Btcercises/NanoBtcLibrary/Go/consensus"
+	regtest "github.com/Btcercises/NanoBtcLibrary/Go/regtest"
+)
+
+func TestValidateGenesis(t *testing.T) {
+	// The mainnet genesis header differs from regtest's only in these fields.
+	genesis := regtest.GenesisBlock()
+	genesis.Timestamp = time.Unix(1231006505, 0)
+	genesis.TargetDifficulty = 0x1d00ffff
+	genesis.Nonce = 2083236893
+	if !consensus.NewProof(&genesis.BlockHeader).Validate() {
+		t.Fatal("mainnet genesis rejected")
+	}
+	genesis.Nonce++
+	if consensus.NewProof(&genesis.BlockHeader).Validate() {
+		t.Fatal("mainnet genesis accepted with a wrong nonce")
+	}
+}
+
+func TestMineBlock(t *testing.T) {
+	chain := regtest.NewChain()
+	blocks, err := chain.GenerateToScript(1, []byte{0x51})
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := blocks[0]
+	if err := consensus.SetExtraNonce(block, 1, 7); err != nil {
+		t.Fatal(err)
+	}
+	if err := block.CheckMerkleRoot(); err != nil {
+		t.Fatal(err)
+	}
+	if err := block.CheckWitnessCommitment(); err != nil {
+		t.Fatal(err)
+	}
+	now := func() time.Time { return block.Timestamp }
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := consensus.MineBlock(ctx, block, 1, now); !errors.Is(err, context.Canceled) {
+		t.Fatalf("mining with a cancelled context: %v", err)
+	}
+	if err := consensus.MineBlock(context.Background(), block, 1, now); err != nil {
+		t.Fatal(err)
+	}
+	if !consensus.NewProof(&block.BlockHeader).Validate() {
+		t.Fatal("mined block does not validate")
+	}
+}
@@ -0,0 +1,67 @@
+package consensus
+
+// Rule names a consensus rule, using the reject reason Bitcoin Core reports
+// when a block breaks it.
+type Rule string
+
+const (
+	RuleHighHash              Rule = "high-hash"
+	RuleBadMerkleRoot         Rule = "bad-txnmrklroot"
+	RuleDuplicateTx           Rule = "bad-txns-duplicate"
+	RuleBIP30                 Rule = "bad-txns-BIP30"
+	RuleBadBlockLength        Rule = "bad-blk-length"
+	RuleBadBlockWeight        Rule = "bad-blk-weight"
+	RuleCoinbaseMissing       Rule = "bad-cb-missing"
+	RuleCoinbaseMultiple      Rule = "bad-cb-multiple"
+	RuleCoinbaseLength        Rule = "bad-cb-length"
+	RuleCoinbaseHeight        Rule = "bad-cb-height"
+	RuleCoinbaseAmount        Rule = "bad-cb-amount"
+	RuleBlockSigOps           Rule = "bad-blk-sigops"
+	RuleWitnessNonceSize      Rule = "bad-witness-nonce-size"
+	RuleWitnessMerkleMatch    Rule = "bad-witness-merkle-match"
+	RuleUnexpectedWitness     Rule = "unexpected-witness"
+	RuleNonFinalTx            Rule = "bad-txns-nonfinal"
+	RuleTxInputsEmpty         Rule = "bad-txns-vin-empty"
+	RuleTxOutputsEmpty        Rule = "bad-txns-vout-empty"
+	RuleTxOversize            Rule = "bad-txns-oversize"
+	RuleTxOutputNegative      Rule = "bad-txns-vout-negative"
+	RuleTxOutputTooLarge      Rule = "bad-txns-vout-toolarge"
+	RuleTxOutputTotalTooLarge Rule = "bad-txns-txouttotal-toolarge"
+	RuleTxInputsDuplicate     Rule = "bad-txns-inputs-duplicate"
+	RuleTxPrevOutNull         Rule = "bad-txns-prevout-null"
+	RuleMissingOrSpent        Rule = "bad-txns-inputs-missingorspent"
+	RulePrematureCoinbase     Rule = "bad-txns-premature-spend-of-coinbase"
+	RuleInputValuesRange      Rule = "bad-txns-inputvalues-outofrange"
+	RuleInputsBelowOutputs    Rule = "bad-txns-in-belowout"
+	RuleFeeRange              Rule = "bad-txns-fee-outofrange"
+	RuleScriptVerify          Rule = "mandatory-script-verify-flag-failed"
+)
+
+// RuleError is returned when a block or transaction breaks a consensus rule.
+type RuleError struct {
+	Rule Rule
+	// Err gives details when they are available.
+	Err error
+}
+
+func ruleError(rule Rule, err error) error {
+	return &RuleError{Rule: rule, Err: err}
+}
+
+func (err *RuleError) Error() string {
+	if err.Err == nil {
+		return string(err.Rule)
+	}
+	return string(err.Rule) + ": " + err.Err.Error()
+}
+
+func (err *RuleError) Unwrap() error {
+	return err.Err
+}
+
+// Is matches any RuleError for the same rule, so that
+// errors.Is(err, &RuleError{Rule: RuleCoinbaseAmount}) tests for a rule.
+func (err *RuleError) Is(target error) bool {
+	other, ok := target.(*RuleError)
+	return ok && other.Rule == err.Rule
+}
@@ -0,0 +1,450 @@
+package consensus
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	utils "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+	utxo "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utxo"
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
+	difficulty "github.com/Btcercises/NanoBtcLibrary/Go/consensus/difficulty"
+)
+
+// Consensus limits on blocks and amounts.
+const (
+	MaxBlockWeight     = 4000000
+	MaxBlockSigOpsCost = 80000
+	// MaxMoney is the largest amount, in satoshis, any output or sum of
+	// outputs may hold.
+	MaxMoney = 21000000 * 100000000
+)
+
+// locktimeThreshold separates block heights from timestamps in lock times.
+const locktimeThreshold = 500000000
+
+// bip34ImpliesBIP30Limit is the first height at which a coinbase could
+// repeat one from before BIP34, whose height push was not enforced, so BIP30
+// is enforced again from there.
+const bip34ImpliesBIP30Limit = 1983702
+
+// bip30Exceptions are the two mainnet blocks, by height, whose coinbases
+// overwrote unspent earlier ones before BIP30.
+var bip30Exceptions = map[int32]string{
+	91842: "00000000000a4d0a398161ffc163c503763b1f4360639393e0e4c8e300e0caec",
+	91880: "00000000000743f190a18c5577a3c2d2a1f610ae9601ac046a38084ccb7cd721",
+}
+
+// scriptFlagExceptions are the mainnet blocks, by hash, checked with fewer
+// script rules than every other block: one spends a P2SH output breaking
+// BIP16 and the other a witness v1 output breaking taproot, both before the
+// rules were enforced.
+var scriptFlagExceptions = map[string]transactions.ScriptFlags{
+	"00000000000002dc756eebf4f49723ed8d30cc28a5f108eb94b1ba88ac4f9c22": 0,
+	"0000000000000000000f14c35b2d841e986ab5441de8c585d5ffe55ea1e395ad": transactions.ScriptVerifyP2SH | transactions.ScriptVerifyWitness,
+}
+
+func moneyRange(amount int64) bool {
+	return amount >= 0 && amount <= MaxMoney
+}
+
+// deployed reports whether a soft fork buried at deployHeight is enforced at
+// height. Negative heights are never enforced.
+func deployed(deployHeight, height int32) bool {
+	return deployHeight >= 0 && height >= deployHeight
+}
+
+func isNullPrevOut(in transactions.TxInput) bool {
+	return in.Index == 0xffffffff && bytes.Equal(in.Hash, make([]byte, 32))
+}
+
+// IsCoinbase reports whether tx has the single null input of a coinbase.
+func IsCoinbase(tx transactions.Transaction) bool {
+	return len(tx.Input) == 1 && isNullPrevOut(tx.Input[0])
+}
+
+// BlockScriptFlags returns the script rules enforced for the inputs of the
+// block hash at height, which may be nil for a block not mined yet. As in
+// Bitcoin Core, P2SH, segwit and taproot are enforced on every block but the
+// exceptions, since no other block in the chain breaks them.
+func BlockScriptFlags(params *chaincfg.ChainParams, height int32, hash []byte) transactions.ScriptFlags {
+	flags := transactions.ScriptVerifyP2SH | transactions.ScriptVerifyWitness | transactions.ScriptVerifyTaproot
+	if exception, ok := scriptFlagExceptions[utils.HashString(hash)]; ok {
+		flags = exception
+	}
+	if deployed(params.BIP66Height, height) {
+		flags |= transactions.ScriptVerifyDERSig
+	}
+	if deployed(params.BIP65Height, height) {
+		flags |= transactions.ScriptVerifyCheckLockTimeVerify
+	}
+	if deployed(params.CSVHeight, height) {
+		flags |= transactions.ScriptVerifyCheckSequenceVerify
+	}
+	if deployed(params.SegwitHeight, height) {
+		flags |= transactions.ScriptVerifyNullDummy
+	}
+	return flags
+}
+
+// CheckTransaction runs the checks on tx that need no context.
+func CheckTransaction(tx transactions.Transaction) error {
+	if len(tx.Input) == 0 {
+		return ruleError(RuleTxInputsEmpty, nil)
+	}
+	if len(tx.Output) == 0 {
+		return ruleError(RuleTxOutputsEmpty, nil)
+	}
+	if transactions.StrippedSize(tx)*transactions.WitnessScaleFactor > MaxBlockWeight {
+		return ruleError(RuleTxOversize, nil)
+	}
+	var total int64
+	for _, out := range tx.Output {
+		if out.Amount < 0 {
+			return ruleError(RuleTxOutputNegative, nil)
+		}
+		if out.Amount > MaxMoney {
+			return ruleError(RuleTxOutputTooLarge, nil)
+		}
+		total += out.Amount
+		if !moneyRange(total) {
+			return ruleError(RuleTxOutputTotalTooLarge, nil)
+		}
+	}
+	seen := make(map[utxo.OutPoint]bool, len(tx.Input))
+	for _, in := range tx.Input {
+		outPoint := utxo.NewOutPoint(in.Hash, in.Index)
+		if seen[outPoint] {
+			return ruleError(RuleTxInputsDuplicate, nil)
+		}
+		seen[outPoint] = true
+	}
+	if IsCoinbase(tx) {
+		if length := len(tx.Input[0].Script); length < 2 || length > 100 {
+			return ruleError(RuleCoinbaseLength, nil)
+		}
+		return nil
+	}
+	for _, in := range tx.Input {
+		if isNullPrevOut(in) {
+			return ruleError(RuleTxPrevOutNull, nil)
+		}
+	}
+	return nil
+}
+
+// legacySigOps counts the signature operations of every script in tx,
+// without looking at the outputs it spends.
+func legacySigOps(tx transactions.Transaction) int {
+	count := 0
+	for _, in := range tx.Input {
+		count += transactions.SigOpCount(in.Script, false)
+	}
+	for _, out := range tx.Output {
+		count += transactions.SigOpCount(out.Script, false)
+	}
+	return count
+}
+
+// TxSigOpCost returns the signature operation cost tx adds to a block,
+// given the coins its inputs spend, in order, and the block's script flags.
+func TxSigOpCost(tx transactions.Transaction, coins []*utxo.Coin, flags transactions.ScriptFlags) int {
+	cost := legacySigOps(tx) * transactions.WitnessScaleFactor
+	if IsCoinbase(tx) {
+		return cost
+	}
+	for i, input := range tx.Input {
+		if flags&transactions.ScriptVerifyP2SH != 0 {
+			cost += transactions.P2SHSigOpCount(input.Script, coins[i].Script) * transactions.WitnessScaleFactor
+		}
+		cost += transactions.WitnessSigOpCount(input.Script, coins[i].Script, input.ScriptWitness, flags)
+	}
+	return cost
+}
+
+// CheckBlock runs the checks on block that need neither its place in the
+// chain nor the UTXO set: proof of work, merkle root, size and coinbase
+// placement, and CheckTransaction on every transaction. Header rules that
+// depend on the parent, such as bits and timestamp, are left to the
+// HeaderChain.
+func CheckBlock(block *blockchain.Block, params *chaincfg.ChainParams) error {
+	if err := difficulty.CheckProofOfWork(block.HashBlock(), block.TargetDifficulty, params.Pow); err != nil {
+		return ruleError(RuleHighHash, err)
+	}
+	switch err := block.CheckMerkleRoot(); err {
+	case nil:
+	case blockchain.ErrNoTransactions:
+		return ruleError(RuleBadBlockLength, err)
+	case blockchain.ErrMerkleMutated:
+		return ruleError(RuleDuplicateTx, err)
+	default:
+		return ruleError(RuleBadMerkleRoot, err)
+	}
+	if len(block.Transactions)*transactions.WitnessScaleFactor > MaxBlockWeight ||
+		block.StrippedSize()*transactions.WitnessScaleFactor > MaxBlockWeight {
+		return ruleError(RuleBadBlockLength, nil)
+	}
+	if !IsCoinbase(block.Transactions[0]) {
+		return ruleError(RuleCoinbaseMissing, nil)
+	}
+	for _, tx := range block.Transactions[1:] {
+		if IsCoinbase(tx) {
+			return ruleError(RuleCoinbaseMultiple, nil)
+		}
+	}
+	txids := make(map[string]bool, len(block.Transactions))
+	sigOps := 0
+	for _, tx := range block.Transactions {
+		if err := CheckTransaction(tx); err != nil {
+			return err
+		}
+		txid := transactions.GenerateTransactionId(tx)
+		if txids[string(txid)] {
+			return ruleError(RuleDuplicateTx, errors.New(utils.HashString(txid)))
+		}
+		txids[string(txid)] = true
+		sigOps += legacySigOps(tx)
+	}
+	if sigOps*transactions.WitnessScaleFactor > MaxBlockSigOpsCost {
+		return ruleError(RuleBlockSigOps, nil)
+	}
+	return nil
+}
+
+// IsFinalTx reports whether tx may be included in a block at height whose
+// lock time cutoff, in seconds, is cutoff.
+func IsFinalTx(tx transactions.Transaction, height int32, cutoff int64) bool {
+	if tx.Locktime == 0 {
+		return true
+	}
+	limit := int64(height)
+	if tx.Locktime >= locktimeThreshold {
+		limit = cutoff
+	}
+	if int64(tx.Locktime) < limit {
+		return true
+	}
+	for _, in := range tx.Input {
+		if in.Sequence != 0xffffffff {
+			return false
+		}
+	}
+	return true
+}
+
+// ContextualCheckBlock runs the checks that depend on the height of block and
+// on the median time past of its parent: transaction finality, the BIP34
+// height in the coinbase, the witness commitment and the block weight.
+func ContextualCheckBlock(block *blockchain.Block, height int32, medianTimePast int64, params *chaincfg.ChainParams) error {
+	if len(block.Transactions) == 0 {
+		return ruleError(RuleBadBlockLength, blockchain.ErrNoTransactions)
+	}
+	if !IsCoinbase(block.Transactions[0]) {
+		return ruleError(RuleCoinbaseMissing, nil)
+	}
+	cutoff := block.Timestamp.Unix()
+	if deployed(params.CSVHeight, height) {
+		cutoff = medianTimePast
+	}
+	for _, tx := range block.Transactions {
+		if !IsFinalTx(tx, height, cutoff) {
+			return ruleError(RuleNonFinalTx, nil)
+		}
+	}
+	if deployed(params.BIP34Height, height) {
+		expected := transactions.PushInt(int64(height))
+		if !bytes.HasPrefix(block.Transactions[0].Input[0].Script, expected) {
+			return ruleError(RuleCoinbaseHeight, nil)
+		}
+	}
+	if deployed(params.SegwitHeight, height) {
+		switch err := block.CheckWitnessCommitment(); err {
+		case nil:
+		case blockchain.ErrBadWitnessNonce:
+			return ruleError(RuleWitnessNonceSize, err)
+		case blockchain.ErrBadWitnessCommitment:
+			return ruleError(RuleWitnessMerkleMatch, err)
+		default:
+			return ruleError(RuleUnexpectedWitness, err)
+		}
+	} else {
+		for _, tx := range block.Transactions {
+			if transactions.HasWitness(tx) {
+				return ruleError(RuleUnexpectedWitness, nil)
+			}
+		}
+	}
+	if block.Weight() > MaxBlockWeight {
+		return ruleError(RuleBadBlockWeight, nil)
+	}
+	return nil
+}
+
+// blockView is the UTXO set as seen by a transaction of a block being
+// validated: the set, plus the outputs and minus the inputs of the
+// transactions before it.
+type blockView struct {
+	set     *utxo.Set
+	created map[utxo.OutPoint]*utxo.Coin
+	spent   map[utxo.OutPoint]bool
+}
+
+func (view *blockView) get(outPoint utxo.OutPoint) (*utxo.Coin, error) {
+	if view.spent[outPoint] {
+		return nil, nil
+	}
+	if coin, ok := view.created[outPoint]; ok {
+		return coin, nil
+	}
+	coin, err := view.set.GetCoin(outPoint)
+	if errors.Is(err, utxo.ErrCoinNotFound) {
+		return nil, nil
+	}
+	return coin, err
+}
+
+// enforceBIP30 reports whether the block hash at height may not create
+// outputs that already exist unspent. BIP34 made that impossible until its
+// height pushes could repeat, so the check is skipped in between.
+func enforceBIP30(params *chaincfg.ChainParams, height int32, hash []byte) bool {
+	if exception, ok := bip30Exceptions[height]; ok && utils.HashString(hash) == exception {
+		return false
+	}
+	return !deployed(params.BIP34Height, height) || height >= bip34ImpliesBIP30Limit
+}
+
+// CheckBlockInputs runs the checks that need the coins block spends, which
+// must be in set: no overwritten outputs (BIP30), no missing or double
+// spends, coinbase maturity, relative lock times (BIP68), amounts and fees,
+// the signature operation cost, script verification and the coinbase value.
+// pastTimes gives the median time past of the blocks below height. set is
+// read but not modified.
+func CheckBlockInputs(block *blockchain.Block, height int32, pastTimes MedianTimeFunc, set *utxo.Set, params *chaincfg.ChainParams) error {
+	hash := block.HashBlock()
+	if enforceBIP30(params, height, hash) {
+		for _, tx := range block.Transactions {
+			txid := transactions.GenerateTransactionId(tx)
+			for j := range tx.Output {
+				_, err := set.GetCoin(utxo.NewOutPoint(txid, uint32(j)))
+				if err == nil {
+					return ruleError(RuleBIP30, fmt.Errorf("%s:%d", utils.HashString(txid), j))
+				}
+				if !errors.Is(err, utxo.ErrCoinNotFound) {
+					return err
+				}
+			}
+		}
+	}
+	enforceBIP68 := deployed(params.CSVHeight, height)
+	var medianTimePast int64
+	if enforceBIP68 {
+		var err error
+		if medianTimePast, err = pastTimes(height - 1); err != nil {
+			return err
+		}
+	}
+	view := &blockView{set: set, created: make(map[utxo.OutPoint]*utxo.Coin), spent: make(map[utxo.OutPoint]bool)}
+	flags := BlockScriptFlags(params, height, hash)
+	var fees int64
+	sigOpsCost := 0
+	for i := range block.Transactions {
+		tx := &block.Transactions[i]
+		txid := transactions.GenerateTransactionId(*tx)
+		sigOpsCost += legacySigOps(*tx) * transactions.WitnessScaleFactor
+		if i > 0 {
+			var in int64
+			prevouts := make([]transactions.TxOutput, len(tx.Input))
+			prevHeights := make([]int32, len(tx.Input))
+			for j, input := range tx.Input {
+				outPoint := utxo.NewOutPoint(input.Hash, input.Index)
+				coin, err := view.get(outPoint)
+				if err != nil {
+					return err
+				}
+				if coin == nil {
+					return ruleError(RuleMissingOrSpent, fmt.Errorf("%s:%d", utils.HashString(input.Hash), input.Index))
+				}
+				if coin.Coinbase && height-coin.Height < params.CoinbaseMaturity {
+					return ruleError(RulePrematureCoinbase, fmt.Errorf("coinbase from height %d", coin.Height))
+				}
+				in += coin.Amount
+				if !moneyRange(coin.Amount) || !moneyRange(in) {
+					return ruleError(RuleInputValuesRange, nil)
+				}
+				if flags&transactions.ScriptVerifyP2SH != 0 {
+					sigOpsCost += transactions.P2SHSigOpCount(input.Script, coin.Script) * transactions.WitnessScaleFactor
+				}
+				sigOpsCost += transactions.WitnessSigOpCount(input.Script, coin.Script, input.ScriptWitness, flags)
+				prevouts[j] = transactions.TxOutput{Amount: coin.Amount, Script: coin.Script}
+				prevHeights[j] = coin.Height
+				view.spent[outPoint] = true
+			}
+			if enforceBIP68 {
+				lock, err := CalculateSequenceLock(*tx, prevHeights, pastTimes)
+				if err != nil {
+					return err
+				}
+				if !lock.Satisfied(height, medianTimePast) {
+					return ruleError(RuleNonFinalTx, fmt.Errorf("%s is not BIP68 final", utils.HashString(txid)))
+				}
+			}
+			// Taproot signatures commit to every output the transaction
+			// spends, so scripts are only checked once all are known.
+			hashes := transactions.NewTaprootHashes(*tx, prevouts)
+			for j, input := range tx.Input {
+				checker := &transactions.SigChecker{Tx: tx, Index: j, Amount: prevouts[j].Amount, Taproot: hashes}
+				if err := transactions.VerifyScript(input.Script, prevouts[j].Script, input.ScriptWitness, flags, checker); err != nil {
+					return ruleError(RuleScriptVerify, fmt.Errorf("input %d of %s: %w", j, utils.HashString(txid), err))
+				}
+			}
+			var out int64
+			for _, output := range tx.Output {
+				out += output.Amount
+			}
+			if in < out {
+				return ruleError(RuleInputsBelowOutputs, errors.New(utils.HashString(txid)))
+			}
+			fees += in - out
+			if !moneyRange(fees) {
+				return ruleError(RuleFeeRange, nil)
+			}
+		}
+		if sigOpsCost > MaxBlockSigOpsCost {
+			return ruleError(RuleBlockSigOps, nil)
+		}
+		for j, output := range tx.Output {
+			view.created[utxo.NewOutPoint(txid, uint32(j))] = &utxo.Coin{Amount: output.Amount, Script: output.Script, Height: height, Coinbase: i == 0}
+		}
+	}
+	var coinbaseValue int64
+	for _, out := range block.Transactions[0].Output {
+		coinbaseValue += out.Amount
+	}
+	if limit := params.BlockSubsidy(height) + fees; coinbaseValue > limit {
+		return ruleError(RuleCoinbaseAmount, fmt.Errorf("coinbase pays %d, limit %d", coinbaseValue, limit))
+	}
+	return nil
+}
+
+// ValidateBlock checks everything a full node checks before connecting block
+// at height on top of set's best block, given the median times past of the
+// blocks below it. Broken rules are reported as *RuleError. On success the
+// block can be applied with set.ConnectBlock.
+func ValidateBlock(block *blockchain.Block, height int32, pastTimes MedianTimeFunc, set *utxo.Set, params *chaincfg.ChainParams) error {
+	if best, _ := set.BestBlock(); !bytes.Equal(block.HashPrev, best) {
+		return utxo.ErrNotBestBlock
+	}
+	if err := CheckBlock(block, params); err != nil {
+		return err
+	}
+	medianTimePast, err := pastTimes(height - 1)
+	if err != nil {
+		return err
+	}
+	if err := ContextualCheckBlock(block, height, medianTimePast, params); err != nil {
+		return err
+	}
+	return CheckBlockInputs(block, height, pastTimes, set, params)
+}
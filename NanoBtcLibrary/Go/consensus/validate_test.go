@@ -0,0 +1,427 @@
+package consensus_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	blockindex "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/blockindex"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	utils "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+	utxo "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utxo"
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
+	consensus "github.com/Btcercises/NanoBtcLibrary/Go/consensus"
+	secp256k1 "github.com/Btcercises/NanoBtcLibrary/Go/crypto/secp256k1"
+	cryptoutils "github.com/Btcercises/NanoBtcLibrary/Go/crypto/utils"
+	regtesttest "github.com/Btcercises/NanoBtcLibrary/Go/internal/regtesttest"
+	regtest "github.com/Btcercises/NanoBtcLibrary/Go/regtest"
+)
+
+// pastTimes returns the median times past of blocks, indexed by height.
+func pastTimes(blocks []*blockchain.Block) consensus.MedianTimeFunc {
+	return consensus.MedianTimes(func(height int32) (int64, error) {
+		return blocks[height].Timestamp.Unix(), nil
+	})
+}
+
+// modified returns a copy of block with its transactions changed by modify,
+// its commitments updated and its proof of work redone.
+func modified(t *testing.T, block *blockchain.Block, modify func(txs []transactions.Transaction) []transactions.Transaction) *blockchain.Block {
+	result := *block
+	txs := make([]transactions.Transaction, len(block.Transactions))
+	for i, tx := range block.Transactions {
+		tx.Input = append([]transactions.TxInput{}, tx.Input...)
+		tx.Output = append([]transactions.TxOutput{}, tx.Output...)
+		tx.Id = nil
+		txs[i] = tx
+	}
+	txs = modify(txs)
+	if len(txs) > 0 {
+		coinbase := &txs[0]
+		if index := blockchain.WitnessCommitmentIndex(*coinbase); index >= 0 {
+			root, _ := blockchain.WitnessMerkleRoot(txs)
+			script := append([]byte{0x6a, 0x24, 0xaa, 0x21, 0xa9, 0xed}, blockchain.WitnessCommitment(root, coinbase.Input[0].ScriptWitness[0])...)
+			coinbase.Output[index].Script = script
+			coinbase.Id = nil
+		}
+	}
+	result.Transactions = txs
+	result.TransactionCount = uint64(len(txs))
+	if err := regtesttest.Remine(&result); err != nil {
+		t.Fatal(err)
+	}
+	return &result
+}
+
+// validateCase is a change to the block at a height and the rule it breaks,
+// or "" if the block stays valid.
+type validateCase struct {
+	name   string
+	modify func(txs []transactions.Transaction) []transactions.Transaction
+	rule   consensus.Rule
+	// params replaces the regtest parameters if set.
+	params *chaincfg.ChainParams
+}
+
+// validateChain validates and connects blocks, from height 1, trying the
+// cases of each height first.
+func validateChain(t *testing.T, blocks []*blockchain.Block, cases map[int32][]validateCase) *utxo.Set {
+	set, err := utxo.Open(blockindex.NewMemoryStore(), blocks[0].HashBlock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	times := pastTimes(blocks)
+	for height := int32(1); int(height) < len(blocks); height++ {
+		block := blocks[height]
+		for _, test := range cases[height] {
+			params := test.params
+			if params == nil {
+				params = &chaincfg.RegTestParams
+			}
+			err := consensus.ValidateBlock(modified(t, block, test.modify), height, times, set, params)
+			if test.rule == "" && err != nil {
+				t.Errorf("%s: %v", test.name, err)
+			}
+			if test.rule != "" && !errors.Is(err, &consensus.RuleError{Rule: test.rule}) {
+				t.Errorf("%s: got %v, want %s", test.name, err, test.rule)
+			}
+		}
+		if err := consensus.ValidateBlock(block, height, times, set, &chaincfg.RegTestParams); err != nil {
+			t.Fatalf("block %d: %v", height, err)
+		}
+		if err := set.ConnectBlock(block, height); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return set
+}
+
+func TestValidateBlock(t *testing.T) {
+	fixture, err := regtesttest.NewSpendFixture(func(amount int64) []transactions.TxOutput {
+		return []transactions.TxOutput{{Amount: amount - 1000, Script: regtesttest.TrueScript}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := append([]*blockchain.Block{regtest.GenesisBlock()}, fixture.Blocks...)
+	spend := fixture.Spend
+	tipHeight := int32(len(blocks) - 1)
+
+	// spendWith returns a copy of spend changed by change, appended to txs.
+	spendWith := func(change func(tx *transactions.Transaction)) func(txs []transactions.Transaction) []transactions.Transaction {
+		return func(txs []transactions.Transaction) []transactions.Transaction {
+			tx := spend
+			tx.Input = append([]transactions.TxInput{}, spend.Input...)
+			tx.Output = append([]transactions.TxOutput{}, spend.Output...)
+			change(&tx)
+			return append(txs, tx)
+		}
+	}
+	// tipSpendWith changes the spend already in the tip block.
+	tipSpendWith := func(change func(tx *transactions.Transaction)) func(txs []transactions.Transaction) []transactions.Transaction {
+		return func(txs []transactions.Transaction) []transactions.Transaction {
+			change(&txs[1])
+			return txs
+		}
+	}
+	noBIP34 := chaincfg.RegTestParams
+	noBIP34.BIP34Height = -1
+	noSegwit := chaincfg.RegTestParams
+	noSegwit.SegwitHeight = 1000
+
+	cases := map[int32][]validateCase{
+		50: {
+			{name: "no transactions", modify: func([]transactions.Transaction) []transactions.Transaction {
+				return nil
+			}, rule: consensus.RuleBadBlockLength},
+			{name: "block too long", modify: spendWith(func(tx *transactions.Transaction) {
+				tx.Output[0].Script = make([]byte, consensus.MaxBlockWeight/transactions.WitnessScaleFactor)
+			}), rule: consensus.RuleBadBlockLength},
+			{name: "coinbase missing", modify: func([]transactions.Transaction) []transactions.Transaction {
+				return []transactions.Transaction{spend}
+			}, rule: consensus.RuleCoinbaseMissing},
+			{name: "coinbase script too short", modify: func(txs []transactions.Transaction) []transactions.Transaction {
+				txs[0].Input[0].Script = transactions.Script{transactions.OP_1}
+				return txs
+			}, rule: consensus.RuleCoinbaseLength},
+			{name: "no inputs", modify: spendWith(func(tx *transactions.Transaction) {
+				tx.Input = nil
+			}), rule: consensus.RuleTxInputsEmpty},
+			{name: "no outputs", modify: spendWith(func(tx *transactions.Transaction) {
+				tx.Output = nil
+			}), rule: consensus.RuleTxOutputsEmpty},
+			{name: "negative output", modify: spendWith(func(tx *transactions.Transaction) {
+				tx.Output[0].Amount = -1
+			}), rule: consensus.RuleTxOutputNegative},
+			{name: "output above the money supply", modify: spendWith(func(tx *transactions.Transaction) {
+				tx.Output[0].Amount = consensus.MaxMoney + 1
+			}), rule: consensus.RuleTxOutputTooLarge},
+			{name: "outputs above the money supply", modify: spendWith(func(tx *transactions.Transaction) {
+				tx.Output = []transactions.TxOutput{{Amount: consensus.MaxMoney}, {Amount: 1}}
+			}), rule: consensus.RuleTxOutputTotalTooLarge},
+			{name: "input spent twice", modify: spendWith(func(tx *transactions.Transaction) {
+				tx.Input = append(tx.Input, tx.Input[0])
+			}), rule: consensus.RuleTxInputsDuplicate},
+			{name: "null prevout", modify: spendWith(func(tx *transactions.Transaction) {
+				tx.Input = append(tx.Input, transactions.TxInput{Hash: make([]byte, 32), Index: 0xffffffff})
+			}), rule: consensus.RuleTxPrevOutNull},
+			{name: "too many sigops", modify: spendWith(func(tx *transactions.Transaction) {
+				tx.Output[0].Script = bytes.Repeat([]byte{transactions.OP_CHECKSIG}, consensus.MaxBlockSigOpsCost/transactions.WitnessScaleFactor+1)
+			}), rule: consensus.RuleBlockSigOps},
+			{name: "future lock time", modify: spendWith(func(tx *transactions.Transaction) {
+				tx.Locktime = 51
+				tx.Input[0].Sequence = 0
+			}), rule: consensus.RuleNonFinalTx},
+			{name: "bad coinbase height", modify: func(txs []transactions.Transaction) []transactions.Transaction {
+				txs[0].Input[0].Script = append(transactions.PushInt(49), transactions.OP_1)
+				return txs
+			}, rule: consensus.RuleCoinbaseHeight},
+			{name: "witness nonce too short", modify: func(txs []transactions.Transaction) []transactions.Transaction {
+				txs[0].Input[0].ScriptWitness = [][]byte{{1}}
+				return txs
+			}, rule: consensus.RuleWitnessNonceSize},
+			{name: "witness before segwit", modify: func(txs []transactions.Transaction) []transactions.Transaction {
+				return txs
+			}, rule: consensus.RuleUnexpectedWitness, params: &noSegwit},
+			{name: "block too heavy", modify: spendWith(func(tx *transactions.Transaction) {
+				tx.Input[0].ScriptWitness = [][]byte{make([]byte, consensus.MaxBlockWeight)}
+			}), rule: consensus.RuleBadBlockWeight},
+			{name: "premature coinbase spend", modify: spendWith(func(*transactions.Transaction) {}), rule: consensus.RulePrematureCoinbase},
+			{name: "missing input", modify: spendWith(func(tx *transactions.Transaction) {
+				tx.Input[0] = transactions.TxInput{Hash: make([]byte, 32), Index: 3, Sequence: 0xffffffff}
+			}), rule: consensus.RuleMissingOrSpent},
+			{name: "coinbase overwriting an unspent one", modify: func(txs []transactions.Transaction) []transactions.Transaction {
+				txs[0] = blocks[49].Transactions[0]
+				txs[0].Output = append([]transactions.TxOutput{}, txs[0].Output...)
+				return txs
+			}, rule: consensus.RuleBIP30, params: &noBIP34},
+		},
+		tipHeight: {
+			{name: "coinbase overpays", modify: func(txs []transactions.Transaction) []transactions.Transaction {
+				txs[0].Output[0].Amount++
+				return txs
+			}, rule: consensus.RuleCoinbaseAmount},
+			{name: "duplicate transaction", modify: func(txs []transactions.Transaction) []transactions.Transaction {
+				return append(txs, txs[1])
+			}, rule: consensus.RuleDuplicateTx},
+			{name: "second coinbase", modify: func(txs []transactions.Transaction) []transactions.Transaction {
+				return append(txs, txs[0])
+			}, rule: consensus.RuleCoinbaseMultiple},
+			{name: "double spend in the block", modify: spendWith(func(tx *transactions.Transaction) {
+				tx.Output[0].Amount--
+			}), rule: consensus.RuleMissingOrSpent},
+			{name: "outputs above inputs", modify: tipSpendWith(func(tx *transactions.Transaction) {
+				tx.Output[0].Amount += 1001
+			}), rule: consensus.RuleInputsBelowOutputs},
+			{name: "relative height lock", modify: tipSpendWith(func(tx *transactions.Transaction) {
+				tx.Input[0].Sequence = uint32(tipHeight)
+			}), rule: consensus.RuleNonFinalTx},
+			{name: "relative time lock on an output of the block", modify: func(txs []transactions.Transaction) []transactions.Transaction {
+				child := transactions.Transaction{
+					Version: 2,
+					Input:   []transactions.TxInput{{Hash: transactions.GenerateTransactionId(txs[1]), Sequence: transactions.SequenceLockTimeTypeFlag | 1}},
+					Output:  []transactions.TxOutput{{Amount: txs[1].Output[0].Amount - 1000, Script: regtesttest.TrueScript}},
+				}
+				return append(txs, child)
+			}, rule: consensus.RuleNonFinalTx},
+			// Time locks count from the block before the coin's, the
+			// genesis block here, years before the tip.
+			{name: "expired relative time lock", modify: tipSpendWith(func(tx *transactions.Transaction) {
+				tx.Input[0].Sequence = transactions.SequenceLockTimeTypeFlag | transactions.SequenceLockTimeMask
+			})},
+			{name: "expired relative height lock", modify: tipSpendWith(func(tx *transactions.Transaction) {
+				tx.Input[0].Sequence = uint32(tipHeight - 1)
+			})},
+			{name: "relative lock in a version 1 transaction", modify: tipSpendWith(func(tx *transactions.Transaction) {
+				tx.Version = 1
+				tx.Input[0].Sequence = uint32(tipHeight)
+			})},
+		},
+	}
+	validateChain(t, blocks, cases)
+
+	params := &chaincfg.RegTestParams
+	tamper := func(change func(block *blockchain.Block)) *blockchain.Block {
+		block := modified(t, blocks[tipHeight], func(txs []transactions.Transaction) []transactions.Transaction { return txs })
+		change(block)
+		block.Hash = nil
+		return block
+	}
+	highHash := tamper(func(block *blockchain.Block) { block.TargetDifficulty = 0x1d00ffff })
+	if err := consensus.CheckBlock(highHash, params); !errors.Is(err, &consensus.RuleError{Rule: consensus.RuleHighHash}) {
+		t.Fatalf("block above the target gave %v", err)
+	}
+	badMerkle := tamper(func(block *blockchain.Block) {
+		block.Transactions = block.Transactions[:1]
+		if _, _, err := consensus.NewProof(&block.BlockHeader).Run(); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err := consensus.CheckBlock(badMerkle, params); !errors.Is(err, &consensus.RuleError{Rule: consensus.RuleBadMerkleRoot}) {
+		t.Fatalf("block with a dropped transaction gave %v", err)
+	}
+	badCommitment := tamper(func(block *blockchain.Block) {
+		coinbase := &block.Transactions[0]
+		index := blockchain.WitnessCommitmentIndex(*coinbase)
+		coinbase.Output[index].Script = append([]byte{}, coinbase.Output[index].Script...)
+		coinbase.Output[index].Script[10] ^= 1
+		coinbase.Id = nil
+		if err := regtesttest.Remine(block); err != nil {
+			t.Fatal(err)
+		}
+	})
+	if err := consensus.ContextualCheckBlock(badCommitment, tipHeight, 0, params); !errors.Is(err, &consensus.RuleError{Rule: consensus.RuleWitnessMerkleMatch}) {
+		t.Fatalf("altered witness commitment gave %v", err)
+	}
+	// ContextualCheckBlock does not count on CheckBlock having run first.
+	empty := tamper(func(block *blockchain.Block) { block.Transactions = nil })
+	if err := consensus.ContextualCheckBlock(empty, tipHeight, 0, params); !errors.Is(err, &consensus.RuleError{Rule: consensus.RuleBadBlockLength}) {
+		t.Fatalf("block without transactions gave %v", err)
+	}
+	noCoinbaseInput := tamper(func(block *blockchain.Block) { block.Transactions[0].Input = nil })
+	if err := consensus.ContextualCheckBlock(noCoinbaseInput, tipHeight, 0, params); !errors.Is(err, &consensus.RuleError{Rule: consensus.RuleCoinbaseMissing}) {
+		t.Fatalf("coinbase without inputs gave %v", err)
+	}
+	if _, err := pastTimes(blocks)(-1); err != consensus.ErrNoMedianTime {
+		t.Fatalf("median time past before genesis gave %v", err)
+	}
+
+	oversize := spend
+	oversize.Output = []transactions.TxOutput{{Script: make([]byte, consensus.MaxBlockWeight/transactions.WitnessScaleFactor)}}
+	if err := consensus.CheckTransaction(oversize); !errors.Is(err, &consensus.RuleError{Rule: consensus.RuleTxOversize}) {
+		t.Fatalf("oversize transaction gave %v", err)
+	}
+}
+
+// TestValidateBlockSignedSpends validates a block spending P2PKH, P2WPKH and
+// P2SH outputs with real signatures, and the same block with each broken.
+func TestValidateBlockSignedSpends(t *testing.T) {
+	fixture, err := regtesttest.NewSpendFixture(func(amount int64) []transactions.TxOutput {
+		return []transactions.TxOutput{{Amount: amount - 1000, Script: regtesttest.TrueScript}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := fixture.Chain
+	key, err := secp256k1.NewPrivateKey(big.NewInt(0xc0ffee))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pubKey := key.PubKey().SerializeCompressed()
+	keyHash := cryptoutils.Hash160(pubKey)
+	p2pkh := append(append(transactions.Script{transactions.OP_DUP, transactions.OP_HASH160}, transactions.PushData(keyHash)...), transactions.OP_EQUALVERIFY, transactions.OP_CHECKSIG)
+	p2wpkh := append(transactions.Script{transactions.OP_0}, transactions.PushData(keyHash)...)
+	redeem := append(transactions.PushData(pubKey), transactions.OP_CHECKSIG)
+	p2sh := append(append(transactions.Script{transactions.OP_HASH160}, transactions.PushData(cryptoutils.Hash160(redeem))...), transactions.OP_EQUAL)
+
+	coinbase := fixture.Blocks[1].Transactions[0]
+	fund := transactions.Transaction{
+		Version: 2,
+		Input:   []transactions.TxInput{{Hash: transactions.GenerateTransactionId(coinbase), Sequence: 0xffffffff}},
+		Output: []transactions.TxOutput{
+			{Amount: 100000, Script: p2pkh},
+			{Amount: 200000, Script: p2wpkh},
+			{Amount: 300000, Script: p2sh},
+		},
+	}
+	if err := chain.AddTransaction(fund); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.GenerateToScript(1, regtesttest.TrueScript); err != nil {
+		t.Fatal(err)
+	}
+
+	fundId := transactions.GenerateTransactionId(fund)
+	spend := transactions.Transaction{Version: 2, Output: []transactions.TxOutput{{Amount: 590000, Script: regtesttest.TrueScript}}}
+	for i := range fund.Output {
+		spend.Input = append(spend.Input, transactions.TxInput{Hash: fundId, Index: uint32(i), Sequence: 0xffffffff})
+	}
+	sign := func(hash []byte) []byte {
+		return append(key.Sign(hash).Serialize(), transactions.SigHashAll)
+	}
+	p2pkhSig := sign(transactions.LegacySignatureHash(spend, 0, p2pkh, transactions.SigHashAll))
+	p2wpkhSig := sign(transactions.WitnessV0SignatureHash(spend, 1, p2pkh, 200000, transactions.SigHashAll))
+	p2shSig := sign(transactions.LegacySignatureHash(spend, 2, redeem, transactions.SigHashAll))
+	spend.Input[0].Script = append(transactions.PushData(p2pkhSig), transactions.PushData(pubKey)...)
+	spend.Input[1].ScriptWitness = [][]byte{p2wpkhSig, pubKey}
+	spend.Input[2].Script = append(transactions.PushData(p2shSig), transactions.PushData(redeem)...)
+	if err := chain.AddTransaction(spend); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.GenerateToScript(1, regtesttest.TrueScript); err != nil {
+		t.Fatal(err)
+	}
+
+	blocks := make([]*blockchain.Block, chain.Height()+1)
+	for height := range blocks {
+		if blocks[height], err = chain.BlockAtHeight(int32(height)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// broken changes input index of the spend in the tip block.
+	broken := func(name string, index int, change func(in *transactions.TxInput)) validateCase {
+		return validateCase{name: name, rule: consensus.RuleScriptVerify, modify: func(txs []transactions.Transaction) []transactions.Transaction {
+			change(&txs[1].Input[index])
+			return txs
+		}}
+	}
+	otherSig := sign(transactions.LegacySignatureHash(spend, 1, p2pkh, transactions.SigHashAll))
+	otherKey, err := secp256k1.NewPrivateKey(big.NewInt(0xbeef))
+	if err != nil {
+		t.Fatal(err)
+	}
+	validateChain(t, blocks, map[int32][]validateCase{
+		chain.Height(): {
+			broken("P2PKH signature of another input", 0, func(in *transactions.TxInput) {
+				in.Script = append(transactions.PushData(otherSig), transactions.PushData(pubKey)...)
+			}),
+			broken("P2PKH with another key", 0, func(in *transactions.TxInput) {
+				in.Script = append(transactions.PushData(p2pkhSig), transactions.PushData(otherKey.PubKey().SerializeCompressed())...)
+			}),
+			broken("P2WPKH signed for another amount", 1, func(in *transactions.TxInput) {
+				in.ScriptWitness = [][]byte{sign(transactions.WitnessV0SignatureHash(spend, 1, p2pkh, 200001, transactions.SigHashAll)), pubKey}
+			}),
+			broken("P2WPKH spent from the script sig", 1, func(in *transactions.TxInput) {
+				in.Script = append(transactions.PushData(p2wpkhSig), transactions.PushData(pubKey)...)
+				in.ScriptWitness = nil
+			}),
+			broken("P2SH with another redeem script", 2, func(in *transactions.TxInput) {
+				in.Script = append(transactions.PushData(p2shSig), transactions.PushData(append(redeem[:len(redeem)-1:len(redeem)-1], transactions.OP_CHECKSIGVERIFY))...)
+			}),
+			broken("P2SH without its signature", 2, func(in *transactions.TxInput) {
+				in.Script = transactions.PushData(redeem)
+			}),
+		},
+	})
+}
+
+func TestBlockScriptFlags(t *testing.T) {
+	hash := func(s string) []byte {
+		bin, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return utils.ReverseByteArray(bin)
+	}
+	params := &chaincfg.MainNetParams
+	all := transactions.ScriptVerifyP2SH | transactions.ScriptVerifyWitness | transactions.ScriptVerifyTaproot
+	tests := []struct {
+		name   string
+		height int32
+		hash   []byte
+		want   transactions.ScriptFlags
+	}{
+		{"early block", 1000, nil, all},
+		{"BIP16 exception", 170060, hash("00000000000002dc756eebf4f49723ed8d30cc28a5f108eb94b1ba88ac4f9c22"), 0},
+		{"taproot exception", 692261, hash("0000000000000000000f14c35b2d841e986ab5441de8c585d5ffe55ea1e395ad"), transactions.ScriptVerifyConsensus &^ transactions.ScriptVerifyTaproot},
+		{"after segwit", params.SegwitHeight, nil, transactions.ScriptVerifyConsensus},
+	}
+	for _, test := range tests {
+		if got := consensus.BlockScriptFlags(params, test.height, test.hash); got != test.want {
+			t.Errorf("%s: got %b, want %b", test.name, got, test.want)
+		}
+	}
+}
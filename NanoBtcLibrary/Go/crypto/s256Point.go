@@ -7,6 +7,7 @@ import (
 	btcMath "github.com/Btcercises/NanoBtcLibrary/Go/math"
 	"github.com/Btcercises/NanoBtcLibrary/Go/math/utils"
 
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
 	cryptoUtils "github.com/Btcercises/NanoBtcLibrary/Go/crypto/utils"
 	"github.com/Btcercises/NanoBtcLibrary/Go/math"
 	base58 "github.com/btcsuite/btcutil/base58"
@@ -106,14 +107,7 @@ func hash160(p S256Point, compressed bool) []byte {
 	return cryptoUtils.Hash160(bytes)
 }
 
-func GenerateAddress(p S256Point, compressed bool, testnet bool) string {
-	h160 := Sec(p, true)
-	prefix := "x6f"
-	if testnet {
-		prefix = "x00"
-	}
-	prefix = "x00"
-	address := prefix + h160
-	return base58.Encode([]byte(address))
-
+// GenerateAddress returns the base58check P2PKH address of p on the network.
+func GenerateAddress(p S256Point, compressed bool, params *chaincfg.ChainParams) string {
+	return base58.CheckEncode(hash160(p, compressed), params.PubKeyHashAddrId)
 }
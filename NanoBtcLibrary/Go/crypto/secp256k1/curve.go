@@ -0,0 +1,142 @@
+// Package secp256k1 implements the curve arithmetic, key encodings and ECDSA
+// signatures used by Bitcoin scripts. It favours clarity over speed and is
+// not constant time, so it must not be used to sign with valuable keys.
+package secp256k1
+
+import (
+	"math/big"
+)
+
+func hexToBig(str string) *big.Int {
+	result, ok := new(big.Int).SetString(str, 16)
+	if !ok {
+		panic("invalid hex constant " + str)
+	}
+	return result
+}
+
+var (
+	// P is the order of the field.
+	P = hexToBig("fffffffffffffffffffffffffffffffffffffffffffffffffffffffefffffc2f")
+	// N is the order of the group generated by G.
+	N = hexToBig("fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141")
+	// G is the generator.
+	G = &Point{
+		X: hexToBig("79be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798"),
+		Y: hexToBig("483ada7726a3c4655da4fbfc0e1108a8fd17b448a68554199c47d08ffb10d4b8"),
+	}
+
+	halfN   = new(big.Int).Rsh(N, 1)
+	curveB  = big.NewInt(7)
+	sqrtExp = new(big.Int).Rsh(new(big.Int).Add(P, big.NewInt(1)), 2)
+)
+
+// Point is a point of the curve in affine coordinates. The point at infinity
+// has nil coordinates.
+type Point struct {
+	X, Y *big.Int
+}
+
+func (p *Point) IsInfinity() bool {
+	return p.X == nil
+}
+
+// IsOnCurve reports whether y² = x³ + 7 holds.
+func (p *Point) IsOnCurve() bool {
+	if p.IsInfinity() {
+		return false
+	}
+	left := new(big.Int).Mul(p.Y, p.Y)
+	left.Mod(left, P)
+	return left.Cmp(curveRight(p.X)) == 0
+}
+
+// curveRight returns x³ + 7 mod P.
+func curveRight(x *big.Int) *big.Int {
+	result := new(big.Int).Exp(x, big.NewInt(3), P)
+	result.Add(result, curveB)
+	return result.Mod(result, P)
+}
+
+// Add returns p + q.
+func Add(p, q *Point) *Point {
+	if p.IsInfinity() {
+		return q
+	}
+	if q.IsInfinity() {
+		return p
+	}
+	if p.X.Cmp(q.X) == 0 {
+		if p.Y.Cmp(q.Y) != 0 || p.Y.Sign() == 0 {
+			return &Point{}
+		}
+		return Double(p)
+	}
+	slope := new(big.Int).Sub(q.Y, p.Y)
+	denominator := new(big.Int).Sub(q.X, p.X)
+	denominator.Mod(denominator, P)
+	slope.Mul(slope, denominator.ModInverse(denominator, P))
+	slope.Mod(slope, P)
+	return pointFromSlope(p, q.X, slope)
+}
+
+// Double returns 2p.
+func Double(p *Point) *Point {
+	if p.IsInfinity() || p.Y.Sign() == 0 {
+		return &Point{}
+	}
+	slope := new(big.Int).Mul(p.X, p.X)
+	slope.Mul(slope, big.NewInt(3))
+	denominator := new(big.Int).Lsh(p.Y, 1)
+	slope.Mul(slope, denominator.ModInverse(denominator, P))
+	slope.Mod(slope, P)
+	return pointFromSlope(p, p.X, slope)
+}
+
+// pointFromSlope finishes an addition of p and a point with x coordinate qx.
+func pointFromSlope(p *Point, qx, slope *big.Int) *Point {
+	x := new(big.Int).Mul(slope, slope)
+	x.Sub(x, p.X)
+	x.Sub(x, qx)
+	x.Mod(x, P)
+	y := new(big.Int).Sub(p.X, x)
+	y.Mul(y, slope)
+	y.Sub(y, p.Y)
+	y.Mod(y, P)
+	return &Point{X: x, Y: y}
+}
+
+// ScalarMult returns k·p.
+func ScalarMult(p *Point, k *big.Int) *Point {
+	result := &Point{}
+	scalar := new(big.Int).Mod(k, N)
+	for i := scalar.BitLen() - 1; i >= 0; i-- {
+		result = Double(result)
+		if scalar.Bit(i) == 1 {
+			result = Add(result, p)
+		}
+	}
+	return result
+}
+
+// ScalarBaseMult returns k·G.
+func ScalarBaseMult(k *big.Int) *Point {
+	return ScalarMult(G, k)
+}
+
+// liftX returns the point with x coordinate x and a y of the given parity.
+func liftX(x *big.Int, odd bool) (*Point, bool) {
+	if x.Cmp(P) >= 0 {
+		return nil, false
+	}
+	right := curveRight(x)
+	y := new(big.Int).Exp(right, sqrtExp, P)
+	check := new(big.Int).Mul(y, y)
+	if check.Mod(check, P).Cmp(right) != 0 {
+		return nil, false
+	}
+	if (y.Bit(0) == 1) != odd {
+		y.Sub(P, y)
+	}
+	return &Point{X: new(big.Int).Set(x), Y: y}, true
+}
@@ -0,0 +1,164 @@
+package secp256k1
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+var ErrInvalidSignature = errors.New("invalid DER signature")
+
+type Signature struct {
+	R, S *big.Int
+}
+
+// hashToInt interprets a 32-byte message hash as a scalar, as bits2int of
+// RFC 6979 does for a 256-bit group.
+func hashToInt(hash []byte) *big.Int {
+	if len(hash) > 32 {
+		hash = hash[:32]
+	}
+	return new(big.Int).SetBytes(hash)
+}
+
+// nonceRFC6979 returns the deterministic nonce of RFC 6979 with HMAC-SHA256.
+// The nth valid candidate is returned, so callers can retry on a zero r or s.
+func nonceRFC6979(key *big.Int, hash []byte, skip int) *big.Int {
+	x := key.FillBytes(make([]byte, 32))
+	h := new(big.Int).Mod(hashToInt(hash), N).FillBytes(make([]byte, 32))
+	v := make([]byte, 32)
+	k := make([]byte, 32)
+	for i := range v {
+		v[i] = 0x01
+	}
+	mac := func(key []byte, data ...[]byte) []byte {
+		m := hmac.New(sha256.New, key)
+		for _, d := range data {
+			m.Write(d)
+		}
+		return m.Sum(nil)
+	}
+	k = mac(k, v, []byte{0x00}, x, h)
+	v = mac(k, v)
+	k = mac(k, v, []byte{0x01}, x, h)
+	v = mac(k, v)
+	for {
+		v = mac(k, v)
+		candidate := new(big.Int).SetBytes(v)
+		if candidate.Sign() > 0 && candidate.Cmp(N) < 0 {
+			if skip == 0 {
+				return candidate
+			}
+			skip--
+		}
+		k = mac(k, v, []byte{0x00})
+		v = mac(k, v)
+	}
+}
+
+// Sign signs a 32-byte hash with a deterministic nonce and returns a
+// signature with a low S, as required by Bitcoin Core's standardness rules.
+func (key *PrivateKey) Sign(hash []byte) *Signature {
+	e := hashToInt(hash)
+	for attempt := 0; ; attempt++ {
+		k := nonceRFC6979(key.D, hash, attempt)
+		r := new(big.Int).Mod(ScalarBaseMult(k).X, N)
+		if r.Sign() == 0 {
+			continue
+		}
+		s := new(big.Int).Mul(r, key.D)
+		s.Add(s, e)
+		s.Mul(s, new(big.Int).ModInverse(k, N))
+		s.Mod(s, N)
+		if s.Sign() == 0 {
+			continue
+		}
+		if s.Cmp(halfN) > 0 {
+			s.Sub(N, s)
+		}
+		return &Signature{R: r, S: s}
+	}
+}
+
+// Verify reports whether sig is a signature of hash by key. High S values are
+// accepted, as consensus does.
+func (sig *Signature) Verify(hash []byte, key *PublicKey) bool {
+	if sig.R.Sign() <= 0 || sig.S.Sign() <= 0 || sig.R.Cmp(N) >= 0 || sig.S.Cmp(N) >= 0 {
+		return false
+	}
+	w := new(big.Int).ModInverse(sig.S, N)
+	u1 := new(big.Int).Mul(hashToInt(hash), w)
+	u1.Mod(u1, N)
+	u2 := new(big.Int).Mul(sig.R, w)
+	u2.Mod(u2, N)
+	point := Add(ScalarBaseMult(u1), ScalarMult(&key.Point, u2))
+	if point.IsInfinity() {
+		return false
+	}
+	return new(big.Int).Mod(point.X, N).Cmp(sig.R) == 0
+}
+
+// IsLowS reports whether S is at most N/2.
+func (sig *Signature) IsLowS() bool {
+	return sig.S.Cmp(halfN) <= 0
+}
+
+func derInteger(n *big.Int) []byte {
+	bytes := n.Bytes()
+	if len(bytes) == 0 || bytes[0]&0x80 != 0 {
+		bytes = append([]byte{0x00}, bytes...)
+	}
+	return append([]byte{0x02, byte(len(bytes))}, bytes...)
+}
+
+// Serialize returns the DER encoding of the signature.
+func (sig *Signature) Serialize() []byte {
+	r := derInteger(sig.R)
+	s := derInteger(sig.S)
+	result := []byte{0x30, byte(len(r) + len(s))}
+	result = append(result, r...)
+	return append(result, s...)
+}
+
+// IsValidDER reports whether data is a strictly encoded DER signature, as
+// BIP66 requires, without a sighash byte.
+func IsValidDER(data []byte) bool {
+	if len(data) < 8 || len(data) > 72 {
+		return false
+	}
+	if data[0] != 0x30 || int(data[1]) != len(data)-2 {
+		return false
+	}
+	rLength := int(data[3])
+	if data[2] != 0x02 || rLength == 0 || 5+rLength >= len(data) {
+		return false
+	}
+	sLength := int(data[5+rLength])
+	if data[4+rLength] != 0x02 || sLength == 0 || rLength+sLength+6 != len(data) {
+		return false
+	}
+	r := data[4 : 4+rLength]
+	s := data[6+rLength:]
+	for _, integer := range [][]byte{r, s} {
+		if integer[0]&0x80 != 0 {
+			return false
+		}
+		if len(integer) > 1 && integer[0] == 0x00 && integer[1]&0x80 == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseDERSignature decodes a strictly encoded DER signature.
+func ParseDERSignature(data []byte) (*Signature, error) {
+	if !IsValidDER(data) {
+		return nil, ErrInvalidSignature
+	}
+	rLength := int(data[3])
+	return &Signature{
+		R: new(big.Int).SetBytes(data[4 : 4+rLength]),
+		S: new(big.Int).SetBytes(data[6+rLength:]),
+	}, nil
+}
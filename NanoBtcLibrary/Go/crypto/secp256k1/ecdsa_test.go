@@ -0,0 +1,49 @@
+package secp256k1
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/big"
+	"testing"
+)
+
+func TestSignRFC6979(t *testing.T) {
+	key, err := NewPrivateKey(big.NewInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hash := sha256.Sum256([]byte("Satoshi Nakamoto"))
+	sig := key.Sign(hash[:])
+	want := "3045022100934b1ea10a4b3c1757e2b0c017d0b6143ce3c9a7e6a4a49860d7a6ab210ee3d802202442ce9d2b916064108014783e923ec36b49743e2ffa1c4496f01a512aafd9e5"
+	if hex.EncodeToString(sig.Serialize()) != want {
+		t.Fatalf("signature %x", sig.Serialize())
+	}
+	if !sig.Verify(hash[:], key.PubKey()) {
+		t.Fatal("signature does not verify")
+	}
+	hash[0] ^= 1
+	if sig.Verify(hash[:], key.PubKey()) {
+		t.Fatal("signature verifies another hash")
+	}
+}
+
+func TestPublicKeyEncoding(t *testing.T) {
+	key, err := NewPrivateKey(big.NewInt(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	compressed := key.PubKey().SerializeCompressed()
+	if hex.EncodeToString(compressed) != "0279be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798" {
+		t.Fatalf("compressed %x", compressed)
+	}
+	for _, encoding := range [][]byte{compressed, key.PubKey().SerializeUncompressed()} {
+		parsed, err := ParsePublicKey(encoding)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(parsed.SerializeCompressed(), compressed) {
+			t.Fatal("round trip changed the key")
+		}
+	}
+}
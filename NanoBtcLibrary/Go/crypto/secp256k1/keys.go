@@ -0,0 +1,98 @@
+package secp256k1
+
+import (
+	"crypto/rand"
+	"errors"
+	"math/big"
+)
+
+var (
+	ErrInvalidPublicKey  = errors.New("invalid public key")
+	ErrInvalidPrivateKey = errors.New("private key out of range")
+)
+
+const (
+	CompressedPubKeySize   = 33
+	UncompressedPubKeySize = 65
+)
+
+type PublicKey struct {
+	Point
+}
+
+// ParsePublicKey decodes a compressed or uncompressed SEC public key.
+func ParsePublicKey(data []byte) (*PublicKey, error) {
+	switch {
+	case len(data) == CompressedPubKeySize && (data[0] == 0x02 || data[0] == 0x03):
+		point, ok := liftX(new(big.Int).SetBytes(data[1:]), data[0] == 0x03)
+		if !ok {
+			return nil, ErrInvalidPublicKey
+		}
+		return &PublicKey{*point}, nil
+	case len(data) == UncompressedPubKeySize && data[0] == 0x04:
+		key := &PublicKey{Point{X: new(big.Int).SetBytes(data[1:33]), Y: new(big.Int).SetBytes(data[33:])}}
+		if key.X.Cmp(P) >= 0 || key.Y.Cmp(P) >= 0 || !key.IsOnCurve() {
+			return nil, ErrInvalidPublicKey
+		}
+		return key, nil
+	}
+	return nil, ErrInvalidPublicKey
+}
+
+// SerializeCompressed returns the 33-byte SEC encoding of the key.
+func (key *PublicKey) SerializeCompressed() []byte {
+	result := make([]byte, CompressedPubKeySize)
+	result[0] = 0x02 + byte(key.Y.Bit(0))
+	key.X.FillBytes(result[1:])
+	return result
+}
+
+// SerializeUncompressed returns the 65-byte SEC encoding of the key.
+func (key *PublicKey) SerializeUncompressed() []byte {
+	result := make([]byte, UncompressedPubKeySize)
+	result[0] = 0x04
+	key.X.FillBytes(result[1:33])
+	key.Y.FillBytes(result[33:])
+	return result
+}
+
+type PrivateKey struct {
+	D *big.Int
+	PublicKey
+}
+
+// NewPrivateKey returns the key with secret d, which must be in [1, N-1].
+func NewPrivateKey(d *big.Int) (*PrivateKey, error) {
+	if d.Sign() <= 0 || d.Cmp(N) >= 0 {
+		return nil, ErrInvalidPrivateKey
+	}
+	return &PrivateKey{D: new(big.Int).Set(d), PublicKey: PublicKey{*ScalarBaseMult(d)}}, nil
+}
+
+// PrivateKeyFromBytes interprets 32 bytes as a big endian secret.
+func PrivateKeyFromBytes(data []byte) (*PrivateKey, error) {
+	return NewPrivateKey(new(big.Int).SetBytes(data))
+}
+
+// GeneratePrivateKey returns a random key.
+func GeneratePrivateKey() (*PrivateKey, error) {
+	for {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+		if key, err := PrivateKeyFromBytes(secret); err == nil {
+			return key, nil
+		}
+	}
+}
+
+// Serialize returns the secret as 32 big endian bytes.
+func (key *PrivateKey) Serialize() []byte {
+	return key.D.FillBytes(make([]byte, 32))
+}
+
+// PubKey returns the public key of key.
+func (key *PrivateKey) PubKey() *PublicKey {
+	return &key.PublicKey
+}
@@ -0,0 +1,149 @@
+package secp256k1
+
+import (
+	"crypto/sha256"
+	"errors"
+	"math/big"
+)
+
+const (
+	XOnlyPubKeySize  = 32
+	SchnorrSigSize   = 64
+	schnorrScalarLen = 32
+)
+
+var (
+	ErrInvalidAuxRandomness = errors.New("auxiliary randomness must be 32 bytes")
+	ErrInvalidTweak         = errors.New("tweak out of range or cancels the key")
+	ErrZeroNonce            = errors.New("nonce is zero")
+)
+
+// TaggedHash returns the BIP340 hash SHA256(SHA256(tag) || SHA256(tag) || data).
+func TaggedHash(tag string, data ...[]byte) []byte {
+	tagHash := sha256.Sum256([]byte(tag))
+	hasher := sha256.New()
+	hasher.Write(tagHash[:])
+	hasher.Write(tagHash[:])
+	for _, d := range data {
+		hasher.Write(d)
+	}
+	return hasher.Sum(nil)
+}
+
+// ParseXOnlyPublicKey decodes a 32-byte BIP340 public key, the point with
+// that x coordinate and an even y.
+func ParseXOnlyPublicKey(data []byte) (*PublicKey, error) {
+	if len(data) != XOnlyPubKeySize {
+		return nil, ErrInvalidPublicKey
+	}
+	point, ok := liftX(new(big.Int).SetBytes(data), false)
+	if !ok {
+		return nil, ErrInvalidPublicKey
+	}
+	return &PublicKey{*point}, nil
+}
+
+// SerializeXOnly returns the 32-byte x coordinate of the key.
+func (key *PublicKey) SerializeXOnly() []byte {
+	return key.X.FillBytes(make([]byte, XOnlyPubKeySize))
+}
+
+// HasEvenY reports whether the y coordinate of the key is even.
+func (key *PublicKey) HasEvenY() bool {
+	return key.Y.Bit(0) == 0
+}
+
+// schnorrChallenge returns the BIP340 challenge e of a signature with nonce
+// point x coordinate r.
+func schnorrChallenge(r, pubKey, msg []byte) *big.Int {
+	e := new(big.Int).SetBytes(TaggedHash("BIP0340/challenge", r, pubKey, msg))
+	return e.Mod(e, N)
+}
+
+// SignSchnorr returns the BIP340 signature of msg. aux is 32 bytes of
+// auxiliary randomness; zeroes give a deterministic signature.
+func (key *PrivateKey) SignSchnorr(msg, aux []byte) ([]byte, error) {
+	if len(aux) != 32 {
+		return nil, ErrInvalidAuxRandomness
+	}
+	d := new(big.Int).Set(key.D)
+	if !key.HasEvenY() {
+		d.Sub(N, d)
+	}
+	pubKey := key.SerializeXOnly()
+	masked := new(big.Int).SetBytes(TaggedHash("BIP0340/aux", aux))
+	masked.Xor(masked, d)
+	nonce := TaggedHash("BIP0340/nonce", masked.FillBytes(make([]byte, 32)), pubKey, msg)
+	k := new(big.Int).SetBytes(nonce)
+	k.Mod(k, N)
+	if k.Sign() == 0 {
+		return nil, ErrZeroNonce
+	}
+	nonceKey := PublicKey{*ScalarBaseMult(k)}
+	if !nonceKey.HasEvenY() {
+		k.Sub(N, k)
+	}
+	r := nonceKey.SerializeXOnly()
+	s := schnorrChallenge(r, pubKey, msg)
+	s.Mul(s, d)
+	s.Add(s, k)
+	s.Mod(s, N)
+	return append(r, s.FillBytes(make([]byte, schnorrScalarLen))...), nil
+}
+
+// VerifySchnorr reports whether sig is a BIP340 signature of msg by the
+// x-only public key pubKey.
+func VerifySchnorr(sig, msg, pubKey []byte) bool {
+	if len(sig) != SchnorrSigSize {
+		return false
+	}
+	key, err := ParseXOnlyPublicKey(pubKey)
+	if err != nil {
+		return false
+	}
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:])
+	if r.Cmp(P) >= 0 || s.Cmp(N) >= 0 {
+		return false
+	}
+	e := schnorrChallenge(sig[:32], pubKey, msg)
+	// R = s·G - e·P
+	point := Add(ScalarBaseMult(s), ScalarMult(&key.Point, new(big.Int).Sub(N, e)))
+	if point.IsInfinity() || point.Y.Bit(0) != 0 {
+		return false
+	}
+	return point.X.Cmp(r) == 0
+}
+
+// TweakPublicKey returns the point key + tweak·G, as taproot uses to commit
+// to a script tree. It fails if tweak is not below N or the sum is infinity.
+func TweakPublicKey(key *PublicKey, tweak []byte) (*PublicKey, error) {
+	t := new(big.Int).SetBytes(tweak)
+	if t.Cmp(N) >= 0 {
+		return nil, ErrInvalidTweak
+	}
+	point := Add(&key.Point, ScalarBaseMult(t))
+	if point.IsInfinity() {
+		return nil, ErrInvalidTweak
+	}
+	return &PublicKey{*point}, nil
+}
+
+// TweakPrivateKey returns the key of TweakPublicKey applied to the x-only
+// public key of key, that is with key negated first if its y is odd.
+func TweakPrivateKey(key *PrivateKey, tweak []byte) (*PrivateKey, error) {
+	t := new(big.Int).SetBytes(tweak)
+	if t.Cmp(N) >= 0 {
+		return nil, ErrInvalidTweak
+	}
+	d := new(big.Int).Set(key.D)
+	if !key.HasEvenY() {
+		d.Sub(N, d)
+	}
+	d.Add(d, t)
+	d.Mod(d, N)
+	if d.Sign() == 0 {
+		return nil, ErrInvalidTweak
+	}
+	return NewPrivateKey(d)
+}
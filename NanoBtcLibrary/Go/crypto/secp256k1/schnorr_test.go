@@ -0,0 +1,81 @@
+package secp256k1
+
+import (
+	"bytes"
+	"encoding/hex"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+// bip340Vectors are test vectors of BIP340; the secret key is empty for the
+// verification only ones.
+var bip340Vectors = []struct {
+	secretKey, publicKey, aux, msg, sig string
+	valid                               bool
+}{
+	{"0000000000000000000000000000000000000000000000000000000000000003", "F9308A019258C31049344F85F89D5229B531C845836F99B08601F113BCE036F9", "0000000000000000000000000000000000000000000000000000000000000000", "0000000000000000000000000000000000000000000000000000000000000000", "E907831F80848D1069A5371B402410364BDF1C5F8307B0084C55F1CE2DCA821525F66A4A85EA8B71E482A74F382D2CE5EBEEE8FDB2172F477DF4900D310536C0", true},
+	{"B7E151628AED2A6ABF7158809CF4F3C762E7160F38B4DA56A784D9045190CFEF", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "0000000000000000000000000000000000000000000000000000000000000001", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "6896BD60EEAE296DB48A229FF71DFE071BDE413E6D43F917DC8DCF8C78DE33418906D11AC976ABCCB20B091292BFF4EA897EFCB639EA871CFA95F6DE339E4B0A", true},
+	{"C90FDAA22168C234C4C6628B80DC1CD129024E088A67CC74020BBEA63B14E5C9", "DD308AFEC5777E13121FA72B9CC1B7CC0139715309B086C960E18FD969774EB8", "C87AA53824B4D7AE2EB035A2B5BBBCCC080E76CDC6D1692C4B0B62D798E6D906", "7E2D58D8B3BCDF1ABADEC7829054F90DDA9805AAB56C77333024B9D0A508B75C", "5831AAEED7B44BB74E5EAB94BA9D4294C49BCF2A60728D8B4C200F50DD313C1BAB745879A5AD954A72C45A91C3A51D3C7ADEA98D82F8481E0E1E03674A6F3FB7", true},
+	{"0B432B2677937381AEF05BB02A66ECD012773062CF3FA2549E44F58ED2401710", "25D1DFF95105F5253C4022F628A996AD3A0D95FBF21D468A1B33F8C160D8F517", "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF", "FFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFFF", "7EB0509757E246F19449885651611CB965ECC1A187DD51B64FDA1EDC9637D5EC97582B9CB13DB3933705B32BA982AF5AF25FD78881EBB32771FC5922EFC66EA3", true},
+	{"", "D69C3509BB99E412E68B0FE8544E72837DFA30746D8BE2AA65975F29D22DC7B9", "", "4DF3C3F68FCC83B27E9D42C90431A72499F17875C81A599B566C9889B9696703", "00000000000000000000003B78CE563F89A0ED9414F5AA28AD0D96D6795F9C6376AFB1548AF603B3EB45C9F8207DEE1060CB71C04E80F593060B07D28308D7F4", true},
+	// Public key not on the curve.
+	{"", "EEFDEA4CDB677750A420FEE807EACF21EB9898AE79B9768766E4FAA04A2D4A34", "", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "6CFF5C3BA86C69EA4B7376F31A9BCB4F74C1976089B2D9963DA2E5543E17776969E89B4C5564D00349106B8497785DD7D1D713A8AE82B32FA79D5F7FC407D39B", false},
+	// R has an odd y.
+	{"", "DFF1D77F2A671C5F36183726DB2341BE58FEAE1DA2DECED843240F7B502BA659", "", "243F6A8885A308D313198A2E03707344A4093822299F31D0082EFA98EC4E6C89", "FFF97BD5755EEEA420453A14355235D382F6472F8568A18B2F057A14602975563CC27944640AC607CD107AE10923D9EF7A73C643E166BE5EBEAFA34B1AC553E2", false},
+}
+
+func TestSchnorrBIP340(t *testing.T) {
+	decode := func(s string) []byte {
+		data, err := hex.DecodeString(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	for i, vector := range bip340Vectors {
+		publicKey, msg, sig := decode(vector.publicKey), decode(vector.msg), decode(vector.sig)
+		if vector.secretKey != "" {
+			key, err := PrivateKeyFromBytes(decode(vector.secretKey))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(key.SerializeXOnly(), publicKey) {
+				t.Errorf("vector %d: public key %X", i, key.SerializeXOnly())
+			}
+			signed, err := key.SignSchnorr(msg, decode(vector.aux))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(signed, sig) {
+				t.Errorf("vector %d: signature %s", i, strings.ToUpper(hex.EncodeToString(signed)))
+			}
+		}
+		if VerifySchnorr(sig, msg, publicKey) != vector.valid {
+			t.Errorf("vector %d: verification gave %v", i, !vector.valid)
+		}
+		if vector.valid {
+			sig[63] ^= 1
+			if VerifySchnorr(sig, msg, publicKey) {
+				t.Errorf("vector %d: altered signature verified", i)
+			}
+		}
+	}
+}
+
+func TestTweakPrivateKey(t *testing.T) {
+	key, _ := NewPrivateKey(big.NewInt(3))
+	tweak := TaggedHash("TapTweak", key.SerializeXOnly())
+	tweakedKey, err := TweakPrivateKey(key, tweak)
+	if err != nil {
+		t.Fatal(err)
+	}
+	internal, _ := ParseXOnlyPublicKey(key.SerializeXOnly())
+	tweaked, err := TweakPublicKey(internal, tweak)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(tweaked.SerializeCompressed(), tweakedKey.PubKey().SerializeCompressed()) {
+		t.Fatal("tweaked keys differ")
+	}
+}
@@ -0,0 +1,74 @@
+// Package regtesttest builds deterministic regtest chains and fixtures for
+// the tests of other packages.
+package regtesttest
+
+import (
+	"time"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	consensus "github.com/Btcercises/NanoBtcLibrary/Go/consensus"
+	regtest "github.com/Btcercises/NanoBtcLibrary/Go/regtest"
+)
+
+// TrueScript is an output script anyone can spend with an empty script sig.
+var TrueScript = []byte{transactions.OP_1}
+
+// NewTestChain returns a chain whose clock starts at a fixed time and moves
+// a minute on every read, so that tests mine the same blocks on every run.
+func NewTestChain() *regtest.Chain {
+	chain := regtest.NewChain()
+	clock := time.Unix(1700000000, 0)
+	chain.Now = func() time.Time {
+		clock = clock.Add(time.Minute)
+		return clock
+	}
+	return chain
+}
+
+// SpendFixture is a test chain whose first coinbase has matured and been
+// spent in the tip.
+type SpendFixture struct {
+	Chain *regtest.Chain
+	// Blocks are the mined blocks from height 1, the tip last.
+	Blocks []*blockchain.Block
+	Spend  transactions.Transaction
+}
+
+// NewSpendFixture mines CoinbaseMaturity+1 blocks paying TrueScript and then
+// a block with a transaction spending the first coinbase to the outputs pay
+// returns for the coinbase amount.
+func NewSpendFixture(pay func(amount int64) []transactions.TxOutput) (*SpendFixture, error) {
+	chain := NewTestChain()
+	blocks, err := chain.GenerateToScript(regtest.CoinbaseMaturity+1, TrueScript)
+	if err != nil {
+		return nil, err
+	}
+	coinbase := blocks[0].Transactions[0]
+	spend := transactions.Transaction{
+		Version: 2,
+		Input: []transactions.TxInput{{
+			Hash:     transactions.GenerateTransactionId(coinbase),
+			Sequence: 0xffffffff,
+		}},
+		Output: pay(coinbase.Output[0].Amount),
+	}
+	if err := chain.AddTransaction(spend); err != nil {
+		return nil, err
+	}
+	mined, err := chain.GenerateToScript(1, TrueScript)
+	if err != nil {
+		return nil, err
+	}
+	return &SpendFixture{Chain: chain, Blocks: append(blocks, mined...), Spend: spend}, nil
+}
+
+// Remine redoes the proof of work of block after its header or
+// transactions were changed, updating its merkle root first.
+func Remine(block *blockchain.Block) error {
+	block.HashMerkle, _ = blockchain.MerkleRoot(block.Transactions)
+	copy(block.MerkleRoot[:], block.HashMerkle)
+	block.Hash = nil
+	_, _, err := consensus.NewProof(&block.BlockHeader).Run()
+	return err
+}
@@ -0,0 +1,112 @@
+package mempool
+
+import (
+	"errors"
+	"fmt"
+
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	utils "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+	utxo "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utxo"
+)
+
+// DustLimit is the smallest output the bump helpers leave behind, the dust
+// threshold of a P2PKH output at the default relay fee.
+const DustLimit = 546
+
+var (
+	ErrNotInPool          = errors.New("transaction not in mempool")
+	ErrNoSuchOutput       = errors.New("output index out of range")
+	ErrInsufficientChange = errors.New("output too small to pay the fee")
+)
+
+// BumpFee returns a replacement for the pool transaction txid paying rate,
+// taking the extra fee from its output changeIndex. The fee is raised to at
+// least what BIP125 requires to evict the transaction and its descendants.
+// Unless the pool runs full RBF, the transaction must signal replaceability
+// itself or through an ancestor, or the pool would refuse the replacement.
+// The inputs keep the original scripts and witnesses, so the replacement
+// must be signed again before it is broadcast.
+func (pool *Pool) BumpFee(txid []byte, changeIndex int, rate FeeRate) (transactions.Transaction, error) {
+	pool.mutex.RLock()
+	defer pool.mutex.RUnlock()
+	entry, ok := pool.txs[string(txid)]
+	if !ok {
+		return transactions.Transaction{}, fmt.Errorf("%w: %s", ErrNotInPool, utils.HashString(txid))
+	}
+	if !pool.config.FullRBF && !replaceable(entry) {
+		return transactions.Transaction{}, fmt.Errorf("%w: %s", ErrNotReplaceable, utils.HashString(txid))
+	}
+	if changeIndex < 0 || changeIndex >= len(entry.Tx.Output) {
+		return transactions.Transaction{}, ErrNoSuchOutput
+	}
+	var evictedFees int64
+	for other := range withDescendants(entry) {
+		evictedFees += other.Fee
+	}
+	fee := max(rate.Fee(entry.VSize), evictedFees+pool.config.IncrementalRelayFeeRate.Fee(entry.VSize))
+
+	tx := entry.Tx
+	tx.Id = nil
+	tx.Input = append([]transactions.TxInput{}, entry.Tx.Input...)
+	for i := range tx.Input {
+		// Keep sequences that already signal, they may carry a relative
+		// lock time.
+		if tx.Input[i].Sequence > maxReplaceableSequence {
+			tx.Input[i].Sequence = maxReplaceableSequence
+		}
+	}
+	tx.Output = append([]transactions.TxOutput{}, entry.Tx.Output...)
+	tx.Output[changeIndex].Amount -= fee - entry.Fee
+	if tx.Output[changeIndex].Amount < DustLimit {
+		return transactions.Transaction{}, fmt.Errorf("%w: %d needed", ErrInsufficientChange, fee-entry.Fee)
+	}
+	return tx, nil
+}
+
+// CPFP returns a child spending outPoint, an output of a pool transaction,
+// to script with a fee that raises the package of the child and all its
+// unconfirmed ancestors to rate. childVSize is the size of the signed
+// child; if it is not positive the size of the unsigned child is used.
+func (pool *Pool) CPFP(outPoint utxo.OutPoint, script []byte, rate FeeRate, childVSize int64) (transactions.Transaction, error) {
+	pool.mutex.RLock()
+	defer pool.mutex.RUnlock()
+	parent, ok := pool.txs[string(outPoint.TxId[:])]
+	if !ok {
+		return transactions.Transaction{}, fmt.Errorf("%w: %s", ErrNotInPool, utils.HashString(outPoint.TxId[:]))
+	}
+	return childPaying(parent.Tx, outPoint.Index, parent.AncestorFees, parent.AncestorSize, script, rate, childVSize)
+}
+
+// PackageChild returns a child spending output index of parent, a
+// transaction paying parentFee that is not in the pool, so that the two
+// together pay rate. The result is meant for AcceptPackage; childVSize is
+// as for CPFP.
+func PackageChild(parent transactions.Transaction, parentFee int64, index uint32, script []byte, rate FeeRate, childVSize int64) (transactions.Transaction, error) {
+	return childPaying(parent, index, parentFee, VSize(parent), script, rate, childVSize)
+}
+
+// childPaying builds a child of parent paying for the package of
+// ancestorSize virtual bytes that already pays ancestorFees.
+func childPaying(parent transactions.Transaction, index uint32, ancestorFees, ancestorSize int64, script []byte, rate FeeRate, childVSize int64) (transactions.Transaction, error) {
+	if int(index) >= len(parent.Output) {
+		return transactions.Transaction{}, ErrNoSuchOutput
+	}
+	child := transactions.Transaction{
+		Version: 2,
+		Input: []transactions.TxInput{{
+			Hash:     transactions.GenerateTransactionId(parent),
+			Index:    index,
+			Sequence: maxReplaceableSequence,
+		}},
+		Output: []transactions.TxOutput{{Script: script}},
+	}
+	if childVSize <= 0 {
+		childVSize = VSize(child)
+	}
+	fee := max(rate.Fee(ancestorSize+childVSize)-ancestorFees, rate.Fee(childVSize))
+	child.Output[0].Amount = parent.Output[index].Amount - fee
+	if child.Output[0].Amount < DustLimit {
+		return transactions.Transaction{}, fmt.Errorf("%w: %d needed", ErrInsufficientChange, fee)
+	}
+	return child, nil
+}
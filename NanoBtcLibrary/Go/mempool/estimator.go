@@ -0,0 +1,506 @@
+package mempool
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	consensus "github.com/Btcercises/NanoBtcLibrary/Go/consensus"
+)
+
+// Bucket and horizon parameters of Bitcoin Core's block policy estimator.
+const (
+	minBucketFeeRate = 1000
+	maxBucketFeeRate = 1e7
+	feeSpacing       = 1.05
+
+	// Fractions of transactions that must have confirmed in time for a
+	// fee rate to pass, at half, once and twice the target.
+	halfSuccessPct   = 0.6
+	successPct       = 0.85
+	doubleSuccessPct = 0.95
+	// Decayed transaction counts a bucket range needs before it is judged.
+	sufficientFeeTxs   = 0.1
+	sufficientTxsShort = 0.5
+
+	estimatesVersion = 1
+)
+
+var (
+	ErrInsufficientData = errors.New("not enough data to estimate a fee rate")
+	ErrBadTarget        = errors.New("confirmation target out of range")
+	ErrBadEstimates     = errors.New("corrupt fee estimates")
+)
+
+// confirmStats tracks, per fee rate bucket, how many transactions confirmed
+// within each number of periods of scale blocks, with counts decayed every
+// block so that recent blocks weigh more.
+type confirmStats struct {
+	decay float64
+	scale int
+	// confAvg[p][b] counts transactions of bucket b confirmed within p+1
+	// periods, failAvg[p][b] those that left the pool unconfirmed after at
+	// least p+1 periods. txCtAvg and feeSum are the bucket totals.
+	confAvg [][]float64
+	failAvg [][]float64
+	txCtAvg []float64
+	feeSum  []float64
+	// unconfTxs[h%len][b] counts transactions still unconfirmed that entered
+	// at height h, oldUnconfTxs those older than the array reaches.
+	unconfTxs    [][]float64
+	oldUnconfTxs []float64
+}
+
+func newConfirmStats(buckets, periods, scale int, decay float64) *confirmStats {
+	stats := &confirmStats{
+		decay:        decay,
+		scale:        scale,
+		confAvg:      make([][]float64, periods),
+		failAvg:      make([][]float64, periods),
+		txCtAvg:      make([]float64, buckets),
+		feeSum:       make([]float64, buckets),
+		unconfTxs:    make([][]float64, periods*scale),
+		oldUnconfTxs: make([]float64, buckets),
+	}
+	for i := range stats.confAvg {
+		stats.confAvg[i] = make([]float64, buckets)
+		stats.failAvg[i] = make([]float64, buckets)
+	}
+	for i := range stats.unconfTxs {
+		stats.unconfTxs[i] = make([]float64, buckets)
+	}
+	return stats
+}
+
+// maxConfirms returns the largest target in blocks the stats answer for.
+func (stats *confirmStats) maxConfirms() int {
+	return len(stats.confAvg) * stats.scale
+}
+
+func (stats *confirmStats) slot(height int32) int {
+	bins := int32(len(stats.unconfTxs))
+	return int((height%bins + bins) % bins)
+}
+
+func (stats *confirmStats) newTx(height int32, bucket int) {
+	stats.unconfTxs[stats.slot(height)][bucket]++
+}
+
+// clearCurrent frees the unconfirmed slot of height for reuse, moving what
+// it held to the old transactions.
+func (stats *confirmStats) clearCurrent(height int32) {
+	row := stats.unconfTxs[stats.slot(height)]
+	for b := range row {
+		stats.oldUnconfTxs[b] += row[b]
+		row[b] = 0
+	}
+}
+
+func (stats *confirmStats) record(blocksToConfirm int, rate FeeRate, bucket int) {
+	periods := (blocksToConfirm + stats.scale - 1) / stats.scale
+	for p := periods; p <= len(stats.confAvg); p++ {
+		stats.confAvg[p-1][bucket]++
+	}
+	stats.txCtAvg[bucket]++
+	stats.feeSum[bucket] += float64(rate)
+}
+
+func (stats *confirmStats) removeTx(entryHeight, bestHeight int32, bucket int, inBlock bool) {
+	blocksAgo := int(bestHeight - entryHeight)
+	if blocksAgo < 0 {
+		blocksAgo = 0
+	}
+	if blocksAgo >= len(stats.unconfTxs) {
+		stats.oldUnconfTxs[bucket] = max(stats.oldUnconfTxs[bucket]-1, 0)
+	} else {
+		row := stats.unconfTxs[stats.slot(entryHeight)]
+		row[bucket] = max(row[bucket]-1, 0)
+	}
+	if !inBlock {
+		for p := 0; p < len(stats.failAvg) && p < blocksAgo/stats.scale; p++ {
+			stats.failAvg[p][bucket]++
+		}
+	}
+}
+
+func (stats *confirmStats) updateMovingAverages() {
+	for b := range stats.txCtAvg {
+		for p := range stats.confAvg {
+			stats.confAvg[p][b] *= stats.decay
+			stats.failAvg[p][b] *= stats.decay
+		}
+		stats.txCtAvg[b] *= stats.decay
+		stats.feeSum[b] *= stats.decay
+	}
+}
+
+// estimate returns the lowest fee rate whose transactions, grouped from the
+// highest bucket down into ranges of at least sufficient decayed
+// transactions, confirmed within target blocks at least threshold of the
+// time. It returns -1 without an answer.
+func (stats *confirmStats) estimate(target int, sufficient, threshold float64, bestHeight int32) FeeRate {
+	periods := (target + stats.scale - 1) / stats.scale
+	if periods <= 0 || periods > len(stats.confAvg) {
+		return -1
+	}
+	var conf, total, fail, extra float64
+	near := len(stats.txCtAvg) - 1
+	passFar, passNear := -1, -1
+	for b := len(stats.txCtAvg) - 1; b >= 0; b-- {
+		conf += stats.confAvg[periods-1][b]
+		total += stats.txCtAvg[b]
+		fail += stats.failAvg[periods-1][b]
+		for blocks := target; blocks < len(stats.unconfTxs); blocks++ {
+			extra += stats.unconfTxs[stats.slot(bestHeight-int32(blocks))][b]
+		}
+		extra += stats.oldUnconfTxs[b]
+		if total < sufficient/(1-stats.decay) {
+			continue
+		}
+		if conf/(total+fail+extra) < threshold {
+			break
+		}
+		passFar, passNear = b, near
+		conf, total, fail, extra = 0, 0, 0, 0
+		near = b - 1
+	}
+	if passFar < 0 {
+		return -1
+	}
+	// The answer is the median fee rate of the lowest passing range.
+	var count float64
+	for b := passFar; b <= passNear; b++ {
+		count += stats.txCtAvg[b]
+	}
+	var seen float64
+	for b := passFar; b <= passNear; b++ {
+		seen += stats.txCtAvg[b]
+		if seen >= count/2 && stats.txCtAvg[b] > 0 {
+			return FeeRate(stats.feeSum[b] / stats.txCtAvg[b])
+		}
+	}
+	return -1
+}
+
+// trackedTx is a pool transaction the estimator waits to see confirmed.
+type trackedTx struct {
+	height int32
+	bucket int
+	rate   FeeRate
+}
+
+// FeeEstimator estimates the fee rate needed to confirm within a number of
+// blocks from how long past transactions took, the way Bitcoin Core's
+// estimatesmartfee does. Transactions are bucketed by fee rate and tracked
+// from entering the pool until confirmed or dropped, over a short, a
+// medium and a long horizon. It is safe for concurrent use.
+type FeeEstimator struct {
+	mutex   sync.Mutex
+	buckets []float64
+
+	short  *confirmStats
+	medium *confirmStats
+	long   *confirmStats
+
+	tracked     map[string]trackedTx
+	bestHeight  int32
+	firstHeight int32
+}
+
+// NewFeeEstimator returns an estimator without history.
+func NewFeeEstimator() *FeeEstimator {
+	var buckets []float64
+	for rate := float64(minBucketFeeRate); rate <= maxBucketFeeRate; rate *= feeSpacing {
+		buckets = append(buckets, rate)
+	}
+	buckets = append(buckets, math.Inf(1))
+	return &FeeEstimator{
+		buckets: buckets,
+		short:   newConfirmStats(len(buckets), 12, 1, 0.962),
+		medium:  newConfirmStats(len(buckets), 24, 2, 0.9952),
+		long:    newConfirmStats(len(buckets), 42, 24, 0.99931),
+		tracked: make(map[string]trackedTx),
+	}
+}
+
+func (estimator *FeeEstimator) allStats() []*confirmStats {
+	return []*confirmStats{estimator.short, estimator.medium, estimator.long}
+}
+
+// bucket returns the first bucket whose bound is at least rate.
+func (estimator *FeeEstimator) bucket(rate FeeRate) int {
+	return sort.SearchFloat64s(estimator.buckets, float64(rate))
+}
+
+// ProcessEntry starts tracking txid, which entered the pool paying rate with
+// the tip at height. Transactions entering while the estimator is behind
+// the tip are not tracked.
+func (estimator *FeeEstimator) ProcessEntry(txid []byte, rate FeeRate, height int32) {
+	estimator.mutex.Lock()
+	defer estimator.mutex.Unlock()
+	if height != estimator.bestHeight {
+		return
+	}
+	if _, ok := estimator.tracked[string(txid)]; ok {
+		return
+	}
+	bucket := estimator.bucket(rate)
+	estimator.tracked[string(txid)] = trackedTx{height: height, bucket: bucket, rate: rate}
+	for _, stats := range estimator.allStats() {
+		stats.newTx(height, bucket)
+	}
+}
+
+// RemoveTx stops tracking txid, which left the pool without being mined,
+// and counts it as failing to confirm in the time it waited.
+func (estimator *FeeEstimator) RemoveTx(txid []byte) {
+	estimator.mutex.Lock()
+	defer estimator.mutex.Unlock()
+	estimator.removeTx(txid, false)
+}
+
+func (estimator *FeeEstimator) removeTx(txid []byte, inBlock bool) (trackedTx, bool) {
+	tx, ok := estimator.tracked[string(txid)]
+	if !ok {
+		return tx, false
+	}
+	delete(estimator.tracked, string(txid))
+	for _, stats := range estimator.allStats() {
+		stats.removeTx(tx.height, estimator.bestHeight, tx.bucket, inBlock)
+	}
+	return tx, true
+}
+
+// ProcessBlock records the transactions of the block connected at height,
+// given by txid. Blocks at or below the last one seen, as when a reorg
+// connects them again, are ignored.
+func (estimator *FeeEstimator) ProcessBlock(height int32, txids [][]byte) {
+	estimator.mutex.Lock()
+	defer estimator.mutex.Unlock()
+	if height <= estimator.bestHeight {
+		return
+	}
+	estimator.bestHeight = height
+	for _, stats := range estimator.allStats() {
+		stats.clearCurrent(height)
+		stats.updateMovingAverages()
+	}
+	counted := 0
+	for _, txid := range txids {
+		tx, ok := estimator.removeTx(txid, true)
+		if !ok {
+			continue
+		}
+		blocks := int(height - tx.height)
+		if blocks <= 0 {
+			continue
+		}
+		for _, stats := range estimator.allStats() {
+			stats.record(blocks, tx.rate, tx.bucket)
+		}
+		counted++
+	}
+	if counted > 0 && estimator.firstHeight == 0 {
+		estimator.firstHeight = height
+	}
+}
+
+// MaxTarget returns the largest confirmation target estimates are made
+// for.
+func (estimator *FeeEstimator) MaxTarget() int {
+	return estimator.long.maxConfirms()
+}
+
+// maxUsableTarget limits targets to half the blocks the estimator has
+// watched, beyond which it has not seen enough to answer.
+func (estimator *FeeEstimator) maxUsableTarget() int {
+	if estimator.firstHeight == 0 {
+		return 0
+	}
+	return min(estimator.MaxTarget(), int(estimator.bestHeight-estimator.firstHeight)/2)
+}
+
+func (estimator *FeeEstimator) statsFor(target int) (*confirmStats, float64) {
+	switch {
+	case target <= estimator.short.maxConfirms():
+		return estimator.short, sufficientTxsShort
+	case target <= estimator.medium.maxConfirms():
+		return estimator.medium, sufficientFeeTxs
+	default:
+		return estimator.long, sufficientFeeTxs
+	}
+}
+
+// EstimateFee returns the fee rate at which transactions confirmed within
+// target blocks with at least the given confidence, a fraction between 0
+// and 1, on the shortest horizon covering target.
+func (estimator *FeeEstimator) EstimateFee(target int, confidence float64) (FeeRate, error) {
+	estimator.mutex.Lock()
+	defer estimator.mutex.Unlock()
+	if target <= 0 || target > estimator.MaxTarget() || confidence <= 0 || confidence > 1 {
+		return 0, ErrBadTarget
+	}
+	stats, sufficient := estimator.statsFor(target)
+	rate := stats.estimate(target, sufficient, confidence, estimator.bestHeight)
+	if rate < 0 {
+		return 0, ErrInsufficientData
+	}
+	return rate, nil
+}
+
+// estimateCombined estimates on the horizon covering target. With
+// checkShorter, a lower answer from the full range of a shorter, more
+// recent horizon is preferred.
+func (estimator *FeeEstimator) estimateCombined(target int, threshold float64, checkShorter bool) FeeRate {
+	if target <= 0 || target > estimator.MaxTarget() {
+		return -1
+	}
+	stats, sufficient := estimator.statsFor(target)
+	rate := stats.estimate(target, sufficient, threshold, estimator.bestHeight)
+	if !checkShorter {
+		return rate
+	}
+	for _, shorter := range []*confirmStats{estimator.medium, estimator.short} {
+		if target <= shorter.maxConfirms() {
+			continue
+		}
+		sufficient := sufficientFeeTxs
+		if shorter == estimator.short {
+			sufficient = sufficientTxsShort
+		}
+		if other := shorter.estimate(shorter.maxConfirms(), sufficient, threshold, estimator.bestHeight); other > 0 && (rate < 0 || other < rate) {
+			rate = other
+		}
+	}
+	return rate
+}
+
+// EstimateSmartFee returns the fee rate to confirm within target blocks and
+// the target the estimate is actually for, which is lower when the
+// estimator has not watched enough blocks and at least 2. It takes the
+// highest of the estimates at half, once and twice the target with rising
+// confidence; conservative estimates also require the long horizon to
+// agree at twice the target. Without enough history it returns
+// ErrInsufficientData, and Pool.EstimateFeeRate can be used instead.
+func (estimator *FeeEstimator) EstimateSmartFee(target int, conservative bool) (FeeRate, int, error) {
+	estimator.mutex.Lock()
+	defer estimator.mutex.Unlock()
+	if target <= 0 {
+		return 0, 0, ErrBadTarget
+	}
+	target = max(min(target, estimator.maxUsableTarget()), 2)
+	if target > estimator.maxUsableTarget() {
+		return 0, 0, ErrInsufficientData
+	}
+	rate := estimator.estimateCombined(target/2, halfSuccessPct, true)
+	rate = max(rate, estimator.estimateCombined(target, successPct, true))
+	doubleTarget := min(2*target, estimator.maxUsableTarget())
+	rate = max(rate, estimator.estimateCombined(doubleTarget, doubleSuccessPct, !conservative))
+	if conservative {
+		rate = max(rate, estimator.long.estimate(doubleTarget, sufficientFeeTxs, doubleSuccessPct, estimator.bestHeight))
+	}
+	if rate <= 0 {
+		return 0, target, ErrInsufficientData
+	}
+	return rate, target, nil
+}
+
+// Save writes the estimator's history so that a restarted node keeps its
+// estimates. Transactions still being tracked are not saved.
+func (estimator *FeeEstimator) Save(w io.Writer) error {
+	estimator.mutex.Lock()
+	defer estimator.mutex.Unlock()
+	header := []any{uint32(estimatesVersion), estimator.bestHeight, estimator.firstHeight, uint32(len(estimator.buckets))}
+	for _, value := range header {
+		if err := binary.Write(w, binary.LittleEndian, value); err != nil {
+			return err
+		}
+	}
+	if err := binary.Write(w, binary.LittleEndian, estimator.buckets[:len(estimator.buckets)-1]); err != nil {
+		return err
+	}
+	for _, stats := range estimator.allStats() {
+		rows := [][]float64{stats.txCtAvg, stats.feeSum}
+		rows = append(rows, stats.confAvg...)
+		rows = append(rows, stats.failAvg...)
+		for _, row := range rows {
+			if err := binary.Write(w, binary.LittleEndian, row); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// LoadFeeEstimator reads an estimator written by Save. Its bucket layout
+// must match this version's.
+func LoadFeeEstimator(r io.Reader) (*FeeEstimator, error) {
+	estimator := NewFeeEstimator()
+	var version, buckets uint32
+	for _, value := range []any{&version, &estimator.bestHeight, &estimator.firstHeight, &buckets} {
+		if err := binary.Read(r, binary.LittleEndian, value); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrBadEstimates, err)
+		}
+	}
+	if version != estimatesVersion {
+		return nil, fmt.Errorf("%w: version %d", ErrBadEstimates, version)
+	}
+	if int(buckets) != len(estimator.buckets) {
+		return nil, fmt.Errorf("%w: %d buckets", ErrBadEstimates, buckets)
+	}
+	bounds := make([]float64, buckets-1)
+	if err := binary.Read(r, binary.LittleEndian, bounds); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrBadEstimates, err)
+	}
+	for i, bound := range bounds {
+		if bound != estimator.buckets[i] {
+			return nil, fmt.Errorf("%w: bucket %d bound %v", ErrBadEstimates, i, bound)
+		}
+	}
+	for _, stats := range estimator.allStats() {
+		rows := [][]float64{stats.txCtAvg, stats.feeSum}
+		rows = append(rows, stats.confAvg...)
+		rows = append(rows, stats.failAvg...)
+		for _, row := range rows {
+			if err := binary.Read(r, binary.LittleEndian, row); err != nil {
+				return nil, fmt.Errorf("%w: %w", ErrBadEstimates, err)
+			}
+			for _, value := range row {
+				if value < 0 || math.IsNaN(value) || math.IsInf(value, 0) {
+					return nil, fmt.Errorf("%w: invalid count", ErrBadEstimates)
+				}
+			}
+		}
+	}
+	return estimator, nil
+}
+
+// blockVSize is the virtual size a block template fills, the maximum less
+// Bitcoin Core's reserve for the coinbase and header.
+const blockVSize = (consensus.MaxBlockWeight - 4000) / transactions.WitnessScaleFactor
+
+// EstimateFeeRate estimates the fee rate to confirm within target blocks
+// from the pool alone, without history: the ancestor fee rate at which
+// the packages ahead of a new transaction fill target blocks, or the
+// minimum fee rate when they do not. It assumes no further transactions
+// arrive, so it is a lower bound best used when a FeeEstimator has no
+// answer yet.
+func (pool *Pool) EstimateFeeRate(target int) FeeRate {
+	minimum := pool.MinFeeRate()
+	if target <= 0 {
+		return minimum
+	}
+	var filled int64
+	for _, entry := range pool.ByAncestorFeeRate() {
+		filled += entry.VSize
+		if filled > int64(target)*blockVSize {
+			return max(entry.AncestorFeeRate()+1, minimum)
+		}
+	}
+	return minimum
+}
@@ -0,0 +1,98 @@
+package mempool
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
+	regtest "github.com/Btcercises/NanoBtcLibrary/Go/regtest"
+)
+
+// feedEstimator simulates blocks up to height in which transactions paying
+// 20 sat/vB confirm in the next block and those paying 2 sat/vB after ten.
+func feedEstimator(estimator *FeeEstimator, height int32) {
+	txid := func(kind string, height int32, i int) []byte {
+		return []byte(fmt.Sprintf("%s-%d-%d", kind, height, i))
+	}
+	for h := int32(1); h <= height; h++ {
+		var confirmed [][]byte
+		for i := 0; i < 10; i++ {
+			confirmed = append(confirmed, txid("fast", h-1, i), txid("slow", h-10, i))
+		}
+		estimator.ProcessBlock(h, confirmed)
+		for i := 0; i < 10; i++ {
+			estimator.ProcessEntry(txid("fast", h, i), 20000, h)
+			estimator.ProcessEntry(txid("slow", h, i), 2000, h)
+		}
+	}
+}
+
+func TestFeeEstimator(t *testing.T) {
+	estimator := NewFeeEstimator()
+	if _, _, err := estimator.EstimateSmartFee(2, false); !errors.Is(err, ErrInsufficientData) {
+		t.Fatalf("estimate without history gave %v", err)
+	}
+	feedEstimator(estimator, 200)
+
+	fast, target, err := estimator.EstimateSmartFee(1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target != 2 || fast < 15000 || fast > 25000 {
+		t.Fatalf("next block estimate is %s for %d blocks", fast, target)
+	}
+	slow, _, err := estimator.EstimateSmartFee(24, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if slow > 3000 {
+		t.Fatalf("24 block estimate is %s", slow)
+	}
+	if rate, err := estimator.EstimateFee(5, 0.95); err != nil || rate < 15000 {
+		t.Fatalf("5 block estimate at 95%% is %s, %v", rate, err)
+	}
+
+	var saved bytes.Buffer
+	if err := estimator.Save(&saved); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadFeeEstimator(bytes.NewReader(saved.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate, _, err := loaded.EstimateSmartFee(24, false); err != nil || rate != slow {
+		t.Fatalf("loaded estimator gives %s, %v", rate, err)
+	}
+	if _, err := LoadFeeEstimator(bytes.NewReader(saved.Bytes()[:100])); !errors.Is(err, ErrBadEstimates) {
+		t.Fatalf("truncated estimates gave %v", err)
+	}
+}
+
+func TestPoolFeeEstimates(t *testing.T) {
+	tc := newTestChain(t, regtest.CoinbaseMaturity+3)
+	estimator := NewFeeEstimator()
+	estimator.ProcessBlock(int32(len(tc.blocks)), nil)
+	pool := New(Config{Params: &chaincfg.RegTestParams, Now: tc.now, Estimator: estimator}, tc.set, int32(len(tc.blocks)), 0)
+	tx := spend(5000, 1, tc.coinbase(1))
+	if _, err := pool.Accept(tx); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := estimator.tracked[string(transactions.GenerateTransactionId(tx))]; !ok {
+		t.Fatal("accepted transaction is not tracked")
+	}
+	if rate := pool.EstimateFeeRate(1); rate != DefaultMinRelayFeeRate {
+		t.Fatalf("nearly empty pool estimates %s", rate)
+	}
+
+	if err := tc.chain.AddTransaction(tx); err != nil {
+		t.Fatal(err)
+	}
+	block := tc.mine(t, 1)[0]
+	pool.BlockConnected(block, int32(len(tc.blocks)), 0)
+	if len(estimator.tracked) != 0 || estimator.short.txCtAvg[estimator.bucket(NewFeeRate(5000, VSize(tx)))] != 1 {
+		t.Fatal("confirmed transaction was not recorded")
+	}
+}
@@ -0,0 +1,35 @@
+package mempool
+
+import "fmt"
+
+// FeeRate is a fee rate in satoshis per 1000 virtual bytes, the unit Bitcoin
+// Core uses for relay and mempool limits.
+type FeeRate int64
+
+// NewFeeRate returns the rate of paying fee for vsize virtual bytes.
+func NewFeeRate(fee, vsize int64) FeeRate {
+	if vsize <= 0 {
+		return 0
+	}
+	return FeeRate(fee * 1000 / vsize)
+}
+
+// Fee returns the fee for vsize virtual bytes at the rate, rounded up so
+// that paying it always meets the rate.
+func (rate FeeRate) Fee(vsize int64) int64 {
+	fee := int64(rate) * vsize / 1000
+	if fee*1000 < int64(rate)*vsize {
+		fee++
+	}
+	return fee
+}
+
+func (rate FeeRate) String() string {
+	return fmt.Sprintf("%d.%03d sat/vB", rate/1000, rate%1000)
+}
+
+// feeRateLess compares fee1/size1 with fee2/size2 without losing precision
+// to integer division.
+func feeRateLess(fee1, size1, fee2, size2 int64) bool {
+	return fee1*size2 < fee2*size1
+}
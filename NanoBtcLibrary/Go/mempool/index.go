@@ -0,0 +1,68 @@
+package mempool
+
+import (
+	"bytes"
+	"sort"
+)
+
+// index keeps pool entries ordered by before, a strict total order, so that
+// reading them in order or finding the worst does not sort or scan the pool.
+type index struct {
+	before  func(a, b *TxDesc) bool
+	entries []*TxDesc
+}
+
+func newIndex(before func(a, b *TxDesc) bool) *index {
+	return &index{before: before}
+}
+
+// search returns the position of entry, or where it would go.
+func (idx *index) search(entry *TxDesc) int {
+	return sort.Search(len(idx.entries), func(i int) bool { return !idx.before(idx.entries[i], entry) })
+}
+
+// insert adds entry, which must not be in the index.
+func (idx *index) insert(entry *TxDesc) {
+	i := idx.search(entry)
+	idx.entries = append(idx.entries, nil)
+	copy(idx.entries[i+1:], idx.entries[i:])
+	idx.entries[i] = entry
+}
+
+// remove takes entry out of the index if it is there. The fields it is
+// ordered by must not have changed since it was inserted.
+func (idx *index) remove(entry *TxDesc) {
+	if i := idx.search(entry); i < len(idx.entries) && idx.entries[i] == entry {
+		idx.entries = append(idx.entries[:i], idx.entries[i+1:]...)
+	}
+}
+
+// rateBefore orders by increasing fee over size, breaking ties by txid so
+// that every entry has one place in an index.
+func rateBefore(aFee, aSize int64, a *TxDesc, bFee, bSize int64, b *TxDesc) bool {
+	if feeRateLess(aFee, aSize, bFee, bSize) {
+		return true
+	}
+	if feeRateLess(bFee, bSize, aFee, aSize) {
+		return false
+	}
+	return bytes.Compare(a.TxId, b.TxId) < 0
+}
+
+// feeRateBefore orders by decreasing own fee rate.
+func feeRateBefore(a, b *TxDesc) bool {
+	return rateBefore(b.Fee, b.VSize, b, a.Fee, a.VSize, a)
+}
+
+// ancestorFeeRateBefore orders by decreasing ancestor fee rate.
+func ancestorFeeRateBefore(a, b *TxDesc) bool {
+	return rateBefore(b.AncestorFees, b.AncestorSize, b, a.AncestorFees, a.AncestorSize, a)
+}
+
+// descendantScoreBefore orders by increasing descendant score, the order in
+// which eviction removes packages.
+func descendantScoreBefore(a, b *TxDesc) bool {
+	aFee, aSize := descendantScore(a)
+	bFee, bSize := descendantScore(b)
+	return rateBefore(aFee, aSize, a, bFee, bSize, b)
+}
@@ -0,0 +1,74 @@
+package mempool
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+)
+
+var (
+	ErrNotChild   = errors.New("package child does not spend its parent")
+	ErrPackageFee = errors.New("package fee rate below the mempool minimum")
+)
+
+// AcceptPackage validates a one-parent-one-child package and adds it. The
+// parent is accepted on its own when it can be; otherwise it may pay less
+// than the minimum fee rate as long as the package as a whole meets it, so
+// that a child can bump a parent the pool would not take alone. It returns
+// copies of the two entries.
+func (pool *Pool) AcceptPackage(parent, child transactions.Transaction) ([]*TxDesc, error) {
+	parentId := transactions.GenerateTransactionId(parent)
+	spendsParent := false
+	for _, input := range child.Input {
+		if bytes.Equal(input.Hash, parentId) {
+			spendsParent = true
+			break
+		}
+	}
+	if !spendsParent {
+		return nil, ErrNotChild
+	}
+
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	parentEntry, err := pool.accept(parent, acceptPolicy{limits: true, deferTrim: true, replace: true})
+	paidFor := false
+	switch {
+	case err == nil:
+	case err == ErrAlreadyInPool:
+		parentEntry = pool.txs[string(parentId)]
+	case errors.Is(err, ErrInsufficientFee):
+		parentEntry, err = pool.accept(parent, acceptPolicy{limits: true, skipFee: true, deferTrim: true})
+		if err != nil {
+			return nil, err
+		}
+		paidFor = true
+	default:
+		return nil, err
+	}
+
+	childEntry, err := pool.accept(child, acceptPolicy{limits: true, deferTrim: true})
+	if err != nil {
+		if paidFor {
+			pool.remove(withDescendants(parentEntry))
+		}
+		return nil, err
+	}
+	if paidFor {
+		fee, size := parentEntry.Fee+childEntry.Fee, parentEntry.VSize+childEntry.VSize
+		if minimum := pool.minFeeRate(); fee < minimum.Fee(size) {
+			pool.remove(withDescendants(parentEntry))
+			return nil, fmt.Errorf("%w: %s < %s", ErrPackageFee, NewFeeRate(fee, size), minimum)
+		}
+	}
+
+	pool.trim()
+	for _, entry := range []*TxDesc{parentEntry, childEntry} {
+		if _, ok := pool.txs[string(entry.TxId)]; !ok {
+			return nil, ErrMempoolFull
+		}
+	}
+	return snapshot([]*TxDesc{parentEntry, childEntry}), nil
+}
@@ -0,0 +1,826 @@
+// Package mempool holds the unconfirmed transactions a node relays and mines,
+// validated against the UTXO set and kept within size and package limits.
+package mempool
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	utils "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+	utxo "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utxo"
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
+	consensus "github.com/Btcercises/NanoBtcLibrary/Go/consensus"
+)
+
+// Bitcoin Core's default policy limits.
+const (
+	DefaultMaxSize                 = 300000000
+	DefaultExpiry                  = 336 * time.Hour
+	DefaultMaxAncestors            = 25
+	DefaultMaxAncestorSize         = 101000
+	DefaultMaxDescendants          = 25
+	DefaultMaxDescendantSize       = 101000
+	DefaultMinRelayFeeRate         = FeeRate(1000)
+	DefaultIncrementalRelayFeeRate = FeeRate(1000)
+	// rollingFeeHalfLife is how fast the minimum fee rate raised by
+	// eviction decays back.
+	rollingFeeHalfLife = 12 * time.Hour
+)
+
+var (
+	ErrAlreadyInPool       = errors.New("transaction already in mempool")
+	ErrCoinbase            = errors.New("coinbase transactions are only valid in blocks")
+	ErrNonFinal            = errors.New("transaction is not final")
+	ErrMissingInputs       = errors.New("transaction spends unknown outputs")
+	ErrDoubleSpend         = errors.New("transaction spends an output already spent in the mempool")
+	ErrImmatureSpend       = errors.New("transaction spends an immature coinbase")
+	ErrInsufficientFee     = errors.New("fee rate below the mempool minimum")
+	ErrTooManyAncestors    = errors.New("too many unconfirmed ancestors")
+	ErrTooManyDescendants  = errors.New("too many unconfirmed descendants")
+	ErrMempoolFull         = errors.New("mempool full")
+	ErrInputValuesOutRange = errors.New("input values out of range")
+	ErrNegativeFee         = errors.New("outputs exceed inputs")
+
+	errNoMedianTimes = errors.New("no median times for a relative time lock")
+)
+
+// CoinView gives the confirmed coins transactions may spend. *utxo.Set
+// implements it.
+type CoinView interface {
+	GetCoin(outPoint utxo.OutPoint) (*utxo.Coin, error)
+}
+
+// Config holds the pool's policy. Zero values take the defaults above.
+type Config struct {
+	Params            *chaincfg.ChainParams
+	MaxSize           int64
+	Expiry            time.Duration
+	MaxAncestors      int
+	MaxAncestorSize   int64
+	MaxDescendants    int
+	MaxDescendantSize int64
+	MinRelayFeeRate   FeeRate
+	// IncrementalRelayFeeRate is the rate a replacement must add on top of
+	// the fees of what it replaces, and by which eviction raises the
+	// minimum fee rate.
+	IncrementalRelayFeeRate FeeRate
+	// FullRBF lets any transaction be replaced, whether it signals BIP125
+	// replaceability or not.
+	FullRBF bool
+	// MedianTimes gives the median time past of the active chain by
+	// height, which BIP68 time locks on confirmed coins count from. Without
+	// it transactions with such locks are refused as not final.
+	MedianTimes consensus.MedianTimeFunc
+	// Estimator, if set, is fed the transactions entering and leaving the
+	// pool and the blocks connected.
+	Estimator *FeeEstimator
+	// Now is the clock used to timestamp entries, time.Now by default.
+	Now func() time.Time
+}
+
+// TxDesc is a transaction in the pool along with the aggregate fee and size
+// of its package: itself and its unconfirmed ancestors or descendants.
+type TxDesc struct {
+	Tx    transactions.Transaction
+	TxId  []byte
+	Fee   int64
+	VSize int64
+	// SigOpCost is the signature operation cost the transaction adds to a
+	// block.
+	SigOpCost int
+	// Time is when the transaction entered the pool and Height the tip
+	// height then.
+	Time   time.Time
+	Height int32
+	// SequenceLock is the BIP68 relative lock of the transaction, counting
+	// its pool parents as mined in the block after Height.
+	SequenceLock consensus.SequenceLock
+
+	AncestorCount   int
+	AncestorSize    int64
+	AncestorFees    int64
+	DescendantCount int
+	DescendantSize  int64
+	DescendantFees  int64
+
+	parents  map[*TxDesc]bool
+	children map[*TxDesc]bool
+}
+
+// FeeRate returns the transaction's own fee rate.
+func (desc *TxDesc) FeeRate() FeeRate {
+	return NewFeeRate(desc.Fee, desc.VSize)
+}
+
+// AncestorFeeRate returns the fee rate of the transaction with its
+// ancestors, the rate a miner gets by including them all.
+func (desc *TxDesc) AncestorFeeRate() FeeRate {
+	return NewFeeRate(desc.AncestorFees, desc.AncestorSize)
+}
+
+// Parents returns the transactions in the pool that tx spends outputs of.
+// The entries the pool returns are copies, linked only to the entries
+// returned by the same call.
+func (desc *TxDesc) Parents() []*TxDesc {
+	result := make([]*TxDesc, 0, len(desc.parents))
+	for parent := range desc.parents {
+		result = append(result, parent)
+	}
+	return result
+}
+
+// Children returns the transactions in the pool spending outputs of tx.
+func (desc *TxDesc) Children() []*TxDesc {
+	result := make([]*TxDesc, 0, len(desc.children))
+	for child := range desc.children {
+		result = append(result, child)
+	}
+	return result
+}
+
+// descendantScore returns the fee and size whose ratio is the descendant
+// score of entry, the higher of its own and its descendant fee rate.
+func descendantScore(entry *TxDesc) (int64, int64) {
+	if feeRateLess(entry.Fee, entry.VSize, entry.DescendantFees, entry.DescendantSize) {
+		return entry.DescendantFees, entry.DescendantSize
+	}
+	return entry.Fee, entry.VSize
+}
+
+// Pool is the mempool. It is safe for concurrent use.
+type Pool struct {
+	mutex  sync.RWMutex
+	config Config
+	view   CoinView
+
+	txs      map[string]*TxDesc
+	spenders map[utxo.OutPoint]*TxDesc
+	size     int64
+
+	byFeeRate         *index
+	byAncestorFeeRate *index
+	byDescendantScore *index
+
+	height         int32
+	medianTimePast int64
+
+	rollingMinFee   FeeRate
+	rollingFeeSince time.Time
+}
+
+// New returns an empty pool validating against view, with the chain tip at
+// height and medianTimePast.
+func New(config Config, view CoinView, height int32, medianTimePast int64) *Pool {
+	if config.Params == nil {
+		config.Params = &chaincfg.MainNetParams
+	}
+	if config.MaxSize == 0 {
+		config.MaxSize = DefaultMaxSize
+	}
+	if config.Expiry == 0 {
+		config.Expiry = DefaultExpiry
+	}
+	if config.MaxAncestors == 0 {
+		config.MaxAncestors = DefaultMaxAncestors
+	}
+	if config.MaxAncestorSize == 0 {
+		config.MaxAncestorSize = DefaultMaxAncestorSize
+	}
+	if config.MaxDescendants == 0 {
+		config.MaxDescendants = DefaultMaxDescendants
+	}
+	if config.MaxDescendantSize == 0 {
+		config.MaxDescendantSize = DefaultMaxDescendantSize
+	}
+	if config.MinRelayFeeRate == 0 {
+		config.MinRelayFeeRate = DefaultMinRelayFeeRate
+	}
+	if config.IncrementalRelayFeeRate == 0 {
+		config.IncrementalRelayFeeRate = DefaultIncrementalRelayFeeRate
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	return &Pool{
+		config:            config,
+		view:              view,
+		txs:               make(map[string]*TxDesc),
+		spenders:          make(map[utxo.OutPoint]*TxDesc),
+		byFeeRate:         newIndex(feeRateBefore),
+		byAncestorFeeRate: newIndex(ancestorFeeRateBefore),
+		byDescendantScore: newIndex(descendantScoreBefore),
+		height:            height,
+		medianTimePast:    medianTimePast,
+	}
+}
+
+// VSize returns the virtual size of tx, its weight divided by four rounded
+// up.
+func VSize(tx transactions.Transaction) int64 {
+	return int64(transactions.Weight(tx)+transactions.WitnessScaleFactor-1) / transactions.WitnessScaleFactor
+}
+
+// Count returns the number of transactions in the pool.
+func (pool *Pool) Count() int {
+	pool.mutex.RLock()
+	defer pool.mutex.RUnlock()
+	return len(pool.txs)
+}
+
+// Size returns the total virtual size of the pool.
+func (pool *Pool) Size() int64 {
+	pool.mutex.RLock()
+	defer pool.mutex.RUnlock()
+	return pool.size
+}
+
+// snapshot copies entries for use outside the lock. The copies link to one
+// another as the entries do, but not to entries left out.
+func snapshot(entries []*TxDesc) []*TxDesc {
+	copies := make(map[*TxDesc]*TxDesc, len(entries))
+	result := make([]*TxDesc, len(entries))
+	for i, entry := range entries {
+		copied := *entry
+		result[i] = &copied
+		copies[entry] = &copied
+	}
+	for _, copied := range result {
+		parents, children := copied.parents, copied.children
+		copied.parents = make(map[*TxDesc]bool, len(parents))
+		copied.children = make(map[*TxDesc]bool, len(children))
+		for parent := range parents {
+			if other, ok := copies[parent]; ok {
+				copied.parents[other] = true
+			}
+		}
+		for child := range children {
+			if other, ok := copies[child]; ok {
+				copied.children[other] = true
+			}
+		}
+	}
+	return result
+}
+
+// Get returns a copy of the entry for txid.
+func (pool *Pool) Get(txid []byte) (*TxDesc, bool) {
+	pool.mutex.RLock()
+	defer pool.mutex.RUnlock()
+	entry, ok := pool.txs[string(txid)]
+	if !ok {
+		return nil, false
+	}
+	return snapshot([]*TxDesc{entry})[0], true
+}
+
+// Spender returns a copy of the entry of the pool transaction spending
+// outPoint.
+func (pool *Pool) Spender(outPoint utxo.OutPoint) (*TxDesc, bool) {
+	pool.mutex.RLock()
+	defer pool.mutex.RUnlock()
+	entry, ok := pool.spenders[outPoint]
+	if !ok {
+		return nil, false
+	}
+	return snapshot([]*TxDesc{entry})[0], true
+}
+
+// Transactions returns the transactions in the pool, in no particular
+// order.
+func (pool *Pool) Transactions() []transactions.Transaction {
+	pool.mutex.RLock()
+	defer pool.mutex.RUnlock()
+	result := make([]transactions.Transaction, 0, len(pool.txs))
+	for _, entry := range pool.txs {
+		result = append(result, entry.Tx)
+	}
+	return result
+}
+
+func (pool *Pool) sorted(idx *index) []*TxDesc {
+	pool.mutex.RLock()
+	defer pool.mutex.RUnlock()
+	return snapshot(idx.entries)
+}
+
+// ByFeeRate returns copies of the pool's entries by decreasing own fee
+// rate.
+func (pool *Pool) ByFeeRate() []*TxDesc {
+	return pool.sorted(pool.byFeeRate)
+}
+
+// ByAncestorFeeRate returns copies of the pool's entries by decreasing
+// ancestor fee rate, the order in which a block template picks packages.
+func (pool *Pool) ByAncestorFeeRate() []*TxDesc {
+	return pool.sorted(pool.byAncestorFeeRate)
+}
+
+// MinFeeRate returns the fee rate a transaction needs to enter the pool:
+// the relay minimum, raised after evictions until it decays back.
+func (pool *Pool) MinFeeRate() FeeRate {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	return pool.minFeeRate()
+}
+
+func (pool *Pool) minFeeRate() FeeRate {
+	if pool.rollingMinFee > 0 {
+		now := pool.config.Now()
+		if halvings := int(now.Sub(pool.rollingFeeSince) / rollingFeeHalfLife); halvings > 0 {
+			pool.rollingMinFee >>= min(halvings, 63)
+			pool.rollingFeeSince = pool.rollingFeeSince.Add(time.Duration(halvings) * rollingFeeHalfLife)
+			// Below half the relay minimum the raise is dropped.
+			if pool.rollingMinFee < pool.config.MinRelayFeeRate/2 {
+				pool.rollingMinFee = 0
+			}
+		}
+	}
+	return max(pool.rollingMinFee, pool.config.MinRelayFeeRate)
+}
+
+// ancestors returns the transitive in-pool parents of entry.
+func ancestors(entry *TxDesc) map[*TxDesc]bool {
+	result := make(map[*TxDesc]bool)
+	stack := []*TxDesc{entry}
+	for len(stack) > 0 {
+		next := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for parent := range next.parents {
+			if !result[parent] {
+				result[parent] = true
+				stack = append(stack, parent)
+			}
+		}
+	}
+	return result
+}
+
+// descendants returns the transitive in-pool children of entry.
+func descendants(entry *TxDesc) map[*TxDesc]bool {
+	result := make(map[*TxDesc]bool)
+	stack := []*TxDesc{entry}
+	for len(stack) > 0 {
+		next := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for child := range next.children {
+			if !result[child] {
+				result[child] = true
+				stack = append(stack, child)
+			}
+		}
+	}
+	return result
+}
+
+// updatePackage recomputes the ancestor and descendant aggregates of entry
+// from the graph and moves it to its place in the indexes.
+func (pool *Pool) updatePackage(entry *TxDesc) {
+	pool.unindex(entry)
+	defer pool.index(entry)
+	entry.AncestorCount, entry.AncestorSize, entry.AncestorFees = 1, entry.VSize, entry.Fee
+	for ancestor := range ancestors(entry) {
+		entry.AncestorCount++
+		entry.AncestorSize += ancestor.VSize
+		entry.AncestorFees += ancestor.Fee
+	}
+	entry.DescendantCount, entry.DescendantSize, entry.DescendantFees = 1, entry.VSize, entry.Fee
+	for descendant := range descendants(entry) {
+		entry.DescendantCount++
+		entry.DescendantSize += descendant.VSize
+		entry.DescendantFees += descendant.Fee
+	}
+}
+
+// index inserts entry into the pool's indexes.
+func (pool *Pool) index(entry *TxDesc) {
+	pool.byFeeRate.insert(entry)
+	pool.byAncestorFeeRate.insert(entry)
+	pool.byDescendantScore.insert(entry)
+}
+
+// unindex takes entry out of the pool's indexes, before the aggregates
+// they order it by change.
+func (pool *Pool) unindex(entry *TxDesc) {
+	pool.byFeeRate.remove(entry)
+	pool.byAncestorFeeRate.remove(entry)
+	pool.byDescendantScore.remove(entry)
+}
+
+// coin returns the coin at outPoint, from a pool transaction or the view.
+func (pool *Pool) coin(outPoint utxo.OutPoint) (*utxo.Coin, *TxDesc, error) {
+	if parent, ok := pool.txs[string(outPoint.TxId[:])]; ok {
+		if int(outPoint.Index) >= len(parent.Tx.Output) {
+			return nil, nil, nil
+		}
+		out := parent.Tx.Output[outPoint.Index]
+		return &utxo.Coin{Amount: out.Amount, Script: out.Script, Height: pool.height + 1}, parent, nil
+	}
+	coin, err := pool.view.GetCoin(outPoint)
+	if errors.Is(err, utxo.ErrCoinNotFound) {
+		return nil, nil, nil
+	}
+	return coin, nil, err
+}
+
+// Accept validates tx against the pool and the view, adds it and returns a
+// copy of its entry.
+func (pool *Pool) Accept(tx transactions.Transaction) (*TxDesc, error) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	entry, err := pool.accept(tx, acceptPolicy{limits: true, replace: true})
+	if err != nil {
+		return nil, err
+	}
+	return snapshot([]*TxDesc{entry})[0], nil
+}
+
+// acceptPolicy selects what accept enforces beyond validity.
+type acceptPolicy struct {
+	// limits enforces the fee, package and size limits. It is off for
+	// transactions returned from disconnected blocks, so that they are not
+	// lost to them.
+	limits bool
+	// skipFee admits a parent below the minimum fee rate whose child pays
+	// for it.
+	skipFee bool
+	// deferTrim leaves trimming the pool to the caller.
+	deferTrim bool
+	// replace lets the transaction evict conflicts under BIP125.
+	replace bool
+}
+
+// accept validates tx and adds it under policy.
+func (pool *Pool) accept(tx transactions.Transaction, policy acceptPolicy) (*TxDesc, error) {
+	txid := transactions.GenerateTransactionId(tx)
+	tx.Id = txid
+	if _, ok := pool.txs[string(txid)]; ok {
+		return nil, ErrAlreadyInPool
+	}
+	if err := consensus.CheckTransaction(tx); err != nil {
+		return nil, err
+	}
+	if consensus.IsCoinbase(tx) {
+		return nil, ErrCoinbase
+	}
+	height := pool.height + 1
+	if !consensus.IsFinalTx(tx, height, pool.medianTimePast) {
+		return nil, ErrNonFinal
+	}
+
+	parents := make(map[*TxDesc]bool)
+	conflicts := make(map[*TxDesc]bool)
+	coins := make([]*utxo.Coin, len(tx.Input))
+	var in int64
+	for i, input := range tx.Input {
+		outPoint := utxo.NewOutPoint(input.Hash, input.Index)
+		if spender, ok := pool.spenders[outPoint]; ok {
+			if !policy.replace {
+				return nil, fmt.Errorf("%w: %s:%d by %s", ErrDoubleSpend, utils.HashString(input.Hash), input.Index, utils.HashString(spender.TxId))
+			}
+			conflicts[spender] = true
+		}
+		coin, parent, err := pool.coin(outPoint)
+		if err != nil {
+			return nil, err
+		}
+		if coin == nil {
+			return nil, fmt.Errorf("%w: %s:%d", ErrMissingInputs, utils.HashString(input.Hash), input.Index)
+		}
+		if coin.Coinbase && height-coin.Height < pool.config.Params.CoinbaseMaturity {
+			return nil, ErrImmatureSpend
+		}
+		if parent != nil {
+			parents[parent] = true
+		}
+		coins[i] = coin
+		in += coin.Amount
+		if coin.Amount < 0 || in > consensus.MaxMoney {
+			return nil, ErrInputValuesOutRange
+		}
+	}
+	var out int64
+	for _, output := range tx.Output {
+		out += output.Amount
+	}
+	if in < out {
+		return nil, ErrNegativeFee
+	}
+	lock, err := pool.sequenceLock(tx, coins)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &TxDesc{
+		Tx:           tx,
+		TxId:         txid,
+		Fee:          in - out,
+		VSize:        VSize(tx),
+		Time:         pool.config.Now(),
+		Height:       pool.height,
+		SequenceLock: lock,
+		parents:      parents,
+		children:     make(map[*TxDesc]bool),
+	}
+	if policy.limits {
+		if minimum := pool.minFeeRate(); !policy.skipFee && entry.Fee < minimum.Fee(entry.VSize) {
+			return nil, fmt.Errorf("%w: %s < %s", ErrInsufficientFee, entry.FeeRate(), minimum)
+		}
+		if err := pool.checkLimits(entry); err != nil {
+			return nil, err
+		}
+	}
+	var evicted map[*TxDesc]bool
+	if len(conflicts) > 0 {
+		var err error
+		if evicted, err = pool.checkReplacement(entry, conflicts); err != nil {
+			return nil, err
+		}
+	}
+
+	flags := consensus.BlockScriptFlags(pool.config.Params, height, nil)
+	entry.SigOpCost = consensus.TxSigOpCost(tx, coins, flags)
+	prevouts := make([]transactions.TxOutput, len(coins))
+	for i, coin := range coins {
+		prevouts[i] = transactions.TxOutput{Amount: coin.Amount, Script: coin.Script}
+	}
+	hashes := transactions.NewTaprootHashes(tx, prevouts)
+	for i, input := range tx.Input {
+		checker := &transactions.SigChecker{Tx: &tx, Index: i, Amount: coins[i].Amount, Taproot: hashes}
+		if err := transactions.VerifyScript(input.Script, coins[i].Script, input.ScriptWitness, flags, checker); err != nil {
+			return nil, fmt.Errorf("input %d: %w", i, err)
+		}
+	}
+
+	pool.remove(evicted)
+	pool.add(entry)
+	// Only transactions mined on their own fee rate tell how long that
+	// rate takes to confirm.
+	if estimator := pool.config.Estimator; estimator != nil && policy.limits && !policy.skipFee && len(entry.parents) == 0 {
+		estimator.ProcessEntry(txid, entry.FeeRate(), pool.height)
+	}
+	if policy.limits && !policy.deferTrim {
+		pool.trim()
+		if _, ok := pool.txs[string(txid)]; !ok {
+			return nil, ErrMempoolFull
+		}
+	}
+	return entry, nil
+}
+
+// sequenceLock returns the BIP68 relative lock of tx, spending coins, and
+// checks that it lets tx into the next block. Coins of pool transactions
+// count as mined in that block, as in Bitcoin Core.
+func (pool *Pool) sequenceLock(tx transactions.Transaction, coins []*utxo.Coin) (consensus.SequenceLock, error) {
+	prevHeights := make([]int32, len(coins))
+	for i, coin := range coins {
+		prevHeights[i] = coin.Height
+	}
+	pastTimes := func(height int32) (int64, error) {
+		if height >= pool.height {
+			return pool.medianTimePast, nil
+		}
+		if pool.config.MedianTimes == nil {
+			return 0, errNoMedianTimes
+		}
+		return pool.config.MedianTimes(height)
+	}
+	lock, err := consensus.CalculateSequenceLock(tx, prevHeights, pastTimes)
+	if err != nil {
+		return lock, fmt.Errorf("%w: %w", ErrNonFinal, err)
+	}
+	if !lock.Satisfied(pool.height+1, pool.medianTimePast) {
+		return lock, fmt.Errorf("%w: relative lock until height %d, time %d", ErrNonFinal, lock.Height, lock.Time)
+	}
+	return lock, nil
+}
+
+// checkLimits checks the package limits entry would break if added.
+func (pool *Pool) checkLimits(entry *TxDesc) error {
+	all := ancestors(entry)
+	count, size := 1, entry.VSize
+	for ancestor := range all {
+		count++
+		size += ancestor.VSize
+	}
+	if count > pool.config.MaxAncestors || size > pool.config.MaxAncestorSize {
+		return fmt.Errorf("%w: %d ancestors of %d vbytes", ErrTooManyAncestors, count, size)
+	}
+	for ancestor := range all {
+		if ancestor.DescendantCount+1 > pool.config.MaxDescendants || ancestor.DescendantSize+entry.VSize > pool.config.MaxDescendantSize {
+			return fmt.Errorf("%w: %s", ErrTooManyDescendants, utils.HashString(ancestor.TxId))
+		}
+	}
+	return nil
+}
+
+// add links entry into the pool, including to children already in it.
+func (pool *Pool) add(entry *TxDesc) {
+	pool.txs[string(entry.TxId)] = entry
+	pool.size += entry.VSize
+	for _, input := range entry.Tx.Input {
+		pool.spenders[utxo.NewOutPoint(input.Hash, input.Index)] = entry
+	}
+	for parent := range entry.parents {
+		parent.children[entry] = true
+	}
+	for i := range entry.Tx.Output {
+		if child, ok := pool.spenders[utxo.NewOutPoint(entry.TxId, uint32(i))]; ok {
+			child.parents[entry] = true
+			entry.children[child] = true
+		}
+	}
+	affected := ancestors(entry)
+	for descendant := range descendants(entry) {
+		affected[descendant] = true
+		for ancestor := range ancestors(descendant) {
+			affected[ancestor] = true
+		}
+	}
+	affected[entry] = true
+	for other := range affected {
+		pool.updatePackage(other)
+	}
+}
+
+// remove takes the given entries out of the pool. Descendants left behind
+// no longer count them as ancestors.
+func (pool *Pool) remove(entries map[*TxDesc]bool) {
+	affected := make(map[*TxDesc]bool)
+	for entry := range entries {
+		for other := range ancestors(entry) {
+			affected[other] = true
+		}
+		for other := range descendants(entry) {
+			affected[other] = true
+		}
+	}
+	for entry := range entries {
+		pool.unindex(entry)
+		if pool.config.Estimator != nil {
+			pool.config.Estimator.RemoveTx(entry.TxId)
+		}
+		delete(pool.txs, string(entry.TxId))
+		pool.size -= entry.VSize
+		for _, input := range entry.Tx.Input {
+			outPoint := utxo.NewOutPoint(input.Hash, input.Index)
+			if pool.spenders[outPoint] == entry {
+				delete(pool.spenders, outPoint)
+			}
+		}
+		for parent := range entry.parents {
+			delete(parent.children, entry)
+		}
+		for child := range entry.children {
+			delete(child.parents, entry)
+		}
+	}
+	for other := range affected {
+		if !entries[other] {
+			pool.updatePackage(other)
+		}
+	}
+}
+
+// withDescendants returns entry and all its descendants.
+func withDescendants(entry *TxDesc) map[*TxDesc]bool {
+	result := descendants(entry)
+	result[entry] = true
+	return result
+}
+
+// Remove takes txid and its descendants out of the pool.
+func (pool *Pool) Remove(txid []byte) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	if entry, ok := pool.txs[string(txid)]; ok {
+		pool.remove(withDescendants(entry))
+	}
+}
+
+// trim evicts the packages with the lowest descendant score until the pool
+// fits its size limit, raising the minimum fee rate above what was evicted.
+func (pool *Pool) trim() {
+	for pool.size > pool.config.MaxSize {
+		worst := pool.byDescendantScore.entries[0]
+		fee, size := descendantScore(worst)
+		if rate := NewFeeRate(fee, size) + pool.config.IncrementalRelayFeeRate; rate > pool.rollingMinFee {
+			pool.rollingMinFee = rate
+			pool.rollingFeeSince = pool.config.Now()
+		}
+		pool.remove(withDescendants(worst))
+	}
+}
+
+// Expire removes the transactions that entered the pool longer than the
+// expiry ago, with their descendants, and returns how many were removed.
+func (pool *Pool) Expire() int {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	return pool.expire()
+}
+
+func (pool *Pool) expire() int {
+	cutoff := pool.config.Now().Add(-pool.config.Expiry)
+	expired := make(map[*TxDesc]bool)
+	for _, entry := range pool.txs {
+		if entry.Time.Before(cutoff) {
+			for other := range withDescendants(entry) {
+				expired[other] = true
+			}
+		}
+	}
+	pool.remove(expired)
+	return len(expired)
+}
+
+// BlockConnected removes the transactions of block, now confirmed at height,
+// and those conflicting with them, then expires old entries. The view must
+// already include the block. The estimator, if any, records the block
+// first, so that the confirmed transactions do not count as dropped.
+func (pool *Pool) BlockConnected(block *blockchain.Block, height int32, medianTimePast int64) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	pool.height = height
+	pool.medianTimePast = medianTimePast
+	if pool.config.Estimator != nil {
+		txids := make([][]byte, len(block.Transactions))
+		for i, tx := range block.Transactions {
+			txids[i] = transactions.GenerateTransactionId(tx)
+		}
+		pool.config.Estimator.ProcessBlock(height, txids)
+	}
+	confirmed := make(map[*TxDesc]bool)
+	conflicts := make(map[*TxDesc]bool)
+	for _, tx := range block.Transactions {
+		if entry, ok := pool.txs[string(transactions.GenerateTransactionId(tx))]; ok {
+			confirmed[entry] = true
+			continue
+		}
+		for _, input := range tx.Input {
+			if spender, ok := pool.spenders[utxo.NewOutPoint(input.Hash, input.Index)]; ok {
+				for other := range withDescendants(spender) {
+					conflicts[other] = true
+				}
+			}
+		}
+	}
+	pool.remove(confirmed)
+	pool.remove(conflicts)
+	pool.expire()
+}
+
+// BlockDisconnected returns the transactions of block to the pool after it
+// was disconnected, leaving the tip at height and medianTimePast, and drops
+// entries the reorg made invalid. The view must no longer include the block.
+func (pool *Pool) BlockDisconnected(block *blockchain.Block, height int32, medianTimePast int64) {
+	pool.mutex.Lock()
+	defer pool.mutex.Unlock()
+	pool.height = height
+	pool.medianTimePast = medianTimePast
+	for _, tx := range block.Transactions {
+		if consensus.IsCoinbase(tx) {
+			continue
+		}
+		pool.accept(tx, acceptPolicy{})
+	}
+	pool.removeInvalid()
+	pool.trim()
+}
+
+// removeInvalid drops entries that spend coins no longer available or not
+// yet mature, or that are no longer final at the lower tip, along with
+// their descendants.
+func (pool *Pool) removeInvalid() {
+	invalid := make(map[*TxDesc]bool)
+	for _, entry := range pool.txs {
+		if !invalid[entry] && !pool.stillValid(entry) {
+			for other := range withDescendants(entry) {
+				invalid[other] = true
+			}
+		}
+	}
+	pool.remove(invalid)
+}
+
+// stillValid reports whether entry may still go into the next block,
+// updating its sequence lock.
+func (pool *Pool) stillValid(entry *TxDesc) bool {
+	if !consensus.IsFinalTx(entry.Tx, pool.height+1, pool.medianTimePast) {
+		return false
+	}
+	coins := make([]*utxo.Coin, len(entry.Tx.Input))
+	for i, input := range entry.Tx.Input {
+		coin, _, err := pool.coin(utxo.NewOutPoint(input.Hash, input.Index))
+		if err != nil || coin == nil || (coin.Coinbase && pool.height+1-coin.Height < pool.config.Params.CoinbaseMaturity) {
+			return false
+		}
+		coins[i] = coin
+	}
+	lock, err := pool.sequenceLock(entry.Tx, coins)
+	entry.SequenceLock = lock
+	return err == nil
+}
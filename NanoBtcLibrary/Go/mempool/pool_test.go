@@ -0,0 +1,270 @@
+package mempool
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	blockindex "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/blockindex"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	utxo "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utxo"
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
+	regtesttest "github.com/Btcercises/NanoBtcLibrary/Go/internal/regtesttest"
+	regtest "github.com/Btcercises/NanoBtcLibrary/Go/regtest"
+)
+
+var testScript = regtesttest.TrueScript
+
+type testChain struct {
+	chain  *regtest.Chain
+	set    *utxo.Set
+	blocks []*blockchain.Block
+	// skew moves the pool's clock ahead of the chain's.
+	skew time.Duration
+}
+
+// newTestChain mines n blocks on a regtest chain and connects them to a
+// UTXO set.
+func newTestChain(t *testing.T, n int) *testChain {
+	tc := &testChain{chain: regtesttest.NewTestChain()}
+	set, err := utxo.Open(blockindex.NewMemoryStore(), regtest.GenesisBlock().HashBlock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tc.set = set
+	tc.mine(t, n)
+	return tc
+}
+
+func (tc *testChain) now() time.Time {
+	return tc.chain.Now().Add(tc.skew)
+}
+
+func (tc *testChain) mine(t *testing.T, n int) []*blockchain.Block {
+	blocks, err := tc.chain.GenerateToScript(n, testScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, block := range blocks {
+		tc.blocks = append(tc.blocks, block)
+		if err := tc.set.ConnectBlock(block, int32(len(tc.blocks))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return blocks
+}
+
+// spend returns a transaction spending the first output of each of txs,
+// paying fee and splitting the rest over outputs outputs.
+func spend(fee int64, outputs int, txs ...transactions.Transaction) transactions.Transaction {
+	tx := transactions.Transaction{Version: 2}
+	var total int64
+	for _, parent := range txs {
+		tx.Input = append(tx.Input, transactions.TxInput{Hash: transactions.GenerateTransactionId(parent), Sequence: 0xffffffff})
+		total += parent.Output[0].Amount
+	}
+	for i := 0; i < outputs; i++ {
+		tx.Output = append(tx.Output, transactions.TxOutput{Amount: (total - fee) / int64(outputs), Script: testScript})
+	}
+	return tx
+}
+
+func (tc *testChain) coinbase(height int) transactions.Transaction {
+	return tc.blocks[height-1].Transactions[0]
+}
+
+func TestAcceptAndPackages(t *testing.T) {
+	tc := newTestChain(t, regtest.CoinbaseMaturity+5)
+	pool := New(Config{Params: &chaincfg.RegTestParams, MaxAncestors: 3, Now: tc.now}, tc.set, int32(len(tc.blocks)), 0)
+
+	parent := spend(1000, 1, tc.coinbase(1))
+	if _, err := pool.Accept(parent); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Accept(parent); err != ErrAlreadyInPool {
+		t.Fatalf("resubmission gave %v", err)
+	}
+	if _, err := pool.Accept(spend(2000, 1, tc.coinbase(1))); !errors.Is(err, ErrDoubleSpend) {
+		t.Fatalf("double spend gave %v", err)
+	}
+	if _, err := pool.Accept(spend(1000, 1, tc.coinbase(len(tc.blocks)))); err != ErrImmatureSpend {
+		t.Fatalf("immature spend gave %v", err)
+	}
+	if _, err := pool.Accept(spend(10, 1, tc.coinbase(2))); !errors.Is(err, ErrInsufficientFee) {
+		t.Fatalf("low fee gave %v", err)
+	}
+
+	child := spend(50000, 1, parent)
+	childDesc, err := pool.Accept(child)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parentDesc, _ := pool.Get(transactions.GenerateTransactionId(parent))
+	if childDesc.AncestorCount != 2 || childDesc.AncestorFees != 51000 || parentDesc.DescendantCount != 2 || parentDesc.DescendantFees != 51000 {
+		t.Fatalf("child has %d ancestors paying %d, parent %d descendants", childDesc.AncestorCount, childDesc.AncestorFees, parentDesc.DescendantCount)
+	}
+	grandchild := spend(1000, 1, child)
+	if _, err := pool.Accept(grandchild); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Accept(spend(1000, 1, grandchild)); !errors.Is(err, ErrTooManyAncestors) {
+		t.Fatalf("fourth generation gave %v", err)
+	}
+
+	other := spend(5000, 1, tc.coinbase(2))
+	if _, err := pool.Accept(other); err != nil {
+		t.Fatal(err)
+	}
+	byRate := pool.ByFeeRate()
+	if string(byRate[0].TxId) != string(transactions.GenerateTransactionId(child)) {
+		t.Fatal("child does not have the highest fee rate")
+	}
+	byAncestor := pool.ByAncestorFeeRate()
+	if string(byAncestor[0].TxId) != string(transactions.GenerateTransactionId(child)) || string(byAncestor[2].TxId) != string(transactions.GenerateTransactionId(other)) {
+		t.Fatal("wrong ancestor fee rate order")
+	}
+
+	pool.Remove(transactions.GenerateTransactionId(child))
+	if pool.Count() != 2 || len(pool.ByFeeRate()) != 2 || len(pool.ByAncestorFeeRate()) != 2 || len(pool.byDescendantScore.entries) != 2 {
+		t.Fatalf("%d transactions left after removing child", pool.Count())
+	}
+	// Entries are copies, untouched by later changes to the pool.
+	if parentDesc.DescendantCount != 2 {
+		t.Fatalf("copy of parent changed to %d descendants", parentDesc.DescendantCount)
+	}
+	if parentDesc, _ = pool.Get(transactions.GenerateTransactionId(parent)); parentDesc.DescendantCount != 1 {
+		t.Fatalf("parent still counts %d descendants", parentDesc.DescendantCount)
+	}
+}
+
+func TestEviction(t *testing.T) {
+	tc := newTestChain(t, regtest.CoinbaseMaturity+3)
+	low := spend(1000, 1, tc.coinbase(1))
+	pool := New(Config{Params: &chaincfg.RegTestParams, MaxSize: 2 * VSize(low), Now: tc.now}, tc.set, int32(len(tc.blocks)), 0)
+	if _, err := pool.Accept(low); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Accept(spend(3000, 1, tc.coinbase(2))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Accept(spend(2000, 1, tc.coinbase(3))); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := pool.Get(transactions.GenerateTransactionId(low)); ok || pool.Count() != 2 {
+		t.Fatal("lowest fee rate transaction was not evicted")
+	}
+	if pool.MinFeeRate() <= DefaultMinRelayFeeRate {
+		t.Fatal("eviction did not raise the minimum fee rate")
+	}
+	if _, err := pool.Accept(low); !errors.Is(err, ErrInsufficientFee) {
+		t.Fatalf("evicted transaction re-entered: %v", err)
+	}
+
+	tc.skew = DefaultExpiry + time.Hour
+	if pool.MinFeeRate() != DefaultMinRelayFeeRate {
+		t.Fatal("minimum fee rate did not decay")
+	}
+	if n := pool.Expire(); n != 2 || pool.Count() != 0 {
+		t.Fatalf("expired %d, %d left", n, pool.Count())
+	}
+}
+
+func TestBlockConnectDisconnect(t *testing.T) {
+	tc := newTestChain(t, regtest.CoinbaseMaturity+2)
+	pool := New(Config{Params: &chaincfg.RegTestParams, Now: tc.now}, tc.set, int32(len(tc.blocks)), 0)
+	parent := spend(1000, 1, tc.coinbase(1))
+	child := spend(1000, 1, parent)
+	for _, tx := range []transactions.Transaction{parent, child} {
+		if _, err := pool.Accept(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	conflicted := spend(1000, 1, tc.coinbase(2))
+	if _, err := pool.Accept(conflicted); err != nil {
+		t.Fatal(err)
+	}
+
+	// The block confirms parent and a conflicting spend of the second
+	// coinbase.
+	if err := tc.chain.AddTransaction(parent); err != nil {
+		t.Fatal(err)
+	}
+	if err := tc.chain.AddTransaction(spend(3000, 2, tc.coinbase(2))); err != nil {
+		t.Fatal(err)
+	}
+	block := tc.mine(t, 1)[0]
+	pool.BlockConnected(block, int32(len(tc.blocks)), 0)
+	childDesc, ok := pool.Get(transactions.GenerateTransactionId(child))
+	if !ok || pool.Count() != 1 || childDesc.AncestorCount != 1 {
+		t.Fatalf("%d transactions left after connect", pool.Count())
+	}
+
+	if err := tc.set.DisconnectBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	tc.blocks = tc.blocks[:len(tc.blocks)-1]
+	pool.BlockDisconnected(block, int32(len(tc.blocks)), 0)
+	childDesc, _ = pool.Get(transactions.GenerateTransactionId(child))
+	if pool.Count() != 3 || childDesc.AncestorCount != 2 {
+		t.Fatalf("%d transactions after disconnect, child has %d ancestors", pool.Count(), childDesc.AncestorCount)
+	}
+}
+
+func TestSequenceLocks(t *testing.T) {
+	tc := newTestChain(t, regtest.CoinbaseMaturity+5)
+	height := int32(len(tc.blocks))
+	pastTimes := tc.chain.MedianTimes()
+	medianTimePast, err := pastTimes(height)
+	if err != nil {
+		t.Fatal(err)
+	}
+	locked := func(sequence uint32, parent transactions.Transaction) transactions.Transaction {
+		tx := spend(1000, 1, parent)
+		tx.Input[0].Sequence = sequence
+		return tx
+	}
+	timeLock := uint32(transactions.SequenceLockTimeTypeFlag | 1)
+
+	pool := New(Config{Params: &chaincfg.RegTestParams, Now: tc.now}, tc.set, height, medianTimePast)
+	for name, tx := range map[string]transactions.Transaction{
+		"height lock":                   locked(uint32(height), tc.coinbase(2)),
+		"time lock without median time": locked(timeLock, tc.coinbase(3)),
+	} {
+		if _, err := pool.Accept(tx); !errors.Is(err, ErrNonFinal) {
+			t.Fatalf("%s gave %v", name, err)
+		}
+	}
+
+	pool = New(Config{Params: &chaincfg.RegTestParams, Now: tc.now, MedianTimes: pastTimes}, tc.set, height, medianTimePast)
+	expiring := locked(uint32(height), tc.coinbase(1))
+	if _, err := pool.Accept(expiring); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Accept(locked(timeLock, tc.coinbase(3))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Accept(locked(transactions.SequenceLockTimeTypeFlag|0xffff, tc.coinbase(4))); !errors.Is(err, ErrNonFinal) {
+		t.Fatalf("unexpired time lock gave %v", err)
+	}
+	// A parent in the pool counts as mined in the next block, so a child
+	// locked for a block must wait.
+	if _, err := pool.Accept(locked(1, expiring)); !errors.Is(err, ErrNonFinal) {
+		t.Fatalf("child of a pool transaction gave %v", err)
+	}
+
+	// Disconnecting the tip puts the height lock back in force.
+	block := tc.blocks[len(tc.blocks)-1]
+	if err := tc.set.DisconnectBlock(block); err != nil {
+		t.Fatal(err)
+	}
+	tc.blocks = tc.blocks[:len(tc.blocks)-1]
+	medianTimePast, err = pastTimes(height - 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.BlockDisconnected(block, height-1, medianTimePast)
+	if _, ok := pool.Get(transactions.GenerateTransactionId(expiring)); ok || pool.Count() != 1 {
+		t.Fatalf("%d transactions left after disconnect", pool.Count())
+	}
+}
@@ -0,0 +1,108 @@
+package mempool
+
+import (
+	"errors"
+	"fmt"
+
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	utils "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+)
+
+// MaxReplacementEvictions is the most transactions a replacement may evict,
+// counting the conflicts and all their descendants.
+const MaxReplacementEvictions = 100
+
+// maxReplaceableSequence is the highest input sequence signaling BIP125
+// replaceability.
+const maxReplaceableSequence = 0xfffffffd
+
+var (
+	ErrNotReplaceable            = errors.New("conflicting transaction does not signal replaceability")
+	ErrTooManyReplacements       = errors.New("replacement would evict too many transactions")
+	ErrReplacementSpendsConflict = errors.New("replacement spends an output of a transaction it replaces")
+	ErrReplacementNewUnconfirmed = errors.New("replacement adds an unconfirmed input")
+	ErrReplacementFeeRate        = errors.New("replacement fee rate not above the replaced transaction")
+	ErrReplacementFee            = errors.New("replacement fee too low")
+)
+
+// SignalsReplacement reports whether tx opts in to replacement under BIP125,
+// by having an input sequence no higher than 0xfffffffd.
+func SignalsReplacement(tx transactions.Transaction) bool {
+	for _, input := range tx.Input {
+		if input.Sequence <= maxReplaceableSequence {
+			return true
+		}
+	}
+	return false
+}
+
+// replaceable reports whether entry signals replaceability itself or
+// inherits it from an unconfirmed ancestor.
+func replaceable(entry *TxDesc) bool {
+	if SignalsReplacement(entry.Tx) {
+		return true
+	}
+	for ancestor := range ancestors(entry) {
+		if SignalsReplacement(ancestor.Tx) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkReplacement applies the BIP125 rules to entry replacing conflicts,
+// the pool transactions spending the same outputs, and returns everything
+// it would evict. A conflict that may not be replaced is still reported as
+// ErrDoubleSpend.
+func (pool *Pool) checkReplacement(entry *TxDesc, conflicts map[*TxDesc]bool) (map[*TxDesc]bool, error) {
+	if !pool.config.FullRBF {
+		for conflict := range conflicts {
+			if !replaceable(conflict) {
+				return nil, fmt.Errorf("%w: %w: %s", ErrDoubleSpend, ErrNotReplaceable, utils.HashString(conflict.TxId))
+			}
+		}
+	}
+
+	evicted := make(map[*TxDesc]bool)
+	for conflict := range conflicts {
+		for other := range withDescendants(conflict) {
+			evicted[other] = true
+		}
+		if len(evicted) > MaxReplacementEvictions {
+			return nil, fmt.Errorf("%w: more than %d", ErrTooManyReplacements, MaxReplacementEvictions)
+		}
+	}
+	for parent := range entry.parents {
+		if evicted[parent] {
+			return nil, fmt.Errorf("%w: %s", ErrReplacementSpendsConflict, utils.HashString(parent.TxId))
+		}
+	}
+
+	// Only unconfirmed parents the replaced transactions already had are
+	// allowed, so that the replacement is not mined later than they would.
+	conflictParents := make(map[*TxDesc]bool)
+	for conflict := range conflicts {
+		for parent := range conflict.parents {
+			conflictParents[parent] = true
+		}
+	}
+	for parent := range entry.parents {
+		if !conflictParents[parent] {
+			return nil, fmt.Errorf("%w: %s", ErrReplacementNewUnconfirmed, utils.HashString(parent.TxId))
+		}
+	}
+
+	for conflict := range conflicts {
+		if !feeRateLess(conflict.Fee, conflict.VSize, entry.Fee, entry.VSize) {
+			return nil, fmt.Errorf("%w: %s <= %s", ErrReplacementFeeRate, entry.FeeRate(), conflict.FeeRate())
+		}
+	}
+	var evictedFees int64
+	for other := range evicted {
+		evictedFees += other.Fee
+	}
+	if required := evictedFees + pool.config.IncrementalRelayFeeRate.Fee(entry.VSize); entry.Fee < required {
+		return nil, fmt.Errorf("%w: %d < %d", ErrReplacementFee, entry.Fee, required)
+	}
+	return evicted, nil
+}
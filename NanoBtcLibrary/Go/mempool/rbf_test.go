@@ -0,0 +1,125 @@
+package mempool
+
+import (
+	"errors"
+	"testing"
+
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	utxo "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utxo"
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
+	regtest "github.com/Btcercises/NanoBtcLibrary/Go/regtest"
+)
+
+// signaling returns tx with all its inputs signaling BIP125.
+func signaling(tx transactions.Transaction) transactions.Transaction {
+	for i := range tx.Input {
+		tx.Input[i].Sequence = maxReplaceableSequence
+	}
+	return tx
+}
+
+func TestReplaceByFee(t *testing.T) {
+	tc := newTestChain(t, regtest.CoinbaseMaturity+4)
+	pool := New(Config{Params: &chaincfg.RegTestParams, Now: tc.now}, tc.set, int32(len(tc.blocks)), 0)
+
+	original := signaling(spend(1000, 1, tc.coinbase(1)))
+	child := spend(1000, 1, original)
+	for _, tx := range []transactions.Transaction{original, child} {
+		if _, err := pool.Accept(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tooLow := spend(1000+1000+VSize(original)/2, 1, tc.coinbase(1))
+	if _, err := pool.Accept(tooLow); !errors.Is(err, ErrReplacementFee) {
+		t.Fatalf("replacement not paying for the evicted child gave %v", err)
+	}
+	sameRate := spend(1000, 1, tc.coinbase(1))
+	sameRate.Locktime = 1
+	if _, err := pool.Accept(sameRate); !errors.Is(err, ErrReplacementFeeRate) {
+		t.Fatalf("replacement at the same fee rate gave %v", err)
+	}
+	unrelated := spend(1000, 1, tc.coinbase(2))
+	if _, err := pool.Accept(unrelated); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Accept(spend(50000, 1, tc.coinbase(1), unrelated)); !errors.Is(err, ErrReplacementNewUnconfirmed) {
+		t.Fatalf("replacement with a new unconfirmed input gave %v", err)
+	}
+
+	bumped, err := pool.BumpFee(transactions.GenerateTransactionId(original), 0, 20000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := pool.Accept(bumped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry.FeeRate() < 20000 || pool.Count() != 2 {
+		t.Fatalf("bumped to %s, %d transactions left", entry.FeeRate(), pool.Count())
+	}
+	if _, ok := pool.Get(transactions.GenerateTransactionId(child)); ok {
+		t.Fatal("child of the replaced transaction is still in the pool")
+	}
+
+	// Without signaling only full RBF allows the replacement.
+	final := spend(1000, 1, tc.coinbase(3))
+	if _, err := pool.Accept(final); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Accept(spend(20000, 1, tc.coinbase(3))); !errors.Is(err, ErrNotReplaceable) {
+		t.Fatalf("replacing a non-signaling transaction gave %v", err)
+	}
+	if _, err := pool.BumpFee(transactions.GenerateTransactionId(final), 0, 20000); !errors.Is(err, ErrNotReplaceable) {
+		t.Fatalf("bumping a non-signaling transaction gave %v", err)
+	}
+	pool.config.FullRBF = true
+	if _, err := pool.BumpFee(transactions.GenerateTransactionId(final), 0, 20000); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Accept(spend(20000, 1, tc.coinbase(3))); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPackageCPFP(t *testing.T) {
+	tc := newTestChain(t, regtest.CoinbaseMaturity+2)
+	pool := New(Config{Params: &chaincfg.RegTestParams, Now: tc.now}, tc.set, int32(len(tc.blocks)), 0)
+
+	parent := spend(0, 1, tc.coinbase(1))
+	if _, err := pool.Accept(parent); !errors.Is(err, ErrInsufficientFee) {
+		t.Fatalf("zero fee parent gave %v", err)
+	}
+	if _, err := pool.AcceptPackage(parent, spend(0, 1, parent)); !errors.Is(err, ErrInsufficientFee) {
+		t.Fatalf("zero fee package gave %v", err)
+	}
+	if pool.Count() != 0 {
+		t.Fatal("failed package left transactions behind")
+	}
+	child, err := PackageChild(parent, 0, 0, testScript, 5000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := pool.AcceptPackage(parent, child)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate := entries[1].AncestorFeeRate(); rate < 5000 {
+		t.Fatalf("package pays %s", rate)
+	}
+
+	low := spend(200, 1, tc.coinbase(2))
+	if _, err := pool.Accept(low); err != nil {
+		t.Fatal(err)
+	}
+	bump, err := pool.CPFP(utxo.NewOutPoint(transactions.GenerateTransactionId(low), 0), testScript, 10000, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry, err := pool.Accept(bump)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rate := entry.AncestorFeeRate(); rate < 10000 {
+		t.Fatalf("CPFP child brings its package to %s", rate)
+	}
+}
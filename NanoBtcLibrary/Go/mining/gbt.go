@@ -0,0 +1,286 @@
+package mining
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	utils "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+	utxo "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utxo"
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
+	consensus "github.com/Btcercises/NanoBtcLibrary/Go/consensus"
+	difficulty "github.com/Btcercises/NanoBtcLibrary/Go/consensus/difficulty"
+	mempool "github.com/Btcercises/NanoBtcLibrary/Go/mempool"
+)
+
+var (
+	ErrBlockDecode     = errors.New("block decode failed")
+	ErrDuplicateBlock  = errors.New("block already known")
+	ErrHeadersNotAtTip = errors.New("header chain tip is not the UTXO set's best block")
+)
+
+// TemplateTx is a transaction of a getblocktemplate result. Depends holds
+// the 1-based positions in the transaction list of the transactions it
+// spends from.
+type TemplateTx struct {
+	Data    string `json:"data"`
+	TxId    string `json:"txid"`
+	Hash    string `json:"hash"`
+	Depends []int  `json:"depends"`
+	Fee     int64  `json:"fee"`
+	SigOps  int    `json:"sigops"`
+	Weight  int    `json:"weight"`
+}
+
+// TemplateResult is the getblocktemplate result of BIP22 and BIP23, with
+// Bitcoin Core's field names, for encoding/json. Miners build their own
+// coinbase paying CoinbaseValue and including DefaultWitnessCommitment.
+type TemplateResult struct {
+	Capabilities             []string          `json:"capabilities"`
+	Version                  int               `json:"version"`
+	Rules                    []string          `json:"rules"`
+	VbAvailable              map[string]int    `json:"vbavailable"`
+	VbRequired               int               `json:"vbrequired"`
+	PreviousBlockHash        string            `json:"previousblockhash"`
+	Transactions             []TemplateTx      `json:"transactions"`
+	CoinbaseAux              map[string]string `json:"coinbaseaux"`
+	CoinbaseValue            int64             `json:"coinbasevalue"`
+	Target                   string            `json:"target"`
+	MinTime                  int64             `json:"mintime"`
+	Mutable                  []string          `json:"mutable"`
+	NonceRange               string            `json:"noncerange"`
+	SigOpLimit               int               `json:"sigoplimit"`
+	SizeLimit                int               `json:"sizelimit"`
+	WeightLimit              int               `json:"weightlimit"`
+	CurTime                  int64             `json:"curtime"`
+	Bits                     string            `json:"bits"`
+	Height                   int32             `json:"height"`
+	SignetChallenge          string            `json:"signet_challenge,omitempty"`
+	DefaultWitnessCommitment string            `json:"default_witness_commitment,omitempty"`
+}
+
+// Result returns the getblocktemplate view of the template on the network
+// of params.
+func (template *Template) Result(params *chaincfg.ChainParams) *TemplateResult {
+	block := template.Block
+	target, _, _ := difficulty.CompactToBig(block.TargetDifficulty)
+	result := &TemplateResult{
+		Capabilities:      []string{},
+		Version:           block.Version,
+		Rules:             activeRules(params, template.Height),
+		VbAvailable:       map[string]int{},
+		PreviousBlockHash: utils.HashString(block.HashPrev),
+		Transactions:      make([]TemplateTx, 0, len(block.Transactions)-1),
+		CoinbaseAux:       map[string]string{},
+		CoinbaseValue:     block.Transactions[0].Output[0].Amount,
+		Target:            fmt.Sprintf("%064x", target),
+		MinTime:           template.MedianTimePast + 1,
+		Mutable:           []string{"time", "transactions", "prevblock"},
+		NonceRange:        "00000000ffffffff",
+		SigOpLimit:        consensus.MaxBlockSigOpsCost,
+		SizeLimit:         consensus.MaxBlockWeight,
+		WeightLimit:       consensus.MaxBlockWeight,
+		CurTime:           block.Timestamp.Unix(),
+		Bits:              fmt.Sprintf("%08x", block.TargetDifficulty),
+		Height:            template.Height,
+	}
+	positions := make(map[string]int)
+	for i, tx := range block.Transactions[1:] {
+		txid := transactions.GenerateTransactionId(tx)
+		positions[string(txid)] = i + 1
+		entry := TemplateTx{
+			Data:    hex.EncodeToString(transactions.Serialize(tx)),
+			TxId:    utils.HashString(txid),
+			Hash:    utils.HashString(transactions.GenerateWitnessTransactionId(tx)),
+			Depends: []int{},
+			Fee:     template.Fees[i+1],
+			SigOps:  template.SigOpCosts[i+1],
+			Weight:  transactions.Weight(tx),
+		}
+		for _, input := range tx.Input {
+			if position, ok := positions[string(input.Hash)]; ok && !containsInt(entry.Depends, position) {
+				entry.Depends = append(entry.Depends, position)
+			}
+		}
+		result.Transactions = append(result.Transactions, entry)
+	}
+	if commitment := template.WitnessCommitment(); commitment != nil {
+		result.DefaultWitnessCommitment = hex.EncodeToString(commitment)
+	}
+	if params.SignetChallenge != nil {
+		result.SignetChallenge = hex.EncodeToString(params.SignetChallenge)
+	}
+	return result
+}
+
+func containsInt(values []int, value int) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// activeRules lists the deployments a block at height must follow, a "!"
+// marking those a miner must understand to use the template. Taproot is
+// listed only where consensus.BlockScriptFlags enforces it.
+func activeRules(params *chaincfg.ChainParams, height int32) []string {
+	rules := []string{}
+	active := func(deployHeight int32) bool {
+		return deployHeight >= 0 && height >= deployHeight
+	}
+	if active(params.CSVHeight) {
+		rules = append(rules, "csv")
+	}
+	if active(params.SegwitHeight) {
+		rules = append(rules, "!segwit")
+	}
+	if active(params.TaprootHeight) && consensus.BlockScriptFlags(params, height, nil)&transactions.ScriptVerifyTaproot != 0 {
+		rules = append(rules, "taproot")
+	}
+	if params.SignetChallenge != nil {
+		rules = append(rules, "!signet")
+	}
+	return rules
+}
+
+// BlockSubmitter accepts solved blocks, as regtest.Chain and ChainSubmitter
+// do. Errors that are neither consensus.RuleErrors nor known to
+// RejectReason may carry their reject reason in a RejectReason() string
+// method.
+type BlockSubmitter interface {
+	SubmitBlock(block *blockchain.Block) error
+}
+
+// ChainSubmitter is the BlockSubmitter of a node whose active chain is
+// Headers and whose coins are Set. It takes blocks extending the tip only,
+// validating them with consensus.ValidateBlock and the header chain and
+// connecting them to Set.
+type ChainSubmitter struct {
+	Params  *chaincfg.ChainParams
+	Headers *blockchain.HeaderChain
+	Set     *utxo.Set
+	// Pool, if set, is told of each block connected.
+	Pool *mempool.Pool
+
+	mutex sync.Mutex
+}
+
+// SubmitBlock validates block and connects it on top of the tip.
+func (submitter *ChainSubmitter) SubmitBlock(block *blockchain.Block) error {
+	submitter.mutex.Lock()
+	defer submitter.mutex.Unlock()
+	best, height := submitter.Set.BestBlock()
+	if !bytes.Equal(submitter.Headers.Tip().HashBlock(), best) {
+		return ErrHeadersNotAtTip
+	}
+	if _, _, err := submitter.Headers.HeaderByHash(block.HashBlock()); err == nil {
+		return ErrDuplicateBlock
+	}
+	if _, _, err := submitter.Headers.HeaderByHash(block.HashPrev); err != nil {
+		return blockchain.ErrOrphanHeader
+	}
+	pastTimes := consensus.MedianTimes(func(height int32) (int64, error) {
+		header, err := submitter.Headers.HeaderByHeight(height)
+		if err != nil {
+			return 0, err
+		}
+		return header.Timestamp.Unix(), nil
+	})
+	if err := consensus.ValidateBlock(block, height+1, pastTimes, submitter.Set, submitter.Params); err != nil {
+		return err
+	}
+	// The coins are connected first, as they can be disconnected again if
+	// the header chain turns the header down, while the header cannot.
+	if err := submitter.Set.ConnectBlock(block, height+1); err != nil {
+		return err
+	}
+	if _, err := submitter.Headers.AcceptHeader(&block.BlockHeader); err != nil {
+		if undoErr := submitter.Set.DisconnectBlock(block); undoErr != nil {
+			return fmt.Errorf("%w, and disconnecting the block failed: %v", err, undoErr)
+		}
+		return err
+	}
+	if submitter.Pool != nil {
+		medianTimePast, err := pastTimes(height + 1)
+		if err != nil {
+			return err
+		}
+		submitter.Pool.BlockConnected(block, height+1, medianTimePast)
+	}
+	return nil
+}
+
+// rejectReasons maps the errors of block processing that are not
+// consensus.RuleErrors to Bitcoin Core's reject reasons.
+var rejectReasons = []struct {
+	err    error
+	reason string
+}{
+	{ErrDuplicateBlock, "duplicate"},
+	{ErrHeadersNotAtTip, "inconclusive"},
+	{utxo.ErrNotBestBlock, "inconclusive"},
+	{blockchain.ErrOrphanHeader, "prev-blk-not-found"},
+	{blockchain.ErrBadDiffBits, "bad-diffbits"},
+	{blockchain.ErrTimeTooOld, "time-too-old"},
+	{blockchain.ErrTimeTooNew, "time-too-new"},
+	{blockchain.ErrTimewarp, "time-timewarp-attack"},
+	{blockchain.ErrCheckpointMismatch, "checkpoint mismatch"},
+	{blockchain.ErrForkBeforeCheckpoint, "bad-fork-prior-to-checkpoint"},
+	{difficulty.ErrHighHash, string(consensus.RuleHighHash)},
+	{blockchain.ErrBadMerkleRoot, string(consensus.RuleBadMerkleRoot)},
+	{blockchain.ErrMerkleMutated, string(consensus.RuleDuplicateTx)},
+	{blockchain.ErrBadWitnessNonce, string(consensus.RuleWitnessNonceSize)},
+	{blockchain.ErrBadWitnessCommitment, string(consensus.RuleWitnessMerkleMatch)},
+	{blockchain.ErrUnexpectedWitness, string(consensus.RuleUnexpectedWitness)},
+}
+
+// RejectReason returns the BIP22 submitblock result for err: "" when the
+// block was accepted, the reject reason of a broken rule or of an error
+// carrying its own, or "rejected".
+func RejectReason(err error) string {
+	if err == nil {
+		return ""
+	}
+	var ruleErr *consensus.RuleError
+	if errors.As(err, &ruleErr) {
+		return string(ruleErr.Rule)
+	}
+	var rejectErr interface{ RejectReason() string }
+	if errors.As(err, &rejectErr) {
+		return rejectErr.RejectReason()
+	}
+	for _, known := range rejectReasons {
+		if errors.Is(err, known.err) {
+			return known.reason
+		}
+	}
+	return "rejected"
+}
+
+// SubmitBlock decodes the hex block of a submitblock call and hands it to
+// submitter, returning the BIP22 result: "" on success, otherwise why the
+// block was rejected. Undecodable blocks give ErrBlockDecode.
+func SubmitBlock(hexBlock string, submitter BlockSubmitter) (string, error) {
+	data, err := hex.DecodeString(hexBlock)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrBlockDecode, err)
+	}
+	reader := bytes.NewReader(data)
+	block, err := blockchain.ParseBlock(reader)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", ErrBlockDecode, err)
+	}
+	if reader.Len() != 0 {
+		return "", fmt.Errorf("%w: %d trailing bytes", ErrBlockDecode, reader.Len())
+	}
+	if len(block.Transactions) == 0 || !consensus.IsCoinbase(block.Transactions[0]) {
+		return string(consensus.RuleCoinbaseMissing), nil
+	}
+	return RejectReason(submitter.SubmitBlock(block)), nil
+}
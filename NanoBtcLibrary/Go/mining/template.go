@@ -0,0 +1,297 @@
+// Package mining assembles block templates from the mempool, for mining on
+// regtest and signet and for external miners through getblocktemplate.
+package mining
+
+import (
+	"sort"
+	"time"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
+	consensus "github.com/Btcercises/NanoBtcLibrary/Go/consensus"
+	mempool "github.com/Btcercises/NanoBtcLibrary/Go/mempool"
+)
+
+// Bitcoin Core's default block assembly policy.
+const (
+	// DefaultMaxWeight leaves room below the consensus limit for the
+	// coinbase and header.
+	DefaultMaxWeight     = consensus.MaxBlockWeight - 4000
+	DefaultMinFeeRate    = mempool.FeeRate(1000)
+	DefaultBlockVersion  = 0x20000000
+	coinbaseReserve      = 4000
+	coinbaseSigOpReserve = 400
+	// maxConsecutiveFailures is how many packages may fail to fit in a
+	// nearly full block before assembly gives up.
+	maxConsecutiveFailures = 1000
+)
+
+// witnessCommitmentHeader starts the BIP141 commitment output script:
+// OP_RETURN, a 36 byte push and the commitment tag.
+var witnessCommitmentHeader = []byte{0x6a, 0x24, 0xaa, 0x21, 0xa9, 0xed}
+
+// Config holds the assembly policy. Zero values take the defaults above.
+type Config struct {
+	Params *chaincfg.ChainParams
+	// PayScript receives the subsidy and the fees.
+	PayScript []byte
+	MaxWeight int
+	// MinFeeRate is the lowest package fee rate included.
+	MinFeeRate mempool.FeeRate
+	// Now is the clock used for the timestamp, time.Now by default.
+	Now func() time.Time
+}
+
+// Tip is the block a template builds on.
+type Tip struct {
+	// Hash is in internal byte order.
+	Hash           []byte
+	Height         int32
+	MedianTimePast int64
+	// Bits is the target the next block must meet.
+	Bits uint32
+}
+
+// Template is a block ready for proof of work, with what was learned while
+// assembling it. Fees and SigOpCosts are per transaction, the coinbase
+// first; its fee is minus the total fees as in Bitcoin Core.
+type Template struct {
+	Block          *blockchain.Block
+	Height         int32
+	MedianTimePast int64
+	Fees           []int64
+	SigOpCosts     []int
+	TotalFees      int64
+	Weight         int
+	SigOpCost      int
+	// HasWitnessCommitment is set when the coinbase commits to the
+	// witnesses, as it does once segwit is active.
+	HasWitnessCommitment bool
+}
+
+// pkg is a transaction with its ancestors not yet in the block.
+type pkg struct {
+	entry     *mempool.TxDesc
+	members   map[*mempool.TxDesc]bool
+	fee       int64
+	vsize     int64
+	weight    int
+	sigOpCost int
+}
+
+// better reports whether a pays a higher fee rate than b.
+func (a *pkg) better(b *pkg) bool {
+	return b == nil || a.fee*b.vsize > b.fee*a.vsize
+}
+
+// newPackage gathers entry and its ancestors not in included.
+func newPackage(entry *mempool.TxDesc, included map[*mempool.TxDesc]bool) *pkg {
+	result := &pkg{entry: entry, members: make(map[*mempool.TxDesc]bool)}
+	stack := []*mempool.TxDesc{entry}
+	for len(stack) > 0 {
+		next := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if result.members[next] || included[next] {
+			continue
+		}
+		result.members[next] = true
+		result.fee += next.Fee
+		result.vsize += next.VSize
+		result.weight += transactions.Weight(next.Tx)
+		result.sigOpCost += next.SigOpCost
+		stack = append(stack, next.Parents()...)
+	}
+	return result
+}
+
+// NewTemplate builds a block on tip from the transactions of pool, picking
+// packages by ancestor fee rate, as Bitcoin Core does, until the weight or
+// signature operation limit is reached or the rest pay less than the
+// minimum fee rate. Packages holding a transaction whose lock time or BIP68
+// sequence lock is not yet satisfied are skipped. The pool must be at tip
+// while the template is built.
+func NewTemplate(config Config, pool *mempool.Pool, tip Tip) (*Template, error) {
+	if config.Params == nil {
+		config.Params = &chaincfg.MainNetParams
+	}
+	if config.MaxWeight == 0 {
+		config.MaxWeight = DefaultMaxWeight
+	}
+	if config.MinFeeRate == 0 {
+		config.MinFeeRate = DefaultMinFeeRate
+	}
+	if config.Now == nil {
+		config.Now = time.Now
+	}
+	height := tip.Height + 1
+	template := &Template{
+		Height:         height,
+		MedianTimePast: tip.MedianTimePast,
+		Fees:           []int64{0},
+		SigOpCosts:     []int{0},
+		Weight:         coinbaseReserve,
+		SigOpCost:      coinbaseSigOpReserve,
+	}
+
+	txs := []transactions.Transaction{{}}
+	included := make(map[*mempool.TxDesc]bool)
+	failed := make(map[*mempool.TxDesc]bool)
+	// modified holds the packages of transactions some of whose ancestors
+	// are already in the block.
+	modified := make(map[*mempool.TxDesc]*pkg)
+	sorted := pool.ByAncestorFeeRate()
+	next, failures := 0, 0
+	for {
+		for next < len(sorted) && (included[sorted[next]] || failed[sorted[next]] || modified[sorted[next]] != nil) {
+			next++
+		}
+		var best *pkg
+		if next < len(sorted) {
+			best = newPackage(sorted[next], included)
+		}
+		fromModified := false
+		for _, candidate := range modified {
+			if candidate.better(best) {
+				best, fromModified = candidate, true
+			}
+		}
+		if best == nil {
+			break
+		}
+		if !fromModified {
+			next++
+		}
+		if best.fee < config.MinFeeRate.Fee(best.vsize) {
+			break
+		}
+
+		fits := template.Weight+best.weight <= config.MaxWeight && template.SigOpCost+best.sigOpCost <= consensus.MaxBlockSigOpsCost
+		for member := range best.members {
+			if !consensus.IsFinalTx(member.Tx, height, tip.MedianTimePast) || !member.SequenceLock.Satisfied(height, tip.MedianTimePast) {
+				fits = false
+			}
+		}
+		if !fits {
+			failed[best.entry] = true
+			delete(modified, best.entry)
+			failures++
+			if failures > maxConsecutiveFailures && template.Weight > config.MaxWeight-coinbaseReserve {
+				break
+			}
+			continue
+		}
+		failures = 0
+
+		// Parents have fewer ancestors than their children, so this order
+		// is topological.
+		members := make([]*mempool.TxDesc, 0, len(best.members))
+		for member := range best.members {
+			members = append(members, member)
+		}
+		sort.Slice(members, func(i, j int) bool { return members[i].AncestorCount < members[j].AncestorCount })
+		for _, member := range members {
+			included[member] = true
+			delete(modified, member)
+			txs = append(txs, member.Tx)
+			template.Fees = append(template.Fees, member.Fee)
+			template.SigOpCosts = append(template.SigOpCosts, member.SigOpCost)
+			template.TotalFees += member.Fee
+		}
+		template.Weight += best.weight
+		template.SigOpCost += best.sigOpCost
+		for _, member := range members {
+			for _, descendant := range descendants(member) {
+				if !included[descendant] && !failed[descendant] {
+					modified[descendant] = newPackage(descendant, included)
+				}
+			}
+		}
+	}
+	template.Fees[0] = -template.TotalFees
+
+	timestamp := config.Now().Unix()
+	if timestamp <= tip.MedianTimePast {
+		timestamp = tip.MedianTimePast + 1
+	}
+	template.Block = &blockchain.Block{
+		BlockHeader: blockchain.BlockHeader{
+			Version:          DefaultBlockVersion,
+			HashPrev:         append(blockchain.Hash256{}, tip.Hash...),
+			Timestamp:        time.Unix(timestamp, 0),
+			TargetDifficulty: tip.Bits,
+		},
+		MagicId:          blockchain.MagicId(config.Params.Net),
+		TransactionCount: uint64(len(txs)),
+		Transactions:     txs,
+	}
+	if err := template.setCoinbase(config); err != nil {
+		return nil, err
+	}
+	return template, nil
+}
+
+// descendants returns the transitive in-pool children of entry.
+func descendants(entry *mempool.TxDesc) []*mempool.TxDesc {
+	seen := make(map[*mempool.TxDesc]bool)
+	var result []*mempool.TxDesc
+	stack := entry.Children()
+	for len(stack) > 0 {
+		next := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[next] {
+			continue
+		}
+		seen[next] = true
+		result = append(result, next)
+		stack = append(stack, next.Children()...)
+	}
+	return result
+}
+
+// setCoinbase builds the coinbase paying the subsidy and fees, commits to
+// the witnesses once segwit is active and sets the merkle root.
+func (template *Template) setCoinbase(config Config) error {
+	block := template.Block
+	coinbase := transactions.Transaction{
+		Version: 2,
+		Input: []transactions.TxInput{{
+			Hash:      make([]byte, 32),
+			Index:     0xffffffff,
+			PrevIndex: -1,
+			Sequence:  0xffffffff,
+		}},
+		Output: []transactions.TxOutput{{
+			Amount: config.Params.BlockSubsidy(template.Height) + template.TotalFees,
+			Script: config.PayScript,
+		}},
+	}
+	if template.Height >= config.Params.SegwitHeight && config.Params.SegwitHeight >= 0 {
+		block.Transactions[0] = coinbase
+		witnessRoot, _ := blockchain.WitnessMerkleRoot(block.Transactions)
+		nonce := make([]byte, 32)
+		coinbase.Input[0].ScriptWitness = [][]byte{nonce}
+		script := append(append([]byte{}, witnessCommitmentHeader...), blockchain.WitnessCommitment(witnessRoot, nonce)...)
+		coinbase.Output = append(coinbase.Output, transactions.TxOutput{Amount: 0, Script: script})
+		template.HasWitnessCommitment = true
+	}
+	block.Transactions[0] = coinbase
+	if err := consensus.SetExtraNonce(block, template.Height, 0); err != nil {
+		return err
+	}
+	// The reserves give way to the actual coinbase.
+	template.SigOpCosts[0] = consensus.TxSigOpCost(block.Transactions[0], nil, 0)
+	template.SigOpCost += template.SigOpCosts[0] - coinbaseSigOpReserve
+	template.Weight = block.Weight()
+	return nil
+}
+
+// WitnessCommitment returns the commitment output script of the coinbase,
+// or nil before segwit.
+func (template *Template) WitnessCommitment() []byte {
+	coinbase := template.Block.Transactions[0]
+	if index := blockchain.WitnessCommitmentIndex(coinbase); index >= 0 {
+		return coinbase.Output[index].Script
+	}
+	return nil
+}
@@ -0,0 +1,249 @@
+package mining
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"testing"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	blockindex "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/blockindex"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	utxo "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utxo"
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
+	consensus "github.com/Btcercises/NanoBtcLibrary/Go/consensus"
+	difficulty "github.com/Btcercises/NanoBtcLibrary/Go/consensus/difficulty"
+	regtesttest "github.com/Btcercises/NanoBtcLibrary/Go/internal/regtesttest"
+	mempool "github.com/Btcercises/NanoBtcLibrary/Go/mempool"
+	regtest "github.com/Btcercises/NanoBtcLibrary/Go/regtest"
+)
+
+var testScript = regtesttest.TrueScript
+
+// spend returns a transaction spending the first output of parent and
+// paying fee.
+func spend(fee int64, parent transactions.Transaction) transactions.Transaction {
+	return transactions.Transaction{
+		Version: 2,
+		Input:   []transactions.TxInput{{Hash: transactions.GenerateTransactionId(parent), Sequence: 0xffffffff}},
+		Output:  []transactions.TxOutput{{Amount: parent.Output[0].Amount - fee, Script: testScript}},
+	}
+}
+
+func TestNewTemplate(t *testing.T) {
+	chain := regtesttest.NewTestChain()
+	now := chain.Now
+	blocks, err := chain.GenerateToScript(regtest.CoinbaseMaturity+3, testScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := utxo.Open(blockindex.NewMemoryStore(), regtest.GenesisBlock().HashBlock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, block := range blocks {
+		if err := set.ConnectBlock(block, int32(i+1)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	height := chain.Height()
+	pool := mempool.New(mempool.Config{Params: &chaincfg.RegTestParams, Now: now}, set, height, 0)
+
+	parent := spend(1000, blocks[0].Transactions[0])
+	child := spend(50000, parent)
+	mid := spend(5000, blocks[1].Transactions[0])
+	low := spend(1000, blocks[2].Transactions[0])
+	for _, tx := range []transactions.Transaction{low, mid, parent, child} {
+		if _, err := pool.Accept(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tip := Tip{Hash: chain.Tip().HashBlock(), Height: height, Bits: chain.Tip().TargetDifficulty}
+	config := Config{Params: &chaincfg.RegTestParams, PayScript: testScript, MinFeeRate: 20000, Now: now}
+	template, err := NewTemplate(config, pool, tip)
+	if err != nil {
+		t.Fatal(err)
+	}
+	block := template.Block
+	want := []transactions.Transaction{parent, child, mid}
+	if len(block.Transactions) != len(want)+1 {
+		t.Fatalf("template has %d transactions", len(block.Transactions))
+	}
+	for i, tx := range want {
+		if hex.EncodeToString(transactions.GenerateTransactionId(block.Transactions[i+1])) != hex.EncodeToString(transactions.GenerateTransactionId(tx)) {
+			t.Fatalf("transaction %d out of order", i+1)
+		}
+	}
+	if template.TotalFees != 56000 || template.Fees[0] != -56000 || block.Transactions[0].Output[0].Amount != chaincfg.RegTestParams.BlockSubsidy(height+1)+56000 {
+		t.Fatalf("fees %d, coinbase pays %d", template.TotalFees, block.Transactions[0].Output[0].Amount)
+	}
+	if template.Weight != block.Weight() || template.WitnessCommitment() == nil {
+		t.Fatal("weight or witness commitment missing")
+	}
+
+	result := template.Result(&chaincfg.RegTestParams)
+	if result.Height != height+1 || len(result.Transactions) != 3 || len(result.Transactions[1].Depends) != 1 || result.Transactions[1].Depends[0] != 1 || result.Transactions[1].Fee != 50000 {
+		t.Fatalf("unexpected getblocktemplate result %+v", result)
+	}
+
+	if err := consensus.MineBlock(context.Background(), block, template.Height, now); err != nil {
+		t.Fatal(err)
+	}
+	if err := consensus.ValidateBlock(block, template.Height, chain.MedianTimes(), set, &chaincfg.RegTestParams); err != nil {
+		t.Fatal(err)
+	}
+	data := hex.EncodeToString(block.Serialize())
+	if reason, err := SubmitBlock(data, chain); err != nil || reason != "" {
+		t.Fatalf("submitblock gave %q, %v", reason, err)
+	}
+	if reason, _ := SubmitBlock(data, chain); reason != "duplicate" {
+		t.Fatalf("resubmission gave %q", reason)
+	}
+	if _, err := SubmitBlock(data[:100], chain); err == nil {
+		t.Fatal("truncated block decoded")
+	}
+
+	orphan := *block
+	orphan.HashPrev = make([]byte, 32)
+	orphan.Hash = nil
+	if reason, _ := SubmitBlock(hex.EncodeToString(orphan.Serialize()), chain); reason != "prev-blk-not-found" {
+		t.Fatalf("orphan block gave %q", reason)
+	}
+}
+
+// testNode mines n blocks on a regtest chain and returns them with a UTXO
+// set and header chain at their tip.
+func testNode(t *testing.T, n int) (*regtest.Chain, []*blockchain.Block, *utxo.Set, *blockchain.HeaderChain) {
+	chain := regtesttest.NewTestChain()
+	blocks, err := chain.GenerateToScript(n, testScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	set, err := utxo.Open(blockindex.NewMemoryStore(), regtest.GenesisBlock().HashBlock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, err := blockchain.NewHeaderChain(&difficulty.RegTestParams, &regtest.GenesisBlock().BlockHeader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, block := range blocks {
+		if err := set.ConnectBlock(block, int32(i+1)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := headers.AcceptHeader(&block.BlockHeader); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return chain, blocks, set, headers
+}
+
+func TestNewTemplateSequenceLocks(t *testing.T) {
+	chain, blocks, set, _ := testNode(t, regtest.CoinbaseMaturity+3)
+	height := chain.Height()
+	pool := mempool.New(mempool.Config{Params: &chaincfg.RegTestParams, Now: chain.Now}, set, height, 0)
+	locked := spend(1000, blocks[0].Transactions[0])
+	locked.Input[0].Sequence = uint32(height)
+	if _, err := pool.Accept(locked); err != nil {
+		t.Fatal(err)
+	}
+
+	// The lock ends with the block the pool was accepting for, so a
+	// template one block lower must leave the transaction out.
+	config := Config{Params: &chaincfg.RegTestParams, PayScript: testScript, Now: chain.Now}
+	template, err := NewTemplate(config, pool, Tip{Hash: chain.Tip().HashBlock(), Height: height, Bits: chain.Tip().TargetDifficulty})
+	if err != nil || len(template.Block.Transactions) != 2 {
+		t.Fatalf("template at the tip: %v", err)
+	}
+	template, err = NewTemplate(config, pool, Tip{Hash: blocks[height-2].HashBlock(), Height: height - 1, Bits: chain.Tip().TargetDifficulty})
+	if err != nil || len(template.Block.Transactions) != 1 {
+		t.Fatalf("template below the lock: %v", err)
+	}
+}
+
+func TestChainSubmitter(t *testing.T) {
+	chain, blocks, set, headers := testNode(t, regtest.CoinbaseMaturity+1)
+	height := chain.Height()
+	pool := mempool.New(mempool.Config{Params: &chaincfg.RegTestParams, Now: chain.Now}, set, height, 0)
+	if _, err := pool.Accept(spend(1000, blocks[0].Transactions[0])); err != nil {
+		t.Fatal(err)
+	}
+	submitter := &ChainSubmitter{Params: &chaincfg.RegTestParams, Headers: headers, Set: set, Pool: pool}
+
+	newBlock := func() *blockchain.Block {
+		tip := Tip{Hash: headers.Tip().HashBlock(), Height: headers.Height(), Bits: headers.Tip().TargetDifficulty}
+		template, err := NewTemplate(Config{Params: &chaincfg.RegTestParams, PayScript: testScript, Now: chain.Now}, pool, tip)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := consensus.MineBlock(context.Background(), template.Block, template.Height, chain.Now); err != nil {
+			t.Fatal(err)
+		}
+		return template.Block
+	}
+	block := newBlock()
+	if len(block.Transactions) != 2 {
+		t.Fatalf("template has %d transactions", len(block.Transactions))
+	}
+	data := hex.EncodeToString(block.Serialize())
+	if reason, err := SubmitBlock(data, submitter); err != nil || reason != "" {
+		t.Fatalf("submitblock gave %q, %v", reason, err)
+	}
+	if best, bestHeight := set.BestBlock(); !bytes.Equal(best, block.HashBlock()) || bestHeight != height+1 || headers.Height() != height+1 || pool.Count() != 0 {
+		t.Fatalf("block not connected: height %d, %d in pool", bestHeight, pool.Count())
+	}
+	if reason, _ := SubmitBlock(data, submitter); reason != "duplicate" {
+		t.Fatalf("resubmission gave %q", reason)
+	}
+
+	// A block breaking a consensus rule reaches neither the set nor the
+	// header chain.
+	greedy := newBlock()
+	greedy.Transactions[0].Output[0].Amount++
+	if err := regtesttest.Remine(greedy); err != nil {
+		t.Fatal(err)
+	}
+	if reason, _ := SubmitBlock(hex.EncodeToString(greedy.Serialize()), submitter); reason != string(consensus.RuleCoinbaseAmount) {
+		t.Fatalf("overpaying coinbase gave %q", reason)
+	}
+	if _, bestHeight := set.BestBlock(); bestHeight != height+1 || headers.Height() != height+1 {
+		t.Fatal("invalid block connected")
+	}
+
+	// Timestamps are left to the header chain, which turns the block down
+	// after its coins were connected; they must be disconnected again.
+	early := newBlock()
+	early.Timestamp = blocks[0].Timestamp
+	if err := regtesttest.Remine(early); err != nil {
+		t.Fatal(err)
+	}
+	if reason, _ := SubmitBlock(hex.EncodeToString(early.Serialize()), submitter); reason != "time-too-old" {
+		t.Fatalf("block before the median time past gave %q", reason)
+	}
+	if best, bestHeight := set.BestBlock(); !bytes.Equal(best, block.HashBlock()) || bestHeight != height+1 {
+		t.Fatal("coins of a block with a rejected header left connected")
+	}
+	earlyCoinbase := transactions.GenerateTransactionId(early.Transactions[0])
+	if _, err := set.GetCoin(utxo.NewOutPoint(earlyCoinbase, 0)); err != utxo.ErrCoinNotFound {
+		t.Fatalf("coinbase of a rejected block in the set: %v", err)
+	}
+
+	orphan := newBlock()
+	orphan.HashPrev = make([]byte, 32)
+	if err := regtesttest.Remine(orphan); err != nil {
+		t.Fatal(err)
+	}
+	if reason, _ := SubmitBlock(hex.EncodeToString(orphan.Serialize()), submitter); reason != "prev-blk-not-found" {
+		t.Fatalf("orphan block gave %q", reason)
+	}
+}
+
+func TestActiveRules(t *testing.T) {
+	if rules := activeRules(&chaincfg.MainNetParams, chaincfg.MainNetParams.TaprootHeight); len(rules) != 3 || rules[2] != "taproot" {
+		t.Fatalf("mainnet rules at taproot activation %v", rules)
+	}
+	if rules := activeRules(&chaincfg.MainNetParams, chaincfg.MainNetParams.TaprootHeight-1); len(rules) != 2 {
+		t.Fatalf("mainnet rules before taproot %v", rules)
+	}
+}
@@ -0,0 +1,180 @@
+package messaging
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	bloom "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/bloom"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	util "github.com/Btcercises/NanoBtcLibrary/Go/network/util"
+)
+
+// MaxFilterAddSize is the largest element filteradd may carry, the largest
+// script push.
+const MaxFilterAddSize = 520
+
+var (
+	ErrFilterAddTooLarge = errors.New("filteradd element too large")
+	ErrShortFilterAdd    = errors.New("filteradd payload too short")
+)
+
+// FilterLoadMessage replaces the peer's bloom filter for this connection.
+type FilterLoadMessage struct {
+	Filter *bloom.Filter
+	err    error
+}
+
+func FilterLoadMessageOption() ReceiveMessageTypeOption {
+	return func() reflect.Type {
+		return reflect.TypeOf((*FilterLoadMessage)(nil))
+	}
+}
+
+func NewFilterLoadMessage(filter *bloom.Filter) *FilterLoadMessage {
+	return &FilterLoadMessage{Filter: filter}
+}
+
+func (*FilterLoadMessage) Command() []byte {
+	return []byte("filterload")
+}
+
+func (msg *FilterLoadMessage) Serialize() []byte {
+	return msg.Filter.Serialize()
+}
+
+func (msg *FilterLoadMessage) Parse(reader *bytes.Reader) Message {
+	msg.Filter, msg.err = bloom.Parse(reader)
+	return msg
+}
+
+// Err returns the error met while parsing the filter, if any.
+func (msg *FilterLoadMessage) Err() error {
+	return msg.err
+}
+
+// FilterAddMessage adds one element to the peer's bloom filter.
+type FilterAddMessage struct {
+	Data []byte
+	err  error
+}
+
+func FilterAddMessageOption() ReceiveMessageTypeOption {
+	return func() reflect.Type {
+		return reflect.TypeOf((*FilterAddMessage)(nil))
+	}
+}
+
+func NewFilterAddMessage(data []byte) *FilterAddMessage {
+	return &FilterAddMessage{Data: data}
+}
+
+func (*FilterAddMessage) Command() []byte {
+	return []byte("filteradd")
+}
+
+func (msg *FilterAddMessage) Serialize() []byte {
+	return append(util.EncodeVarInt(len(msg.Data)), msg.Data...)
+}
+
+func (msg *FilterAddMessage) Parse(reader *bytes.Reader) Message {
+	length, err := readItemCount(reader, 1)
+	if err != nil {
+		msg.err = ErrShortFilterAdd
+		return msg
+	}
+	if length > MaxFilterAddSize {
+		msg.err = ErrFilterAddTooLarge
+		return msg
+	}
+	msg.Data = make([]byte, length)
+	reader.Read(msg.Data)
+	return msg
+}
+
+// Err returns the error met while parsing the element, if any.
+func (msg *FilterAddMessage) Err() error {
+	return msg.err
+}
+
+// FilterClearMessage removes the peer's bloom filter.
+type FilterClearMessage struct{}
+
+func FilterClearMessageOption() ReceiveMessageTypeOption {
+	return func() reflect.Type {
+		return reflect.TypeOf((*FilterClearMessage)(nil))
+	}
+}
+
+func NewFilterClearMessage() *FilterClearMessage {
+	return &FilterClearMessage{}
+}
+
+func (*FilterClearMessage) Command() []byte {
+	return []byte("filterclear")
+}
+
+func (*FilterClearMessage) Serialize() []byte {
+	return []byte{}
+}
+
+func (msg *FilterClearMessage) Parse(reader *bytes.Reader) Message {
+	return msg
+}
+
+// TxMessage carries one transaction.
+type TxMessage struct {
+	Tx  transactions.Transaction
+	err error
+}
+
+func TxMessageOption() ReceiveMessageTypeOption {
+	return func() reflect.Type {
+		return reflect.TypeOf((*TxMessage)(nil))
+	}
+}
+
+func NewTxMessage(tx transactions.Transaction) *TxMessage {
+	return &TxMessage{Tx: tx}
+}
+
+func (*TxMessage) Command() []byte {
+	return []byte("tx")
+}
+
+func (msg *TxMessage) Serialize() []byte {
+	return transactions.Serialize(msg.Tx)
+}
+
+func (msg *TxMessage) Parse(reader *bytes.Reader) Message {
+	msg.Tx, msg.err = transactions.ParseTransaction(reader)
+	return msg
+}
+
+// Err returns the error met while parsing the transaction, if any.
+func (msg *TxMessage) Err() error {
+	return msg.err
+}
+
+// NewFilteredBlock answers a MSG_FILTERED_BLOCK request for block: a
+// merkleblock proving the transactions relevant to filter, followed by a tx
+// message for each of them, in block order and without witness data. The
+// filter is updated as the block is matched, as BIP37 requires.
+func NewFilteredBlock(block *blockchain.Block, filter *bloom.Filter) (*MerkleBlockMessage, []*TxMessage) {
+	txids := make([][]byte, len(block.Transactions))
+	matched := make([][]byte, 0)
+	txs := make([]*TxMessage, 0)
+	for i, tx := range block.Transactions {
+		txids[i] = transactions.GenerateTransactionId(tx)
+		if filter.IsRelevantAndUpdate(tx) {
+			matched = append(matched, txids[i])
+			tx.Input = append([]transactions.TxInput{}, tx.Input...)
+			for j := range tx.Input {
+				tx.Input[j].ScriptWitness = nil
+			}
+			txs = append(txs, NewTxMessage(tx))
+		}
+	}
+	return NewMerkleBlockMessage(&block.BlockHeader, txids, matched), txs
+}
@@ -0,0 +1,80 @@
+package messaging
+
+import (
+	"bytes"
+	"testing"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	bloom "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/bloom"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+)
+
+func TestNewFilteredBlock(t *testing.T) {
+	pubKeyHash := bytes.Repeat([]byte{3}, 20)
+	p2pkh := append(append(transactions.Script{transactions.OP_DUP, transactions.OP_HASH160}, transactions.PushData(pubKeyHash)...), transactions.OP_EQUALVERIFY, transactions.OP_CHECKSIG)
+	coinbase := transactions.Transaction{
+		Version: 1,
+		Input:   []transactions.TxInput{{Hash: make([]byte, 32), Index: 0xffffffff, PrevIndex: -1, Script: transactions.Script{1, 1}, Sequence: 0xffffffff}},
+		Output:  []transactions.TxOutput{{Amount: 50, Script: p2pkh}},
+	}
+	other := transactions.Transaction{
+		Version: 1,
+		Input:   []transactions.TxInput{{Hash: testHash(1), Sequence: 0xffffffff}},
+		Output:  []transactions.TxOutput{{Amount: 1, Script: transactions.Script{transactions.OP_1}}},
+	}
+	// The spend of the coinbase matches through the outpoint the filter
+	// learnt from the coinbase earlier in the same block.
+	spend := transactions.Transaction{
+		Version: 1,
+		Input:   []transactions.TxInput{{Hash: transactions.GenerateTransactionId(coinbase), Sequence: 0xffffffff, ScriptWitness: [][]byte{{1}}}},
+		Output:  []transactions.TxOutput{{Amount: 49, Script: transactions.Script{transactions.OP_1}}},
+	}
+	txs := []transactions.Transaction{coinbase, other, spend}
+	merkleRoot, _ := blockchain.MerkleRoot(txs)
+	block := &blockchain.Block{
+		BlockHeader:      blockchain.BlockHeader{Version: 1, HashPrev: testHash(2), HashMerkle: merkleRoot},
+		TransactionCount: uint64(len(txs)),
+		Transactions:     txs,
+	}
+
+	filter := bloom.New(10, 0.000001, 0, bloom.UpdateAll)
+	filter.Insert(pubKeyHash)
+	merkleBlock, matched := NewFilteredBlock(block, filter)
+	parsed := parseMerkleBlock(merkleBlock.Serialize())
+	proofs, err := parsed.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proofs) != 2 || len(matched) != 2 {
+		t.Fatalf("proved %d and sent %d transactions", len(proofs), len(matched))
+	}
+	for i, index := range []int{0, 2} {
+		if !bytes.Equal(proofs[i].TxId, transactions.GenerateTransactionId(txs[index])) {
+			t.Fatalf("proof %d is for %x", i, proofs[i].TxId)
+		}
+		if !bytes.Equal(transactions.GenerateTransactionId(matched[i].Tx), proofs[i].TxId) {
+			t.Fatalf("tx message %d does not match its proof", i)
+		}
+	}
+	if matched[1].Tx.Input[0].ScriptWitness != nil || block.Transactions[2].Input[0].ScriptWitness == nil {
+		t.Fatal("witness not stripped from the sent copy only")
+	}
+}
+
+func TestFilterAddRejectsMalformedPayloads(t *testing.T) {
+	tests := []struct {
+		payload []byte
+		err     error
+	}{
+		{nil, ErrShortFilterAdd},
+		{[]byte{3, 1, 2}, ErrShortFilterAdd},
+		{append([]byte{0xfd, 0x09, 0x02}, make([]byte, MaxFilterAddSize+1)...), ErrFilterAddTooLarge},
+		{append([]byte{0xfd, 0x08, 0x02}, make([]byte, MaxFilterAddSize)...), nil},
+	}
+	for _, test := range tests {
+		msg := new(FilterAddMessage).Parse(bytes.NewReader(test.payload)).(*FilterAddMessage)
+		if msg.Err() != test.err {
+			t.Errorf("payload of %d bytes: got %v, want %v", len(test.payload), msg.Err(), test.err)
+		}
+	}
+}
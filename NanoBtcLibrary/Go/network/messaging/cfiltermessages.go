@@ -0,0 +1,343 @@
+package messaging
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+
+	filter "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/filter"
+	util "github.com/Btcercises/NanoBtcLibrary/Go/network/util"
+)
+
+// BIP157 limits and constants. Hashes in these messages are kept in the
+// internal byte order used on the wire.
+const (
+	FilterTypeBasic uint8 = 0x00
+	// MaxGetCFilters is the most filters a single getcfilters may request.
+	MaxGetCFilters = 1000
+	// MaxGetCFHeaders is the most filter headers a single getcfheaders may request.
+	MaxGetCFHeaders = 2000
+	// CFCheckptInterval is the spacing of the filter headers in cfcheckpt.
+	CFCheckptInterval = 1000
+)
+
+var (
+	ErrShortCFilterPayload = errors.New("compact filter message payload too short")
+	ErrUnknownFilterType   = errors.New("unknown filter type")
+)
+
+func readHash(reader *bytes.Reader) ([]byte, error) {
+	hash := make([]byte, 32)
+	if _, err := io.ReadFull(reader, hash); err != nil {
+		return nil, ErrShortCFilterPayload
+	}
+	return hash, nil
+}
+
+func readHashes(reader *bytes.Reader) ([][]byte, error) {
+	count, err := readItemCount(reader, 32)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([][]byte, count)
+	for i := range hashes {
+		hashes[i], _ = readHash(reader)
+	}
+	return hashes, nil
+}
+
+// filterRequest is the common layout of getcfilters and getcfheaders.
+type filterRequest struct {
+	FilterType  uint8
+	StartHeight uint32
+	StopHash    []byte
+	err         error
+}
+
+func (msg *filterRequest) serialize() []byte {
+	result := []byte{msg.FilterType}
+	result = append(result, util.Int32ToLittleEndian(msg.StartHeight)...)
+	return append(result, msg.StopHash...)
+}
+
+func (msg *filterRequest) parse(reader *bytes.Reader) {
+	var err error
+	if msg.FilterType, err = reader.ReadByte(); err != nil {
+		msg.err = ErrShortCFilterPayload
+		return
+	}
+	height := make([]byte, 4)
+	if _, err := io.ReadFull(reader, height); err != nil {
+		msg.err = ErrShortCFilterPayload
+		return
+	}
+	msg.StartHeight = util.LittleEndianToInt32(height)
+	msg.StopHash, msg.err = readHash(reader)
+}
+
+// Err returns the error met while parsing the message, if any.
+func (msg *filterRequest) Err() error {
+	return msg.err
+}
+
+// GetCFiltersMessage requests the filters of the blocks from StartHeight up
+// to the block StopHash.
+type GetCFiltersMessage struct {
+	filterRequest
+}
+
+func NewGetCFiltersMessage(filterType uint8, startHeight uint32, stopHash []byte) *GetCFiltersMessage {
+	return &GetCFiltersMessage{filterRequest{FilterType: filterType, StartHeight: startHeight, StopHash: stopHash}}
+}
+
+func (*GetCFiltersMessage) Command() []byte {
+	return []byte("getcfilters")
+}
+
+func (msg *GetCFiltersMessage) Serialize() []byte {
+	return msg.serialize()
+}
+
+func (msg *GetCFiltersMessage) Parse(reader *bytes.Reader) Message {
+	msg.parse(reader)
+	return msg
+}
+
+// CFilterMessage carries the filter of one block.
+type CFilterMessage struct {
+	FilterType uint8
+	BlockHash  []byte
+	Filter     []byte
+	err        error
+}
+
+func CFilterMessageOption() ReceiveMessageTypeOption {
+	return func() reflect.Type {
+		return reflect.TypeOf((*CFilterMessage)(nil))
+	}
+}
+
+func NewCFilterMessage(filterType uint8, blockHash []byte, filter []byte) *CFilterMessage {
+	return &CFilterMessage{FilterType: filterType, BlockHash: blockHash, Filter: filter}
+}
+
+func (*CFilterMessage) Command() []byte {
+	return []byte("cfilter")
+}
+
+func (msg *CFilterMessage) Serialize() []byte {
+	result := append([]byte{msg.FilterType}, msg.BlockHash...)
+	result = append(result, util.EncodeVarInt(len(msg.Filter))...)
+	return append(result, msg.Filter...)
+}
+
+func (msg *CFilterMessage) Parse(reader *bytes.Reader) Message {
+	msg.FilterType, msg.err = reader.ReadByte()
+	if msg.err != nil {
+		msg.err = ErrShortCFilterPayload
+		return msg
+	}
+	if msg.BlockHash, msg.err = readHash(reader); msg.err != nil {
+		return msg
+	}
+	length, err := readItemCount(reader, 1)
+	if err != nil {
+		msg.err = err
+		return msg
+	}
+	msg.Filter = make([]byte, length)
+	reader.Read(msg.Filter)
+	return msg
+}
+
+// Err returns the error met while parsing the message, if any.
+func (msg *CFilterMessage) Err() error {
+	return msg.err
+}
+
+// BasicFilter decodes the carried filter, which must be a basic filter.
+func (msg *CFilterMessage) BasicFilter() (*filter.Filter, error) {
+	if msg.err != nil {
+		return nil, msg.err
+	}
+	if msg.FilterType != FilterTypeBasic {
+		return nil, ErrUnknownFilterType
+	}
+	return filter.ParseBasicFilter(msg.BlockHash, msg.Filter)
+}
+
+// Hash returns the filter hash committed to by filter headers.
+func (msg *CFilterMessage) Hash() []byte {
+	return util.Hash256(msg.Filter)
+}
+
+// GetCFHeadersMessage requests the filter headers of the blocks from
+// StartHeight up to the block StopHash.
+type GetCFHeadersMessage struct {
+	filterRequest
+}
+
+func NewGetCFHeadersMessage(filterType uint8, startHeight uint32, stopHash []byte) *GetCFHeadersMessage {
+	return &GetCFHeadersMessage{filterRequest{FilterType: filterType, StartHeight: startHeight, StopHash: stopHash}}
+}
+
+func (*GetCFHeadersMessage) Command() []byte {
+	return []byte("getcfheaders")
+}
+
+func (msg *GetCFHeadersMessage) Serialize() []byte {
+	return msg.serialize()
+}
+
+func (msg *GetCFHeadersMessage) Parse(reader *bytes.Reader) Message {
+	msg.parse(reader)
+	return msg
+}
+
+// CFHeadersMessage carries the filter hashes of a range of blocks and the
+// filter header preceding them, from which the headers are rebuilt.
+type CFHeadersMessage struct {
+	FilterType       uint8
+	StopHash         []byte
+	PrevFilterHeader []byte
+	FilterHashes     [][]byte
+	err              error
+}
+
+func CFHeadersMessageOption() ReceiveMessageTypeOption {
+	return func() reflect.Type {
+		return reflect.TypeOf((*CFHeadersMessage)(nil))
+	}
+}
+
+func (*CFHeadersMessage) Command() []byte {
+	return []byte("cfheaders")
+}
+
+func (msg *CFHeadersMessage) Serialize() []byte {
+	result := append([]byte{msg.FilterType}, msg.StopHash...)
+	result = append(result, msg.PrevFilterHeader...)
+	result = append(result, util.EncodeVarInt(len(msg.FilterHashes))...)
+	for _, hash := range msg.FilterHashes {
+		result = append(result, hash...)
+	}
+	return result
+}
+
+func (msg *CFHeadersMessage) Parse(reader *bytes.Reader) Message {
+	msg.FilterType, msg.err = reader.ReadByte()
+	if msg.err != nil {
+		msg.err = ErrShortCFilterPayload
+		return msg
+	}
+	if msg.StopHash, msg.err = readHash(reader); msg.err != nil {
+		return msg
+	}
+	if msg.PrevFilterHeader, msg.err = readHash(reader); msg.err != nil {
+		return msg
+	}
+	msg.FilterHashes, msg.err = readHashes(reader)
+	return msg
+}
+
+// Err returns the error met while parsing the message, if any.
+func (msg *CFHeadersMessage) Err() error {
+	return msg.err
+}
+
+// Headers chains the filter hashes onto PrevFilterHeader and returns the
+// filter header of every block in the range.
+func (msg *CFHeadersMessage) Headers() ([][]byte, error) {
+	if msg.err != nil {
+		return nil, msg.err
+	}
+	headers := make([][]byte, len(msg.FilterHashes))
+	prev := msg.PrevFilterHeader
+	for i, hash := range msg.FilterHashes {
+		headers[i] = filter.FilterHeader(hash, prev)
+		prev = headers[i]
+	}
+	return headers, nil
+}
+
+// GetCFCheckptMessage requests the filter headers at every
+// CFCheckptInterval blocks up to the block StopHash.
+type GetCFCheckptMessage struct {
+	FilterType uint8
+	StopHash   []byte
+	err        error
+}
+
+func NewGetCFCheckptMessage(filterType uint8, stopHash []byte) *GetCFCheckptMessage {
+	return &GetCFCheckptMessage{FilterType: filterType, StopHash: stopHash}
+}
+
+func (*GetCFCheckptMessage) Command() []byte {
+	return []byte("getcfcheckpt")
+}
+
+func (msg *GetCFCheckptMessage) Serialize() []byte {
+	return append([]byte{msg.FilterType}, msg.StopHash...)
+}
+
+func (msg *GetCFCheckptMessage) Parse(reader *bytes.Reader) Message {
+	msg.FilterType, msg.err = reader.ReadByte()
+	if msg.err != nil {
+		msg.err = ErrShortCFilterPayload
+		return msg
+	}
+	msg.StopHash, msg.err = readHash(reader)
+	return msg
+}
+
+// Err returns the error met while parsing the message, if any.
+func (msg *GetCFCheckptMessage) Err() error {
+	return msg.err
+}
+
+// CFCheckptMessage carries the filter headers at heights CFCheckptInterval,
+// 2*CFCheckptInterval and so on.
+type CFCheckptMessage struct {
+	FilterType    uint8
+	StopHash      []byte
+	FilterHeaders [][]byte
+	err           error
+}
+
+func CFCheckptMessageOption() ReceiveMessageTypeOption {
+	return func() reflect.Type {
+		return reflect.TypeOf((*CFCheckptMessage)(nil))
+	}
+}
+
+func (*CFCheckptMessage) Command() []byte {
+	return []byte("cfcheckpt")
+}
+
+func (msg *CFCheckptMessage) Serialize() []byte {
+	result := append([]byte{msg.FilterType}, msg.StopHash...)
+	result = append(result, util.EncodeVarInt(len(msg.FilterHeaders))...)
+	for _, header := range msg.FilterHeaders {
+		result = append(result, header...)
+	}
+	return result
+}
+
+func (msg *CFCheckptMessage) Parse(reader *bytes.Reader) Message {
+	msg.FilterType, msg.err = reader.ReadByte()
+	if msg.err != nil {
+		msg.err = ErrShortCFilterPayload
+		return msg
+	}
+	if msg.StopHash, msg.err = readHash(reader); msg.err != nil {
+		return msg
+	}
+	msg.FilterHeaders, msg.err = readHashes(reader)
+	return msg
+}
+
+// Err returns the error met while parsing the message, if any.
+func (msg *CFCheckptMessage) Err() error {
+	return msg.err
+}
@@ -0,0 +1,86 @@
+package messaging
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	filter "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/filter"
+)
+
+func testHash(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func TestFilterMessagesRoundTrip(t *testing.T) {
+	cfilter := NewCFilterMessage(FilterTypeBasic, testHash(1), []byte{1, 2, 3})
+	parsed := new(CFilterMessage).Parse(bytes.NewReader(cfilter.Serialize())).(*CFilterMessage)
+	if parsed.Err() != nil || !bytes.Equal(parsed.BlockHash, cfilter.BlockHash) || !bytes.Equal(parsed.Filter, cfilter.Filter) {
+		t.Fatalf("cfilter: %+v", parsed)
+	}
+
+	cfheaders := &CFHeadersMessage{StopHash: testHash(2), PrevFilterHeader: testHash(3), FilterHashes: [][]byte{testHash(4), testHash(5)}}
+	parsedHeaders := new(CFHeadersMessage).Parse(bytes.NewReader(cfheaders.Serialize())).(*CFHeadersMessage)
+	if parsedHeaders.Err() != nil || !reflect.DeepEqual(parsedHeaders.FilterHashes, cfheaders.FilterHashes) {
+		t.Fatalf("cfheaders: %v", parsedHeaders.Err())
+	}
+	headers, err := parsedHeaders.Headers()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(headers[1], filter.FilterHeader(testHash(5), filter.FilterHeader(testHash(4), testHash(3)))) {
+		t.Fatal("headers do not chain from the previous filter header")
+	}
+
+	checkpt := &CFCheckptMessage{StopHash: testHash(6), FilterHeaders: [][]byte{testHash(7)}}
+	parsedCheckpt := new(CFCheckptMessage).Parse(bytes.NewReader(checkpt.Serialize())).(*CFCheckptMessage)
+	if parsedCheckpt.Err() != nil || !reflect.DeepEqual(parsedCheckpt.FilterHeaders, checkpt.FilterHeaders) {
+		t.Fatalf("cfcheckpt: %v", parsedCheckpt.Err())
+	}
+
+	getdata := NewGetDataMessage(InvVector{Type: InvTypeWitnessBlock, Hash: testHash(8)}, InvVector{Type: InvTypeTx, Hash: testHash(9)})
+	parsedGetData := new(GetDataMessage).Parse(bytes.NewReader(getdata.Serialize())).(*GetDataMessage)
+	if parsedGetData.Err() != nil || !reflect.DeepEqual(parsedGetData.Inventory, getdata.Inventory) {
+		t.Fatalf("getdata: %v", parsedGetData.Err())
+	}
+}
+
+func TestFilterMessagesRejectMalformedPayloads(t *testing.T) {
+	// A count of 2^64-1 hashes overflows any multiplication by the item
+	// size.
+	huge := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+	prefix := append([]byte{FilterTypeBasic}, testHash(1)...)
+	join := func(parts ...[]byte) []byte {
+		return bytes.Join(parts, nil)
+	}
+	tests := []struct {
+		name    string
+		message interface {
+			Message
+			Err() error
+		}
+		payload []byte
+		err     error
+	}{
+		{"empty cfilter", new(CFilterMessage), nil, ErrShortCFilterPayload},
+		{"cfilter without length", new(CFilterMessage), prefix, ErrShortPayload},
+		{"cfilter longer than the payload", new(CFilterMessage), join(prefix, []byte{3, 1, 2}), ErrCountExceedsPayload},
+		{"cfheaders with a huge count", new(CFHeadersMessage), join(prefix, testHash(2), huge), ErrCountExceedsPayload},
+		{"cfheaders with a truncated count", new(CFHeadersMessage), join(prefix, testHash(2), []byte{0xfd, 1}), ErrShortPayload},
+		{"cfcheckpt with a huge count", new(CFCheckptMessage), join(prefix, huge), ErrCountExceedsPayload},
+		{"cfcheckpt with one hash missing", new(CFCheckptMessage), join(prefix, []byte{2}, testHash(3)), ErrCountExceedsPayload},
+		{"getcfilters without a stop hash", new(GetCFiltersMessage), []byte{FilterTypeBasic, 1, 0, 0, 0}, ErrShortCFilterPayload},
+		{"getcfheaders cut in the start height", new(GetCFHeadersMessage), []byte{FilterTypeBasic, 1}, ErrShortCFilterPayload},
+		{"empty getcfcheckpt", new(GetCFCheckptMessage), nil, ErrShortCFilterPayload},
+		{"getcfcheckpt with a short stop hash", new(GetCFCheckptMessage), prefix[:20], ErrShortCFilterPayload},
+		{"getdata with a huge count", new(GetDataMessage), huge, ErrCountExceedsPayload},
+		{"getdata cut inside an entry", new(GetDataMessage), join([]byte{1, 2, 0, 0, 0}, testHash(1)[:31]), ErrCountExceedsPayload},
+		{"empty getdata", new(GetDataMessage), nil, ErrShortPayload},
+	}
+	for _, test := range tests {
+		test.message.Parse(bytes.NewReader(test.payload))
+		if err := test.message.Err(); err != test.err {
+			t.Errorf("%s: got %v, want %v", test.name, err, test.err)
+		}
+	}
+}
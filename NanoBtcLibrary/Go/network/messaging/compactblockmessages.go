@@ -0,0 +1,381 @@
+package messaging
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	util "github.com/Btcercises/NanoBtcLibrary/Go/network/util"
+	utils "github.com/Btcercises/NanoBtcLibrary/Go/utils"
+)
+
+// BIP152 constants. Version 2 compact blocks identify transactions by wtxid
+// and carry witness data; version 1 uses txids and strips it.
+const (
+	CompactBlocksVersion1 uint64 = 1
+	CompactBlocksVersion2 uint64 = 2
+	// ShortIdSize is the size of a short transaction id on the wire.
+	ShortIdSize = 6
+)
+
+var (
+	ErrShortCompactPayload = errors.New("compact block message payload too short")
+	ErrCompactIndexRange   = errors.New("compact block transaction index out of range")
+	ErrCompactTooManyTxs   = errors.New("compact block transaction count exceeds the block limit")
+)
+
+// SendCmpctMessage tells the peer that compact blocks of Version are
+// understood. With Announce set the peer may announce new blocks with a
+// cmpctblock before validating them, high-bandwidth mode; otherwise it
+// sends inv or headers and cmpctblock only on request, low-bandwidth mode.
+type SendCmpctMessage struct {
+	Announce bool
+	Version  uint64
+	err      error
+}
+
+func SendCmpctMessageOption() ReceiveMessageTypeOption {
+	return func() reflect.Type {
+		return reflect.TypeOf((*SendCmpctMessage)(nil))
+	}
+}
+
+func NewSendCmpctMessage(announce bool, version uint64) *SendCmpctMessage {
+	return &SendCmpctMessage{Announce: announce, Version: version}
+}
+
+func (*SendCmpctMessage) Command() []byte {
+	return []byte("sendcmpct")
+}
+
+func (msg *SendCmpctMessage) Serialize() []byte {
+	result := []byte{0}
+	if msg.Announce {
+		result[0] = 1
+	}
+	return append(result, util.Int64ToLittleEndian(msg.Version)...)
+}
+
+func (msg *SendCmpctMessage) Parse(reader *bytes.Reader) Message {
+	announce, err := reader.ReadByte()
+	if err != nil {
+		msg.err = ErrShortCompactPayload
+		return msg
+	}
+	msg.Announce = announce == 1
+	version := make([]byte, 8)
+	if _, err := io.ReadFull(reader, version); err != nil {
+		msg.err = ErrShortCompactPayload
+		return msg
+	}
+	msg.Version = util.LittleEndianToInt64(version)
+	return msg
+}
+
+// Err returns the error met while parsing the message, if any.
+func (msg *SendCmpctMessage) Err() error {
+	return msg.err
+}
+
+// ShortIdKey returns the SipHash key of the short ids of a compact block:
+// the first 16 bytes of the SHA-256 of its header and nonce.
+func ShortIdKey(header *blockchain.BlockHeader, nonce uint64) (uint64, uint64) {
+	data := append(header.Serialize(), util.Int64ToLittleEndian(nonce)...)
+	sum := sha256.Sum256(data)
+	return binary.LittleEndian.Uint64(sum[0:8]), binary.LittleEndian.Uint64(sum[8:16])
+}
+
+// ShortId returns the 6 byte short id of the transaction hash under the
+// key of ShortIdKey.
+func ShortId(k0, k1 uint64, hash []byte) uint64 {
+	return utils.SipHash(k0, k1, hash) & 0xffffffffffff
+}
+
+// CompactTxHash returns the hash a compact block of version identifies tx
+// by: its wtxid for version 2 and its txid for version 1.
+func CompactTxHash(tx transactions.Transaction, version uint64) []byte {
+	if version == CompactBlocksVersion1 {
+		return transactions.GenerateTransactionId(tx)
+	}
+	return transactions.GenerateWitnessTransactionId(tx)
+}
+
+// serializeTx encodes tx as a compact block of version carries it.
+func serializeTx(tx transactions.Transaction, version uint64) []byte {
+	if version == CompactBlocksVersion1 {
+		tx.Input = append([]transactions.TxInput{}, tx.Input...)
+		for i := range tx.Input {
+			tx.Input[i].ScriptWitness = nil
+		}
+	}
+	return transactions.Serialize(tx)
+}
+
+// readIndexes reads count differentially encoded indexes: each is sent as
+// its distance from the previous one, less one.
+func readIndexes(reader *bytes.Reader, count int, next func(index int) error) error {
+	index := -1
+	for i := 0; i < count; i++ {
+		delta, err := readVarint(reader)
+		if err != nil {
+			return ErrShortCompactPayload
+		}
+		if delta > maxBlockTransactions {
+			return ErrCompactIndexRange
+		}
+		index += int(delta) + 1
+		if index > maxBlockTransactions {
+			return ErrCompactIndexRange
+		}
+		if err := next(index); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// PrefilledTx is a transaction sent in full in a compact block, at Index
+// in the block.
+type PrefilledTx struct {
+	Index int
+	Tx    transactions.Transaction
+}
+
+// CmpctBlockMessage is a block header with short ids for the transactions
+// the receiver probably has and, in full, those it probably lacks; the
+// coinbase at least. Version selects the transaction hash and encoding
+// and is not on the wire: it is the version agreed with sendcmpct.
+type CmpctBlockMessage struct {
+	Header    *blockchain.BlockHeader
+	Nonce     uint64
+	ShortIds  []uint64
+	Prefilled []PrefilledTx
+	Version   uint64
+	err       error
+}
+
+func CmpctBlockMessageOption() ReceiveMessageTypeOption {
+	return func() reflect.Type {
+		return reflect.TypeOf((*CmpctBlockMessage)(nil))
+	}
+}
+
+// NewCmpctBlockMessage builds the compact block of version for block under
+// nonce, prefilling the coinbase and the transactions at prefill, which
+// must be increasing.
+func NewCmpctBlockMessage(block *blockchain.Block, nonce uint64, version uint64, prefill ...int) *CmpctBlockMessage {
+	msg := &CmpctBlockMessage{Header: &block.BlockHeader, Nonce: nonce, Version: version}
+	k0, k1 := ShortIdKey(msg.Header, nonce)
+	prefilled := map[int]bool{0: true}
+	for _, index := range prefill {
+		prefilled[index] = true
+	}
+	for i, tx := range block.Transactions {
+		if prefilled[i] {
+			msg.Prefilled = append(msg.Prefilled, PrefilledTx{Index: i, Tx: tx})
+		} else {
+			msg.ShortIds = append(msg.ShortIds, ShortId(k0, k1, CompactTxHash(tx, version)))
+		}
+	}
+	return msg
+}
+
+func (*CmpctBlockMessage) Command() []byte {
+	return []byte("cmpctblock")
+}
+
+func (msg *CmpctBlockMessage) Serialize() []byte {
+	result := msg.Header.Serialize()
+	result = append(result, util.Int64ToLittleEndian(msg.Nonce)...)
+	result = append(result, util.EncodeVarInt(len(msg.ShortIds))...)
+	for _, id := range msg.ShortIds {
+		result = append(result, util.Int64ToLittleEndian(id)[:ShortIdSize]...)
+	}
+	result = append(result, util.EncodeVarInt(len(msg.Prefilled))...)
+	last := -1
+	for _, prefilled := range msg.Prefilled {
+		result = append(result, util.EncodeVarInt(prefilled.Index-last-1)...)
+		result = append(result, serializeTx(prefilled.Tx, msg.Version)...)
+		last = prefilled.Index
+	}
+	return result
+}
+
+func (msg *CmpctBlockMessage) Parse(reader *bytes.Reader) Message {
+	if msg.Version == 0 {
+		msg.Version = CompactBlocksVersion2
+	}
+	if msg.Header, msg.err = blockchain.ParseBlockHeader(reader); msg.err != nil {
+		return msg
+	}
+	nonce := make([]byte, 8)
+	if _, err := io.ReadFull(reader, nonce); err != nil {
+		msg.err = ErrShortCompactPayload
+		return msg
+	}
+	msg.Nonce = util.LittleEndianToInt64(nonce)
+	count, err := readItemCount(reader, ShortIdSize)
+	if err != nil {
+		msg.err = ErrShortCompactPayload
+		return msg
+	}
+	if count > maxBlockTransactions {
+		msg.err = ErrCompactTooManyTxs
+		return msg
+	}
+	msg.ShortIds = make([]uint64, count)
+	for i := range msg.ShortIds {
+		id := make([]byte, 8)
+		reader.Read(id[:ShortIdSize])
+		msg.ShortIds[i] = binary.LittleEndian.Uint64(id)
+	}
+	if count, err = readItemCount(reader, 1); err != nil {
+		msg.err = ErrShortCompactPayload
+		return msg
+	}
+	msg.err = readIndexes(reader, count, func(index int) error {
+		tx, err := transactions.ParseTransaction(reader)
+		if err != nil {
+			return err
+		}
+		msg.Prefilled = append(msg.Prefilled, PrefilledTx{Index: index, Tx: tx})
+		return nil
+	})
+	return msg
+}
+
+// Err returns the error met while parsing the message, if any.
+func (msg *CmpctBlockMessage) Err() error {
+	return msg.err
+}
+
+// TxCount returns the number of transactions in the block.
+func (msg *CmpctBlockMessage) TxCount() int {
+	return len(msg.ShortIds) + len(msg.Prefilled)
+}
+
+// GetBlockTxnMessage requests the transactions at Indexes, increasing, of
+// the block with BlockHash after a compact block left them missing.
+type GetBlockTxnMessage struct {
+	BlockHash []byte
+	Indexes   []int
+	err       error
+}
+
+func GetBlockTxnMessageOption() ReceiveMessageTypeOption {
+	return func() reflect.Type {
+		return reflect.TypeOf((*GetBlockTxnMessage)(nil))
+	}
+}
+
+func NewGetBlockTxnMessage(blockHash []byte, indexes []int) *GetBlockTxnMessage {
+	return &GetBlockTxnMessage{BlockHash: blockHash, Indexes: indexes}
+}
+
+func (*GetBlockTxnMessage) Command() []byte {
+	return []byte("getblocktxn")
+}
+
+func (msg *GetBlockTxnMessage) Serialize() []byte {
+	result := append([]byte{}, msg.BlockHash...)
+	result = append(result, util.EncodeVarInt(len(msg.Indexes))...)
+	last := -1
+	for _, index := range msg.Indexes {
+		result = append(result, util.EncodeVarInt(index-last-1)...)
+		last = index
+	}
+	return result
+}
+
+func (msg *GetBlockTxnMessage) Parse(reader *bytes.Reader) Message {
+	if msg.BlockHash, msg.err = readHash(reader); msg.err != nil {
+		return msg
+	}
+	count, err := readItemCount(reader, 1)
+	if err != nil {
+		msg.err = ErrShortCompactPayload
+		return msg
+	}
+	msg.Indexes = make([]int, 0, count)
+	msg.err = readIndexes(reader, count, func(index int) error {
+		msg.Indexes = append(msg.Indexes, index)
+		return nil
+	})
+	return msg
+}
+
+// Err returns the error met while parsing the message, if any.
+func (msg *GetBlockTxnMessage) Err() error {
+	return msg.err
+}
+
+// BlockTxnMessage answers a getblocktxn with the requested transactions,
+// in the order requested.
+type BlockTxnMessage struct {
+	BlockHash    []byte
+	Transactions []transactions.Transaction
+	Version      uint64
+	err          error
+}
+
+func BlockTxnMessageOption() ReceiveMessageTypeOption {
+	return func() reflect.Type {
+		return reflect.TypeOf((*BlockTxnMessage)(nil))
+	}
+}
+
+// NewBlockTxnMessage answers request from block, encoding the transactions
+// for compact blocks of version.
+func NewBlockTxnMessage(block *blockchain.Block, request *GetBlockTxnMessage, version uint64) (*BlockTxnMessage, error) {
+	msg := &BlockTxnMessage{BlockHash: block.HashBlock(), Version: version}
+	for _, index := range request.Indexes {
+		if index >= len(block.Transactions) {
+			return nil, ErrCompactIndexRange
+		}
+		msg.Transactions = append(msg.Transactions, block.Transactions[index])
+	}
+	return msg, nil
+}
+
+func (*BlockTxnMessage) Command() []byte {
+	return []byte("blocktxn")
+}
+
+func (msg *BlockTxnMessage) Serialize() []byte {
+	result := append([]byte{}, msg.BlockHash...)
+	result = append(result, util.EncodeVarInt(len(msg.Transactions))...)
+	for _, tx := range msg.Transactions {
+		result = append(result, serializeTx(tx, msg.Version)...)
+	}
+	return result
+}
+
+func (msg *BlockTxnMessage) Parse(reader *bytes.Reader) Message {
+	if msg.BlockHash, msg.err = readHash(reader); msg.err != nil {
+		return msg
+	}
+	count, err := readItemCount(reader, 1)
+	if err != nil {
+		msg.err = ErrShortCompactPayload
+		return msg
+	}
+	for i := 0; i < count; i++ {
+		tx, err := transactions.ParseTransaction(reader)
+		if err != nil {
+			msg.err = err
+			return msg
+		}
+		msg.Transactions = append(msg.Transactions, tx)
+	}
+	return msg
+}
+
+// Err returns the error met while parsing the message, if any.
+func (msg *BlockTxnMessage) Err() error {
+	return msg.err
+}
@@ -0,0 +1,104 @@
+package messaging
+
+import (
+	"bytes"
+	"reflect"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	util "github.com/Btcercises/NanoBtcLibrary/Go/network/util"
+)
+
+// Inventory types.
+const (
+	InvTypeTx            uint32 = 1
+	InvTypeBlock         uint32 = 2
+	InvTypeFilteredBlock uint32 = 3
+	InvTypeCmpctBlock    uint32 = 4
+	InvTypeWitnessFlag   uint32 = 1 << 30
+	InvTypeWitnessTx            = InvTypeTx | InvTypeWitnessFlag
+	InvTypeWitnessBlock         = InvTypeBlock | InvTypeWitnessFlag
+)
+
+// InvVector identifies an object by type and hash, in internal byte order.
+type InvVector struct {
+	Type uint32
+	Hash []byte
+}
+
+// GetDataMessage requests the objects listed in Inventory.
+type GetDataMessage struct {
+	Inventory []InvVector
+	err       error
+}
+
+func NewGetDataMessage(inventory ...InvVector) *GetDataMessage {
+	return &GetDataMessage{Inventory: inventory}
+}
+
+func (*GetDataMessage) Command() []byte {
+	return []byte("getdata")
+}
+
+func (msg *GetDataMessage) Serialize() []byte {
+	result := util.EncodeVarInt(len(msg.Inventory))
+	for _, inv := range msg.Inventory {
+		result = append(result, util.Int32ToLittleEndian(inv.Type)...)
+		result = append(result, inv.Hash...)
+	}
+	return result
+}
+
+func (msg *GetDataMessage) Parse(reader *bytes.Reader) Message {
+	count, err := readItemCount(reader, 36)
+	if err != nil {
+		msg.err = err
+		return msg
+	}
+	msg.Inventory = make([]InvVector, count)
+	for i := range msg.Inventory {
+		invType := make([]byte, 4)
+		reader.Read(invType)
+		msg.Inventory[i].Type = util.LittleEndianToInt32(invType)
+		msg.Inventory[i].Hash, _ = readHash(reader)
+	}
+	return msg
+}
+
+// Err returns the error met while parsing the message, if any.
+func (msg *GetDataMessage) Err() error {
+	return msg.err
+}
+
+// BlockMessage carries a full block.
+type BlockMessage struct {
+	Block *blockchain.Block
+	err   error
+}
+
+func BlockMessageOption() ReceiveMessageTypeOption {
+	return func() reflect.Type {
+		return reflect.TypeOf((*BlockMessage)(nil))
+	}
+}
+
+func NewBlockMessage(block *blockchain.Block) *BlockMessage {
+	return &BlockMessage{Block: block}
+}
+
+func (*BlockMessage) Command() []byte {
+	return []byte("block")
+}
+
+func (msg *BlockMessage) Serialize() []byte {
+	return msg.Block.Serialize()
+}
+
+func (msg *BlockMessage) Parse(reader *bytes.Reader) Message {
+	msg.Block, msg.err = blockchain.ParseBlock(reader)
+	return msg
+}
+
+// Err returns the error met while parsing the block, if any.
+func (msg *BlockMessage) Err() error {
+	return msg.err
+}
@@ -2,6 +2,8 @@ package messaging
 
 import (
 	"bytes"
+	"fmt"
+	"io"
 
 	"github.com/Btcercises/NanoBtcLibrary/Go/network/util"
 )
@@ -11,6 +13,7 @@ type GetHeadersMessage struct {
 	NumHashes  int
 	StartBlock [32]byte
 	EndBlock   [32]byte
+	err        error
 }
 
 const (
@@ -53,13 +56,32 @@ func (msg *GetHeadersMessage) Serialize() []byte {
 
 func (msg *GetHeadersMessage) Parse(reader *bytes.Reader) Message {
 	version := make([]byte, 4)
-	reader.Read(version)
+	if _, err := io.ReadFull(reader, version); err != nil {
+		msg.err = fmt.Errorf("getheaders version: %w", ErrShortPayload)
+		return msg
+	}
 	msg.Version = util.LittleEndianToInt32(version)
-	msg.NumHashes = util.ReadVarInt(reader)
+	numHashes, err := readItemCount(reader, 32)
+	if err != nil {
+		msg.err = fmt.Errorf("getheaders hashes: %w", err)
+		return msg
+	}
+	msg.NumHashes = numHashes
 	blockData := make([]byte, 32)
-	reader.Read(blockData)
+	if _, err := io.ReadFull(reader, blockData); err != nil {
+		msg.err = fmt.Errorf("getheaders start block: %w", ErrShortPayload)
+		return msg
+	}
 	copy(msg.StartBlock[:], util.ReverseByteArray(blockData))
-	reader.Read(blockData)
+	if _, err := io.ReadFull(reader, blockData); err != nil {
+		msg.err = fmt.Errorf("getheaders end block: %w", ErrShortPayload)
+		return msg
+	}
 	copy(msg.EndBlock[:], util.ReverseByteArray(blockData))
 	return msg
 }
+
+// Err returns the error met while parsing the message, if any.
+func (msg *GetHeadersMessage) Err() error {
+	return msg.err
+}
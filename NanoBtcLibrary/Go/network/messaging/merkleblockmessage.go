@@ -0,0 +1,193 @@
+package messaging
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	utils "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+	util "github.com/Btcercises/NanoBtcLibrary/Go/network/util"
+)
+
+// maxBlockTransactions is the most transactions a block can hold, the
+// maximum block weight divided by the weight of the smallest transaction.
+const maxBlockTransactions = 4000000 / 240
+
+var (
+	// ErrShortPayload is returned for a payload that ends inside a field.
+	ErrShortPayload = errors.New("message payload is truncated")
+	// ErrCountExceedsPayload is returned for a list longer than the rest of
+	// the payload can hold.
+	ErrCountExceedsPayload = errors.New("list count exceeds the payload")
+)
+
+// readVarint reads a varint, which may not be cut short by the end of the
+// payload.
+func readVarint(reader *bytes.Reader) (uint64, error) {
+	value, err := utils.ReadVarint(reader)
+	if err != nil {
+		return 0, ErrShortPayload
+	}
+	return value, nil
+}
+
+// readItemCount reads the varint count of a list of items of at least
+// itemSize bytes. Counts the rest of the payload cannot hold are rejected
+// before anything is allocated for them.
+func readItemCount(reader *bytes.Reader, itemSize int) (int, error) {
+	count, err := readVarint(reader)
+	if err != nil {
+		return 0, err
+	}
+	if count > uint64(reader.Len()/itemSize) {
+		return 0, ErrCountExceedsPayload
+	}
+	return int(count), nil
+}
+
+// MerkleBlockMessage is a block header together with a BIP37 partial merkle
+// tree proving that some of the block's transactions matched a filter.
+// Hashes are kept in the internal byte order used on the wire.
+type MerkleBlockMessage struct {
+	Header *blockchain.BlockHeader
+	Total  uint32
+	Hashes [][]byte
+	Flags  []byte
+	err    error
+}
+
+// InclusionProof states that TxId is included in the block with the given
+// header. It only proves inclusion under Header.HashMerkle; the header itself
+// still has to be validated against the header chain.
+type InclusionProof struct {
+	TxId   []byte
+	Header *blockchain.BlockHeader
+}
+
+func MerkleBlockMessageOption() ReceiveMessageTypeOption {
+	return func() reflect.Type {
+		return reflect.TypeOf((*MerkleBlockMessage)(nil))
+	}
+}
+
+// NewMerkleBlockMessage builds a merkleblock for header proving the matched
+// txids out of all the block's txids.
+func NewMerkleBlockMessage(header *blockchain.BlockHeader, txids [][]byte, matched [][]byte) *MerkleBlockMessage {
+	flags, hashes := blockchain.BuildPartialMerkleTree(txids, matched)
+	return &MerkleBlockMessage{
+		Header: header,
+		Total:  uint32(len(txids)),
+		Hashes: hashes,
+		Flags:  flags,
+	}
+}
+
+func (*MerkleBlockMessage) Command() []byte {
+	return []byte("merkleblock")
+}
+
+func (msg *MerkleBlockMessage) Serialize() []byte {
+	result := make([]byte, 0)
+	result = append(result, msg.Header.Serialize()...)
+	result = append(result, util.Int32ToLittleEndian(msg.Total)...)
+	result = append(result, util.EncodeVarInt(len(msg.Hashes))...)
+	for _, hash := range msg.Hashes {
+		result = append(result, hash...)
+	}
+	result = append(result, util.EncodeVarInt(len(msg.Flags))...)
+	result = append(result, msg.Flags...)
+	return result
+}
+
+func (msg *MerkleBlockMessage) Parse(reader *bytes.Reader) Message {
+	header, err := blockchain.ParseBlockHeader(reader)
+	if err != nil {
+		msg.err = fmt.Errorf("merkleblock header: %w", ErrShortPayload)
+		return msg
+	}
+	msg.Header = header
+	total := make([]byte, 4)
+	if _, err := io.ReadFull(reader, total); err != nil {
+		msg.err = fmt.Errorf("merkleblock transaction count: %w", ErrShortPayload)
+		return msg
+	}
+	msg.Total = util.LittleEndianToInt32(total)
+	numHashes, err := readItemCount(reader, 32)
+	if err != nil {
+		msg.err = fmt.Errorf("merkleblock hashes: %w", err)
+		return msg
+	}
+	msg.Hashes = make([][]byte, numHashes)
+	for i := range msg.Hashes {
+		msg.Hashes[i] = make([]byte, 32)
+		if _, err := io.ReadFull(reader, msg.Hashes[i]); err != nil {
+			msg.err = fmt.Errorf("merkleblock hashes: %w", ErrShortPayload)
+			return msg
+		}
+	}
+	numFlags, err := readItemCount(reader, 1)
+	if err != nil {
+		msg.err = fmt.Errorf("merkleblock flags: %w", err)
+		return msg
+	}
+	msg.Flags = make([]byte, numFlags)
+	if _, err := io.ReadFull(reader, msg.Flags); err != nil {
+		msg.err = fmt.Errorf("merkleblock flags: %w", ErrShortPayload)
+	}
+	return msg
+}
+
+// Err returns the error met while parsing the message, if any.
+func (msg *MerkleBlockMessage) Err() error {
+	return msg.err
+}
+
+// Verify rebuilds the partial merkle tree and checks it against the
+// header's merkle root, returning one proof per matched transaction.
+func (msg *MerkleBlockMessage) Verify() ([]InclusionProof, error) {
+	if msg.err != nil {
+		return nil, msg.err
+	}
+	if msg.Header == nil {
+		return nil, errors.New("merkleblock has no header")
+	}
+	if msg.Total == 0 || msg.Total > maxBlockTransactions {
+		return nil, fmt.Errorf("invalid transaction count %d", msg.Total)
+	}
+	if len(msg.Hashes) > int(msg.Total) {
+		return nil, errors.New("more hashes than transactions")
+	}
+	if len(msg.Flags)*8 < len(msg.Hashes) {
+		return nil, errors.New("fewer flag bits than hashes")
+	}
+	tree := blockchain.NewTree(int(msg.Total))
+	if err := tree.PopulateTree(blockchain.BytesToBitField(msg.Flags), msg.Hashes); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(tree.Root(), msg.Header.HashMerkle) {
+		return nil, blockchain.ErrBadMerkleRoot
+	}
+	result := make([]InclusionProof, len(tree.Matched))
+	for i, txid := range tree.Matched {
+		result[i] = InclusionProof{TxId: txid, Header: msg.Header}
+	}
+	return result, nil
+}
+
+// Includes verifies the message and reports whether it proves that txid is
+// part of the block.
+func (msg *MerkleBlockMessage) Includes(txid []byte) (bool, error) {
+	proofs, err := msg.Verify()
+	if err != nil {
+		return false, err
+	}
+	for _, proof := range proofs {
+		if bytes.Equal(proof.TxId, txid) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,79 @@
+package messaging
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	utils "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+)
+
+// merkleBlockExample is the merkleblock of the Bitcoin developer reference:
+// a block of seven transactions of which the fifth matched.
+const merkleBlockExample = "01000000" +
+	"82bb869cf3a793432a66e826e05a6fc37469f8efb7421dc88067010000000000" +
+	"7f16c5962e8bd963659c793ce370d95f093bc7e367117b3c30c1f8fdd0d97287" +
+	"76381b4d" + "4c86041b" + "554b8529" +
+	"07000000" + "04" +
+	"3612262624047ee87660be1a707519a443b1c1ce3d248cbfc6c15870f6c5daa2" +
+	"019f5b01d4195ecbc9398fbf3c3b1fa9bb3183301d7a1fb3bd174fcfa40a2b65" +
+	"41ed70551dd7e841883ab8f0b16bf04176b7d1480e4f0af9f3d4c3595768d068" +
+	"20d2a7bc994987302e5b1ac80fc425fe25f8b63169ea78e68fbaaefa59379bbf" +
+	"01" + "1d"
+
+func parseMerkleBlock(payload []byte) *MerkleBlockMessage {
+	msg := &MerkleBlockMessage{}
+	msg.Parse(bytes.NewReader(payload))
+	return msg
+}
+
+func TestMerkleBlockExample(t *testing.T) {
+	payload, _ := hex.DecodeString(merkleBlockExample)
+	msg := parseMerkleBlock(payload)
+	if msg.Err() != nil {
+		t.Fatal(msg.Err())
+	}
+	if !bytes.Equal(msg.Serialize(), payload) {
+		t.Fatal("serialization differs from the payload")
+	}
+	proofs, err := msg.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(proofs) != 1 || !bytes.Equal(proofs[0].TxId, msg.Hashes[1]) {
+		t.Fatalf("proved %d transactions", len(proofs))
+	}
+	if ok, err := msg.Includes(msg.Hashes[2]); ok || err != nil {
+		t.Fatalf("unmatched hash proved included: %v", err)
+	}
+
+	// A different hash no longer leads to the merkle root.
+	msg.Hashes[3] = utils.DoubleSha256(msg.Hashes[3])
+	if _, err := msg.Verify(); err == nil {
+		t.Fatal("tampered tree verified")
+	}
+}
+
+func TestMerkleBlockRejectsMalformedPayloads(t *testing.T) {
+	payload, _ := hex.DecodeString(merkleBlockExample)
+	for _, length := range []int{0, 40, 80, 84, 85, 100, len(payload) - 2, len(payload) - 1} {
+		if err := parseMerkleBlock(payload[:length]).Err(); err == nil {
+			t.Errorf("payload truncated to %d bytes parsed", length)
+		}
+	}
+
+	// A hash count of 2^59 overflowed the size check.
+	huge := append(make([]byte, 84), 0xff, 0, 0, 0, 0, 0, 0, 0, 0x08)
+	if err := parseMerkleBlock(huge).Err(); !errors.Is(err, ErrCountExceedsPayload) {
+		t.Errorf("huge hash count: %v", err)
+	}
+	flags := append(append([]byte{}, payload[:len(payload)-2]...), 0xfe, 0xff, 0xff, 0xff, 0xff)
+	if err := parseMerkleBlock(flags).Err(); !errors.Is(err, ErrCountExceedsPayload) {
+		t.Errorf("huge flag count: %v", err)
+	}
+	short := append(append([]byte{}, payload[:84]...), 0xfd, 0x01)
+	if err := parseMerkleBlock(short).Err(); !errors.Is(err, ErrShortPayload) {
+		t.Errorf("truncated varint: %v", err)
+	}
+}
@@ -2,11 +2,13 @@ package messaging
 
 import (
 	"bytes"
+	"io"
 	"reflect"
 )
 
 type PingMessage struct {
 	Nonce [8]byte
+	err   error
 }
 
 func PingMessageOption() ReceiveMessageTypeOption {
@@ -28,6 +30,13 @@ func (msg *PingMessage) Serialize() []byte {
 }
 
 func (msg *PingMessage) Parse(reader *bytes.Reader) Message {
-	reader.Read(msg.Nonce[:])
+	if _, err := io.ReadFull(reader, msg.Nonce[:]); err != nil {
+		msg.err = ErrShortPayload
+	}
 	return msg
 }
+
+// Err returns the error met while parsing the message, if any.
+func (msg *PingMessage) Err() error {
+	return msg.err
+}
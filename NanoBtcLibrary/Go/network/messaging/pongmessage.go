@@ -2,10 +2,12 @@ package messaging
 
 import (
 	"bytes"
+	"io"
 )
 
 type PongMessage struct {
 	Nonce [8]byte
+	err   error
 }
 
 func NewPongMessage(nonce []byte) *PongMessage {
@@ -23,6 +25,13 @@ func (msg *PongMessage) Serialize() []byte {
 }
 
 func (msg *PongMessage) Parse(reader *bytes.Reader) Message {
-	reader.Read(msg.Nonce[:])
+	if _, err := io.ReadFull(reader, msg.Nonce[:]); err != nil {
+		msg.err = ErrShortPayload
+	}
 	return msg
 }
+
+// Err returns the error met while parsing the message, if any.
+func (msg *PongMessage) Err() error {
+	return msg.err
+}
@@ -2,6 +2,8 @@ package messaging
 
 import (
 	"bytes"
+	"fmt"
+	"io"
 	"math/rand"
 	"time"
 
@@ -22,6 +24,7 @@ type VersionMessage struct {
 	UserAgent        string
 	LatestBlock      uint32
 	Relay            bool
+	err              error
 }
 
 const (
@@ -137,45 +140,49 @@ func (msg *VersionMessage) Serialize() []byte {
 	return result
 }
 
+// versionFixedSize is the size of the fields before the user agent.
+const versionFixedSize = 80
+
 func (msg *VersionMessage) Parse(reader *bytes.Reader) Message {
-	version := make([]byte, 4)
-	reader.Read(version)
-	msg.Version = util.LittleEndianToInt32(version)
-	services := make([]byte, 8)
-	reader.Read(services)
-	msg.Services = util.LittleEndianToInt64(services)
-	timestamp := make([]byte, 8)
-	reader.Read(timestamp)
-	msg.Timestamp = util.LittleEndianToInt64(timestamp)
-	receiverServices := make([]byte, 8)
-	reader.Read(receiverServices)
-	msg.ReceiverServices = util.LittleEndianToInt64(receiverServices)
-	receiverIP := make([]byte, 16)
-	reader.Read(receiverIP)
-	copy(msg.ReceiverIP[:], receiverIP[12:])
-	receiverPort := make([]byte, 2)
-	reader.Read(receiverPort)
-	msg.ReceiverPort = util.LittleEndianToInt16(receiverPort)
-	senderServices := make([]byte, 8)
-	reader.Read(senderServices)
-	msg.ReceiverServices = util.LittleEndianToInt64(senderServices)
-	senderIP := make([]byte, 16)
-	reader.Read(senderIP)
-	copy(msg.SenderIP[:], senderIP[12:])
-	senderPort := make([]byte, 2)
-	reader.Read(senderPort)
-	msg.SenderPort = util.LittleEndianToInt16(senderPort)
-	nonce := make([]byte, 8)
-	reader.Read(nonce)
-	copy(msg.Nonce[:], nonce)
-	userAgentLength := util.ReadVarInt(reader)
+	fixed := make([]byte, versionFixedSize)
+	if _, err := io.ReadFull(reader, fixed); err != nil {
+		msg.err = fmt.Errorf("version: %w", ErrShortPayload)
+		return msg
+	}
+	msg.Version = util.LittleEndianToInt32(fixed[0:4])
+	msg.Services = util.LittleEndianToInt64(fixed[4:12])
+	msg.Timestamp = util.LittleEndianToInt64(fixed[12:20])
+	msg.ReceiverServices = util.LittleEndianToInt64(fixed[20:28])
+	copy(msg.ReceiverIP[:], fixed[40:44])
+	msg.ReceiverPort = util.LittleEndianToInt16(fixed[44:46])
+	msg.SenderServices = util.LittleEndianToInt64(fixed[46:54])
+	copy(msg.SenderIP[:], fixed[66:70])
+	msg.SenderPort = util.LittleEndianToInt16(fixed[70:72])
+	copy(msg.Nonce[:], fixed[72:80])
+	userAgentLength, err := readItemCount(reader, 1)
+	if err != nil {
+		msg.err = fmt.Errorf("version user agent: %w", err)
+		return msg
+	}
 	userAgent := make([]byte, userAgentLength)
-	reader.Read(userAgent)
+	if _, err := io.ReadFull(reader, userAgent); err != nil {
+		msg.err = fmt.Errorf("version user agent: %w", ErrShortPayload)
+		return msg
+	}
 	msg.UserAgent = string(userAgent)
 	latestBlock := make([]byte, 4)
-	reader.Read(latestBlock)
+	if _, err := io.ReadFull(reader, latestBlock); err != nil {
+		msg.err = fmt.Errorf("version latest block: %w", ErrShortPayload)
+		return msg
+	}
 	msg.LatestBlock = util.LittleEndianToInt32(latestBlock)
+	// The relay flag is optional.
 	relay, _ := reader.ReadByte()
 	msg.Relay = relay != 0
 	return msg
 }
+
+// Err returns the error met while parsing the message, if any.
+func (msg *VersionMessage) Err() error {
+	return msg.err
+}
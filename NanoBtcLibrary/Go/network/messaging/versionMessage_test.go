@@ -0,0 +1,62 @@
+package messaging
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestVersionMessageRoundTrip(t *testing.T) {
+	sent := NewVersionMessage(map[int]interface{}{
+		ServicesArg:       uint64(1),
+		SenderServicesArg: uint64(9),
+		SenderIPArg:       [4]byte{10, 0, 0, 1},
+		LatestBlockArg:    uint32(800000),
+		RelayArg:          true,
+	})
+	payload := sent.Serialize()
+	received := new(VersionMessage)
+	received.Parse(bytes.NewReader(payload))
+	if err := received.Err(); err != nil {
+		t.Fatal(err)
+	}
+	sent.err = nil
+	if *received != *sent {
+		t.Fatalf("got %+v, want %+v", received, sent)
+	}
+
+	// Only the relay flag may be left out.
+	received = new(VersionMessage)
+	received.Parse(bytes.NewReader(payload[:len(payload)-1]))
+	if received.Err() != nil || received.Relay {
+		t.Fatalf("without the relay flag: %v, relay %v", received.Err(), received.Relay)
+	}
+}
+
+// checkedMessage is a message reporting parse errors through Err.
+type checkedMessage interface {
+	Message
+	Err() error
+}
+
+func TestBaseMessagesRejectTruncatedPayloads(t *testing.T) {
+	version := NewVersionMessage(nil).Serialize()
+	for _, test := range []struct {
+		name    string
+		message func() checkedMessage
+		payload []byte
+	}{
+		{"version", func() checkedMessage { return new(VersionMessage) }, version[:len(version)-1]},
+		{"ping", func() checkedMessage { return new(PingMessage) }, NewPingMessage([8]byte{1, 2, 3, 4, 5, 6, 7, 8}).Serialize()},
+		{"pong", func() checkedMessage { return new(PongMessage) }, NewPongMessage([]byte{1, 2, 3, 4, 5, 6, 7, 8}).Serialize()},
+		{"getheaders", func() checkedMessage { return new(GetHeadersMessage) }, NewGetHeadersMessage(make([]byte, 32)).Serialize()},
+	} {
+		for length := 0; length < len(test.payload); length++ {
+			message := test.message()
+			message.Parse(bytes.NewReader(test.payload[:length]))
+			if err := message.Err(); !errors.Is(err, ErrShortPayload) && !errors.Is(err, ErrCountExceedsPayload) {
+				t.Fatalf("%s cut at %d bytes: %v", test.name, length, err)
+			}
+		}
+	}
+}
@@ -1,67 +1,184 @@
 package rpc
 
 import (
+	"bufio"
 	"bytes"
-	"encoding/hex"
+	"encoding/binary"
+	"errors"
 	"fmt"
-	"os"
+	"io"
 
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
 	"github.com/Btcercises/NanoBtcLibrary/Go/network/util"
 )
 
+const (
+	// HeaderSize is the size of the envelope before the payload.
+	HeaderSize = 24
+	// MaxMessageSize is the largest payload accepted, Bitcoin Core's
+	// MAX_SIZE.
+	MaxMessageSize = 32 * 1024 * 1024
+)
+
 var (
-	networkMagic     = [4]byte{0xf9, 0xbe, 0xb4, 0xd9}
-	testNetworkMagic = [4]byte{0x0b, 0x11, 0x09, 0x07}
+	ErrBadMagic        = errors.New("message does not start with the network magic")
+	ErrBadCommand      = errors.New("malformed message command")
+	ErrMessageTooLarge = errors.New("message payload exceeds the maximum size")
+	ErrBadChecksum     = errors.New("message checksum mismatch")
 )
 
 type NetworkEnvelope struct {
-	Command     []byte
-	Payload     []byte
-	Magic       [4]byte
-	TestNetwork bool
+	Command []byte
+	Payload []byte
+	Magic   [4]byte
+	Network *chaincfg.ChainParams
 }
 
-func NewEnvelope(command []byte, payload []byte, testnet bool) *NetworkEnvelope {
+// networkMagic returns the message start of the network as sent on the wire.
+func networkMagic(params *chaincfg.ChainParams) [4]byte {
 	var magic [4]byte
-	if testnet {
-		magic = testNetworkMagic
-	} else {
-		magic = networkMagic
+	binary.LittleEndian.PutUint32(magic[:], params.Net)
+	return magic
+}
+
+func NewEnvelope(command []byte, payload []byte, params *chaincfg.ChainParams) *NetworkEnvelope {
+	return &NetworkEnvelope{Command: command, Payload: payload, Magic: networkMagic(params), Network: params}
+}
+
+// ParseEnvelope reads one envelope of the network of params from reader,
+// which must start with it. Nothing past the envelope is read, so the next
+// one can be parsed from the same reader.
+func ParseEnvelope(reader io.Reader, params *chaincfg.ChainParams) (*NetworkEnvelope, error) {
+	decoder := &Decoder{reader: unbufferedReader{reader}, params: params, magic: networkMagic(params)}
+	return decoder.Decode()
+}
+
+// streamReader is what a Decoder reads from.
+type streamReader interface {
+	io.Reader
+	io.ByteReader
+}
+
+// unbufferedReader reads single bytes straight from its reader.
+type unbufferedReader struct {
+	io.Reader
+}
+
+func (reader unbufferedReader) ReadByte() (byte, error) {
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(reader.Reader, b); err != nil {
+		return 0, err
+	}
+	return b[0], nil
+}
+
+// Decoder reads envelopes from a stream, such as a peer connection.
+// Errors are returned rather than trusted: the payload length is capped
+// before anything is allocated, and a short read gives
+// io.ErrUnexpectedEOF. After ErrBadChecksum or ErrBadCommand the stream is
+// still in step and decoding can go on; whether to keep a peer sending
+// them is up to the caller.
+type Decoder struct {
+	reader streamReader
+	params *chaincfg.ChainParams
+	magic  [4]byte
+	// Resync skips bytes up to the next network magic when a message does
+	// not start with it, as Bitcoin Core does, instead of returning
+	// ErrBadMagic. It is on by default. Up to MaxMessageSize bytes are
+	// skipped before giving up with ErrBadMagic.
+	Resync bool
+	// Skipped counts the bytes skipped so far while resynchronizing.
+	Skipped int
+}
+
+func NewDecoder(reader io.Reader, params *chaincfg.ChainParams) *Decoder {
+	return &Decoder{reader: bufio.NewReader(reader), params: params, magic: networkMagic(params), Resync: true}
+}
+
+// findMagic consumes the network magic, skipping what precedes it when
+// resynchronizing. A stream that ends cleanly before a message gives
+// io.EOF.
+func (decoder *Decoder) findMagic() error {
+	window := make([]byte, 4)
+	if _, err := io.ReadFull(decoder.reader, window); err != nil {
+		return err
+	}
+	skipped := 0
+	for !bytes.Equal(window, decoder.magic[:]) {
+		if !decoder.Resync {
+			return fmt.Errorf("%w: %x", ErrBadMagic, window)
+		}
+		if skipped >= MaxMessageSize {
+			return fmt.Errorf("%w: skipped %d bytes", ErrBadMagic, skipped)
+		}
+		next, err := decoder.reader.ReadByte()
+		if err == io.EOF {
+			return io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return err
+		}
+		copy(window, window[1:])
+		window[3] = next
+		skipped++
+		decoder.Skipped++
 	}
-	return &NetworkEnvelope{Command: command, Payload: payload, Magic: magic}
+	return nil
 }
 
-func ParseEnvelope(reader *bytes.Reader, testnet bool) *NetworkEnvelope {
-	if reader.Len() == 0 {
-		panic("Connection reset!")
+// parseCommand checks the 12 byte command field: printable ASCII padded
+// with zero bytes only, and returns the command without the padding.
+func parseCommand(field []byte) ([]byte, error) {
+	end := bytes.IndexByte(field, 0)
+	if end < 0 {
+		end = len(field)
 	}
-	magic := make([]byte, 4)
-	reader.Read(magic)
-	var expectedMagic [4]byte
-	if testnet {
-		expectedMagic = testNetworkMagic
-	} else {
-		expectedMagic = networkMagic
+	for _, b := range field[end:] {
+		if b != 0 {
+			return nil, fmt.Errorf("%w: %q", ErrBadCommand, field)
+		}
 	}
-	if !bytes.Equal(magic[:], expectedMagic[:]) {
-		panic(fmt.Sprintf("magic is not right %v vs %v", hex.EncodeToString(magic[:]), hex.EncodeToString(expectedMagic[:])))
+	for _, b := range field[:end] {
+		if b < 0x20 || b > 0x7e {
+			return nil, fmt.Errorf("%w: %q", ErrBadCommand, field)
+		}
 	}
-	command := make([]byte, 12)
-	reader.Read(command)
-	command = bytes.TrimRightFunc(command, func(r rune) bool { return r == 0 })
-	buffer := make([]byte, 4)
-	reader.Read(buffer)
-	payloadLength := util.LittleEndianToInt32(buffer)
-	checksum := make([]byte, 4)
-	reader.Read(checksum)
-	payload := make([]byte, payloadLength)
-	reader.Read(payload)
-	if !bytes.Equal(util.Hash256(payload)[:4], checksum) {
-		fmt.Fprintf(os.Stderr, "%x %x\n", util.Hash256(payload)[:4], checksum)
-		panic("Invalid checksum!")
+	return append([]byte{}, field[:end]...), nil
+}
+
+// Decode reads the next envelope.
+func (decoder *Decoder) Decode() (*NetworkEnvelope, error) {
+	if err := decoder.findMagic(); err != nil {
+		return nil, err
+	}
+	header := make([]byte, HeaderSize-4)
+	if _, err := io.ReadFull(decoder.reader, header); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	length := binary.LittleEndian.Uint32(header[12:16])
+	if length > MaxMessageSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrMessageTooLarge, length)
+	}
+	// The payload buffer grows with what actually arrives, not with the
+	// length the peer claims.
+	var payload bytes.Buffer
+	if _, err := io.CopyN(&payload, decoder.reader, int64(length)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	command, err := parseCommand(header[:12])
+	if err != nil {
+		return nil, err
+	}
+	if checksum := util.Hash256(payload.Bytes())[:4]; !bytes.Equal(checksum, header[16:20]) {
+		return nil, fmt.Errorf("%w: %s", ErrBadChecksum, command)
 	}
-	var returnedMagic [4]byte
-	return &NetworkEnvelope{command, payload, returnedMagic, testnet}
+	return &NetworkEnvelope{Command: command, Payload: payload.Bytes(), Magic: decoder.magic, Network: decoder.params}, nil
 }
 
 func (env *NetworkEnvelope) Serialize() []byte {
@@ -69,7 +186,7 @@ func (env *NetworkEnvelope) Serialize() []byte {
 	copy(command, env.Command)
 	payloadLength := len(env.Payload)
 	checksum := util.Hash256(env.Payload)[:4]
-	result := make([]byte, payloadLength+24)
+	result := make([]byte, payloadLength+HeaderSize)
 	copy(result[:4], env.Magic[:])
 	copy(result[4:16], command)
 	copy(result[16:20], util.Int32ToLittleEndian(uint32(payloadLength)))
@@ -0,0 +1,90 @@
+package rpc
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
+)
+
+func TestDecoder(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	ping := NewEnvelope([]byte("ping"), []byte{1, 2, 3, 4, 5, 6, 7, 8}, params).Serialize()
+	verack := NewEnvelope([]byte("verack"), nil, params).Serialize()
+
+	var stream []byte
+	stream = append(stream, ping...)
+	stream = append(stream, 0xf9, 0xbe, 0x00, 0x13, 0x37)
+	stream = append(stream, verack...)
+	decoder := NewDecoder(bytes.NewReader(stream), params)
+	envelope, err := decoder.Decode()
+	if err != nil || string(envelope.Command) != "ping" || !bytes.Equal(envelope.Payload, ping[HeaderSize:]) {
+		t.Fatalf("ping: %v %v", envelope, err)
+	}
+	envelope, err = decoder.Decode()
+	if err != nil || string(envelope.Command) != "verack" || len(envelope.Payload) != 0 {
+		t.Fatalf("verack after garbage: %v %v", envelope, err)
+	}
+	if decoder.Skipped != 5 {
+		t.Errorf("skipped %d bytes, want 5", decoder.Skipped)
+	}
+	if _, err := decoder.Decode(); err != io.EOF {
+		t.Errorf("end of stream: %v", err)
+	}
+
+	if _, err := ParseEnvelope(bytes.NewReader(stream[2:]), params); !errors.Is(err, ErrBadMagic) {
+		t.Errorf("bad magic: %v", err)
+	}
+
+	badChecksum := append([]byte{}, ping...)
+	badChecksum[20] ^= 1
+	decoder = NewDecoder(bytes.NewReader(append(badChecksum, verack...)), params)
+	if _, err := decoder.Decode(); !errors.Is(err, ErrBadChecksum) {
+		t.Errorf("bad checksum: %v", err)
+	}
+	if envelope, err := decoder.Decode(); err != nil || string(envelope.Command) != "verack" {
+		t.Errorf("message after bad checksum: %v %v", envelope, err)
+	}
+
+	for _, command := range []string{"ping\x00\x00x", "pi\nng", "\x00ping"} {
+		bad := append([]byte{}, ping...)
+		copy(bad[4:16], make([]byte, 12))
+		copy(bad[4:16], command)
+		if _, err := ParseEnvelope(bytes.NewReader(bad), params); !errors.Is(err, ErrBadCommand) {
+			t.Errorf("command %q: %v", command, err)
+		}
+	}
+
+	huge := append([]byte{}, verack...)
+	binary.LittleEndian.PutUint32(huge[16:20], MaxMessageSize+1)
+	if _, err := ParseEnvelope(bytes.NewReader(huge), params); !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("oversized payload: %v", err)
+	}
+
+	for _, length := range []int{10, HeaderSize + 3} {
+		if _, err := ParseEnvelope(bytes.NewReader(ping[:length]), params); err != io.ErrUnexpectedEOF {
+			t.Errorf("truncated at %d: %v", length, err)
+		}
+	}
+}
+
+func TestParseEnvelopeBackToBack(t *testing.T) {
+	params := &chaincfg.MainNetParams
+	ping := NewEnvelope([]byte("ping"), []byte{1, 2, 3, 4, 5, 6, 7, 8}, params).Serialize()
+	verack := NewEnvelope([]byte("verack"), nil, params).Serialize()
+	reader := bytes.NewReader(append(append([]byte{}, ping...), verack...))
+	envelope, err := ParseEnvelope(reader, params)
+	if err != nil || string(envelope.Command) != "ping" {
+		t.Fatalf("first envelope: %v %v", envelope, err)
+	}
+	if reader.Len() != len(verack) {
+		t.Fatalf("%d bytes left after the first envelope, want %d", reader.Len(), len(verack))
+	}
+	envelope, err = ParseEnvelope(reader, params)
+	if err != nil || string(envelope.Command) != "verack" {
+		t.Fatalf("second envelope: %v %v", envelope, err)
+	}
+}
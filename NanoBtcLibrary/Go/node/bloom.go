@@ -0,0 +1,74 @@
+package node
+
+import (
+	"bytes"
+	"errors"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	bloom "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/bloom"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	messaging "github.com/Btcercises/NanoBtcLibrary/Go/network/messaging"
+)
+
+var ErrUnmatchedTransaction = errors.New("peer sent a transaction the merkleblock does not prove")
+
+// FilteredBlock is a block header with the transactions a peer matched
+// against our bloom filter, each proven to be in the block.
+type FilteredBlock struct {
+	Header       *blockchain.BlockHeader
+	Transactions []transactions.Transaction
+}
+
+// LoadFilter sets the bloom filter the peer matches transactions against.
+func (node *Node) LoadFilter(filter *bloom.Filter) error {
+	_, err := node.Send(messaging.NewFilterLoadMessage(filter))
+	return err
+}
+
+// AddToFilter adds data to the peer's copy of our bloom filter.
+func (node *Node) AddToFilter(data []byte) error {
+	_, err := node.Send(messaging.NewFilterAddMessage(data))
+	return err
+}
+
+// ClearFilter removes our bloom filter from the peer.
+func (node *Node) ClearFilter() error {
+	_, err := node.Send(messaging.NewFilterClearMessage())
+	return err
+}
+
+// GetFilteredBlock requests the block with the given hash filtered by the
+// loaded bloom filter. The merkleblock is verified against its own header
+// and the tx messages that follow are paired with the txids it proves; the
+// caller still has to check the header against its header chain.
+func (node *Node) GetFilteredBlock(hash []byte) (*FilteredBlock, error) {
+	inv := messaging.InvVector{Type: messaging.InvTypeFilteredBlock, Hash: hash}
+	if _, err := node.Send(messaging.NewGetDataMessage(inv)); err != nil {
+		return nil, err
+	}
+	message, err := node.WaitFor(messaging.MerkleBlockMessageOption())
+	if err != nil {
+		return nil, err
+	}
+	merkleBlock := message.(*messaging.MerkleBlockMessage)
+	proofs, err := merkleBlock.Verify()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(merkleBlock.Header.HashBlock(), hash) {
+		return nil, ErrUnexpectedBlock
+	}
+	result := &FilteredBlock{Header: merkleBlock.Header}
+	for _, proof := range proofs {
+		message, err := node.WaitFor(messaging.TxMessageOption())
+		if err != nil {
+			return nil, err
+		}
+		txMessage := message.(*messaging.TxMessage)
+		if !bytes.Equal(transactions.GenerateTransactionId(txMessage.Tx), proof.TxId) {
+			return nil, ErrUnmatchedTransaction
+		}
+		result.Transactions = append(result.Transactions, txMessage.Tx)
+	}
+	return result, nil
+}
@@ -0,0 +1,62 @@
+package node
+
+import (
+	"bytes"
+	"testing"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	bloom "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/bloom"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	messaging "github.com/Btcercises/NanoBtcLibrary/Go/network/messaging"
+	rpc "github.com/Btcercises/NanoBtcLibrary/Go/network/rpc"
+)
+
+// filteredBlockPeer answers a filtered block request with the merkleblock
+// and tx messages NewFilteredBlock builds for block, after letting tamper
+// change them.
+func filteredBlockPeer(t *testing.T, block *blockchain.Block, filter *bloom.Filter, tamper func(*messaging.MerkleBlockMessage, []*messaging.TxMessage)) *Node {
+	return connectTestPeer(t, func(envelope *rpc.NetworkEnvelope) []messaging.Message {
+		if string(envelope.Command) != "getdata" {
+			return nil
+		}
+		merkleBlock, txs := messaging.NewFilteredBlock(block, filter)
+		if tamper != nil {
+			tamper(merkleBlock, txs)
+		}
+		replies := []messaging.Message{merkleBlock}
+		for _, tx := range txs {
+			replies = append(replies, tx)
+		}
+		return replies
+	})
+}
+
+func TestGetFilteredBlock(t *testing.T) {
+	block := testBlock(t, 3)
+	wanted := block.Transactions[2]
+	filter := bloom.New(10, 0.000001, 0, bloom.UpdateNone)
+	filter.Insert(transactions.GenerateTransactionId(wanted))
+
+	filtered, err := filteredBlockPeer(t, block, filter, nil).GetFilteredBlock(block.HashBlock())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(filtered.Header.HashBlock(), block.HashBlock()) {
+		t.Fatal("header of another block")
+	}
+	if len(filtered.Transactions) != 1 || !bytes.Equal(transactions.GenerateTransactionId(filtered.Transactions[0]), transactions.GenerateTransactionId(wanted)) {
+		t.Fatalf("got %d transactions", len(filtered.Transactions))
+	}
+
+	swapTx := func(_ *messaging.MerkleBlockMessage, txs []*messaging.TxMessage) {
+		txs[0] = messaging.NewTxMessage(block.Transactions[1])
+	}
+	if _, err := filteredBlockPeer(t, block, filter, swapTx).GetFilteredBlock(block.HashBlock()); err != ErrUnmatchedTransaction {
+		t.Fatalf("unproven transaction: %v", err)
+	}
+
+	other := testBlock(t, 1)
+	if _, err := filteredBlockPeer(t, other, filter, nil).GetFilteredBlock(block.HashBlock()); err != ErrUnexpectedBlock {
+		t.Fatalf("merkleblock of another block: %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+package node
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	messaging "github.com/Btcercises/NanoBtcLibrary/Go/network/messaging"
+)
+
+var (
+	ErrShortIdCollision      = errors.New("compact block has duplicate short ids")
+	ErrBadPrefilled          = errors.New("compact block has invalid prefilled transactions")
+	ErrBlockTxnMismatch      = errors.New("blocktxn does not hold the missing transactions")
+	ErrCompactReconstruction = errors.New("reconstructed block does not match its header")
+)
+
+// TxSource gives the transactions a compact block may be rebuilt from.
+// *mempool.Pool implements it.
+type TxSource interface {
+	Transactions() []transactions.Transaction
+}
+
+// PartialBlock is a block being rebuilt from a compact block: the
+// prefilled transactions, those found by short id and the indexes still
+// missing.
+type PartialBlock struct {
+	Header  *blockchain.BlockHeader
+	version uint64
+	txs     []transactions.Transaction
+	have    []bool
+	missing []int
+}
+
+// NewPartialBlock places the prefilled transactions of msg and looks up the
+// others by short id among the transactions of source and extra, such as
+// recently rejected or replaced ones. A short id matched by two different
+// transactions is left missing. Duplicate short ids in msg itself give
+// ErrShortIdCollision: the full block has to be downloaded.
+func NewPartialBlock(msg *messaging.CmpctBlockMessage, source TxSource, extra ...transactions.Transaction) (*PartialBlock, error) {
+	if msg.Err() != nil {
+		return nil, msg.Err()
+	}
+	count := msg.TxCount()
+	if count == 0 || len(msg.Prefilled) == 0 {
+		return nil, ErrBadPrefilled
+	}
+	partial := &PartialBlock{
+		Header:  msg.Header,
+		version: msg.Version,
+		txs:     make([]transactions.Transaction, count),
+		have:    make([]bool, count),
+	}
+	for _, prefilled := range msg.Prefilled {
+		if prefilled.Index >= count || partial.have[prefilled.Index] {
+			return nil, ErrBadPrefilled
+		}
+		partial.txs[prefilled.Index] = prefilled.Tx
+		partial.have[prefilled.Index] = true
+	}
+
+	// The short ids fill the slots the prefilled transactions left, in
+	// order.
+	slots := make(map[uint64]int, len(msg.ShortIds))
+	next := 0
+	for _, id := range msg.ShortIds {
+		for partial.have[next] {
+			next++
+		}
+		if _, ok := slots[id]; ok {
+			return nil, ErrShortIdCollision
+		}
+		slots[id] = next
+		next++
+	}
+
+	k0, k1 := messaging.ShortIdKey(msg.Header, msg.Nonce)
+	collided := make(map[int]bool)
+	candidates := append(source.Transactions(), extra...)
+	for _, tx := range candidates {
+		hash := messaging.CompactTxHash(tx, msg.Version)
+		index, ok := slots[messaging.ShortId(k0, k1, hash)]
+		if !ok || collided[index] {
+			continue
+		}
+		if partial.have[index] {
+			if !bytes.Equal(messaging.CompactTxHash(partial.txs[index], msg.Version), hash) {
+				partial.have[index] = false
+				partial.txs[index] = transactions.Transaction{}
+				collided[index] = true
+			}
+			continue
+		}
+		partial.txs[index] = tx
+		partial.have[index] = true
+	}
+	for i, have := range partial.have {
+		if !have {
+			partial.missing = append(partial.missing, i)
+		}
+	}
+	return partial, nil
+}
+
+// Missing returns the indexes of the transactions still to be requested
+// with getblocktxn.
+func (partial *PartialBlock) Missing() []int {
+	return partial.missing
+}
+
+// Fill completes the block with txs, the missing transactions in order,
+// and checks it against the header. A mismatch, which a short id collision
+// with the wrong transaction can cause, gives ErrCompactReconstruction: the
+// full block has to be downloaded.
+func (partial *PartialBlock) Fill(txs []transactions.Transaction) (*blockchain.Block, error) {
+	if len(txs) != len(partial.missing) {
+		return nil, fmt.Errorf("%w: %d for %d missing", ErrBlockTxnMismatch, len(txs), len(partial.missing))
+	}
+	all := append([]transactions.Transaction{}, partial.txs...)
+	for i, index := range partial.missing {
+		all[index] = txs[i]
+	}
+	block := &blockchain.Block{
+		BlockHeader:      *partial.Header,
+		TransactionCount: uint64(len(all)),
+		Transactions:     all,
+	}
+	if err := block.CheckMerkleRoot(); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrCompactReconstruction, err)
+	}
+	if partial.version != messaging.CompactBlocksVersion1 {
+		if err := block.CheckWitnessCommitment(); err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrCompactReconstruction, err)
+		}
+	}
+	return block, nil
+}
+
+// SendCompact asks the peer for version 2 compact blocks. In high-bandwidth
+// mode the peer announces new blocks with an unsolicited cmpctblock, to be
+// passed to ReconstructBlock; in low-bandwidth mode it announces them as
+// before and GetCompactBlock fetches them.
+func (node *Node) SendCompact(highBandwidth bool) error {
+	_, err := node.Send(messaging.NewSendCmpctMessage(highBandwidth, messaging.CompactBlocksVersion2))
+	return err
+}
+
+// GetCompactBlock requests the block with the given hash as a compact block
+// and rebuilds it from source, as ReconstructBlock does.
+func (node *Node) GetCompactBlock(hash []byte, source TxSource) (*blockchain.Block, error) {
+	inv := messaging.InvVector{Type: messaging.InvTypeCmpctBlock, Hash: hash}
+	if _, err := node.Send(messaging.NewGetDataMessage(inv)); err != nil {
+		return nil, err
+	}
+	message, err := node.WaitFor(messaging.CmpctBlockMessageOption())
+	if err != nil {
+		return nil, err
+	}
+	msg := message.(*messaging.CmpctBlockMessage)
+	if !bytes.Equal(msg.Header.HashBlock(), hash) {
+		return nil, ErrUnexpectedBlock
+	}
+	return node.ReconstructBlock(msg, source)
+}
+
+// ReconstructBlock rebuilds the block of msg from source, requesting the
+// missing transactions from the peer. When the compact block cannot be
+// used, because of short id collisions, the full block is downloaded
+// instead. The header itself is not validated.
+func (node *Node) ReconstructBlock(msg *messaging.CmpctBlockMessage, source TxSource) (*blockchain.Block, error) {
+	if msg.Err() != nil {
+		return nil, msg.Err()
+	}
+	hash := msg.Header.HashBlock()
+	partial, err := NewPartialBlock(msg, source)
+	if errors.Is(err, ErrShortIdCollision) {
+		return node.GetBlock(hash)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var txs []transactions.Transaction
+	if missing := partial.Missing(); len(missing) > 0 {
+		if _, err := node.Send(messaging.NewGetBlockTxnMessage(hash, missing)); err != nil {
+			return nil, err
+		}
+		message, err := node.WaitFor(messaging.BlockTxnMessageOption())
+		if err != nil {
+			return nil, err
+		}
+		blockTxn := message.(*messaging.BlockTxnMessage)
+		if !bytes.Equal(blockTxn.BlockHash, hash) {
+			return nil, ErrUnexpectedBlock
+		}
+		txs = blockTxn.Transactions
+	}
+	block, err := partial.Fill(txs)
+	if errors.Is(err, ErrCompactReconstruction) {
+		return node.GetBlock(hash)
+	}
+	return block, err
+}
+
+// GetBlock downloads the block with the given hash with its witness data
+// and checks its transactions against the header.
+func (node *Node) GetBlock(hash []byte) (*blockchain.Block, error) {
+	inv := messaging.InvVector{Type: messaging.InvTypeWitnessBlock, Hash: hash}
+	if _, err := node.Send(messaging.NewGetDataMessage(inv)); err != nil {
+		return nil, err
+	}
+	message, err := node.WaitFor(messaging.BlockMessageOption())
+	if err != nil {
+		return nil, err
+	}
+	msg := message.(*messaging.BlockMessage)
+	if !bytes.Equal(msg.Block.HashBlock(), hash) {
+		return nil, ErrUnexpectedBlock
+	}
+	if err := msg.Block.CheckMerkleRoot(); err != nil {
+		return nil, err
+	}
+	if err := msg.Block.CheckWitnessCommitment(); err != nil {
+		return nil, err
+	}
+	return msg.Block, nil
+}
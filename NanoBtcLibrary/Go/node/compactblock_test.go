@@ -0,0 +1,90 @@
+package node
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	messaging "github.com/Btcercises/NanoBtcLibrary/Go/network/messaging"
+	regtest "github.com/Btcercises/NanoBtcLibrary/Go/regtest"
+)
+
+type txList []transactions.Transaction
+
+func (txs txList) Transactions() []transactions.Transaction {
+	return txs
+}
+
+// testBlock mines a regtest block holding n transactions besides the
+// coinbase.
+func testBlock(t *testing.T, n int) *blockchain.Block {
+	chain := regtest.NewChain()
+	script := []byte{0x51}
+	blocks, err := chain.GenerateToScript(regtest.CoinbaseMaturity+n, script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		coinbase := blocks[i].Transactions[0]
+		tx := transactions.Transaction{
+			Version: 2,
+			Input:   []transactions.TxInput{{Hash: transactions.GenerateTransactionId(coinbase), Sequence: 0xffffffff}},
+			Output:  []transactions.TxOutput{{Amount: coinbase.Output[0].Amount - 1000, Script: script}},
+		}
+		if err := chain.AddTransaction(tx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	mined, err := chain.GenerateToScript(1, script)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return mined[0]
+}
+
+func TestCompactBlockReconstruction(t *testing.T) {
+	block := testBlock(t, 5)
+	sent := messaging.NewCmpctBlockMessage(block, 42, messaging.CompactBlocksVersion2, 3)
+	msg := new(messaging.CmpctBlockMessage).Parse(bytes.NewReader(sent.Serialize())).(*messaging.CmpctBlockMessage)
+	if msg.Err() != nil || len(msg.ShortIds) != 4 || len(msg.Prefilled) != 2 || msg.Prefilled[1].Index != 3 {
+		t.Fatalf("compact block did not round trip: %v", msg.Err())
+	}
+
+	// The pool lacks the transactions at 2 and 5 and holds an unrelated one.
+	pool := txList{block.Transactions[1], block.Transactions[4], testBlock(t, 1).Transactions[1]}
+	partial, err := NewPartialBlock(msg, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	missing := partial.Missing()
+	if len(missing) != 2 || missing[0] != 2 || missing[1] != 5 {
+		t.Fatalf("missing %v", missing)
+	}
+
+	request := new(messaging.GetBlockTxnMessage).Parse(bytes.NewReader(messaging.NewGetBlockTxnMessage(block.HashBlock(), missing).Serialize())).(*messaging.GetBlockTxnMessage)
+	answer, err := messaging.NewBlockTxnMessage(block, request, messaging.CompactBlocksVersion2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	blockTxn := new(messaging.BlockTxnMessage).Parse(bytes.NewReader(answer.Serialize())).(*messaging.BlockTxnMessage)
+	if _, err := partial.Fill(blockTxn.Transactions[:1]); !errors.Is(err, ErrBlockTxnMismatch) {
+		t.Fatalf("short blocktxn gave %v", err)
+	}
+	if _, err := partial.Fill([]transactions.Transaction{blockTxn.Transactions[1], blockTxn.Transactions[0]}); !errors.Is(err, ErrCompactReconstruction) {
+		t.Fatalf("swapped transactions gave %v", err)
+	}
+	rebuilt, err := partial.Fill(blockTxn.Transactions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(rebuilt.Serialize(), block.Serialize()) {
+		t.Fatal("rebuilt block differs")
+	}
+
+	msg.ShortIds[1] = msg.ShortIds[0]
+	if _, err := NewPartialBlock(msg, pool); !errors.Is(err, ErrShortIdCollision) {
+		t.Fatalf("duplicate short ids gave %v", err)
+	}
+}
@@ -0,0 +1,361 @@
+package node
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	filter "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/filter"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	messaging "github.com/Btcercises/NanoBtcLibrary/Go/network/messaging"
+)
+
+var (
+	ErrNoFilterPeers        = errors.New("no peer left to serve compact filters")
+	ErrFilterHeaderConflict = errors.New("peers serve conflicting filter headers")
+	ErrBadCFCheckpt         = errors.New("peer sent an invalid cfcheckpt")
+	ErrBadCFHeaders         = errors.New("peer sent invalid cfheaders")
+	ErrBadCFilter           = errors.New("filter does not match its filter header")
+	ErrUnexpectedBlock      = errors.New("peer sent a block that was not requested")
+	ErrFilterHeadersBehind  = errors.New("filter headers not synced to the requested height")
+)
+
+// FilterClient is a BIP157 light client. It syncs basic filter headers from
+// several peers, cross-checking them so that a single lying peer is noticed,
+// then downloads filters and fetches the blocks they match. Blocks are looked
+// up in a header chain that the caller keeps in sync.
+type FilterClient struct {
+	Chain *blockchain.HeaderChain
+	Peers []*Node
+	// headers[h] is the verified filter header of the block at height h.
+	headers [][]byte
+}
+
+func NewFilterClient(chain *blockchain.HeaderChain, peers ...*Node) *FilterClient {
+	return &FilterClient{Chain: chain, Peers: peers}
+}
+
+// FilterHeader returns the verified filter header at height.
+func (client *FilterClient) FilterHeader(height int32) ([]byte, error) {
+	if height < 0 || int(height) >= len(client.headers) {
+		return nil, ErrFilterHeadersBehind
+	}
+	return client.headers[height], nil
+}
+
+func (client *FilterClient) blockHash(height int32) ([]byte, error) {
+	header, err := client.Chain.HeaderByHeight(height)
+	if err != nil {
+		return nil, err
+	}
+	return header.HashBlock(), nil
+}
+
+func (client *FilterClient) ban(peer *Node) {
+	for i, other := range client.Peers {
+		if other == peer {
+			client.Peers = append(client.Peers[:i], client.Peers[i+1:]...)
+			peer.Close()
+			return
+		}
+	}
+}
+
+func (client *FilterClient) checkpoints(peer *Node, stopHash []byte, stopHeight int32) ([][]byte, error) {
+	if _, err := peer.Send(messaging.NewGetCFCheckptMessage(messaging.FilterTypeBasic, stopHash)); err != nil {
+		return nil, err
+	}
+	message, err := peer.WaitFor(messaging.CFCheckptMessageOption())
+	if err != nil {
+		return nil, err
+	}
+	checkpt := message.(*messaging.CFCheckptMessage)
+	if !bytes.Equal(checkpt.StopHash, stopHash) ||
+		len(checkpt.FilterHeaders) != int(stopHeight)/messaging.CFCheckptInterval {
+		return nil, ErrBadCFCheckpt
+	}
+	return checkpt.FilterHeaders, nil
+}
+
+// cfheaders fetches the filter hashes of the blocks from start to stop and
+// checks that they chain from prevHeader.
+func (client *FilterClient) cfheaders(peer *Node, start, stop int32, prevHeader []byte) ([][]byte, [][]byte, error) {
+	stopHash, err := client.blockHash(stop)
+	if err != nil {
+		return nil, nil, err
+	}
+	if _, err := peer.Send(messaging.NewGetCFHeadersMessage(messaging.FilterTypeBasic, uint32(start), stopHash)); err != nil {
+		return nil, nil, err
+	}
+	message, err := peer.WaitFor(messaging.CFHeadersMessageOption())
+	if err != nil {
+		return nil, nil, err
+	}
+	msg := message.(*messaging.CFHeadersMessage)
+	headers, err := msg.Headers()
+	if err != nil {
+		return nil, nil, err
+	}
+	if !bytes.Equal(msg.StopHash, stopHash) || !bytes.Equal(msg.PrevFilterHeader, prevHeader) ||
+		len(headers) != int(stop-start+1) {
+		return nil, nil, ErrBadCFHeaders
+	}
+	return msg.FilterHashes, headers, nil
+}
+
+// SyncFilterHeaders brings the filter headers up to the tip of the header
+// chain. Every peer is asked for its checkpoints; headers are downloaded from
+// the first peer and must match its checkpoints. When another peer's
+// checkpoints disagree, the conflict is resolved by fetching the block and
+// both filters where the chains first differ: a peer whose filter omits one
+// of the block's output scripts is lying and is dropped. Conflicts that
+// cannot be decided that way are returned as ErrFilterHeaderConflict.
+func (client *FilterClient) SyncFilterHeaders() error {
+	stopHeight := client.Chain.Height()
+	stopHash, err := client.blockHash(stopHeight)
+	if err != nil {
+		return err
+	}
+
+	for {
+		if len(client.Peers) == 0 {
+			return ErrNoFilterPeers
+		}
+		all := make(map[*Node][][]byte)
+		for _, peer := range append([]*Node{}, client.Peers...) {
+			checkpoints, err := client.checkpoints(peer, stopHash, stopHeight)
+			if err != nil {
+				client.ban(peer)
+				continue
+			}
+			all[peer] = checkpoints
+		}
+		if len(client.Peers) == 0 {
+			return ErrNoFilterPeers
+		}
+		primary := client.Peers[0]
+		if err := client.downloadHeaders(primary, all[primary], stopHeight); err != nil {
+			client.ban(primary)
+			continue
+		}
+
+		resolved := true
+		for _, peer := range append([]*Node{}, client.Peers[1:]...) {
+			index := firstDifference(all[primary], all[peer])
+			if index < 0 {
+				continue
+			}
+			liar, err := client.resolveConflict(primary, peer, index)
+			if err != nil {
+				return err
+			}
+			client.ban(liar)
+			if liar == primary {
+				resolved = false
+				break
+			}
+		}
+		if resolved {
+			return nil
+		}
+		client.headers = client.headers[:0]
+	}
+}
+
+func firstDifference(a, b [][]byte) int {
+	for i := range a {
+		if !bytes.Equal(a[i], b[i]) {
+			return i
+		}
+	}
+	return -1
+}
+
+// downloadHeaders extends the verified headers up to stopHeight from peer,
+// checking them against its checkpoints.
+func (client *FilterClient) downloadHeaders(peer *Node, checkpoints [][]byte, stopHeight int32) error {
+	for int32(len(client.headers)) <= stopHeight {
+		start := int32(len(client.headers))
+		stop := min(start+messaging.MaxGetCFHeaders-1, stopHeight)
+		prev := make([]byte, 32)
+		if start > 0 {
+			prev = client.headers[start-1]
+		}
+		_, headers, err := client.cfheaders(peer, start, stop, prev)
+		if err != nil {
+			return err
+		}
+		for i, header := range headers {
+			height := start + int32(i)
+			if height > 0 && height%messaging.CFCheckptInterval == 0 &&
+				!bytes.Equal(header, checkpoints[height/messaging.CFCheckptInterval-1]) {
+				client.headers = client.headers[:start]
+				return ErrBadCFHeaders
+			}
+		}
+		client.headers = append(client.headers, headers...)
+	}
+	return nil
+}
+
+// resolveConflict finds the first block in checkpoint interval index where
+// the filter hashes of a and b differ and returns the peer whose filter is
+// provably wrong.
+func (client *FilterClient) resolveConflict(a, b *Node, index int) (*Node, error) {
+	start := int32(index * messaging.CFCheckptInterval)
+	stop := start + messaging.CFCheckptInterval
+	prev := make([]byte, 32)
+	if start > 0 {
+		prev = client.headers[start-1]
+	}
+	hashesA, _, err := client.cfheaders(a, start, stop, prev)
+	if err != nil {
+		return a, nil
+	}
+	hashesB, _, err := client.cfheaders(b, start, stop, prev)
+	if err != nil {
+		return b, nil
+	}
+	offset := firstDifference(hashesA, hashesB)
+	if offset < 0 {
+		// b's checkpoint does not follow from its own filter hashes.
+		return b, nil
+	}
+	height := start + int32(offset)
+	block, err := client.fetchBlock(a, height)
+	if err != nil {
+		return nil, err
+	}
+	okA := client.checkFilterAgainstBlock(a, block, height, hashesA[offset])
+	okB := client.checkFilterAgainstBlock(b, block, height, hashesB[offset])
+	switch {
+	case okA && !okB:
+		return b, nil
+	case okB && !okA:
+		return a, nil
+	}
+	return nil, fmt.Errorf("%w at height %d", ErrFilterHeaderConflict, height)
+}
+
+// checkFilterAgainstBlock fetches peer's filter for block, at height, and
+// reports whether it hashes to filterHash and contains every output script
+// of the block. Spent scripts cannot be checked without the previous outputs.
+func (client *FilterClient) checkFilterAgainstBlock(peer *Node, block *blockchain.Block, height int32, filterHash []byte) bool {
+	hash := block.HashBlock()
+	if _, err := peer.Send(messaging.NewGetCFiltersMessage(messaging.FilterTypeBasic, uint32(height), hash)); err != nil {
+		return false
+	}
+	message, err := peer.WaitFor(messaging.CFilterMessageOption())
+	if err != nil {
+		return false
+	}
+	msg := message.(*messaging.CFilterMessage)
+	basic, err := msg.BasicFilter()
+	if err != nil || !bytes.Equal(msg.BlockHash, hash) || !bytes.Equal(msg.Hash(), filterHash) {
+		return false
+	}
+	for _, tx := range block.Transactions {
+		for _, out := range tx.Output {
+			if len(out.Script) == 0 || out.Script[0] == transactions.OP_RETURN {
+				continue
+			}
+			if match, err := basic.Match(out.Script); err != nil || !match {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// fetchBlock downloads the block at height with its witness data and checks
+// it against the header chain.
+func (client *FilterClient) fetchBlock(peer *Node, height int32) (*blockchain.Block, error) {
+	hash, err := client.blockHash(height)
+	if err != nil {
+		return nil, err
+	}
+	return peer.GetBlock(hash)
+}
+
+// GetFilters downloads the basic filters of the blocks from start to stop
+// and checks each one against the verified filter headers.
+func (client *FilterClient) GetFilters(start, stop int32) ([]*filter.Filter, error) {
+	if int(stop) >= len(client.headers) || start < 0 || start > stop {
+		return nil, ErrFilterHeadersBehind
+	}
+	result := make([]*filter.Filter, 0, stop-start+1)
+	for batchStart := start; batchStart <= stop; batchStart += messaging.MaxGetCFilters {
+		if len(client.Peers) == 0 {
+			return nil, ErrNoFilterPeers
+		}
+		peer := client.Peers[0]
+		batchStop := min(batchStart+messaging.MaxGetCFilters-1, stop)
+		stopHash, err := client.blockHash(batchStop)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := peer.Send(messaging.NewGetCFiltersMessage(messaging.FilterTypeBasic, uint32(batchStart), stopHash)); err != nil {
+			return nil, err
+		}
+		for height := batchStart; height <= batchStop; height++ {
+			message, err := peer.WaitFor(messaging.CFilterMessageOption())
+			if err != nil {
+				return nil, err
+			}
+			msg := message.(*messaging.CFilterMessage)
+			basic, err := msg.BasicFilter()
+			if err != nil {
+				return nil, err
+			}
+			hash, err := client.blockHash(height)
+			if err != nil {
+				return nil, err
+			}
+			prev := make([]byte, 32)
+			if height > 0 {
+				prev = client.headers[height-1]
+			}
+			if !bytes.Equal(msg.BlockHash, hash) || !bytes.Equal(filter.FilterHeader(msg.Hash(), prev), client.headers[height]) {
+				client.ban(peer)
+				return nil, ErrBadCFilter
+			}
+			result = append(result, basic)
+		}
+	}
+	return result, nil
+}
+
+// Scan downloads the filters of the blocks from start to stop and fetches
+// every block whose filter matches one of scripts, passing it to onMatch.
+// Filter false positives are passed on too; callers check the transactions.
+func (client *FilterClient) Scan(start, stop int32, scripts [][]byte, onMatch func(height int32, block *blockchain.Block) error) error {
+	for batchStart := start; batchStart <= stop; batchStart += messaging.MaxGetCFilters {
+		batchStop := min(batchStart+messaging.MaxGetCFilters-1, stop)
+		filters, err := client.GetFilters(batchStart, batchStop)
+		if err != nil {
+			return err
+		}
+		for i, basic := range filters {
+			match, err := basic.MatchAny(scripts)
+			if err != nil {
+				return err
+			}
+			if !match {
+				continue
+			}
+			if len(client.Peers) == 0 {
+				return ErrNoFilterPeers
+			}
+			height := batchStart + int32(i)
+			block, err := client.fetchBlock(client.Peers[0], height)
+			if err != nil {
+				return err
+			}
+			if err := onMatch(height, block); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,208 @@
+package node
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	filter "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/filter"
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
+	difficulty "github.com/Btcercises/NanoBtcLibrary/Go/consensus/difficulty"
+	messaging "github.com/Btcercises/NanoBtcLibrary/Go/network/messaging"
+	rpc "github.com/Btcercises/NanoBtcLibrary/Go/network/rpc"
+	util "github.com/Btcercises/NanoBtcLibrary/Go/network/util"
+	regtest "github.com/Btcercises/NanoBtcLibrary/Go/regtest"
+)
+
+// filterChain mines a regtest chain long enough to have a filter checkpoint
+// and returns its blocks and a header chain holding them.
+func filterChain(t *testing.T) ([]*blockchain.Block, *blockchain.HeaderChain) {
+	chain := regtest.NewChain()
+	mined, err := chain.GenerateToScript(messaging.CFCheckptInterval, []byte{0x51})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blocks := append([]*blockchain.Block{regtest.GenesisBlock()}, mined...)
+	headers, err := blockchain.NewHeaderChain(&difficulty.RegTestParams, &blocks[0].BlockHeader, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers.Now = func() time.Time { return blocks[len(blocks)-1].Timestamp }
+	for _, block := range mined {
+		if _, err := headers.AcceptHeader(&block.BlockHeader); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return blocks, headers
+}
+
+// filterPeer serves the basic filters of blocks. The filter of the block at
+// height lie, if positive, leaves out the block's outputs.
+type filterPeer struct {
+	blocks  []*blockchain.Block
+	filters [][]byte
+	headers [][]byte
+	heights map[string]int
+}
+
+func newFilterPeer(t *testing.T, blocks []*blockchain.Block, lie int) *filterPeer {
+	peer := &filterPeer{blocks: blocks, heights: make(map[string]int)}
+	prev := make([]byte, 32)
+	for height, block := range blocks {
+		var items [][]byte
+		if height != lie {
+			items = filter.BasicFilterItems(block, nil)
+		}
+		basic, err := filter.New(filter.BasicP, filter.BasicM, filter.BlockKey(block.HashBlock()), items)
+		if err != nil {
+			t.Fatal(err)
+		}
+		peer.filters = append(peer.filters, basic.Bytes())
+		prev = filter.FilterHeader(util.Hash256(basic.Bytes()), prev)
+		peer.headers = append(peer.headers, prev)
+		peer.heights[string(block.HashBlock())] = height
+	}
+	return peer
+}
+
+// connectTestPeer serves a regtest peer on a loopback connection and
+// returns the client's end. serve answers each message the client sends.
+func connectTestPeer(t *testing.T, serve func(envelope *rpc.NetworkEnvelope) []messaging.Message) *Node {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		conn, err := listener.Accept()
+		listener.Close()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		decoder := rpc.NewDecoder(conn, &chaincfg.RegTestParams)
+		for {
+			envelope, err := decoder.Decode()
+			if err != nil {
+				return
+			}
+			for _, reply := range serve(envelope) {
+				if _, err := conn.Write(rpc.NewEnvelope(reply.Command(), reply.Serialize(), &chaincfg.RegTestParams).Serialize()); err != nil {
+					return
+				}
+			}
+		}
+	}()
+	node := NewNode(WithHostName("127.0.0.1", listener.Addr().(*net.TCPAddr).Port), &chaincfg.RegTestParams, false)
+	t.Cleanup(func() { node.Close() })
+	return node
+}
+
+func (peer *filterPeer) connect(t *testing.T) *Node {
+	return connectTestPeer(t, peer.serve)
+}
+
+func (peer *filterPeer) serve(envelope *rpc.NetworkEnvelope) []messaging.Message {
+	var replies []messaging.Message
+	switch string(envelope.Command) {
+	case "getcfcheckpt":
+		request := new(messaging.GetCFCheckptMessage).Parse(envelope.Stream()).(*messaging.GetCFCheckptMessage)
+		reply := &messaging.CFCheckptMessage{StopHash: request.StopHash, FilterHeaders: [][]byte{}}
+		for height := messaging.CFCheckptInterval; height <= peer.heights[string(request.StopHash)]; height += messaging.CFCheckptInterval {
+			reply.FilterHeaders = append(reply.FilterHeaders, peer.headers[height])
+		}
+		replies = append(replies, reply)
+	case "getcfheaders":
+		request := new(messaging.GetCFHeadersMessage).Parse(envelope.Stream()).(*messaging.GetCFHeadersMessage)
+		start, stop := int(request.StartHeight), peer.heights[string(request.StopHash)]
+		reply := &messaging.CFHeadersMessage{StopHash: request.StopHash, PrevFilterHeader: make([]byte, 32)}
+		if start > 0 {
+			reply.PrevFilterHeader = peer.headers[start-1]
+		}
+		for height := start; height <= stop; height++ {
+			reply.FilterHashes = append(reply.FilterHashes, util.Hash256(peer.filters[height]))
+		}
+		replies = append(replies, reply)
+	case "getcfilters":
+		request := new(messaging.GetCFiltersMessage).Parse(envelope.Stream()).(*messaging.GetCFiltersMessage)
+		for height := int(request.StartHeight); height <= peer.heights[string(request.StopHash)]; height++ {
+			replies = append(replies, messaging.NewCFilterMessage(messaging.FilterTypeBasic, peer.blocks[height].HashBlock(), peer.filters[height]))
+		}
+	case "getdata":
+		request := new(messaging.GetDataMessage).Parse(envelope.Stream()).(*messaging.GetDataMessage)
+		for _, inv := range request.Inventory {
+			if height, ok := peer.heights[string(inv.Hash)]; ok {
+				replies = append(replies, messaging.NewBlockMessage(peer.blocks[height]))
+			}
+		}
+	}
+	return replies
+}
+
+func TestFilterClientDropsLyingPeer(t *testing.T) {
+	blocks, chain := filterChain(t)
+	honest := newFilterPeer(t, blocks, -1)
+	for _, liarFirst := range []bool{false, true} {
+		liar := newFilterPeer(t, blocks, 500).connect(t)
+		peers := []*Node{honest.connect(t), liar}
+		if liarFirst {
+			peers[0], peers[1] = peers[1], peers[0]
+		}
+		client := NewFilterClient(chain, peers...)
+		if err := client.SyncFilterHeaders(); err != nil {
+			t.Fatalf("liar first %v: %v", liarFirst, err)
+		}
+		if len(client.Peers) != 1 || client.Peers[0] == liar {
+			t.Fatalf("liar first %v: liar kept", liarFirst)
+		}
+		for _, height := range []int32{0, 500, 1000} {
+			header, err := client.FilterHeader(height)
+			if err != nil || !bytes.Equal(header, honest.headers[height]) {
+				t.Fatalf("liar first %v: header at %d %x, %v", liarFirst, height, header, err)
+			}
+		}
+	}
+}
+
+func TestFilterClientGetFilters(t *testing.T) {
+	blocks, chain := filterChain(t)
+	honest := newFilterPeer(t, blocks, -1)
+	client := NewFilterClient(chain, honest.connect(t))
+	if _, err := client.GetFilters(0, 1); err != ErrFilterHeadersBehind {
+		t.Fatalf("filters before syncing: %v", err)
+	}
+	if err := client.SyncFilterHeaders(); err != nil {
+		t.Fatal(err)
+	}
+	filters, err := client.GetFilters(495, 505)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(filters) != 11 {
+		t.Fatalf("got %d filters", len(filters))
+	}
+	for _, basic := range filters {
+		if match, err := basic.Match([]byte{0x51}); err != nil || !match {
+			t.Fatalf("filter misses the coinbase output: %v", err)
+		}
+	}
+	if _, err := client.GetFilters(1000, 1001); err != ErrFilterHeadersBehind {
+		t.Fatalf("filters past the tip: %v", err)
+	}
+
+	// A peer serving a filter that does not match the synced headers is
+	// dropped.
+	liar := newFilterPeer(t, blocks, 500).connect(t)
+	client.Peers = []*Node{liar}
+	if _, err := client.GetFilters(495, 505); !errors.Is(err, ErrBadCFilter) {
+		t.Fatalf("lying peer: %v", err)
+	}
+	if len(client.Peers) != 0 {
+		t.Fatal("lying peer kept")
+	}
+	if _, err := client.GetFilters(495, 505); err != ErrNoFilterPeers {
+		t.Fatalf("no peers: %v", err)
+	}
+}
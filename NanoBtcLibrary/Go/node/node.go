@@ -1,22 +1,27 @@
 package node
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
-	"io"
 	"net"
 	"os"
 	"reflect"
+	"strconv"
 
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
+	messaging "github.com/Btcercises/NanoBtcLibrary/Go/network/messaging"
 	rpc "github.com/Btcercises/NanoBtcLibrary/Go/network/rpc"
-	"github.com/Btcercises/NanoBtcLibrary/Go/network/util"
 )
 
+// ErrMalformedMessage is returned by WaitFor when the payload of an awaited
+// message does not parse. The peer has been dropped by then.
+var ErrMalformedMessage = errors.New("malformed message")
+
 type Node struct {
 	Connection *net.TCPConn
-	Testnet    bool
+	Params     *chaincfg.ChainParams
 	Logging    bool
+	decoder    *rpc.Decoder
 }
 
 type NodeConnectOption func(*Node) *net.TCPConn
@@ -25,14 +30,11 @@ func WithHostName(host string, ports ...int) NodeConnectOption {
 	return func(node *Node) *net.TCPConn {
 		var port int
 		if len(ports) == 0 {
-			port = 8333
-			if node.Testnet {
-				port = 18333
-			}
+			port = node.Params.DefaultPort
 		} else {
 			port = ports[0]
 		}
-		result, err := net.Dial("tcp", fmt.Sprintf("%s:%d", host, port))
+		result, err := net.Dial("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
 		if err != nil {
 			panic(err)
 		}
@@ -40,9 +42,9 @@ func WithHostName(host string, ports ...int) NodeConnectOption {
 	}
 }
 
-func NewNode(option NodeConnectOption, testnet bool, logging bool) *Node {
+func NewNode(option NodeConnectOption, params *chaincfg.ChainParams, logging bool) *Node {
 	result := &Node{
-		Testnet: testnet,
+		Params:  params,
 		Logging: logging,
 	}
 	result.Connection = option(result)
@@ -54,10 +56,13 @@ func (node *Node) Close() error {
 }
 
 func (node *Node) Handshake() (bool, error) {
-	if ok, err := node.Send(rpc.NewVersionMessage(nil)); !ok {
+	if ok, err := node.Send(messaging.NewVersionMessage(map[int]interface{}{
+		messaging.ReceiverPortArg: uint16(node.Params.DefaultPort),
+		messaging.SenderPortArg:   uint16(node.Params.DefaultPort),
+	})); !ok {
 		return ok, err
 	}
-	verack, err := node.WaitFor(rpc.VerackMessageOption())
+	verack, err := node.WaitFor(messaging.VerackMessageOption())
 	if err != nil {
 		return false, err
 	}
@@ -67,8 +72,8 @@ func (node *Node) Handshake() (bool, error) {
 	return true, nil
 }
 
-func (node *Node) Send(message rpc.Message) (bool, error) {
-	envelope := rpc.NewEnvelope(message.Command(), message.Serialize(), node.Testnet)
+func (node *Node) Send(message messaging.Message) (bool, error) {
+	envelope := rpc.NewEnvelope(message.Command(), message.Serialize(), node.Params)
 	if node.Logging {
 		fmt.Fprintf(os.Stdout, "sending: %v\n", envelope)
 	}
@@ -79,44 +84,24 @@ func (node *Node) Send(message rpc.Message) (bool, error) {
 	return true, nil
 }
 
+// Read returns the next message from the peer. Messages with a bad
+// checksum give rpc.ErrBadChecksum and leave the connection usable; other
+// errors mean the connection should be dropped.
 func (node *Node) Read() (*rpc.NetworkEnvelope, error) {
-	bufCh := make(chan []byte)
-	errCh := make(chan error)
-	go func(conn *net.TCPConn, bufCh chan []byte, errCh chan error) {
-		header := make([]byte, 24)
-		_, err := io.ReadFull(conn, header)
-		if err != nil {
-			errCh <- err
-			return
-		}
-		bufCh <- header
-		payloadLength := int(util.LittleEndianToInt32(header[16:20]))
-		payload := make([]byte, payloadLength)
-		_, err = io.ReadFull(conn, payload)
-		if err != nil {
-			errCh <- err
-			return
-		}
-		bufCh <- payload
-		close(bufCh)
-	}(node.Connection, bufCh, errCh)
-	response := make([]byte, 0)
-	for buf := range bufCh {
-		select {
-		case err := <-errCh:
-			return nil, err
-		default:
-		}
-		response = append(response, buf...)
+	if node.decoder == nil {
+		node.decoder = rpc.NewDecoder(node.Connection, node.Params)
 	}
-	return rpc.ParseEnvelope(bytes.NewReader(response), node.Testnet), nil
+	return node.decoder.Decode()
 }
 
-func (node *Node) WaitFor(messageTypes ...rpc.ReceiveMessageTypeOption) (rpc.Message, error) {
-	commands := make(map[string]rpc.Message)
+// WaitFor reads messages until one of messageTypes arrives and returns it
+// parsed, answering version and ping messages on the way. An awaited
+// message that does not parse gives ErrMalformedMessage.
+func (node *Node) WaitFor(messageTypes ...messaging.ReceiveMessageTypeOption) (messaging.Message, error) {
+	commands := make(map[string]messaging.Message)
 	for _, option := range messageTypes {
 		messageType := option()
-		message, ok := reflect.New(messageType.Elem()).Interface().(rpc.Message)
+		message, ok := reflect.New(messageType.Elem()).Interface().(messaging.Message)
 		if !ok {
 			panic("Failed to cast to Message type!")
 		}
@@ -124,6 +109,10 @@ func (node *Node) WaitFor(messageTypes ...rpc.ReceiveMessageTypeOption) (rpc.Mes
 	}
 	for {
 		envelope, err := node.Read()
+		if errors.Is(err, rpc.ErrBadChecksum) {
+			// Bitcoin Core drops these messages and keeps the peer.
+			continue
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -133,13 +122,23 @@ func (node *Node) WaitFor(messageTypes ...rpc.ReceiveMessageTypeOption) (rpc.Mes
 		}
 		switch command {
 		case "version":
-			node.Send(rpc.NewVerackMessage())
+			node.Send(messaging.NewVerackMessage())
 		case "ping":
-			node.Send(rpc.NewPongMessage(envelope.Payload))
+			node.Send(messaging.NewPongMessage(envelope.Payload))
 		}
 		if result, ok := commands[command]; ok {
-			result.Parse(envelope.Stream())
-			return result, nil
+			return node.parse(result, envelope)
 		}
 	}
 }
+
+// parse parses the payload of envelope into message. Parsers report bad
+// payloads through Err, and a malformed message drops the peer.
+func (node *Node) parse(message messaging.Message, envelope *rpc.NetworkEnvelope) (messaging.Message, error) {
+	message.Parse(envelope.Stream())
+	if parsed, ok := message.(interface{ Err() error }); ok && parsed.Err() != nil {
+		node.Close()
+		return nil, fmt.Errorf("%w: %s: %w", ErrMalformedMessage, envelope.Command, parsed.Err())
+	}
+	return message, nil
+}
@@ -0,0 +1,51 @@
+package node
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	messaging "github.com/Btcercises/NanoBtcLibrary/Go/network/messaging"
+	rpc "github.com/Btcercises/NanoBtcLibrary/Go/network/rpc"
+)
+
+// rawMessage sends payload under command as is, to play a misbehaving peer.
+type rawMessage struct {
+	command string
+	payload []byte
+}
+
+func (message *rawMessage) Command() []byte { return []byte(message.command) }
+
+func (message *rawMessage) Serialize() []byte { return message.payload }
+
+func (message *rawMessage) Parse(reader *bytes.Reader) messaging.Message { return message }
+
+func TestWaitForDropsMalformedMessage(t *testing.T) {
+	for _, test := range []struct {
+		name   string
+		option messaging.ReceiveMessageTypeOption
+		reply  *rawMessage
+	}{
+		// A hash count of 2^59 that overflows when multiplied by the hash
+		// size.
+		{"cfheaders", messaging.CFHeadersMessageOption(), &rawMessage{"cfheaders", append(make([]byte, 65), 0xff, 0, 0, 0, 0, 0, 0, 0, 0x08)}},
+		// Cut off right after the header and transaction count.
+		{"merkleblock", messaging.MerkleBlockMessageOption(), &rawMessage{"merkleblock", make([]byte, 84)}},
+		// A ping without its nonce.
+		{"ping", messaging.PingMessageOption(), &rawMessage{"ping", []byte{1, 2, 3}}},
+	} {
+		node := connectTestPeer(t, func(envelope *rpc.NetworkEnvelope) []messaging.Message {
+			return []messaging.Message{test.reply}
+		})
+		if _, err := node.Send(messaging.NewVerackMessage()); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := node.WaitFor(test.option); !errors.Is(err, ErrMalformedMessage) {
+			t.Fatalf("%s: got %v", test.name, err)
+		}
+		if _, err := node.Read(); err == nil {
+			t.Fatalf("%s: peer not dropped", test.name)
+		}
+	}
+}
@@ -0,0 +1,640 @@
+package regtest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+	"sync"
+	"time"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	blockindex "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/blockindex"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	utxo "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utxo"
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
+	consensus "github.com/Btcercises/NanoBtcLibrary/Go/consensus"
+	difficulty "github.com/Btcercises/NanoBtcLibrary/Go/consensus/difficulty"
+)
+
+const (
+	// CoinbaseMaturity is the depth a coinbase output needs to be spent.
+	CoinbaseMaturity = 100
+)
+
+var (
+	ErrUnknownBlock    = errors.New("unknown block")
+	ErrOrphanBlock     = newRejectError("previous block not found", "prev-blk-not-found")
+	ErrBadBits         = newRejectError("incorrect difficulty bits", "bad-diffbits")
+	ErrBadCoinbase     = newRejectError("first transaction is not a coinbase", string(consensus.RuleCoinbaseMissing))
+	ErrMissingInput    = newRejectError("input missing or spent", string(consensus.RuleMissingOrSpent))
+	ErrImmatureSpend   = newRejectError("spend of immature coinbase output", string(consensus.RulePrematureCoinbase))
+	ErrNegativeFee     = newRejectError("outputs exceed inputs", string(consensus.RuleInputsBelowOutputs))
+	ErrBadCoinbaseFees = newRejectError("coinbase pays more than subsidy and fees", string(consensus.RuleCoinbaseAmount))
+	ErrTimeTooOld      = newRejectError("block timestamp not after median time past", "time-too-old")
+	ErrDuplicateBlock  = newRejectError("block already known", "duplicate")
+)
+
+// rejectError is an error of the chain that carries the reject reason
+// Bitcoin Core's submitblock gives for it.
+type rejectError struct {
+	message string
+	reason  string
+}
+
+func newRejectError(message, reason string) error {
+	return &rejectError{message: message, reason: reason}
+}
+
+func (err *rejectError) Error() string {
+	return err.message
+}
+
+// RejectReason returns the BIP22 reject reason for the error.
+func (err *rejectError) RejectReason() string {
+	return err.reason
+}
+
+// chainBlock is a block known to the chain engine.
+type chainBlock struct {
+	block    *blockchain.Block
+	parent   *chainBlock
+	height   int32
+	work     *big.Int
+	sequence int
+	invalid  bool
+	// failed is set when the block or one of its ancestors is invalid.
+	failed bool
+}
+
+func (node *chainBlock) Height() int32 {
+	return node.height
+}
+
+func (node *chainBlock) Bits() uint32 {
+	return node.block.TargetDifficulty
+}
+
+func (node *chainBlock) Timestamp() int64 {
+	return node.block.Timestamp.Unix()
+}
+
+// Chain is a regtest chain kept in memory. Blocks are mined locally at the
+// minimum difficulty, so tests of wallets and clients can build, spend and
+// reorg chains without a network. Scripts are not verified.
+type Chain struct {
+	mutex  sync.Mutex
+	params *chaincfg.ChainParams
+	blocks map[string]*chainBlock
+	active []*chainBlock
+	// best is the valid block with the most work, which the active chain
+	// is moved to.
+	best       *chainBlock
+	utxos      *utxo.Set
+	mempool    []transactions.Transaction
+	extraNonce uint64
+	sequence   int
+	// Now is the clock used to timestamp new blocks, time.Now by default.
+	Now func() time.Time
+}
+
+// NewChain returns a chain holding only the regtest genesis block.
+func NewChain() *Chain {
+	genesis := GenesisBlock()
+	node := &chainBlock{
+		block: genesis,
+		work:  difficulty.CalcWork(genesis.TargetDifficulty),
+	}
+	// Like in Bitcoin Core, the genesis coinbase is not added to the UTXO
+	// set. Opening a new memory store cannot fail.
+	utxos, _ := utxo.Open(blockindex.NewMemoryStore(), genesis.HashBlock())
+	return &Chain{
+		params: &chaincfg.RegTestParams,
+		blocks: map[string]*chainBlock{string(genesis.HashBlock()): node},
+		active: []*chainBlock{node},
+		best:   node,
+		utxos:  utxos,
+		Now:    time.Now,
+	}
+}
+
+// CalcBlockSubsidy returns the regtest block reward at height.
+func CalcBlockSubsidy(height int32) int64 {
+	return chaincfg.RegTestParams.BlockSubsidy(height)
+}
+
+// Ancestor implements difficulty.HeaderStore.
+func (chain *Chain) Ancestor(node difficulty.HeaderNode, height int32) (difficulty.HeaderNode, error) {
+	current, ok := node.(*chainBlock)
+	if !ok {
+		return nil, difficulty.ErrForeignNode
+	}
+	for current != nil && current.height > height {
+		current = current.parent
+	}
+	if current == nil || current.height != height {
+		return nil, nil
+	}
+	return current, nil
+}
+
+func (chain *Chain) tip() *chainBlock {
+	return chain.active[len(chain.active)-1]
+}
+
+// Tip returns the block at the tip of the active chain.
+func (chain *Chain) Tip() *blockchain.Block {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	return chain.tip().block
+}
+
+// Height returns the height of the active tip.
+func (chain *Chain) Height() int32 {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	return chain.tip().height
+}
+
+// BlockAtHeight returns the block at height on the active chain.
+func (chain *Chain) BlockAtHeight(height int32) (*blockchain.Block, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	if height < 0 || int(height) >= len(chain.active) {
+		return nil, ErrUnknownBlock
+	}
+	return chain.active[height].block, nil
+}
+
+// MedianTimes returns the median times past of the active chain, as
+// consensus.ValidateBlock takes them.
+func (chain *Chain) MedianTimes() consensus.MedianTimeFunc {
+	return consensus.MedianTimes(func(height int32) (int64, error) {
+		block, err := chain.BlockAtHeight(height)
+		if err != nil {
+			return 0, err
+		}
+		return block.Timestamp.Unix(), nil
+	})
+}
+
+// Block returns a known block by hash, whether or not it is active.
+func (chain *Chain) Block(hash []byte) (*blockchain.Block, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	node, ok := chain.blocks[string(hash)]
+	if !ok {
+		return nil, ErrUnknownBlock
+	}
+	return node.block, nil
+}
+
+// GetCoin returns the unspent output at outPoint on the active chain, or
+// utxo.ErrCoinNotFound.
+func (chain *Chain) GetCoin(outPoint utxo.OutPoint) (*utxo.Coin, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	return chain.utxos.GetCoin(outPoint)
+}
+
+// UtxoSet returns the unspent outputs of the active chain. It must not be
+// used concurrently with changes to the chain.
+func (chain *Chain) UtxoSet() *utxo.Set {
+	return chain.utxos
+}
+
+// utxoView overlays the changes of not yet connected transactions on the
+// UTXO set without modifying it.
+type utxoView struct {
+	base  *utxo.Set
+	added map[utxo.OutPoint]*utxo.Coin
+	spent map[utxo.OutPoint]bool
+}
+
+func newUtxoView(base *utxo.Set) *utxoView {
+	return &utxoView{base: base, added: make(map[utxo.OutPoint]*utxo.Coin), spent: make(map[utxo.OutPoint]bool)}
+}
+
+func (view *utxoView) get(outPoint utxo.OutPoint) (*utxo.Coin, error) {
+	if view.spent[outPoint] {
+		return nil, utxo.ErrCoinNotFound
+	}
+	if coin, ok := view.added[outPoint]; ok {
+		return coin, nil
+	}
+	return view.base.GetCoin(outPoint)
+}
+
+func (view *utxoView) spend(outPoint utxo.OutPoint) {
+	if _, ok := view.added[outPoint]; ok {
+		delete(view.added, outPoint)
+		return
+	}
+	view.spent[outPoint] = true
+}
+
+func (view *utxoView) addOutputs(tx transactions.Transaction, height int32) {
+	txid := transactions.GenerateTransactionId(tx)
+	for i, out := range tx.Output {
+		if !utxo.IsUnspendable(out.Script) {
+			view.added[utxo.NewOutPoint(txid, uint32(i))] = &utxo.Coin{Amount: out.Amount, Script: out.Script, Height: height}
+		}
+	}
+}
+
+func medianTimePast(node *chainBlock) int64 {
+	timestamps := make([]int64, 0, 11)
+	for i := 0; i < 11 && node != nil; i++ {
+		timestamps = append(timestamps, node.Timestamp())
+		node = node.parent
+	}
+	sort.Slice(timestamps, func(i, j int) bool { return timestamps[i] < timestamps[j] })
+	return timestamps[len(timestamps)/2]
+}
+
+// checkTransaction checks tx against view, applies it and returns its fee.
+func checkTransaction(view *utxoView, tx transactions.Transaction, height int32) (int64, error) {
+	var in, out int64
+	for _, input := range tx.Input {
+		outPoint := utxo.NewOutPoint(input.Hash, input.Index)
+		coin, err := view.get(outPoint)
+		if errors.Is(err, utxo.ErrCoinNotFound) {
+			return 0, ErrMissingInput
+		}
+		if err != nil {
+			return 0, err
+		}
+		if coin.Coinbase && height-coin.Height < CoinbaseMaturity {
+			return 0, ErrImmatureSpend
+		}
+		in += coin.Amount
+		view.spend(outPoint)
+	}
+	for _, output := range tx.Output {
+		out += output.Amount
+	}
+	if out > in {
+		return 0, ErrNegativeFee
+	}
+	view.addOutputs(tx, height)
+	return in - out, nil
+}
+
+// AddTransaction queues tx for the next generated block. It must spend
+// outputs of the active chain or of queued transactions.
+func (chain *Chain) AddTransaction(tx transactions.Transaction) error {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	view := newUtxoView(chain.utxos)
+	height := chain.tip().height + 1
+	for _, queued := range chain.mempool {
+		if _, err := checkTransaction(view, queued, height); err != nil {
+			return err
+		}
+	}
+	if _, err := checkTransaction(view, tx, height); err != nil {
+		return err
+	}
+	tx.Id = transactions.GenerateTransactionId(tx)
+	chain.mempool = append(chain.mempool, tx)
+	return nil
+}
+
+// coinbaseTransaction builds a coinbase for height paying value to script,
+// with the BIP34 height and an extra nonce in its script.
+func (chain *Chain) coinbaseTransaction(height int32, script []byte, value int64) transactions.Transaction {
+	chain.extraNonce++
+	extraNonce := make([]byte, 8)
+	binary.LittleEndian.PutUint64(extraNonce, chain.extraNonce)
+	scriptSig := append(transactions.PushInt(int64(height)), transactions.PushData(extraNonce)...)
+	return transactions.Transaction{
+		Version: 2,
+		Input: []transactions.TxInput{{
+			Hash:          make([]byte, 32),
+			Index:         0xffffffff,
+			PrevIndex:     -1,
+			Script:        scriptSig,
+			Sequence:      0xffffffff,
+			ScriptWitness: [][]byte{make([]byte, 32)},
+		}},
+		Output: []transactions.TxOutput{{Amount: value, Script: script}},
+	}
+}
+
+// createBlock assembles and mines a block on the active tip.
+func (chain *Chain) createBlock(script []byte, txs []transactions.Transaction) (*blockchain.Block, error) {
+	parent := chain.tip()
+	height := parent.height + 1
+	view := newUtxoView(chain.utxos)
+	var fees int64
+	for _, tx := range txs {
+		fee, err := checkTransaction(view, tx, height)
+		if err != nil {
+			return nil, err
+		}
+		fees += fee
+	}
+
+	coinbase := chain.coinbaseTransaction(height, script, CalcBlockSubsidy(height)+fees)
+	all := append([]transactions.Transaction{coinbase}, txs...)
+	witnessRoot, _ := blockchain.WitnessMerkleRoot(all)
+	commitment := append([]byte{0x6a, 0x24, 0xaa, 0x21, 0xa9, 0xed}, blockchain.WitnessCommitment(witnessRoot, coinbase.Input[0].ScriptWitness[0])...)
+	all[0].Output = append(all[0].Output, transactions.TxOutput{Amount: 0, Script: commitment})
+	all[0].Id = transactions.GenerateTransactionId(all[0])
+	merkleRoot, _ := blockchain.MerkleRoot(all)
+
+	timestamp := chain.Now().Unix()
+	if mtp := medianTimePast(parent); timestamp <= mtp {
+		timestamp = mtp + 1
+	}
+	bits, err := difficulty.NextWorkRequired(chain.params.Pow, chain, parent, timestamp)
+	if err != nil {
+		return nil, err
+	}
+	block := &blockchain.Block{
+		BlockHeader: blockchain.BlockHeader{
+			Version:          0x20000000,
+			HashPrev:         parent.block.HashBlock(),
+			HashMerkle:       merkleRoot,
+			Timestamp:        time.Unix(timestamp, 0),
+			TargetDifficulty: bits,
+		},
+		MagicId:          blockchain.MagicId(chain.params.Net),
+		TransactionCount: uint64(len(all)),
+		Transactions:     all,
+	}
+	copy(block.MerkleRoot[:], merkleRoot)
+
+	// Half of all hashes meet the regtest target, so this ends quickly.
+	if _, _, err := consensus.NewProof(&block.BlockHeader).Run(); err != nil {
+		return nil, err
+	}
+	return block, nil
+}
+
+// GenerateToScript mines n blocks on the active tip paying their rewards to
+// script. Queued transactions are included in the first block.
+func (chain *Chain) GenerateToScript(n int, script []byte) ([]*blockchain.Block, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	result := make([]*blockchain.Block, 0, n)
+	for i := 0; i < n; i++ {
+		block, err := chain.createBlock(script, chain.mempool)
+		if err != nil {
+			return result, err
+		}
+		if err := chain.submitBlock(block); err != nil {
+			return result, err
+		}
+		result = append(result, block)
+	}
+	return result, nil
+}
+
+// GenerateBlock mines a single block with exactly the given transactions,
+// ignoring the queue.
+func (chain *Chain) GenerateBlock(script []byte, txs []transactions.Transaction) (*blockchain.Block, error) {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	block, err := chain.createBlock(script, txs)
+	if err != nil {
+		return nil, err
+	}
+	return block, chain.submitBlock(block)
+}
+
+// SubmitBlock checks block and adds it to the chain, reorganizing if it ends
+// up on the branch with the most work.
+func (chain *Chain) SubmitBlock(block *blockchain.Block) error {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	return chain.submitBlock(block)
+}
+
+func (chain *Chain) submitBlock(block *blockchain.Block) error {
+	hash := block.HashBlock()
+	if _, ok := chain.blocks[string(hash)]; ok {
+		return ErrDuplicateBlock
+	}
+	parent, ok := chain.blocks[string(block.HashPrev)]
+	if !ok {
+		return ErrOrphanBlock
+	}
+	if err := chain.checkBlock(block, parent); err != nil {
+		return err
+	}
+	chain.sequence++
+	node := &chainBlock{
+		block:    block,
+		parent:   parent,
+		height:   parent.height + 1,
+		work:     difficulty.CalcChainWork(parent.work, block.TargetDifficulty),
+		sequence: chain.sequence,
+		failed:   parent.failed,
+	}
+	chain.blocks[string(hash)] = node
+	if !node.failed && isBetter(node, chain.best, chain.tip()) {
+		chain.best = node
+	}
+	return chain.activateBestChain()
+}
+
+// checkBlock runs the checks that do not depend on the UTXO set.
+func (chain *Chain) checkBlock(block *blockchain.Block, parent *chainBlock) error {
+	if err := difficulty.CheckProofOfWork(block.HashBlock(), block.TargetDifficulty, chain.params.Pow); err != nil {
+		return err
+	}
+	bits, err := difficulty.NextWorkRequired(chain.params.Pow, chain, parent, block.Timestamp.Unix())
+	if err != nil {
+		return err
+	}
+	if block.TargetDifficulty != bits {
+		return ErrBadBits
+	}
+	if block.Timestamp.Unix() <= medianTimePast(parent) {
+		return ErrTimeTooOld
+	}
+	if err := block.CheckMerkleRoot(); err != nil {
+		return err
+	}
+	if err := block.CheckWitnessCommitment(); err != nil {
+		return err
+	}
+	coinbase := block.Transactions[0]
+	if len(coinbase.Input) != 1 || !bytes.Equal(coinbase.Input[0].Hash, make([]byte, 32)) || coinbase.Input[0].Index != 0xffffffff {
+		return ErrBadCoinbase
+	}
+	for _, tx := range block.Transactions[1:] {
+		for _, in := range tx.Input {
+			if in.Index == 0xffffffff && bytes.Equal(in.Hash, make([]byte, 32)) {
+				return ErrBadCoinbase
+			}
+		}
+	}
+	return nil
+}
+
+// connectBlock checks the fees of a block and applies it to the UTXO set,
+// which keeps its undo data.
+func (chain *Chain) connectBlock(node *chainBlock) error {
+	view := newUtxoView(chain.utxos)
+	block := node.block
+	var fees int64
+	for _, tx := range block.Transactions[1:] {
+		fee, err := checkTransaction(view, tx, node.height)
+		if err != nil {
+			return err
+		}
+		fees += fee
+	}
+	var coinbaseValue int64
+	for _, out := range block.Transactions[0].Output {
+		coinbaseValue += out.Amount
+	}
+	if coinbaseValue > CalcBlockSubsidy(node.height)+fees {
+		return ErrBadCoinbaseFees
+	}
+	if err := chain.utxos.ConnectBlock(block, node.height); err != nil {
+		return err
+	}
+	chain.active = append(chain.active, node)
+	return nil
+}
+
+// disconnectBlock undoes the tip block and returns its transactions to the
+// queue.
+func (chain *Chain) disconnectBlock() error {
+	node := chain.tip()
+	if err := chain.utxos.DisconnectBlock(node.block); err != nil {
+		return err
+	}
+	chain.active = chain.active[:len(chain.active)-1]
+	chain.mempool = append(append([]transactions.Transaction{}, node.block.Transactions[1:]...), chain.mempool...)
+	return nil
+}
+
+func (chain *Chain) isActive(node *chainBlock) bool {
+	return int(node.height) < len(chain.active) && chain.active[node.height] == node
+}
+
+// isBetter reports whether node has more work than best, or as much and is
+// the active tip or was received before best.
+func isBetter(node, best, tip *chainBlock) bool {
+	if best == nil {
+		return true
+	}
+	cmp := node.work.Cmp(best.work)
+	return cmp > 0 || (cmp == 0 && (node == tip || (best != tip && node.sequence < best.sequence)))
+}
+
+// findBest recomputes the failed flags and the best block after blocks were
+// marked invalid or reconsidered.
+func (chain *Chain) findBest() {
+	done := make(map[*chainBlock]bool, len(chain.blocks))
+	var isFailed func(node *chainBlock) bool
+	isFailed = func(node *chainBlock) bool {
+		if node == nil {
+			return false
+		}
+		if !done[node] {
+			node.failed = node.invalid || isFailed(node.parent)
+			done[node] = true
+		}
+		return node.failed
+	}
+	chain.best = nil
+	tip := chain.tip()
+	for _, node := range chain.blocks {
+		if !isFailed(node) && isBetter(node, chain.best, tip) {
+			chain.best = node
+		}
+	}
+}
+
+// activateBestChain reorganizes to the valid branch with the most work.
+// Blocks failing to connect are marked invalid and the search starts over.
+func (chain *Chain) activateBestChain() error {
+	for {
+		best := chain.best
+		if best == chain.tip() {
+			chain.revalidateMempool()
+			return nil
+		}
+		fork := best
+		connect := make([]*chainBlock, 0)
+		for !chain.isActive(fork) {
+			connect = append(connect, fork)
+			fork = fork.parent
+		}
+		for chain.tip() != fork {
+			if err := chain.disconnectBlock(); err != nil {
+				return err
+			}
+		}
+		for i := len(connect) - 1; i >= 0; i-- {
+			if err := chain.connectBlock(connect[i]); err != nil {
+				connect[i].invalid = true
+				chain.findBest()
+				break
+			}
+		}
+	}
+}
+
+// revalidateMempool drops queued transactions that no longer fit the active
+// chain, including those mined in it.
+func (chain *Chain) revalidateMempool() {
+	view := newUtxoView(chain.utxos)
+	height := chain.tip().height + 1
+	kept := make([]transactions.Transaction, 0, len(chain.mempool))
+	for _, tx := range chain.mempool {
+		if _, err := checkTransaction(view, tx, height); err == nil {
+			kept = append(kept, tx)
+		}
+	}
+	chain.mempool = kept
+}
+
+// InvalidateBlock marks a block as invalid, as bitcoind's invalidateblock.
+// If it is on the active chain the chain reorganizes to the best branch not
+// containing it.
+func (chain *Chain) InvalidateBlock(hash []byte) error {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	node, ok := chain.blocks[string(hash)]
+	if !ok {
+		return ErrUnknownBlock
+	}
+	if node.parent == nil {
+		return fmt.Errorf("cannot invalidate the genesis block")
+	}
+	node.invalid = true
+	chain.findBest()
+	return chain.activateBestChain()
+}
+
+// ReconsiderBlock removes the invalid mark from a block and its ancestors
+// and descendants, as bitcoind's reconsiderblock.
+func (chain *Chain) ReconsiderBlock(hash []byte) error {
+	chain.mutex.Lock()
+	defer chain.mutex.Unlock()
+	target, ok := chain.blocks[string(hash)]
+	if !ok {
+		return ErrUnknownBlock
+	}
+	for _, node := range chain.blocks {
+		for ancestor := node; ancestor != nil; ancestor = ancestor.parent {
+			if ancestor == target {
+				node.invalid = false
+				break
+			}
+		}
+	}
+	for ancestor := target; ancestor != nil; ancestor = ancestor.parent {
+		ancestor.invalid = false
+	}
+	chain.findBest()
+	return chain.activateBestChain()
+}
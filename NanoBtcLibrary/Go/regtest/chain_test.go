@@ -0,0 +1,88 @@
+package regtest_test
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	utxo "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utxo"
+	regtesttest "github.com/Btcercises/NanoBtcLibrary/Go/internal/regtesttest"
+	regtest "github.com/Btcercises/NanoBtcLibrary/Go/regtest"
+)
+
+func TestGenesisHash(t *testing.T) {
+	hash := regtest.GenesisBlock().HashBlock()
+	want := "0f9188f13cb7b2c71f2a335e3a4fc328bf5beb436012afca590b1a11466e2206"
+	reversed := make([]byte, len(hash))
+	for i := range hash {
+		reversed[len(hash)-1-i] = hash[i]
+	}
+	if hex.EncodeToString(reversed) != want {
+		t.Fatalf("genesis hash %x", reversed)
+	}
+}
+
+func TestSpendAndReorg(t *testing.T) {
+	fixture, err := regtesttest.NewSpendFixture(func(amount int64) []transactions.TxOutput {
+		return []transactions.TxOutput{{Amount: amount - 1000, Script: regtesttest.TrueScript}}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain := fixture.Chain
+	coinbase := fixture.Blocks[0].Transactions[0]
+	mined := fixture.Blocks[len(fixture.Blocks)-1]
+	spendId := transactions.GenerateTransactionId(fixture.Spend)
+	if _, err := chain.GetCoin(utxo.NewOutPoint(spendId, 0)); err != nil {
+		t.Fatal("spend output missing after mining")
+	}
+	if fee := mined.Transactions[0].Output[0].Amount - regtest.CalcBlockSubsidy(chain.Height()); fee != 1000 {
+		t.Fatalf("coinbase collected %d in fees", fee)
+	}
+
+	if err := chain.InvalidateBlock(mined.HashBlock()); err != nil {
+		t.Fatal(err)
+	}
+	if chain.Height() != regtest.CoinbaseMaturity+1 {
+		t.Fatalf("height %d after invalidateblock", chain.Height())
+	}
+	if _, err := chain.GetCoin(utxo.NewOutPoint(spendId, 0)); err != utxo.ErrCoinNotFound {
+		t.Fatal("spend output left after disconnect")
+	}
+	if _, err := chain.GetCoin(utxo.NewOutPoint(transactions.GenerateTransactionId(coinbase), 0)); err != nil {
+		t.Fatal("spent coin not restored")
+	}
+
+	// Two blocks on the other branch outweigh the reconsidered one.
+	if _, err := chain.GenerateToScript(2, regtesttest.TrueScript); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.ReconsiderBlock(mined.HashBlock()); err != nil {
+		t.Fatal(err)
+	}
+	tip := chain.Tip()
+	if chain.Height() != regtest.CoinbaseMaturity+3 || bytes.Equal(tip.HashBlock(), mined.HashBlock()) {
+		t.Fatalf("unexpected tip at height %d", chain.Height())
+	}
+	if _, err := chain.GetCoin(utxo.NewOutPoint(spendId, 0)); err != nil {
+		t.Fatal("requeued spend was not mined on the new branch")
+	}
+}
+
+func TestImmatureSpend(t *testing.T) {
+	chain := regtesttest.NewTestChain()
+	blocks, err := chain.GenerateToScript(10, regtesttest.TrueScript)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coinbase := blocks[0].Transactions[0]
+	spend := transactions.Transaction{
+		Version: 2,
+		Input:   []transactions.TxInput{{Hash: transactions.GenerateTransactionId(coinbase), Sequence: 0xffffffff}},
+		Output:  []transactions.TxOutput{{Amount: 1, Script: regtesttest.TrueScript}},
+	}
+	if err := chain.AddTransaction(spend); err != regtest.ErrImmatureSpend {
+		t.Fatalf("got %v, want ErrImmatureSpend", err)
+	}
+}
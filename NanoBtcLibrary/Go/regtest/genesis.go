@@ -0,0 +1,17 @@
+package regtest
+
+import (
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
+)
+
+// GenesisBlock returns the regtest genesis block, which shares its coinbase
+// with mainnet but has its own time, bits and nonce.
+func GenesisBlock() *blockchain.Block {
+	block, err := blockchain.GenesisBlock(&chaincfg.RegTestParams)
+	if err != nil {
+		panic(err)
+	}
+	block.HashBlock()
+	return block
+}
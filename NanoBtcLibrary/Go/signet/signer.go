@@ -0,0 +1,148 @@
+package signet
+
+import (
+	"bytes"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	secp256k1 "github.com/Btcercises/NanoBtcLibrary/Go/crypto/secp256k1"
+	cryptoUtils "github.com/Btcercises/NanoBtcLibrary/Go/crypto/utils"
+)
+
+// Signer produces block solutions for challenges made of its keys. Bare
+// multisig, pay-to-pubkey and P2WPKH challenges are supported, which covers
+// the default signet and signets created with Bitcoin Core's tooling.
+type Signer struct {
+	Keys []*secp256k1.PrivateKey
+}
+
+func NewSigner(keys ...*secp256k1.PrivateKey) *Signer {
+	return &Signer{Keys: keys}
+}
+
+// key returns the private key for a serialized public key.
+func (signer *Signer) key(pubKey []byte) *secp256k1.PrivateKey {
+	for _, key := range signer.Keys {
+		if bytes.Equal(key.PubKey().SerializeCompressed(), pubKey) || bytes.Equal(key.PubKey().SerializeUncompressed(), pubKey) {
+			return key
+		}
+	}
+	return nil
+}
+
+func sign(key *secp256k1.PrivateKey, hash []byte) []byte {
+	return append(key.Sign(hash).Serialize(), transactions.SigHashAll)
+}
+
+// parseMultisig decodes OP_m <keys> OP_n OP_CHECKMULTISIG.
+func parseMultisig(script transactions.Script) (int, [][]byte, bool) {
+	if len(script) < 3 || script[len(script)-1] != transactions.OP_CHECKMULTISIG {
+		return 0, nil, false
+	}
+	required := int(script[0]) - transactions.OP_1 + 1
+	total := int(script[len(script)-2]) - transactions.OP_1 + 1
+	if required < 1 || required > 16 || total < required || total > 16 {
+		return 0, nil, false
+	}
+	var keys [][]byte
+	for pc := 1; pc < len(script)-2; {
+		data, opcode, next, err := readOp(script, pc)
+		if err != nil || opcode > transactions.OP_PUSHDATA4 || len(data) == 0 {
+			return 0, nil, false
+		}
+		keys = append(keys, data)
+		pc = next
+	}
+	if len(keys) != total {
+		return 0, nil, false
+	}
+	return required, keys, true
+}
+
+// Solve returns a solution to challenge for the given to_sign transaction.
+func (signer *Signer) Solve(toSign transactions.Transaction, challenge transactions.Script) (*Solution, error) {
+	if required, keys, ok := parseMultisig(challenge); ok {
+		hash := transactions.LegacySignatureHash(toSign, 0, challenge, transactions.SigHashAll)
+		scriptSig := transactions.Script{transactions.OP_0}
+		signed := 0
+		for _, pubKey := range keys {
+			if signed == required {
+				break
+			}
+			if key := signer.key(pubKey); key != nil {
+				scriptSig = append(scriptSig, transactions.PushData(sign(key, hash))...)
+				signed++
+			}
+		}
+		if signed < required {
+			return nil, ErrUnsupportedChallenge
+		}
+		return &Solution{ScriptSig: scriptSig}, nil
+	}
+
+	if n := len(challenge); (n == 35 || n == 67) && int(challenge[0]) == n-2 && challenge[n-1] == transactions.OP_CHECKSIG {
+		if key := signer.key(challenge[1 : n-1]); key != nil {
+			hash := transactions.LegacySignatureHash(toSign, 0, challenge, transactions.SigHashAll)
+			return &Solution{ScriptSig: transactions.PushData(sign(key, hash))}, nil
+		}
+		return nil, ErrUnsupportedChallenge
+	}
+
+	if version, program, ok := transactions.WitnessProgram(challenge); ok && version == 0 && len(program) == 20 {
+		for _, key := range signer.Keys {
+			pubKey := key.PubKey().SerializeCompressed()
+			if !bytes.Equal(cryptoUtils.Hash160(pubKey), program) {
+				continue
+			}
+			scriptCode := transactions.Script{transactions.OP_DUP, transactions.OP_HASH160}
+			scriptCode = append(scriptCode, transactions.PushData(program)...)
+			scriptCode = append(scriptCode, transactions.OP_EQUALVERIFY, transactions.OP_CHECKSIG)
+			hash := transactions.WitnessV0SignatureHash(toSign, 0, scriptCode, 0, transactions.SigHashAll)
+			return &Solution{Witness: [][]byte{sign(key, hash), pubKey}}, nil
+		}
+	}
+	return nil, ErrUnsupportedChallenge
+}
+
+// SignBlock stores a solution to challenge in the witness commitment of
+// block, replacing any previous one, and updates the merkle root. The block
+// must be signed before its nonce is ground, since the header changes.
+func (signer *Signer) SignBlock(block *blockchain.Block, challenge []byte) error {
+	if len(block.Transactions) == 0 {
+		return ErrNoTransactions
+	}
+	coinbase := &block.Transactions[0]
+	index := blockchain.WitnessCommitmentIndex(*coinbase)
+	if index < 0 {
+		return ErrNoWitnessCommitment
+	}
+	coinbase.Output = append([]transactions.TxOutput{}, coinbase.Output...)
+	setSolution := func(solution []byte) {
+		base := coinbase.Output[index].Script
+		if _, cleared, found := fetchAndClear(base); found {
+			base = bytes.TrimSuffix(cleared, transactions.PushData(Header))
+		}
+		script := append(transactions.Script{}, base...)
+		coinbase.Output[index].Script = append(script, transactions.PushData(append(append([]byte{}, Header...), solution...))...)
+		coinbase.Id = nil
+		coinbase.Id = transactions.GenerateTransactionId(*coinbase)
+	}
+
+	// The signed data does not depend on the solution, so an empty one
+	// yields the transaction to sign.
+	setSolution((&Solution{}).Serialize())
+	txs, err := NewSignetTransactions(block, challenge)
+	if err != nil {
+		return err
+	}
+	solution, err := signer.Solve(txs.ToSign, challenge)
+	if err != nil {
+		return err
+	}
+	setSolution(solution.Serialize())
+
+	merkleRoot, _ := blockchain.MerkleRoot(block.Transactions)
+	block.HashMerkle = merkleRoot
+	block.Hash = nil
+	return nil
+}
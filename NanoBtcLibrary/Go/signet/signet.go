@@ -0,0 +1,233 @@
+// Package signet implements the block signatures of signet networks (BIP325).
+// A signet block carries a solution to the network's challenge script in its
+// witness commitment output; the solution is checked by spending a virtual
+// transaction that commits to the rest of the block.
+package signet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	utils "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
+)
+
+// ScriptFlags are the rules a solution is checked with.
+const ScriptFlags = transactions.ScriptVerifyP2SH | transactions.ScriptVerifyWitness |
+	transactions.ScriptVerifyDERSig | transactions.ScriptVerifyNullDummy
+
+// Header prefixes the solution in the witness commitment output.
+var Header = []byte{0xec, 0xc7, 0xda, 0xa2}
+
+var (
+	ErrNotSignet            = errors.New("network has no signet challenge")
+	ErrNoTransactions       = errors.New("block has no transactions")
+	ErrNoWitnessCommitment  = errors.New("signet block has no witness commitment")
+	ErrBadSolutionEncoding  = errors.New("signet solution is not a scriptSig followed by a witness stack")
+	ErrBadSignature         = errors.New("signet block signature does not satisfy the challenge")
+	ErrUnsupportedChallenge = errors.New("challenge script cannot be signed")
+)
+
+// Solution is the scriptSig and witness satisfying a signet challenge.
+type Solution struct {
+	ScriptSig transactions.Script
+	Witness   [][]byte
+}
+
+// Serialize returns the solution as stored after the header.
+func (solution *Solution) Serialize() []byte {
+	result := utils.Varint(uint64(len(solution.ScriptSig)))
+	result = append(result, solution.ScriptSig...)
+	result = append(result, utils.Varint(uint64(len(solution.Witness)))...)
+	for _, item := range solution.Witness {
+		result = append(result, utils.Varint(uint64(len(item)))...)
+		result = append(result, item...)
+	}
+	return result
+}
+
+func readBytes(reader *bytes.Reader) ([]byte, error) {
+	length, err := utils.ReadVarint(reader)
+	if err != nil {
+		return nil, err
+	}
+	if length > uint64(reader.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+	result := make([]byte, length)
+	_, err = io.ReadFull(reader, result)
+	return result, err
+}
+
+// ParseSolution decodes a solution, which must use up all of data.
+func ParseSolution(data []byte) (*Solution, error) {
+	reader := bytes.NewReader(data)
+	scriptSig, err := readBytes(reader)
+	if err != nil {
+		return nil, ErrBadSolutionEncoding
+	}
+	count, err := utils.ReadVarint(reader)
+	if err != nil || count > uint64(reader.Len()) {
+		return nil, ErrBadSolutionEncoding
+	}
+	solution := &Solution{ScriptSig: scriptSig, Witness: make([][]byte, count)}
+	for i := range solution.Witness {
+		if solution.Witness[i], err = readBytes(reader); err != nil {
+			return nil, ErrBadSolutionEncoding
+		}
+	}
+	if reader.Len() != 0 {
+		return nil, ErrBadSolutionEncoding
+	}
+	return solution, nil
+}
+
+// fetchAndClear finds the first push in script that starts with Header and
+// has data after it. It returns that data and the script with the push cut
+// down to the header, every push being re-encoded as Bitcoin Core does.
+func fetchAndClear(script transactions.Script) ([]byte, transactions.Script, bool) {
+	var replacement transactions.Script
+	var found []byte
+	ok := false
+	for pc := 0; pc < len(script); {
+		data, opcode, next, err := readOp(script, pc)
+		if err != nil {
+			break
+		}
+		pc = next
+		if len(data) == 0 {
+			replacement = append(replacement, opcode)
+			continue
+		}
+		if !ok && len(data) > len(Header) && bytes.HasPrefix(data, Header) {
+			found = append([]byte{}, data[len(Header):]...)
+			data = data[:len(Header)]
+			ok = true
+		}
+		replacement = append(replacement, transactions.PushData(data)...)
+	}
+	if !ok {
+		return nil, script, false
+	}
+	return found, replacement, true
+}
+
+// readOp decodes the operation at pc, returning its pushed data if any.
+func readOp(script transactions.Script, pc int) ([]byte, byte, int, error) {
+	opcode := script[pc]
+	pc++
+	var length int
+	switch {
+	case opcode < transactions.OP_PUSHDATA1:
+		length = int(opcode)
+	case opcode == transactions.OP_PUSHDATA1 && pc+1 <= len(script):
+		length = int(script[pc])
+		pc++
+	case opcode == transactions.OP_PUSHDATA2 && pc+2 <= len(script):
+		length = int(binary.LittleEndian.Uint16(script[pc:]))
+		pc += 2
+	case opcode == transactions.OP_PUSHDATA4 && pc+4 <= len(script):
+		length = int(binary.LittleEndian.Uint32(script[pc:]))
+		pc += 4
+	case opcode > transactions.OP_PUSHDATA4:
+		return nil, opcode, pc, nil
+	default:
+		return nil, 0, 0, io.ErrUnexpectedEOF
+	}
+	if length < 0 || pc+length > len(script) {
+		return nil, 0, 0, io.ErrUnexpectedEOF
+	}
+	return script[pc : pc+length], opcode, pc + length, nil
+}
+
+// SignetTransactions are the virtual transactions whose validity stands for
+// the validity of a block's signature.
+type SignetTransactions struct {
+	ToSpend transactions.Transaction
+	ToSign  transactions.Transaction
+}
+
+// NewSignetTransactions builds to_spend and to_sign for block under
+// challenge. The solution is taken from the witness commitment output; a
+// block without one is given an empty solution, which only trivial
+// challenges accept.
+func NewSignetTransactions(block *blockchain.Block, challenge []byte) (*SignetTransactions, error) {
+	if len(block.Transactions) == 0 {
+		return nil, ErrNoTransactions
+	}
+	coinbase := block.Transactions[0]
+	index := blockchain.WitnessCommitmentIndex(coinbase)
+	if index < 0 {
+		return nil, ErrNoWitnessCommitment
+	}
+
+	solution := &Solution{}
+	data, cleared, found := fetchAndClear(coinbase.Output[index].Script)
+	if found {
+		var err error
+		if solution, err = ParseSolution(data); err != nil {
+			return nil, err
+		}
+	}
+	modified := coinbase
+	modified.Id = nil
+	modified.Output = append([]transactions.TxOutput{}, coinbase.Output...)
+	modified.Output[index].Script = cleared
+	txs := append([]transactions.Transaction{modified}, block.Transactions[1:]...)
+	merkleRoot, _ := blockchain.MerkleRoot(txs)
+
+	blockData := binary.LittleEndian.AppendUint32(nil, uint32(block.Version))
+	blockData = append(blockData, block.HashPrev...)
+	blockData = append(blockData, merkleRoot...)
+	blockData = binary.LittleEndian.AppendUint32(blockData, uint32(block.Timestamp.Unix()))
+
+	toSpend := transactions.Transaction{
+		Version: 0,
+		Input: []transactions.TxInput{{
+			Hash:      make([]byte, 32),
+			Index:     0xffffffff,
+			PrevIndex: -1,
+			Script:    append(transactions.Script{transactions.OP_0}, transactions.PushData(blockData)...),
+			Sequence:  0,
+		}},
+		Output: []transactions.TxOutput{{Amount: 0, Script: challenge}},
+	}
+	toSign := transactions.Transaction{
+		Version: 0,
+		Input: []transactions.TxInput{{
+			Hash:          transactions.GenerateTransactionId(toSpend),
+			Index:         0,
+			Script:        solution.ScriptSig,
+			Sequence:      0,
+			ScriptWitness: solution.Witness,
+		}},
+		Output: []transactions.TxOutput{{Amount: 0, Script: transactions.Script{transactions.OP_RETURN}}},
+	}
+	return &SignetTransactions{ToSpend: toSpend, ToSign: toSign}, nil
+}
+
+// CheckBlockSolution verifies the signature of block against the signet
+// challenge of params. The genesis block needs no signature.
+func CheckBlockSolution(block *blockchain.Block, params *chaincfg.ChainParams) error {
+	if params.SignetChallenge == nil {
+		return ErrNotSignet
+	}
+	if bytes.Equal(block.HashBlock(), params.GenesisHash) {
+		return nil
+	}
+	txs, err := NewSignetTransactions(block, params.SignetChallenge)
+	if err != nil {
+		return err
+	}
+	in := txs.ToSign.Input[0]
+	checker := &transactions.SigChecker{Tx: &txs.ToSign, Index: 0, Amount: txs.ToSpend.Output[0].Amount}
+	if err := transactions.VerifyScript(in.Script, txs.ToSpend.Output[0].Script, in.ScriptWitness, ScriptFlags, checker); err != nil {
+		return fmt.Errorf("%w: %w", ErrBadSignature, err)
+	}
+	return nil
+}
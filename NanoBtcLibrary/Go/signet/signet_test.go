@@ -0,0 +1,203 @@
+package signet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	blockchain "github.com/Btcercises/NanoBtcLibrary/Go/blockchain"
+	transactions "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/transactions"
+	utils "github.com/Btcercises/NanoBtcLibrary/Go/blockchain/utils"
+	chaincfg "github.com/Btcercises/NanoBtcLibrary/Go/chaincfg"
+	secp256k1 "github.com/Btcercises/NanoBtcLibrary/Go/crypto/secp256k1"
+	cryptoUtils "github.com/Btcercises/NanoBtcLibrary/Go/crypto/utils"
+)
+
+func testKey(t *testing.T, d int64) *secp256k1.PrivateKey {
+	key, err := secp256k1.NewPrivateKey(big.NewInt(d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+// testBlock returns an unsigned block on top of the signet genesis block.
+func testBlock(params *chaincfg.ChainParams) *blockchain.Block {
+	coinbase := transactions.Transaction{
+		Version: 2,
+		Input: []transactions.TxInput{{
+			Hash:          make([]byte, 32),
+			Index:         0xffffffff,
+			PrevIndex:     -1,
+			Script:        append(transactions.PushInt(1), transactions.OP_0),
+			Sequence:      0xffffffff,
+			ScriptWitness: [][]byte{make([]byte, 32)},
+		}},
+		Output: []transactions.TxOutput{{Amount: params.BlockSubsidy(1), Script: transactions.Script{transactions.OP_1}}},
+	}
+	witnessRoot, _ := blockchain.WitnessMerkleRoot([]transactions.Transaction{coinbase})
+	commitment := append([]byte{transactions.OP_RETURN, 0x24, 0xaa, 0x21, 0xa9, 0xed}, blockchain.WitnessCommitment(witnessRoot, make([]byte, 32))...)
+	coinbase.Output = append(coinbase.Output, transactions.TxOutput{Script: commitment})
+	txs := []transactions.Transaction{coinbase}
+	merkleRoot, _ := blockchain.MerkleRoot(txs)
+	return &blockchain.Block{
+		BlockHeader: blockchain.BlockHeader{
+			Version:          0x20000000,
+			HashPrev:         params.GenesisHash,
+			HashMerkle:       merkleRoot,
+			Timestamp:        time.Unix(1598918400+600, 0),
+			TargetDifficulty: params.Pow.PowLimitBits,
+		},
+		TransactionCount: 1,
+		Transactions:     txs,
+	}
+}
+
+func TestMultisigChallenge(t *testing.T) {
+	key1, key2 := testKey(t, 1), testKey(t, 2)
+	challenge := transactions.Script{transactions.OP_1}
+	challenge = append(challenge, transactions.PushData(key1.PubKey().SerializeCompressed())...)
+	challenge = append(challenge, transactions.PushData(key2.PubKey().SerializeCompressed())...)
+	challenge = append(challenge, transactions.OP_1+1, transactions.OP_CHECKMULTISIG)
+	params := chaincfg.CustomSigNetParams(challenge, nil)
+
+	block := testBlock(params)
+	if err := CheckBlockSolution(block, params); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("unsigned block: %v", err)
+	}
+	if err := NewSigner(testKey(t, 3)).SignBlock(block, challenge); err != ErrUnsupportedChallenge {
+		t.Fatalf("foreign key: %v", err)
+	}
+	if err := NewSigner(key2).SignBlock(block, challenge); err != nil {
+		t.Fatal(err)
+	}
+	if err := block.CheckMerkleRoot(); err != nil {
+		t.Fatal(err)
+	}
+	if err := block.CheckWitnessCommitment(); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckBlockSolution(block, params); err != nil {
+		t.Fatal(err)
+	}
+
+	// Re-signing replaces the solution instead of adding another one.
+	if err := NewSigner(key1).SignBlock(block, challenge); err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Count(block.Transactions[0].Output[1].Script, Header) != 1 {
+		t.Fatal("solution was not replaced")
+	}
+
+	block.Timestamp = block.Timestamp.Add(time.Second)
+	block.Hash = nil
+	if err := CheckBlockSolution(block, params); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("tampered block: %v", err)
+	}
+	if err := CheckBlockSolution(block, &chaincfg.SigNetParams); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("block accepted by the default signet: %v", err)
+	}
+}
+
+// TestBIP325Transactions builds to_spend, to_sign and the signature hash of a
+// pay-to-pubkey challenge byte by byte as BIP325 lays them out, and checks a
+// solution signed over them without the Signer.
+func TestBIP325Transactions(t *testing.T) {
+	key := testKey(t, 11)
+	challenge := append(transactions.PushData(key.PubKey().SerializeCompressed()), transactions.OP_CHECKSIG)
+	params := chaincfg.CustomSigNetParams(challenge, nil)
+	block := testBlock(params)
+	coinbase := &block.Transactions[0]
+	commitment := coinbase.Output[1].Script
+
+	// The block data commits to the coinbase with the solution cut down to
+	// the header, which as the only transaction is the merkle root.
+	coinbase.Output[1].Script = append(append(transactions.Script{}, commitment...), transactions.PushData(Header)...)
+	coinbase.Id = nil
+	merkleRoot := transactions.GenerateTransactionId(*coinbase)
+	blockData := "00000020" + hex.EncodeToString(block.HashPrev) + hex.EncodeToString(merkleRoot) + hex.EncodeToString(binary.LittleEndian.AppendUint32(nil, uint32(block.Timestamp.Unix())))
+	toSpend := "00000000" + "01" + hex.EncodeToString(make([]byte, 32)) + "ffffffff" + "4a" + "00" + "48" + blockData + "00000000" +
+		"01" + "0000000000000000" + "23" + hex.EncodeToString(challenge) + "00000000"
+	toSpendId := utils.DoubleSha256(decodeTestHex(t, toSpend))
+	toSignWith := func(scriptSig string) string {
+		return "00000000" + "01" + hex.EncodeToString(toSpendId) + "00000000" + scriptSig + "00000000" +
+			"01" + "0000000000000000" + "01" + "6a" + "00000000"
+	}
+	// SIGHASH_ALL signs to_sign with the challenge as its scriptSig.
+	hash := utils.DoubleSha256(decodeTestHex(t, toSignWith("23"+hex.EncodeToString(challenge))+"01000000"))
+
+	scriptSig := transactions.PushData(append(key.Sign(hash).Serialize(), transactions.SigHashAll))
+	solution := &Solution{ScriptSig: scriptSig}
+	coinbase.Output[1].Script = append(append(transactions.Script{}, commitment...), transactions.PushData(append(append([]byte{}, Header...), solution.Serialize()...))...)
+	coinbase.Id = nil
+	block.HashMerkle, _ = blockchain.MerkleRoot(block.Transactions)
+	block.Hash = nil
+
+	txs, err := NewSignetTransactions(block, challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := hex.EncodeToString(transactions.Serialize(txs.ToSpend)); got != toSpend {
+		t.Fatalf("to_spend %s, want %s", got, toSpend)
+	}
+	wantToSign := toSignWith(hex.EncodeToString(utils.Varint(uint64(len(scriptSig)))) + hex.EncodeToString(scriptSig))
+	if got := hex.EncodeToString(transactions.Serialize(txs.ToSign)); got != wantToSign {
+		t.Fatalf("to_sign %s, want %s", got, wantToSign)
+	}
+	if err := CheckBlockSolution(block, params); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckBlockSolution(block, chaincfg.CustomSigNetParams(append(transactions.PushData(testKey(t, 12).PubKey().SerializeCompressed()), transactions.OP_CHECKSIG), nil)); !errors.Is(err, ErrBadSignature) {
+		t.Fatalf("other challenge: %v", err)
+	}
+}
+
+func decodeTestHex(t *testing.T, s string) []byte {
+	data, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestWitnessChallenge(t *testing.T) {
+	key := testKey(t, 7)
+	challenge := append(transactions.Script{transactions.OP_0}, transactions.PushData(cryptoUtils.Hash160(key.PubKey().SerializeCompressed()))...)
+	params := chaincfg.CustomSigNetParams(challenge, nil)
+	block := testBlock(params)
+	if err := NewSigner(key).SignBlock(block, challenge); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckBlockSolution(block, params); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGenesisNeedsNoSolution(t *testing.T) {
+	genesis, err := blockchain.GenesisBlock(&chaincfg.SigNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckBlockSolution(genesis, &chaincfg.SigNetParams); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSignetTransactions(genesis, chaincfg.SigNetParams.SignetChallenge); err != ErrNoWitnessCommitment {
+		t.Fatalf("genesis has a witness commitment: %v", err)
+	}
+}
+
+func TestParseSolutionRejectsTrailingData(t *testing.T) {
+	solution := &Solution{ScriptSig: []byte{0x51}, Witness: [][]byte{{1, 2}}}
+	data := solution.Serialize()
+	parsed, err := ParseSolution(data)
+	if err != nil || !bytes.Equal(parsed.ScriptSig, solution.ScriptSig) || len(parsed.Witness) != 1 {
+		t.Fatalf("round trip: %v", err)
+	}
+	if _, err := ParseSolution(append(data, 0)); err != ErrBadSolutionEncoding {
+		t.Fatalf("trailing data: %v", err)
+	}
+}